@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import "os"
+
+// hasHiddenAttribute reports whether info carries a hidden attribute, which
+// only Windows has.
+func hasHiddenAttribute(info os.FileInfo) bool {
+	return false
+}
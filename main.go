@@ -1,25 +1,59 @@
 package main
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
 	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/csv"
 	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
 	"errors"
+	"flag"
 	"fmt"
 	"image"
 	"image/color"
-	_ "image/gif"
+	"image/draw"
+	"image/gif"
 	_ "image/jpeg"
 	_ "image/png"
 	"io"
+	"math"
+	"math/bits"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
+	"os/user"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
+	"unicode/utf16"
 	"unicode/utf8"
 
+	"github.com/alecthomas/chroma/v2"
 	"github.com/alecthomas/chroma/v2/formatters"
 	"github.com/alecthomas/chroma/v2/lexers"
 	"github.com/alecthomas/chroma/v2/styles"
@@ -29,52 +63,669 @@ import (
 	"github.com/charmbracelet/x/ansi"
 	"github.com/muesli/reflow/truncate"
 	_ "golang.org/x/image/bmp"
+	"golang.org/x/image/colornames"
 	_ "golang.org/x/image/tiff"
+	"golang.org/x/image/vector"
 	_ "golang.org/x/image/webp"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
 var version = "dev"
 
 const (
-	maxPreviewBytes = 256 * 1024
-	maxDirPreview   = 40
+	maxPreviewBytes   = 256 * 1024
+	maxDirPreview     = 40
+	maxClipboardBytes = 1024 * 1024
 )
 
 // ── color palette ──────────────────────────────────────────────────────────────
-// A cohesive dark theme built around deep indigo / slate tones.
+// The active palette. Every colour is populated from a theme by applyTheme so
+// the rest of the UI can keep referring to these names directly.
 var (
-	clrBg              = lipgloss.Color("234") // deep slate frame
-	clrSurface         = lipgloss.Color("236") // main panel fill
-	clrSurfaceAlt      = lipgloss.Color("237") // raised chrome and headers
-	clrSurfaceElevated = lipgloss.Color("239") // modal / selected emphasis
-	clrAccent          = lipgloss.Color("111") // soft electric blue accent
-	clrAccentFg        = lipgloss.Color("255") // bright text on accent
-	clrDir             = lipgloss.Color("68")  // darker blue for directories
-	clrDirHidden       = lipgloss.Color("60")  // dimmer blue for hidden directories
-	clrFile            = lipgloss.Color("255") // bright white for normal files
-	clrFileHidden      = lipgloss.Color("245") // dim white for hidden files
-	clrExec            = lipgloss.Color("150") // sage green for executables
-	clrMedia           = lipgloss.Color("221") // warm amber for media
-	clrDoc             = lipgloss.Color("189") // pale lilac for docs
-	clrConfig          = lipgloss.Color("223") // sand for config files
-	clrBinary          = lipgloss.Color("210") // coral for binary / unknown
-	clrSize            = lipgloss.Color("248") // soft steel for metadata
-	clrMuted           = lipgloss.Color("245") // secondary text
-	clrDim             = lipgloss.Color("240") // dividers / low contrast text
-	clrBreadcrumb      = lipgloss.Color("189") // breadcrumb path text
-	clrPathSep         = lipgloss.Color("243") // breadcrumb separators
-	clrHintKey         = lipgloss.Color("117") // footer keycaps
-	clrHintText        = lipgloss.Color("250") // footer descriptions
-	clrStatus          = lipgloss.Color("189") // normal status copy
-	clrBorder          = lipgloss.Color("241") // default panel border
-	clrBorderStrong    = lipgloss.Color("111") // active border
-	clrTitle           = lipgloss.Color("255") // bright panel titles
-	clrLoading         = lipgloss.Color("221") // loading indicator
-	clrScrollbar       = lipgloss.Color("110") // scroll indicator
-	clrDanger          = lipgloss.Color("203") // destructive accent
-	clrDangerSoft      = lipgloss.Color("52")  // destructive surface
+	clrBg              lipgloss.Color
+	clrSurface         lipgloss.Color
+	clrSurfaceAlt      lipgloss.Color
+	clrSurfaceElevated lipgloss.Color
+	clrAccent          lipgloss.Color
+	clrAccentFg        lipgloss.Color
+	clrDir             lipgloss.Color
+	clrDirHidden       lipgloss.Color
+	clrFile            lipgloss.Color
+	clrFileHidden      lipgloss.Color
+	clrCode            lipgloss.Color
+	clrExec            lipgloss.Color
+	clrMedia           lipgloss.Color
+	clrDoc             lipgloss.Color
+	clrConfig          lipgloss.Color
+	clrBinary          lipgloss.Color
+	clrSize            lipgloss.Color
+	clrMuted           lipgloss.Color
+	clrDim             lipgloss.Color
+	clrBreadcrumb      lipgloss.Color
+	clrPathSep         lipgloss.Color
+	clrHintKey         lipgloss.Color
+	clrHintText        lipgloss.Color
+	clrStatus          lipgloss.Color
+	clrBorder          lipgloss.Color
+	clrBorderStrong    lipgloss.Color
+	clrTitle           lipgloss.Color
+	clrLoading         lipgloss.Color
+	clrScrollbar       lipgloss.Color
+	clrDanger          lipgloss.Color
+	clrDangerSoft      lipgloss.Color
 )
 
+// chromaStyleName and glamourStyleName select the syntax-highlighting and
+// Markdown styles that match the active theme.
+var (
+	chromaStyleName  = "nord"
+	glamourStyleName = "tokyo-night"
+)
+
+// ── themes ────────────────────────────────────────────────────────────────────
+
+// theme is a complete colour scheme for the UI plus the names of the chroma and
+// glamour styles that suit it. Colours are 256-colour indices or #rrggbb hex.
+type theme struct {
+	name    string
+	chroma  string
+	glamour string
+
+	bg, surface, surfaceAlt, surfaceElevated lipgloss.Color
+	accent, accentFg                         lipgloss.Color
+	dir, dirHidden, file, fileHidden, code   lipgloss.Color
+	exec, media, doc, config, binary         lipgloss.Color
+	size, muted, dim                         lipgloss.Color
+	breadcrumb, pathSep, hintKey, hintText   lipgloss.Color
+	status, border, borderStrong, title      lipgloss.Color
+	loading, scrollbar, danger, dangerSoft   lipgloss.Color
+
+	jsonKey, jsonStr, jsonNum, jsonBool, jsonNull, jsonBracket lipgloss.Color
+}
+
+// colorSlots exposes every colour by the key used in theme files.
+func (t *theme) colorSlots() map[string]*lipgloss.Color {
+	return map[string]*lipgloss.Color{
+		"bg":               &t.bg,
+		"surface":          &t.surface,
+		"surface-alt":      &t.surfaceAlt,
+		"surface-elevated": &t.surfaceElevated,
+		"accent":           &t.accent,
+		"accent-fg":        &t.accentFg,
+		"dir":              &t.dir,
+		"dir-hidden":       &t.dirHidden,
+		"file":             &t.file,
+		"file-hidden":      &t.fileHidden,
+		"code":             &t.code,
+		"exec":             &t.exec,
+		"media":            &t.media,
+		"doc":              &t.doc,
+		"config":           &t.config,
+		"binary":           &t.binary,
+		"size":             &t.size,
+		"muted":            &t.muted,
+		"dim":              &t.dim,
+		"breadcrumb":       &t.breadcrumb,
+		"path-sep":         &t.pathSep,
+		"hint-key":         &t.hintKey,
+		"hint-text":        &t.hintText,
+		"status":           &t.status,
+		"border":           &t.border,
+		"border-strong":    &t.borderStrong,
+		"title":            &t.title,
+		"loading":          &t.loading,
+		"scrollbar":        &t.scrollbar,
+		"danger":           &t.danger,
+		"danger-soft":      &t.dangerSoft,
+		"json-key":         &t.jsonKey,
+		"json-string":      &t.jsonStr,
+		"json-number":      &t.jsonNum,
+		"json-bool":        &t.jsonBool,
+		"json-null":        &t.jsonNull,
+		"json-bracket":     &t.jsonBracket,
+	}
+}
+
+// builtinThemes are selectable by name. "dark" is the default: a cohesive
+// theme built around deep indigo / slate tones.
+var builtinThemes = map[string]theme{
+	"dark": {
+		name:            "dark",
+		chroma:          "nord",
+		glamour:         "tokyo-night",
+		bg:              "234", // deep slate frame
+		surface:         "236", // main panel fill
+		surfaceAlt:      "237", // raised chrome and headers
+		surfaceElevated: "239", // modal / selected emphasis
+		accent:          "111", // soft electric blue accent
+		accentFg:        "255", // bright text on accent
+		dir:             "68",  // darker blue for directories
+		dirHidden:       "60",  // dimmer blue for hidden directories
+		file:            "255", // bright white for normal files
+		fileHidden:      "245", // dim white for hidden files
+		code:            "231", // near-white for source files
+		exec:            "150", // sage green for executables
+		media:           "221", // warm amber for media
+		doc:             "189", // pale lilac for docs
+		config:          "223", // sand for config files
+		binary:          "210", // coral for binary / unknown
+		size:            "248", // soft steel for metadata
+		muted:           "245", // secondary text
+		dim:             "240", // dividers / low contrast text
+		breadcrumb:      "189", // breadcrumb path text
+		pathSep:         "243", // breadcrumb separators
+		hintKey:         "117", // footer keycaps
+		hintText:        "250", // footer descriptions
+		status:          "189", // normal status copy
+		border:          "241", // default panel border
+		borderStrong:    "111", // active border
+		title:           "255", // bright panel titles
+		loading:         "221", // loading indicator
+		scrollbar:       "110", // scroll indicator
+		danger:          "203", // destructive accent
+		dangerSoft:      "52",  // destructive surface
+		jsonKey:         "147", // periwinkle – keys
+		jsonStr:         "114", // sage green – string values
+		jsonNum:         "222", // pale gold – numbers
+		jsonBool:        "215", // amber – booleans
+		jsonNull:        "240", // dim – null
+		jsonBracket:     "244", // grey – brackets
+	},
+	"light": {
+		name:            "light",
+		chroma:          "github",
+		glamour:         "light",
+		bg:              "255",
+		surface:         "254",
+		surfaceAlt:      "253",
+		surfaceElevated: "251",
+		accent:          "25",
+		accentFg:        "231",
+		dir:             "25",
+		dirHidden:       "67",
+		file:            "235",
+		fileHidden:      "244",
+		code:            "236",
+		exec:            "28",
+		media:           "130",
+		doc:             "90",
+		config:          "94",
+		binary:          "160",
+		size:            "241",
+		muted:           "243",
+		dim:             "248",
+		breadcrumb:      "24",
+		pathSep:         "246",
+		hintKey:         "25",
+		hintText:        "239",
+		status:          "238",
+		border:          "249",
+		borderStrong:    "25",
+		title:           "234",
+		loading:         "130",
+		scrollbar:       "31",
+		danger:          "160",
+		dangerSoft:      "224",
+		jsonKey:         "25",
+		jsonStr:         "28",
+		jsonNum:         "130",
+		jsonBool:        "166",
+		jsonNull:        "245",
+		jsonBracket:     "241",
+	},
+	"solarized": {
+		name:            "solarized",
+		chroma:          "solarized-dark256",
+		glamour:         "dark",
+		bg:              "#002b36",
+		surface:         "#073642",
+		surfaceAlt:      "#073642",
+		surfaceElevated: "#586e75",
+		accent:          "#268bd2",
+		accentFg:        "#fdf6e3",
+		dir:             "#268bd2",
+		dirHidden:       "#586e75",
+		file:            "#eee8d5",
+		fileHidden:      "#839496",
+		code:            "#93a1a1",
+		exec:            "#859900",
+		media:           "#b58900",
+		doc:             "#6c71c4",
+		config:          "#cb4b16",
+		binary:          "#dc322f",
+		size:            "#93a1a1",
+		muted:           "#839496",
+		dim:             "#586e75",
+		breadcrumb:      "#93a1a1",
+		pathSep:         "#586e75",
+		hintKey:         "#2aa198",
+		hintText:        "#93a1a1",
+		status:          "#eee8d5",
+		border:          "#586e75",
+		borderStrong:    "#268bd2",
+		title:           "#fdf6e3",
+		loading:         "#b58900",
+		scrollbar:       "#2aa198",
+		danger:          "#dc322f",
+		dangerSoft:      "#3b0d0c",
+		jsonKey:         "#268bd2",
+		jsonStr:         "#2aa198",
+		jsonNum:         "#d33682",
+		jsonBool:        "#cb4b16",
+		jsonNull:        "#586e75",
+		jsonBracket:     "#839496",
+	},
+	"high-contrast": {
+		name:            "high-contrast",
+		chroma:          "hr_high_contrast",
+		glamour:         "dark",
+		bg:              "16",
+		surface:         "16",
+		surfaceAlt:      "234",
+		surfaceElevated: "238",
+		accent:          "226",
+		accentFg:        "16",
+		dir:             "51",
+		dirHidden:       "37",
+		file:            "231",
+		fileHidden:      "250",
+		code:            "231",
+		exec:            "46",
+		media:           "226",
+		doc:             "219",
+		config:          "214",
+		binary:          "196",
+		size:            "231",
+		muted:           "252",
+		dim:             "246",
+		breadcrumb:      "231",
+		pathSep:         "250",
+		hintKey:         "226",
+		hintText:        "231",
+		status:          "231",
+		border:          "250",
+		borderStrong:    "226",
+		title:           "231",
+		loading:         "226",
+		scrollbar:       "51",
+		danger:          "196",
+		dangerSoft:      "52",
+		jsonKey:         "51",
+		jsonStr:         "46",
+		jsonNum:         "226",
+		jsonBool:        "214",
+		jsonNull:        "250",
+		jsonBracket:     "231",
+	},
+}
+
+// applyTheme makes t the active palette, rebuilding every derived style.
+func applyTheme(t theme) {
+	clrBg = t.bg
+	clrSurface = t.surface
+	clrSurfaceAlt = t.surfaceAlt
+	clrSurfaceElevated = t.surfaceElevated
+	clrAccent = t.accent
+	clrAccentFg = t.accentFg
+	clrDir = t.dir
+	clrDirHidden = t.dirHidden
+	clrFile = t.file
+	clrFileHidden = t.fileHidden
+	clrCode = t.code
+	clrExec = t.exec
+	clrMedia = t.media
+	clrDoc = t.doc
+	clrConfig = t.config
+	clrBinary = t.binary
+	clrSize = t.size
+	clrMuted = t.muted
+	clrDim = t.dim
+	clrBreadcrumb = t.breadcrumb
+	clrPathSep = t.pathSep
+	clrHintKey = t.hintKey
+	clrHintText = t.hintText
+	clrStatus = t.status
+	clrBorder = t.border
+	clrBorderStrong = t.borderStrong
+	clrTitle = t.title
+	clrLoading = t.loading
+	clrScrollbar = t.scrollbar
+	clrDanger = t.danger
+	clrDangerSoft = t.dangerSoft
+
+	jsonKey = lipgloss.NewStyle().Foreground(t.jsonKey)
+	jsonStr = lipgloss.NewStyle().Foreground(t.jsonStr)
+	jsonNum = lipgloss.NewStyle().Foreground(t.jsonNum)
+	jsonBool = lipgloss.NewStyle().Foreground(t.jsonBool).Bold(true)
+	jsonNull = lipgloss.NewStyle().Foreground(t.jsonNull).Bold(true)
+	jsonBracket = lipgloss.NewStyle().Foreground(t.jsonBracket)
+	jsonMuted = lipgloss.NewStyle().Foreground(t.dim)
+
+	chromaStyleName = t.chroma
+	glamourStyleName = t.glamour
+}
+
+func init() {
+	applyTheme(builtinThemes["dark"])
+}
+
+// loadTheme resolves a theme spec: empty for the default, a built-in name, a
+// path to a theme file, or the name of a file in <config dir>/themes.
+func loadTheme(spec string) (theme, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return builtinThemes["dark"], nil
+	}
+	if t, ok := builtinThemes[strings.ToLower(spec)]; ok {
+		return t, nil
+	}
+	path := expandHome(spec)
+	if !strings.ContainsRune(spec, filepath.Separator) && !strings.HasSuffix(spec, ".toml") {
+		path = filepath.Join(seerConfigDir(), "themes", spec+".toml")
+	}
+	return loadThemeFile(path)
+}
+
+// loadThemeFile reads a user theme. The file may name a built-in "base" to
+// inherit from, override "chroma" / "glamour", and set colours in [colors]:
+//
+//	base = "dark"
+//	chroma = "monokai"
+//
+//	[colors]
+//	accent = "#ff79c6"
+//	dir = "75"
+func loadThemeFile(path string) (theme, error) {
+	cfg, err := readConfigFile(path)
+	if err != nil {
+		return theme{}, err
+	}
+	base := cfg.value("", "base", "dark")
+	t, ok := builtinThemes[strings.ToLower(base)]
+	if !ok {
+		return theme{}, fmt.Errorf("%s: unknown base theme %q", filepath.Base(path), base)
+	}
+	t.name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	t.chroma = cfg.value("", "chroma", t.chroma)
+	t.glamour = expandHome(cfg.value("", "glamour", t.glamour))
+	slots := t.colorSlots()
+	for _, kv := range cfg["colors"] {
+		slot, ok := slots[strings.ToLower(kv.key)]
+		if !ok {
+			return theme{}, fmt.Errorf("%s: unknown colour %q", filepath.Base(path), kv.key)
+		}
+		*slot = lipgloss.Color(kv.value)
+	}
+	return t, nil
+}
+
+// ── config files ──────────────────────────────────────────────────────────────
+
+// seerConfigDir is where seer looks for user configuration and themes.
+func seerConfigDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "seer")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".config", "seer")
+	}
+	return ".seer"
+}
+
+// seerStateDir is where seer persists state such as bookmarks:
+// $XDG_STATE_HOME/seer, falling back to ~/.local/state/seer.
+func seerStateDir() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "seer")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".local", "state", "seer")
+	}
+	return ".seer"
+}
+
+// expandHome replaces a leading "~" with the user's home directory.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
+
+type configEntry struct {
+	key   string
+	value string
+}
+
+// configFile holds the key/value pairs of a TOML-like file grouped by section,
+// in file order. Top-level keys live under the "" section.
+type configFile map[string][]configEntry
+
+// value returns the last value set for key in section, or def.
+func (c configFile) value(section, key, def string) string {
+	entries := c[section]
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].key == key {
+			return entries[i].value
+		}
+	}
+	return def
+}
+
+func readConfigFile(path string) (configFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := parseConfig(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return cfg, nil
+}
+
+// parseConfig parses the small TOML subset seer uses: [section] headers and
+// key = value lines, where keys and values may be bare or double-quoted and #
+// starts a comment outside quotes.
+func parseConfig(text string) (configFile, error) {
+	cfg := configFile{}
+	section := ""
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(stripConfigComment(line))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		eq := configKeyEnd(line)
+		if eq < 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", i+1)
+		}
+		key, err := unquoteConfig(strings.TrimSpace(line[:eq]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		value, err := unquoteConfig(strings.TrimSpace(line[eq+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		cfg[section] = append(cfg[section], configEntry{key: key, value: value})
+	}
+	return cfg, nil
+}
+
+// configKeyEnd finds the "=" separating key from value, skipping any "="
+// inside a quoted key.
+func configKeyEnd(line string) int {
+	inQuote := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			inQuote = !inQuote
+		case '=':
+			if !inQuote {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func stripConfigComment(line string) string {
+	inQuote := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			inQuote = !inQuote
+		case '#':
+			if !inQuote {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
+
+// splitConfigList splits a comma-separated config value, dropping blanks.
+func splitConfigList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func unquoteConfig(s string) (string, error) {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return strconv.Unquote(s)
+	}
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return s[1 : len(s)-1], nil
+	}
+	return s, nil
+}
+
+// config is the user configuration read from <config dir>/config.toml.
+type config struct {
+	theme      string
+	search     string   // "fuzzy" (default) or "substring"
+	searchCase string   // "smart" (default), "ignore" or "sensitive"
+	dirs       string   // directory grouping: "first" (default), "last" or "mixed"
+	mtime      string   // list mtime column: "relative" (default), "absolute" or "off"
+	ignore     []string // name globs for noisy entries (node_modules, *.o, …)
+	ignoreMode string   // "dim" (default) or "hide" for ignored entries
+	hidden     []string // name globs treated as hidden, besides dotfiles
+	stringsMin int      // shortest run shown by the binary strings view
+	// imageMaxMegapixels is the largest image decoded for a preview.
+	imageMaxMegapixels int
+	secretKeys         []string // key name parts whose values are masked in previews
+	// imageBlocks picks the characters images are drawn with: "half"
+	// (default), "quadrant" or "braille".
+	imageBlocks string
+	// listWheel is what the mouse wheel does over the file list: "select"
+	// (default) moves the selection, "scroll" only the view.
+	listWheel string
+	// clipboard is how text is copied: "auto" (default) tries the system
+	// clipboard tools and falls back to OSC 52, "system" or "osc52".
+	clipboard string
+	// copyStyled copies preview selections with their colours; alt-dragging
+	// copies the other way.
+	copyStyled bool
+	previewers []previewerRule
+	plugins    map[string]string // key → plugin name or path
+	keys       map[string]string // extra key → the key its action is handled under
+	openers    []openerRule
+}
+
+// userConfig is the active configuration, loaded once at startup.
+var userConfig config
+
+func configPath() string {
+	return filepath.Join(seerConfigDir(), "config.toml")
+}
+
+// loadConfig reads config.toml. A missing file is not an error and yields the
+// defaults.
+func loadConfig() (config, error) {
+	var c config
+	file, err := readConfigFile(configPath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return c, nil
+		}
+		return c, err
+	}
+	c.theme = file.value("", "theme", "")
+	c.search = file.value("", "search", "fuzzy")
+	c.searchCase = file.value("", "search_case", "smart")
+	c.dirs = file.value("", "dirs", "first")
+	c.mtime = file.value("", "mtime", "relative")
+	c.ignore = splitConfigList(file.value("", "ignore", ""))
+	c.ignoreMode = file.value("", "ignore_mode", "dim")
+	c.hidden = splitConfigList(file.value("", "hidden", ""))
+	if v := file.value("", "strings_min", ""); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return c, fmt.Errorf("strings_min: %q is not a positive number", v)
+		}
+		c.stringsMin = n
+	}
+	if v := file.value("", "image_max_megapixels", ""); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return c, fmt.Errorf("image_max_megapixels: %q is not a positive number", v)
+		}
+		c.imageMaxMegapixels = n
+	}
+	c.secretKeys = splitConfigList(file.value("", "secret_keys", ""))
+	c.imageBlocks = file.value("", "image_blocks", "half")
+	if _, ok := imageBlockGlyphs[c.imageBlocks]; !ok {
+		return c, fmt.Errorf("image_blocks: %q is not half, quadrant or braille", c.imageBlocks)
+	}
+	c.listWheel = file.value("", "list_wheel", "select")
+	if c.listWheel != "select" && c.listWheel != "scroll" {
+		return c, fmt.Errorf("list_wheel: %q is not select or scroll", c.listWheel)
+	}
+	c.clipboard = file.value("", "clipboard", "auto")
+	if c.clipboard != "auto" && c.clipboard != "system" && c.clipboard != "osc52" {
+		return c, fmt.Errorf("clipboard: %q is not auto, system or osc52", c.clipboard)
+	}
+	if v := file.value("", "copy_styled", "false"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return c, fmt.Errorf("copy_styled: %q is not true or false", v)
+		}
+		c.copyStyled = b
+	}
+	c.plugins = make(map[string]string)
+	for _, kv := range file["plugins"] {
+		c.plugins[kv.key] = kv.value
+	}
+	if c.keys, err = parseKeymap(file["keys"]); err != nil {
+		return c, err
+	}
+	for _, kv := range file["previewers"] {
+		c.previewers = append(c.previewers, previewerRule{pattern: kv.key, command: kv.value})
+	}
+	for _, kv := range file["openers"] {
+		c.openers = append(c.openers, openerRule{pattern: kv.key, command: kv.value})
+	}
+	return c, nil
+}
+
 var imageExts = map[string]bool{
 	".png":  true,
 	".jpg":  true,
@@ -83,6 +734,10 @@ var imageExts = map[string]bool{
 	".gif":  true,
 	".bmp":  true,
 	".tiff": true,
+	".heic": true,
+	".heif": true,
+	".avif": true,
+	".jxl":  true,
 }
 
 // fileCategory returns a broad category for an entry used to pick colour/icon.
@@ -99,13 +754,35 @@ const (
 	catOther
 )
 
+// categoryNames gives each category a stable name for machine-readable output.
+var categoryNames = map[fileCategory]string{
+	catDir:    "dir",
+	catImage:  "image",
+	catDoc:    "doc",
+	catCode:   "code",
+	catConfig: "config",
+	catExec:   "exec",
+	catBinary: "binary",
+	catOther:  "other",
+}
+
+func (c fileCategory) String() string {
+	if name, ok := categoryNames[c]; ok {
+		return name
+	}
+	return "other"
+}
+
 func categorise(e entry) fileCategory {
 	if e.isDir {
 		return catDir
 	}
 	ext := strings.ToLower(filepath.Ext(e.name))
+	if e.sniffed != "" {
+		ext = e.sniffed
+	}
 	switch ext {
-	case ".png", ".jpg", ".jpeg", ".webp", ".gif", ".bmp", ".tiff":
+	case ".png", ".jpg", ".jpeg", ".webp", ".gif", ".bmp", ".tiff", ".heic", ".heif", ".avif", ".jxl":
 		return catImage
 	case ".md", ".markdown", ".mdx", ".rst", ".txt":
 		return catDoc
@@ -114,11 +791,11 @@ func categorise(e entry) fileCategory {
 	case ".go", ".js", ".ts", ".jsx", ".tsx", ".py", ".rb", ".rs", ".c", ".cpp",
 		".h", ".java", ".cs", ".php", ".swift", ".kt",
 		".lua", ".ex", ".exs", ".hs", ".ml", ".mli", ".clj", ".scala",
-		".vim", ".mmd", ".mermaid":
+		".vim", ".mmd", ".mermaid", ".dot", ".gv", ".puml", ".plantuml", ".d2", ".mk", ".pl", ".groovy":
 		return catCode
 	case ".json", ".yaml", ".yml", ".toml", ".ini", ".env", ".conf", ".config",
 		".xml", ".dockerignore", ".gitignore", ".editorconfig", ".eslintrc",
-		".prettierrc", ".babelrc", ".nvmrc":
+		".prettierrc", ".babelrc", ".nvmrc", ".dockerfile":
 		return catConfig
 	}
 	return catOther
@@ -180,9 +857,17 @@ var nerdIconByExt = map[string]string{
 	".webp": "\uf1c5 ", //
 	".svg":  "\uf1c5 ", //
 	".bmp":  "\uf1c5 ", //
+	".heic": "\uf1c5 ", //
+	".avif": "\uf1c5 ", //
+	".jxl":  "\uf1c5 ", //
 	// misc
 	".mmd":          "\ueb43 ", //
 	".mermaid":      "\ueb43 ", //
+	".dot":          "\ueb43 ", //
+	".gv":           "\ueb43 ", //
+	".puml":         "\ueb43 ", //
+	".plantuml":     "\ueb43 ", //
+	".d2":           "\ueb43 ", //
 	".pdf":          "\uf1c1 ", //
 	".zip":          "\uf410 ", //
 	".tar":          "\uf410 ", //
@@ -244,7 +929,7 @@ func fileColor(cat fileCategory) lipgloss.Style {
 	case catDoc:
 		return lipgloss.NewStyle().Foreground(clrDoc)
 	case catCode:
-		return lipgloss.NewStyle().Foreground(lipgloss.Color("231"))
+		return lipgloss.NewStyle().Foreground(clrCode)
 	case catConfig:
 		return lipgloss.NewStyle().Foreground(clrConfig)
 	case catExec:
@@ -256,12 +941,49 @@ func fileColor(cat fileCategory) lipgloss.Style {
 	}
 }
 
+// isHiddenName reports whether name is hidden: a dotfile, or a match for one
+// of the config's hidden globs.
 func isHiddenName(name string) bool {
-	return strings.HasPrefix(name, ".")
+	if strings.HasPrefix(name, ".") {
+		return true
+	}
+	for _, pattern := range userConfig.hidden {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isHiddenDirEntry extends isHiddenName with the Windows hidden attribute.
+func isHiddenDirEntry(d os.DirEntry) bool {
+	if isHiddenName(d.Name()) {
+		return true
+	}
+	if runtime.GOOS != "windows" {
+		return false
+	}
+	info, err := d.Info()
+	return err == nil && hasHiddenAttribute(info)
+}
+
+// isIgnoredName reports whether name matches one of the configured ignore
+// globs.
+func isIgnoredName(name string) bool {
+	for _, pattern := range userConfig.ignore {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
 }
 
 func entryNameStyle(e entry) lipgloss.Style {
 	switch {
+	case e.isDir && e.repo == "submodule":
+		return lipgloss.NewStyle().Foreground(clrConfig).Bold(true)
+	case e.isDir && e.repo != "":
+		return lipgloss.NewStyle().Foreground(clrExec).Bold(true)
 	case e.isDir && isHiddenName(e.name):
 		return lipgloss.NewStyle().Foreground(clrDirHidden).Bold(true)
 	case e.isDir:
@@ -279,6 +1001,13 @@ type entry struct {
 	isDir   bool
 	size    int64
 	modTime time.Time
+	depth   int // nesting level below cwd in tree view
+	mode    os.FileMode
+	owner   string // empty where the platform has no Unix ownership
+	group   string
+	ignored bool   // matches an ignore pattern from the config
+	sniffed string // extension recognised from the name or content when the file's own says nothing
+	repo    string // "repo", "submodule" or "worktree" when a directory holds its own git working tree
 }
 
 type previewLoadedMsg struct {
@@ -288,6 +1017,56 @@ type previewLoadedMsg struct {
 	err       error
 }
 
+type jobDoneMsg struct {
+	id     int
+	result string
+	err    error
+}
+
+type jobTickMsg struct{}
+
+type spinnerTickMsg struct{}
+
+type pluginDoneMsg struct {
+	name   string
+	output string
+	err    error
+}
+
+// externalDoneMsg reports that a program run in the foreground (editor,
+// opener) has exited and the TUI has resumed.
+type externalDoneMsg struct {
+	name string
+	err  error
+}
+
+// promptKind identifies what an active inline prompt is collecting.
+type promptKind int
+
+const (
+	promptNone promptKind = iota
+	promptRename
+	promptPermanentDelete
+	promptArchive
+	promptGoto
+	promptFind
+	promptGrep
+	promptJSONQuery
+	promptPreviewSearch
+)
+
+// promptLabels are shown before the input in the bottom bar.
+var promptLabels = map[promptKind]string{
+	promptRename:          "rename: ",
+	promptPermanentDelete: "confirm: ",
+	promptArchive:         "archive: ",
+	promptGoto:            "go to: ",
+	promptFind:            "find: ",
+	promptGrep:            "grep: ",
+	promptJSONQuery:       "jq: ",
+	promptPreviewSearch:   "find in preview: ",
+}
+
 type selectionPoint struct {
 	x int
 	y int
@@ -306,20 +1085,221 @@ type model struct {
 	width         int
 	height        int
 	previewOffset int
+	// previewColumn is how far the preview is scrolled sideways, in cells.
+	previewColumn int
 	loading       bool
 	requestID     int
 	cache         map[string]string
-	cacheOrder    []string // LRU insertion order for cache eviction
+	cacheOrder    []string        // LRU insertion order for cache eviction
+	prefetching   map[string]bool // cache keys being built ahead of need
+
+	// loadingSince is when the pending preview was requested; spinnerFrame
+	// animates the loading indicator while it builds.
+	loadingSince   time.Time
+	spinnerFrame   int
+	spinnerTicking bool
+
+	// statusErr is the last message set by setError; while it is showing the
+	// status is an error. statusHistory keeps recent messages for alt+m.
+	statusErr      string
+	statusSetAt    time.Time
+	statusHistory  []statusEntry
+	showMessages   bool
+	messagesOffset int
+
 	// Search / filter state
 	searching   bool
 	searchQuery string
 	// Delete confirmation dialog
 	confirmingDelete bool
-	deleteTarget     string
+	deleteTargets    []string
+	// discardTargets are the files whose working-tree changes wait on
+	// confirmation before git throws them away.
+	discardTargets []string
+	// Inline prompt in the bottom bar; promptTarget is the path it acts on.
+	prompt       promptKind
+	promptValue  string
+	promptTarget string
+	// promptCompletions lists the candidates after an ambiguous tab.
+	promptCompletions []string
 	// Preview mouse selection state for auto-copy on release.
 	previewSelecting bool
 	previewSelStart  selectionPoint
 	previewSelEnd    selectionPoint
+	// previewSelStyled keeps the selection's ANSI styling when it's copied.
+	previewSelStyled bool
+	// lastClick and clicks track repeated left clicks on one cell, so a
+	// quick second click can be told from a first.
+	lastClick mouseClick
+	clicks    int
+	// marked holds the absolute paths of entries marked for batch operations.
+	marked map[string]bool
+	// pendingKey holds the first key of a two-key sequence such as "yy".
+	pendingKey string
+	// register holds yanked paths for paste; registerCut makes paste a move.
+	register    []string
+	registerCut bool
+	// Background jobs and the jobs panel.
+	jobs       []*job
+	nextJobID  int
+	jobTicking bool
+	showJobs   bool
+	jobCursor  int
+	// bookmarks maps a single-character key to a directory.
+	bookmarks      map[string]string
+	showBookmarks  bool
+	bookmarkCursor int
+	// showHelp shows the keymap overlay; helpOffset is its scroll position.
+	showHelp   bool
+	helpOffset int
+	// frecency tracks visited directories for the z jump overlay. Changes
+	// are saved a little later, in the background, and again on quit.
+	frecency           map[string]frecencyEntry
+	frecencyDirty      bool
+	frecencySaveQueued bool
+	// clipboardSeq is an OSC 52 sequence drawn ahead of the next frames
+	// until a clipboardSentMsg clears it.
+	clipboardSeq string
+	showJump     bool
+	jumpQuery    string
+	jumpCursor   int
+	// tabs holds the saved state of every tab; the active tab's entry is
+	// refreshed from the live fields whenever the user switches away.
+	tabs      []tabState
+	activeTab int
+	// Tree view: directories in expanded are listed inline below their parent.
+	treeMode bool
+	expanded map[string]bool
+	// Dual-pane mode: the live fields above are the focused pane and
+	// otherPane holds the other one; focusRight says which side is live.
+	dualPane   bool
+	focusRight bool
+	otherPane  paneState
+	// Deep (recursive) search: the list shows streamed results instead of
+	// cwd while deepSearch is set.
+	deepSearch  bool
+	deepQuery   string
+	deepID      int
+	deepRunning bool
+	deepCancel  context.CancelFunc
+	// deepGrep marks a content search; grepLines holds each result's
+	// matching lines, shown in place of the preview. deepSensitive is the
+	// case sensitivity the search started with.
+	deepGrep      bool
+	grepLines     map[string][]grepLine
+	deepSensitive bool
+	// quickFilters holds the keys of the active filters from the f menu.
+	quickFilters   map[string]bool
+	showFilterMenu bool
+	// substringSearch switches the filter from fuzzy to plain substring.
+	substringSearch bool
+	// searchCase is "smart", "ignore" or "sensitive"; alt+c cycles it.
+	searchCase string
+	// mtimeColumn is the file list's modified-time format: "relative",
+	// "absolute" or "off".
+	mtimeColumn string
+	// showDetails adds ls -l style mode, owner and group columns.
+	showDetails bool
+	// jsonQuery is the last jq expression applied to a JSON preview.
+	jsonQuery string
+	// jsonExplorer is set while the preview pane has focus for folding a
+	// JSON document.
+	jsonExplorer *jsonExplorer
+	// markdownLinks is set while the preview pane has focus for following
+	// the links of a markdown document.
+	markdownLinks *markdownLinks
+	// markdownOutline is set while the preview pane has focus for folding
+	// the sections of a markdown document.
+	markdownOutline *markdownOutline
+	// markdownFolds holds the folded headings of each markdown file, by
+	// heading index.
+	markdownFolds map[string]map[int]bool
+	// presentation is set while a markdown file is shown as slides.
+	presentation *presentation
+	// contextMenu is the right-click menu, while it's open.
+	contextMenu *contextMenu
+	// listScrolled is set while the mouse wheel has scrolled the file list
+	// away from the selection, and listTop is then its first entry.
+	listScrolled bool
+	listTop      int
+	// listRatio is the file list's share of the width, 0 for the default;
+	// resizing is set while the separator is being dragged.
+	listRatio float64
+	resizing  bool
+	// gifAnim animates the selected GIF in the preview pane.
+	gifAnim *gifAnimation
+	// imageZoom is set while the selected image is zoomed in.
+	imageZoom *imageZoom
+	// showIgnored reveals entries matching the config's ignore patterns,
+	// which are otherwise dimmed or hidden.
+	showIgnored bool
+	// hideGitIgnored drops entries git ignores (.gitignore, info/exclude
+	// and the global excludes file) from listings inside a repository.
+	// gitIgnored records, for each listed path git has been asked about,
+	// whether it is ignored; gitIgnoreStale asks about them all again.
+	hideGitIgnored bool
+	gitIgnored     map[string]bool
+	gitIgnoreStale bool
+	// sourceView shows rendered formats such as HTML as their source.
+	sourceView bool
+	// gitLogView shows the commits touching the selection instead of its
+	// preview.
+	gitLogView bool
+	// gitBlameView prefixes each line of a file's preview with the commit
+	// that last changed it.
+	gitBlameView bool
+	// gitDiffView shows a file's uncommitted changes as a diff.
+	gitDiffView bool
+	// showChanges lists every changed file in the repository.
+	showChanges   bool
+	changesCursor int
+	// previewSearch is the text searched for in the preview of
+	// previewSearchPath; previewMatches are the scrollable lines holding it
+	// and previewMatch the one last jumped to.
+	previewSearch     string
+	previewSearchPath string
+	previewMatches    []int
+	previewMatch      int
+	// previewMore is set while the rest of a long text preview can still
+	// be streamed in as it is scrolled.
+	previewMore *previewStream
+	// follow tails the selected file, appending what's written to it.
+	follow *followState
+	// wrapPaths holds the files whose preview soft-wraps long lines
+	// instead of cutting them at the pane edge.
+	wrapPaths map[string]bool
+	// hidePreview collapses the preview pane, giving the list the full
+	// width (or height, in dual-pane mode).
+	hidePreview bool
+	// previewFocused routes j/k, g/G and ctrl+d/u to the preview instead of
+	// the list; tab toggles it.
+	previewFocused bool
+	// revealSecrets turns off masking of secret values in config previews.
+	revealSecrets bool
+	// dirCounts caches directory item counts for the size column;
+	// countingDirs holds the paths a background count is working on.
+	dirCounts    map[string]dirCount
+	countingDirs map[string]bool
+	// vcs describes the working copy holding vcsDir, the directory its
+	// status was last requested for; nil outside a working copy.
+	vcs    *vcsState
+	vcsDir string
+	// Disk usage mode: duRoot is the scanned tree and duDir the directory
+	// being shown; duScanned counts files while a scan is running.
+	showDiskUsage bool
+	duRoot        *duNode
+	duDir         *duNode
+	duCursor      int
+	duScanning    bool
+	duID          int
+	duCancel      context.CancelFunc
+	duScanned     *atomic.Int64
+	// count is a pending numeric prefix (5j); positionMarks maps a mark key
+	// to the entry it was set on (M<key> / `<key>).
+	count         int
+	positionMarks map[string]string
+	// scratch names the plugin whose output currently replaces the preview.
+	scratch string
 }
 
 func initialModel() model {
@@ -328,21 +1308,76 @@ func initialModel() model {
 		cwd = "."
 	}
 
-	entries, listErr := listDir(cwd, false)
 	status := "ready"
+	cfg, cfgErr := loadConfig()
+	if cfgErr != nil {
+		status = "config: " + cfgErr.Error()
+	}
+	userConfig = cfg
+
+	themeSpec := cfg.theme
+	if env := os.Getenv("SEER_THEME"); env != "" {
+		themeSpec = env
+	}
+	t, themeErr := loadTheme(themeSpec)
+	if themeErr != nil {
+		status = "theme: " + themeErr.Error()
+		t = builtinThemes["dark"]
+	}
+	applyTheme(t)
+
+	bookmarks, bmErr := loadBookmarks()
+	if bmErr != nil {
+		status = "bookmarks: " + bmErr.Error()
+	}
+	frecency, frErr := loadFrecency()
+	if frErr != nil {
+		status = "frecency: " + frErr.Error()
+	}
+	listRatio, splitErr := loadListRatio()
+	if splitErr != nil {
+		status = "split: " + splitErr.Error()
+	}
+
+	entries, listErr := listDir(cwd, false)
 	if listErr != nil {
 		status = listErr.Error()
 	}
+	// Anything but "ready" by now is a startup failure.
+	var statusErr string
+	var statusHistory []statusEntry
+	if status != "ready" {
+		statusErr = status
+		statusHistory = []statusEntry{{text: status, level: statusError, at: time.Now()}}
+	}
 
 	return model{
-		cwd:        cwd,
-		allEntries: entries,
-		entries:    entries,
-		selected:   0,
-		preview:    "",
-		status:     status,
-		cache:      make(map[string]string),
-		showHidden: false,
+		cwd:         cwd,
+		allEntries:  entries,
+		entries:     entries,
+		selected:    0,
+		preview:     "",
+		status:      status,
+		statusErr:   statusErr,
+		cache:       make(map[string]string),
+		showHidden:  false,
+		marked:      make(map[string]bool),
+		wrapPaths:   make(map[string]bool),
+		prefetching: make(map[string]bool),
+		bookmarks:   bookmarks,
+		frecency:    frecency,
+		listRatio:   listRatio,
+		tabs:        []tabState{{cwd: cwd}},
+		expanded:    make(map[string]bool),
+
+		positionMarks:   make(map[string]string),
+		quickFilters:    make(map[string]bool),
+		dirCounts:       make(map[string]dirCount),
+		countingDirs:    make(map[string]bool),
+		substringSearch: cfg.search == "substring",
+		searchCase:      cfg.searchCase,
+		mtimeColumn:     cfg.mtime,
+		statusHistory:   statusHistory,
 	}
 }
 
@@ -355,50 +1390,155 @@ func (m model) Init() tea.Cmd {
 func (m *model) navigate(idx int) tea.Cmd {
 	m.selected = idx
 	m.previewOffset = 0
+	m.previewColumn = 0
+	m.listScrolled = false
 	return m.requestPreview()
 }
 
+// Update handles a message and notes any status change it makes.
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	prev := m.status
+	next, cmd := m.update(msg)
+	nm, ok := next.(model)
+	if !ok {
+		return next, cmd
+	}
+	if seq := nm.clipboardSeq; seq != "" && seq != m.clipboardSeq {
+		cmd = tea.Batch(cmd, tea.Tick(clipboardSeqHold, func(time.Time) tea.Msg { return clipboardSentMsg{seq} }))
+	}
+	if nm.frecencyDirty && !nm.frecencySaveQueued {
+		nm.frecencySaveQueued = true
+		cmd = tea.Batch(cmd, tea.Tick(frecencySaveDelay, func(time.Time) tea.Msg { return frecencySaveMsg{} }))
+	}
+	if nm.status == prev {
+		return nm, cmd
+	}
+	return nm, tea.Batch(cmd, nm.noteStatus())
+}
+
+func (m model) update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
 		m.clampPreviewOffset()
-		return m, m.requestPreview()
+		var slide tea.Cmd
+		if m.presentation != nil {
+			slide = m.showSlide()
+		}
+		return m, tea.Batch(slide, m.requestPreview())
 
 	case tea.KeyMsg:
+		m.listScrolled = false // keys bring the selection back into view
+		if m.presentation != nil {
+			return m, m.updatePresentation(msg)
+		}
+		if m.contextMenu != nil {
+			return m, m.updateContextMenu(msg)
+		}
 		// Handle delete confirmation at top level
 		if m.confirmingDelete {
 			key := msg.String()
 			if key == "y" || key == "Y" || key == "enter" {
-				if err := moveToTrash(m.deleteTarget); err != nil {
-					m.status = "delete failed: " + err.Error()
-				} else {
+				trashed := 0
+				var lastErr error
+				for _, path := range m.deleteTargets {
+					if err := moveToTrash(path); err != nil {
+						lastErr = err
+						continue
+					}
+					delete(m.marked, path)
+					m.duForget(path)
+					trashed++
+				}
+				switch {
+				case lastErr != nil && trashed == 0:
+					m.setError("delete failed: " + lastErr.Error())
+				case lastErr != nil:
+					m.setError(fmt.Sprintf("moved %d to trash, %d failed: %v", trashed, len(m.deleteTargets)-trashed, lastErr))
+				case trashed == 1:
 					m.status = "moved to trash"
-					entries, err := listDir(m.cwd, m.showHidden)
-					if err != nil {
-						m.status = err.Error()
-					} else {
-						m.allEntries = entries
-						m.entries = m.applySearch(entries)
-						if m.selected >= len(m.entries) {
-							m.selected = max(0, len(m.entries)-1)
-						}
+				default:
+					m.status = fmt.Sprintf("moved %d items to trash", trashed)
+				}
+				if trashed > 0 {
+					if err := m.reloadEntries(); err != nil {
+						m.setError(err.Error())
 					}
 				}
 				m.confirmingDelete = false
-				m.deleteTarget = ""
+				m.deleteTargets = nil
 				return m, m.requestPreview()
 			}
 			if key == "n" || key == "N" || key == "esc" {
 				m.confirmingDelete = false
-				m.deleteTarget = ""
+				m.deleteTargets = nil
 				m.status = "delete cancelled"
 				return m, nil
 			}
 			return m, nil
 		}
 
+		if len(m.discardTargets) > 0 {
+			switch msg.String() {
+			case "y", "Y", "enter":
+				paths := m.discardTargets
+				m.discardTargets = nil
+				return m, m.startJob("discard changes to "+countNoun(len(paths), "file"),
+					gitJob(m.cwd, append([]string{"restore", "--worktree", "--"}, paths...)...))
+			case "n", "N", "esc":
+				m.discardTargets = nil
+				m.status = "discard cancelled"
+			}
+			return m, nil
+		}
+
+		if m.prompt != promptNone {
+			return m, m.updatePrompt(msg)
+		}
+
+		if m.showJobs {
+			return m, m.updateJobsPanel(msg)
+		}
+		if m.showBookmarks {
+			return m, m.updateBookmarksPanel(msg)
+		}
+		if m.showHelp {
+			return m, m.updateHelp(msg)
+		}
+		if m.showMessages {
+			return m, m.updateMessages(msg)
+		}
+		if m.showChanges {
+			return m, m.updateChangesPanel(msg)
+		}
+		if m.showJump {
+			return m, m.updateJumpPanel(msg)
+		}
+		if m.showFilterMenu {
+			return m, m.updateFilterMenu(msg)
+		}
+		if m.showDiskUsage {
+			return m, m.updateDiskUsage(msg)
+		}
+		if m.jsonExplorer != nil {
+			return m, m.updateJSONExplorer(msg)
+		}
+		if m.markdownLinks != nil {
+			return m, m.updateMarkdownLinks(msg)
+		}
+		if m.markdownOutline != nil {
+			return m, m.updateMarkdownOutline(msg)
+		}
+		if !m.searching && m.pendingKey == "" {
+			msg = remapKey(msg)
+		}
+		if m.imageZoom != nil && !m.searching {
+			if cmd, ok := m.updateImageZoom(msg); ok {
+				return m, cmd
+			}
+		}
+
 		// In search mode, printable characters extend the query.
 		if m.searching && len(msg.Runes) == 1 {
 			m.searchQuery += string(msg.Runes)
@@ -406,20 +1546,61 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.selected = 0
 			return m, m.requestPreview()
 		}
+		if plugin, ok := userConfig.plugins[msg.String()]; ok && !m.searching {
+			return m, m.runPlugin(plugin)
+		}
+		if key := msg.String(); len(key) == 1 && key[0] >= '0' && key[0] <= '9' &&
+			(key != "0" || m.count > 0) && m.pendingKey == "" {
+			m.count = min(m.count*10+int(key[0]-'0'), 99999)
+			m.status = fmt.Sprintf("count: %d", m.count)
+			return m, nil
+		}
+		// A count applies to the next key only.
+		count := max(1, m.count)
+		hasCount := m.count > 0
+		if hasCount {
+			m.status = fmt.Sprintf("%d%s", m.count, msg.String())
+		}
+		m.count = 0
+		if m.pendingKey != "" {
+			seq := m.pendingKey + msg.String()
+			m.pendingKey = ""
+			if msg.String() == "esc" {
+				return m, nil
+			}
+			return m, m.handleKeySequence(seq)
+		}
 		switch msg.String() {
 		case "q", "ctrl+c":
 			return m, tea.Quit
 		case "j", "down":
+			if m.previewFocused {
+				return m, m.scrollPreview(count)
+			}
 			if m.selected < len(m.entries)-1 {
-				return m, m.navigate(m.selected + 1)
+				return m, m.navigate(min(m.selected+count, len(m.entries)-1))
 			}
 		case "k", "up":
+			if m.previewFocused {
+				return m, m.scrollPreview(-count)
+			}
 			if m.selected > 0 {
-				return m, m.navigate(m.selected - 1)
+				return m, m.navigate(max(m.selected-count, 0))
 			}
 		case "g", "home":
+			if m.previewFocused {
+				m.previewOffset = 0
+				return m, nil
+			}
 			return m, m.navigate(0)
 		case "G", "end":
+			if m.previewFocused {
+				return m, m.scrollPreview(strings.Count(m.preview, "\n") + 1)
+			}
+			// With a count, G jumps to that entry (1-based), as in vim.
+			if hasCount && len(m.entries) > 0 {
+				return m, m.navigate(min(count, len(m.entries)) - 1)
+			}
 			if len(m.entries) > 0 {
 				return m, m.navigate(len(m.entries) - 1)
 			}
@@ -427,22 +1608,35 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if len(m.entries) == 0 {
 				break
 			}
-			picked := m.entries[m.selected]
-			if picked.isDir {
-				if err := m.changeDir(picked.path); err != nil {
-					m.status = err.Error()
+			if picked := m.entries[m.selected]; !picked.isDir && !m.deepSearch && !m.searching && !m.sourceView {
+				switch strings.ToLower(filepath.Ext(picked.name)) {
+				case ".json":
+					return m, m.openJSONExplorer(picked.path)
+				case ".md", ".markdown", ".mdx":
+					opened, err := m.openMarkdownLinks(picked.path)
+					if err != nil {
+						m.setError("links: " + err.Error())
+					}
+					if opened || err != nil {
+						return m, nil
+					}
 				}
-				return m, m.requestPreview()
 			}
-			return m, m.requestPreview()
+			return m, m.openSelected()
 		case "h", "left":
 			if m.searching {
 				break
 			}
+			if m.deepSearch {
+				return m, m.exitDeepSearch()
+			}
+			if m.treeMode && m.collapseSelected() {
+				return m, m.requestPreview()
+			}
 			parent := filepath.Dir(m.cwd)
 			if parent != m.cwd {
 				if err := m.changeDir(parent); err != nil {
-					m.status = err.Error()
+					m.setError(err.Error())
 				}
 				return m, m.requestPreview()
 			}
@@ -460,11 +1654,17 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			fallthrough
 		case "delete":
 			if len(m.entries) > 0 && m.selected < len(m.entries) {
-				m.confirmingDelete = true
-				m.deleteTarget = m.entries[m.selected].path
-				m.status = "confirm move to trash"
-				return m, nil
+				return m, m.confirmTrash()
+			}
+		// Terminals send shift+delete as ESC[3;2~, which bubbletea reports
+		// as alt+insert.
+		case "D", "alt+insert":
+			if len(m.entries) > 0 {
+				m.deleteTargets = m.targetPaths()
+				m.openPrompt(promptPermanentDelete, "", "")
+				m.status = "type to confirm permanent delete"
 			}
+			return m, nil
 		case ".":
 			// Remember current filename so we can restore position after reload.
 			var prevName string
@@ -472,9 +1672,9 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				prevName = m.entries[m.selected].name
 			}
 			m.showHidden = !m.showHidden
-			entries, err := listDir(m.cwd, m.showHidden)
+			entries, err := m.loadEntries(m.cwd)
 			if err != nil {
-				m.status = err.Error()
+				m.setError(err.Error())
 			} else {
 				m.allEntries = entries
 				m.entries = m.applySearch(entries)
@@ -487,6 +1687,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					}
 				}
 				m.previewOffset = 0
+				m.previewColumn = 0
 				if m.showHidden {
 					m.status = "showing hidden files"
 				} else {
@@ -494,47 +1695,427 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 			}
 			return m, m.requestPreview()
-		case "/":
-			m.searching = true
-			m.searchQuery = ""
+		case " ":
+			if len(m.entries) > 0 {
+				m.toggleMark(m.entries[m.selected].path)
+				m.status = fmt.Sprintf("%d marked", len(m.marked))
+				if m.selected < len(m.entries)-1 {
+					return m, m.navigate(m.selected + 1)
+				}
+			}
 			return m, nil
-		case "esc":
-			if m.searching {
-				m.searching = false
-				m.searchQuery = ""
-				m.entries = m.allEntries
-				m.selected = 0
-				return m, m.requestPreview()
+		case "ctrl+a":
+			for _, e := range m.entries {
+				m.marked[e.path] = true
 			}
-		case "ctrl+d", "pagedown":
-			m.previewOffset += previewPageSize(m.height)
-			m.clampPreviewOffset()
-		case "ctrl+u", "pageup":
-			m.previewOffset -= previewPageSize(m.height)
-			m.clampPreviewOffset()
-		case "r":
-			entries, err := listDir(m.cwd, m.showHidden)
-			if err != nil {
-				m.status = err.Error()
-			} else {
-				m.allEntries = entries
-				m.entries = m.applySearch(entries)
-				if m.selected >= len(m.entries) {
-					m.selected = max(0, len(m.entries)-1)
-				}
-				m.status = "reloaded"
+			m.status = fmt.Sprintf("%d marked", len(m.marked))
+			return m, nil
+		case "v":
+			for _, e := range m.entries {
+				m.toggleMark(e.path)
 			}
-			return m, m.requestPreview()
-		}
-
+			m.status = fmt.Sprintf("%d marked", len(m.marked))
+			return m, nil
+		case "y", "d", "p", "m", "'", "M", "`":
+			// First key of a sequence; see handleKeySequence.
+			m.pendingKey = msg.String()
+			return m, nil
+		case "C":
+			paths := m.targetPaths()
+			if len(paths) == 0 {
+				return m, nil
+			}
+			return m, m.startJob(fmt.Sprintf("checksum %d item(s)", len(paths)), checksumJob(paths))
+		case "x":
+			return m, m.extract()
+		case "Z":
+			paths := m.targetPaths()
+			if len(paths) == 0 {
+				return m, nil
+			}
+			name := filepath.Base(m.cwd)
+			if len(paths) == 1 {
+				name = filepath.Base(paths[0])
+			}
+			m.openPrompt(promptArchive, name+".zip", "")
+			m.status = "name ending in .zip or .tar.gz"
+			return m, nil
+		case ":":
+			m.openPrompt(promptGoto, "", "")
+			return m, nil
+		case "~":
+			m.openPrompt(promptGoto, "~/", "")
+			return m, nil
+		case "f":
+			m.showFilterMenu = true
+			return m, nil
+		case "U":
+			return m, m.startDiskUsage()
+		case "alt+p":
+			if len(m.entries) == 0 {
+				return m, nil
+			}
+			picked := m.entries[m.selected]
+			switch strings.ToLower(filepath.Ext(picked.name)) {
+			case ".md", ".markdown", ".mdx":
+				cmd, err := m.openPresentation(picked.path)
+				if err != nil {
+					m.setError("present: " + err.Error())
+				}
+				return m, cmd
+			default:
+				m.status = "present: select a markdown file"
+			}
+			return m, nil
+		case "O":
+			if len(m.entries) == 0 || m.hidePreview {
+				return m, nil
+			}
+			picked := m.entries[m.selected]
+			switch strings.ToLower(filepath.Ext(picked.name)) {
+			case ".md", ".markdown", ".mdx":
+				if err := m.openMarkdownOutline(picked.path); err != nil {
+					m.setError("outline: " + err.Error())
+				}
+			default:
+				m.status = "outline: select a markdown file"
+			}
+			return m, nil
+		case "J":
+			if len(m.entries) == 0 || strings.ToLower(filepath.Ext(m.entries[m.selected].name)) != ".json" {
+				m.status = "jq: select a .json file"
+				return m, nil
+			}
+			query := m.jsonQuery
+			if query == "" {
+				query = "."
+			}
+			m.openPrompt(promptJSONQuery, query, m.entries[m.selected].path)
+			return m, nil
+		case "+", "=":
+			return m, m.zoomImage(2)
+		case "alt+/":
+			if len(m.entries) == 0 || m.hidePreview {
+				return m, nil
+			}
+			m.openPrompt(promptPreviewSearch, m.previewSearch, m.entries[m.selected].path)
+			return m, nil
+		case "n", "N":
+			if m.previewSearch == "" {
+				return m, nil
+			}
+			if msg.String() == "n" {
+				m.jumpPreviewMatch(count)
+			} else {
+				m.jumpPreviewMatch(-count)
+			}
+			return m, nil
+		case "T":
+			return m, m.toggleFollow()
+		case "W":
+			if len(m.entries) == 0 || m.entries[m.selected].isDir {
+				return m, nil
+			}
+			path := m.entries[m.selected].path
+			if m.wrapPaths[path] {
+				delete(m.wrapPaths, path)
+				m.status = "wrap off"
+			} else {
+				m.wrapPaths[path] = true
+				m.status = "wrap on"
+			}
+			return m, m.requestPreview()
+		case "P":
+			m.hidePreview = !m.hidePreview
+			if m.hidePreview {
+				m.gifAnim, m.imageZoom = nil, nil
+				m.previewFocused = false
+				m.status = "preview hidden"
+			} else {
+				m.status = "preview shown"
+			}
+			return m, m.requestPreview()
+		case "s":
+			m.sourceView = !m.sourceView
+			if m.sourceView {
+				m.status = "source view"
+			} else {
+				m.status = "rendered view"
+			}
+			return m, m.requestPreview()
+		case "alt+l":
+			m.gitLogView = !m.gitLogView
+			if m.gitLogView {
+				m.follow, m.imageZoom, m.gifAnim = nil, nil, nil
+				m.gitBlameView, m.gitDiffView = false, false
+				m.status = "git log"
+			} else {
+				m.status = "preview"
+			}
+			m.previewOffset = 0
+			m.previewColumn = 0
+			return m, m.requestPreview()
+		case "alt+d":
+			m.setGitDiffView(!m.gitDiffView)
+			return m, m.requestPreview()
+		case "alt+g":
+			if m.vcs == nil || m.vcsDir != m.cwd {
+				m.setError("not in a repository")
+				return m, nil
+			}
+			m.showChanges = true
+			m.changesCursor = 0
+			m.vcsDir = "" // list the changes as they are now
+			return m, m.requestVCSStatus()
+		case "alt+s", "alt+u":
+			return m, m.gitStage(msg.String() == "alt+s")
+		case "alt+x":
+			m.confirmDiscard()
+			return m, nil
+		case "alt+b":
+			m.gitBlameView = !m.gitBlameView
+			if m.gitBlameView {
+				m.follow = nil
+				m.gitLogView, m.gitDiffView = false, false
+				m.status = "git blame"
+			} else {
+				m.status = "preview"
+			}
+			// The scroll position is kept: blame lines match the file's.
+			return m, m.requestPreview()
+		case "*":
+			m.revealSecrets = !m.revealSecrets
+			if m.revealSecrets {
+				m.status = "secrets revealed"
+			} else {
+				m.status = "secrets masked"
+			}
+			return m, m.requestPreview()
+		case "I":
+			m.showIgnored = !m.showIgnored
+			if err := m.reloadEntries(); err != nil {
+				m.setError(err.Error())
+			} else if m.showIgnored {
+				m.status = "showing ignored entries"
+			} else if userConfig.ignoreMode == "hide" {
+				m.status = "hiding ignored entries"
+			} else {
+				m.status = "dimming ignored entries"
+			}
+			return m, m.requestPreview()
+		case "alt+i":
+			m.hideGitIgnored = !m.hideGitIgnored
+			if err := m.reloadEntries(); err != nil {
+				m.setError(err.Error())
+			} else if m.hideGitIgnored {
+				m.status = "hiding git-ignored entries"
+			} else {
+				m.status = "showing git-ignored entries"
+			}
+			return m, m.requestPreview()
+		case "i":
+			m.showDetails = !m.showDetails
+			if m.showDetails {
+				m.status = "details shown"
+			} else {
+				m.status = "details hidden"
+			}
+			return m, nil
+		case "F":
+			m.openPrompt(promptFind, "", "")
+			return m, nil
+		case "S":
+			m.openPrompt(promptGrep, "", "")
+			return m, nil
+		case "ctrl+f":
+			m.substringSearch = !m.substringSearch
+			m.entries = m.applySearch(m.allEntries)
+			m.selected = 0
+			if m.substringSearch {
+				m.status = "substring search"
+			} else {
+				m.status = "fuzzy search"
+			}
+			return m, m.requestPreview()
+		case "alt+c":
+			switch m.searchCase {
+			case "ignore":
+				m.searchCase = "sensitive"
+			case "sensitive":
+				m.searchCase = "smart"
+			default:
+				m.searchCase = "ignore"
+			}
+			m.entries = m.applySearch(m.allEntries)
+			m.selected = 0
+			m.status = map[string]string{
+				"ignore":    "case-insensitive search",
+				"sensitive": "case-sensitive search",
+				"smart":     "smart-case search",
+			}[m.searchCase]
+			return m, m.requestPreview()
+		case "t":
+			m.treeMode = !m.treeMode
+			if err := m.reloadEntries(); err != nil {
+				m.setError(err.Error())
+			} else if m.treeMode {
+				m.status = "tree view: l expands, h collapses"
+			} else {
+				m.status = "list view"
+			}
+			return m, m.requestPreview()
+		case "|":
+			return m, m.toggleDualPane()
+		case "tab":
+			if m.dualPane {
+				return m, m.swapPanes()
+			}
+			if !m.hidePreview {
+				m.previewFocused = !m.previewFocused
+				if m.previewFocused {
+					m.status = "focus: preview · j/k scroll it"
+				} else {
+					m.status = "focus: list"
+				}
+			}
+		case "f5", "f6":
+			if m.dualPane {
+				return m, m.transferToOtherPane(msg.String() == "f6")
+			}
+		case "ctrl+t":
+			return m, m.newTab()
+		case "ctrl+w":
+			return m, m.closeTab()
+		case "]":
+			return m, m.switchTab((m.activeTab + 1) % len(m.tabs))
+		case "[":
+			return m, m.switchTab((m.activeTab + len(m.tabs) - 1) % len(m.tabs))
+		case "alt+1", "alt+2", "alt+3", "alt+4", "alt+5", "alt+6", "alt+7", "alt+8", "alt+9":
+			if n := int(msg.String()[4] - '1'); n < len(m.tabs) {
+				return m, m.switchTab(n)
+			}
+			return m, nil
+		case "z":
+			m.showJump = true
+			m.jumpQuery = ""
+			m.jumpCursor = 0
+			return m, nil
+		case "alt+m":
+			m.showMessages = true
+			m.messagesOffset = 0
+			return m, nil
+		case "?":
+			m.showHelp = true
+			m.helpOffset = 0
+			return m, nil
+		case "B":
+			m.showBookmarks = true
+			m.bookmarkCursor = 0
+			return m, nil
+		case "w":
+			m.showJobs = true
+			m.jobCursor = max(0, len(m.jobs)-1)
+			return m, nil
+		case "o":
+			return m, m.openWithApp()
+		case "e":
+			if len(m.entries) > 0 && !m.entries[m.selected].isDir {
+				return m, editFile(m.entries[m.selected].path)
+			}
+			return m, nil
+		case "R", "f2":
+			return m, m.renameSelected()
+		case "/":
+			m.searching = true
+			m.searchQuery = ""
+			return m, nil
+		case "esc":
+			if m.searching {
+				m.searching = false
+				m.searchQuery = ""
+				m.entries = m.allEntries
+				m.selected = 0
+				return m, m.requestPreview()
+			}
+			if m.deepSearch {
+				return m, m.exitDeepSearch()
+			}
+			if len(m.marked) > 0 {
+				m.marked = make(map[string]bool)
+				m.status = "marks cleared"
+			}
+		case "ctrl+d", "pagedown":
+			if !m.previewFocused && len(m.entries) > 0 {
+				return m, m.navigate(min(m.selected+m.listHalfPage(), len(m.entries)-1))
+			}
+			return m, m.scrollPreview(previewPageSize(m.height))
+		case "ctrl+u", "pageup":
+			if !m.previewFocused && len(m.entries) > 0 {
+				return m, m.navigate(max(m.selected-m.listHalfPage(), 0))
+			}
+			return m, m.scrollPreview(-previewPageSize(m.height))
+		case "{", "}":
+			step := 4 * count
+			if msg.String() == "{" {
+				step = -step
+			}
+			return m, m.resizeList(step)
+		case "<", ">":
+			_, _, w, _ := m.previewRect()
+			step := max(4, w/4)
+			if msg.String() == "<" {
+				step = -step
+			}
+			m.scrollPreviewColumns(step)
+			return m, nil
+		case "r":
+			m.gitIgnoreStale = true
+			entries, err := m.loadEntries(m.cwd)
+			if err != nil {
+				m.setError(err.Error())
+			} else {
+				m.allEntries = entries
+				m.entries = m.applySearch(entries)
+				if m.selected >= len(m.entries) {
+					m.selected = max(0, len(m.entries)-1)
+				}
+				m.status = "reloaded"
+			}
+			m.vcsDir = "" // refresh the branch and dirty state too
+			return m, m.requestPreview()
+		}
+
 	case tea.MouseMsg:
+		if m.presentation != nil {
+			return m, nil
+		}
 		event := tea.MouseEvent(msg)
+		if m.contextMenu != nil {
+			if event.Action == tea.MouseActionPress && !event.IsWheel() {
+				return m, m.clickContextMenu(event.X, event.Y)
+			}
+			return m, nil
+		}
 		inPreviewPane := m.isInPreviewPane(event.X, event.Y)
 		inPreviewBody := m.isInPreviewBody(event.X, event.Y)
 
 		if event.IsWheel() {
 			if !inPreviewPane {
-				return m, nil
+				_, rows, other, ok := m.listPaneAt(event.X, event.Y)
+				if !ok || other || m.panelOpen() || len(m.entries) == 0 {
+					return m, nil
+				}
+				step := 3
+				if event.Button == tea.MouseButtonWheelUp {
+					step = -step
+				} else if event.Button != tea.MouseButtonWheelDown {
+					return m, nil
+				}
+				if userConfig.listWheel == "scroll" {
+					m.scrollList(step, rows)
+					return m, nil
+				}
+				return m, m.navigate(max(0, min(m.selected+step, len(m.entries)-1)))
 			}
 			scroll := previewPageSize(m.height) / 3
 			if scroll < 1 {
@@ -544,21 +2125,67 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			case tea.MouseButtonWheelDown:
 				m.previewOffset += scroll
 				m.clampPreviewOffset()
+				return m, m.loadMorePreview()
 			case tea.MouseButtonWheelUp:
 				m.previewOffset -= scroll
 				m.clampPreviewOffset()
+			case tea.MouseButtonWheelRight:
+				m.scrollPreviewColumns(2 * scroll)
+			case tea.MouseButtonWheelLeft:
+				m.scrollPreviewColumns(-2 * scroll)
+			}
+			return m, nil
+		}
+
+		if m.resizing {
+			switch event.Action {
+			case tea.MouseActionMotion:
+				m.setListWidth(event.X - 2)
+			case tea.MouseActionRelease:
+				m.resizing = false
+				m.setListWidth(event.X - 2)
+				return m, m.saveSplit()
 			}
 			return m, nil
 		}
+		if event.Action == tea.MouseActionPress && event.Button == tea.MouseButtonLeft &&
+			m.separatorAt(event.X, event.Y) && !m.panelOpen() {
+			m.resizing = true
+			return m, nil
+		}
+		if event.Action == tea.MouseActionPress && event.Button == tea.MouseButtonLeft &&
+			!inPreviewPane && !m.panelOpen() && m.prompt == promptNone {
+			if cmd, open, ok := m.clickList(event.X, event.Y); ok {
+				if open {
+					return m, m.openSelected()
+				}
+				return m, cmd
+			}
+		}
+		if event.Action == tea.MouseActionPress && event.Button == tea.MouseButtonRight &&
+			!inPreviewPane && !m.panelOpen() && m.prompt == promptNone {
+			if cmd, ok := m.openContextMenu(event.X, event.Y); ok {
+				return m, cmd
+			}
+		}
 
 		// Track left-button drag in the preview body and auto-copy on release.
 		switch event.Action {
 		case tea.MouseActionPress:
 			if event.Button == tea.MouseButtonLeft && inPreviewBody {
-				m.previewSelecting = true
+				m.previewSelStyled = event.Alt != userConfig.copyStyled
 				p := m.previewBodyPoint(event.X, event.Y)
 				m.previewSelStart = p
 				m.previewSelEnd = p
+				// A double click copies the word under it, a triple click
+				// the whole line.
+				if clicks := m.countClick(event.X, event.Y); clicks > 1 {
+					m.previewSelecting = false
+					m.selectPreviewSpan(p, clicks == 2)
+					m.copyPreviewSelection()
+					return m, nil
+				}
+				m.previewSelecting = true
 			}
 		case tea.MouseActionMotion:
 			if m.previewSelecting {
@@ -567,19 +2194,148 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case tea.MouseActionRelease:
 			if m.previewSelecting && (event.Button == tea.MouseButtonLeft || event.Button == tea.MouseButtonNone) {
 				m.previewSelEnd = m.previewBodyPoint(event.X, event.Y)
-				selected := m.selectedPreviewText()
 				m.previewSelecting = false
-				if selected == "" {
-					return m, nil
-				}
-				if err := copyToClipboard(selected); err != nil {
-					m.status = "copy failed: " + err.Error()
-					return m, nil
-				}
-				m.status = fmt.Sprintf("copied %d chars", utf8.RuneCountInString(selected))
+				m.copyPreviewSelection()
 			}
 		}
 
+	case pluginDoneMsg:
+		return m, m.handlePluginDone(msg)
+
+	case externalDoneMsg:
+		if msg.err != nil {
+			m.setError(msg.name + ": " + msg.err.Error())
+		}
+		if err := m.reloadEntries(); err != nil {
+			m.setError(err.Error())
+		}
+		return m, m.requestPreview()
+
+	case jobDoneMsg:
+		return m, m.handleJobDone(msg)
+
+	case jobTickMsg:
+		m.jobTicking = false
+		return m, m.scheduleJobTick()
+
+	case statusExpireMsg:
+		if msg.at.Equal(m.statusSetAt) && m.statusLevel() == statusInfo {
+			m.status = "ready"
+		}
+		return m, nil
+
+	case spinnerTickMsg:
+		m.spinnerTicking = false
+		m.spinnerFrame++
+		return m, m.scheduleSpinnerTick()
+
+	case deepSearchMsg:
+		return m, m.handleDeepSearch(msg)
+
+	case duScanMsg:
+		return m, m.handleDiskUsageScan(msg)
+
+	case gifFramesMsg:
+		a := m.gifAnim
+		if a != msg.anim || len(msg.frames) < 2 {
+			return m, nil
+		}
+		a.frames, a.delays = msg.frames, msg.delays
+		return m, gifTick(a, a.delays[0])
+
+	case gifTickMsg:
+		a := m.gifAnim
+		if a != msg.anim {
+			return m, nil
+		}
+		a.frame = (a.frame + 1) % len(a.frames)
+		m.setPreview(a.frames[a.frame])
+		return m, gifTick(a, a.delays[a.frame])
+
+	case followTickMsg:
+		if m.follow != msg.f {
+			return m, nil
+		}
+		return m, readFollow(msg.f)
+
+	case followDataMsg:
+		f := m.follow
+		if f != msg.f {
+			return m, nil
+		}
+		if msg.err != nil {
+			m.follow = nil
+			m.setError("follow: " + msg.err.Error())
+			return m, nil
+		}
+		if m.loading || msg.from != f.size {
+			// The tail preview is on its way, or arrived since this read
+			// began and moved the offset; read again from there.
+			return m, followTick(f)
+		}
+		if msg.size < f.size {
+			// Truncated or replaced: start again from the new end.
+			f.size = msg.size
+			m.status = "follow: file truncated"
+			return m, tea.Batch(m.requestPreview(), followTick(f))
+		}
+		f.size = msg.size
+		if msg.text != "" {
+			m.appendFollowed(msg.text, msg.context)
+		}
+		return m, followTick(f)
+
+	case duTickMsg:
+		if m.duScanning {
+			return m, duTick()
+		}
+		return m, nil
+
+	case dirCountsMsg:
+		for path, c := range msg.counts {
+			m.dirCounts[path] = c
+			delete(m.countingDirs, path)
+		}
+		return m, nil
+
+	case vcsStatusMsg:
+		if msg.dir == m.cwd {
+			m.vcs, m.vcsDir = msg.info, msg.dir
+		}
+		return m, nil
+
+	case gitIgnoredMsg:
+		return m, m.applyGitIgnored(msg)
+
+	case slideRenderedMsg:
+		m.showRenderedSlide(msg)
+		return m, nil
+
+	case jsonQueryMsg:
+		return m, m.showJSONQuery(msg)
+
+	case frecencySaveMsg:
+		return m, m.saveFrecencyLater()
+
+	case zoxideImportMsg:
+		m.mergeZoxide(msg)
+		return m, nil
+
+	case clipboardSentMsg:
+		if m.clipboardSeq == msg.seq {
+			m.clipboardSeq = ""
+		}
+		return m, nil
+
+	case frecencySavedMsg:
+		if msg.err != nil {
+			m.setError("frecency: " + msg.err.Error())
+		}
+		return m, nil
+
+	case jsonDocumentMsg:
+		return m, m.showJSONDocument(msg)
+
 	case previewLoadedMsg:
 		if msg.requestID != m.requestID {
 			return m, nil
@@ -590,76 +2346,290 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, nil
 		}
 		m.cacheSet(msg.cacheKey, msg.content)
-		m.preview = msg.content
-		m.clampPreviewOffset()
+		m.setPreview(msg.content)
+		return m, m.prefetchAdjacent()
+
+	case previewChunkMsg:
+		s := m.previewMore
+		if s != msg.s {
+			return m, nil
+		}
+		if msg.err != nil {
+			m.previewMore = nil
+			m.setError("preview: " + msg.err.Error())
+			return m, nil
+		}
+		if msg.content == "" {
+			m.previewMore = nil // the file ended on the chunk boundary
+			return m, nil
+		}
+		m.setPreview(m.preview + "\n" + msg.content)
+		return m, nil
+
+	case prefetchedMsg:
+		delete(m.prefetching, msg.pending)
+		if msg.err == nil {
+			m.cacheSet(msg.cacheKey, msg.content)
+		}
 	}
 
 	return m, nil
 }
 
-// ── View ───────────────────────────────────────────────────────────────────────
+// ── status messages ───────────────────────────────────────────────────────────
 
-func (m model) View() string {
-	if m.width == 0 || m.height == 0 {
-		return lipgloss.NewStyle().Foreground(clrLoading).Render("loading…")
-	}
+// Status messages are set by assigning m.status, or through setError for
+// failures. Update records every change in a short history; informational
+// messages give way to "ready" after statusTimeout, errors stay until the
+// next message.
 
-	// ── dimensions ──────────────────────────────────────────────────────────
-	leftW, rightW, bodyH := m.layoutDimensions()
+type statusLevel int
 
-	// ── top bar: breadcrumb path ─────────────────────────────────────────────
-	topBar := m.renderTopBar(m.width)
+const (
+	statusInfo statusLevel = iota
+	statusError
+)
 
-	// ── left pane: file list ─────────────────────────────────────────────────
-	leftPane := m.renderFileList(leftW, bodyH)
+type statusEntry struct {
+	text  string
+	level statusLevel
+	at    time.Time
+}
 
-	// ── right pane: preview ───────────────────────────────────────────────────
-	rightPane := m.renderPreviewPane(rightW, bodyH)
+type statusExpireMsg struct{ at time.Time }
 
-	// ── bottom bar ────────────────────────────────────────────────────────────
-	bottomBar := m.renderBottomBar(m.width)
+const (
+	statusTimeout    = 4 * time.Second
+	maxStatusHistory = 100
+)
 
-	sepStyle := lipgloss.NewStyle().Foreground(clrBorder)
-	sepLine := sepStyle.Render("│")
-	sepLines := make([]string, bodyH)
-	for i := range sepLines {
-		sepLines[i] = sepLine
-	}
-	sep := strings.Join(sepLines, "\n")
-	body := lipgloss.JoinHorizontal(lipgloss.Top, leftPane, sep, rightPane)
+// setError shows a failure in the status bar until the next message.
+func (m *model) setError(text string) {
+	m.status = text
+	m.statusErr = text
+}
 
-	if m.confirmingDelete {
-		dialog := m.renderDeleteDialog(m.width, bodyH)
-		return topBar + "\n" + dialog + "\n" + bottomBar
+func (m model) statusLevel() statusLevel {
+	if m.status == m.statusErr {
+		return statusError
 	}
-
-	return topBar + "\n" + body + "\n" + bottomBar
+	return statusInfo
 }
 
-func (m model) renderDeleteDialog(width, height int) string {
-	dialogWidth := min(72, max(42, width-8))
-	fileName := filepath.Base(m.deleteTarget)
-	fileLabel := trimVisual(fileName, dialogWidth-12)
-	meta := "file"
-	if info, err := os.Stat(m.deleteTarget); err == nil {
-		if info.IsDir() {
-			meta = "folder"
-		} else {
-			meta = humanSize(info.Size())
+// noteStatus records a changed status and, for informational messages,
+// schedules its expiry.
+func (m *model) noteStatus() tea.Cmd {
+	if m.status == "ready" || m.status == "" {
+		return nil
+	}
+	now := time.Now()
+	m.statusSetAt = now
+	level := m.statusLevel()
+	entry := statusEntry{text: m.status, level: level, at: now}
+	n := len(m.statusHistory)
+	switch {
+	case n > 0 && m.statusHistory[n-1].text == m.status:
+	case n > 0 && progressPrefix(m.statusHistory[n-1].text) != "" &&
+		progressPrefix(m.statusHistory[n-1].text) == progressPrefix(m.status):
+		// Progress updates like "searching for x… 12 matches" replace
+		// each other.
+		m.statusHistory[n-1] = entry
+	default:
+		m.statusHistory = append(m.statusHistory, entry)
+		if len(m.statusHistory) > maxStatusHistory {
+			m.statusHistory = m.statusHistory[1:]
+		}
+	}
+	if level == statusError {
+		return nil
+	}
+	return tea.Tick(statusTimeout, func(time.Time) tea.Msg { return statusExpireMsg{at: now} })
+}
+
+// progressPrefix is the text before the "…" of a progress message, or "".
+func progressPrefix(s string) string {
+	prefix, _, ok := strings.Cut(s, "…")
+	if !ok {
+		return ""
+	}
+	return prefix
+}
+
+// updateMessages handles keys while the message history is open.
+func (m *model) updateMessages(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "esc", "alt+m", "q":
+		m.showMessages = false
+	case "j", "down":
+		m.messagesOffset++
+	case "k", "up":
+		m.messagesOffset = max(0, m.messagesOffset-1)
+	case "g", "home":
+		m.messagesOffset = 0
+	case "c":
+		m.statusHistory = nil
+		m.messagesOffset = 0
+	}
+	_, _, bodyH := m.layoutDimensions()
+	m.messagesOffset = min(m.messagesOffset, max(0, len(m.statusHistory)-max(1, bodyH-10)))
+	return nil
+}
+
+// renderMessages lists recent status messages, newest first.
+func (m model) renderMessages(width, height int) string {
+	panelW := min(96, max(40, width-8))
+	innerW := panelW - 6
+	titleStyle := lipgloss.NewStyle().Foreground(clrTitle).Bold(true)
+	mutedStyle := lipgloss.NewStyle().Foreground(clrMuted)
+	textStyle := lipgloss.NewStyle().Foreground(clrFile)
+	errorStyle := lipgloss.NewStyle().Foreground(clrDanger)
+
+	lines := []string{titleStyle.Render("Messages"), ""}
+	if len(m.statusHistory) == 0 {
+		lines = append(lines, mutedStyle.Render("No messages yet."))
+	}
+	rows := max(1, height-10)
+	offset := min(m.messagesOffset, max(0, len(m.statusHistory)-rows))
+	for i := len(m.statusHistory) - 1 - offset; i >= 0 && i > len(m.statusHistory)-1-offset-rows; i-- {
+		e := m.statusHistory[i]
+		icon, style := "●", textStyle
+		if e.level == statusError {
+			icon, style = "✗", errorStyle
 		}
+		lines = append(lines, mutedStyle.Render(e.at.Format("15:04:05"))+"  "+
+			style.Render(icon+" "+trimVisual(e.text, innerW-12)))
+	}
+	lines = append(lines, "", mutedStyle.Render("j/k scroll  ·  c clear  ·  esc close"))
+
+	box := lipgloss.NewStyle().
+		Width(panelW).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(clrBorderStrong).
+		Padding(1, 2).
+		Render(strings.Join(lines, "\n"))
+	return centerOverlay(box, width, height)
+}
+
+// ── View ───────────────────────────────────────────────────────────────────────
+
+// panelOpen reports whether a dialog or panel covers the panes.
+func (m model) panelOpen() bool {
+	return m.confirmingDelete || len(m.discardTargets) > 0 || m.prompt == promptPermanentDelete ||
+		m.showJobs || m.showBookmarks || m.showHelp || m.showMessages || m.showChanges || m.showJump || m.showFilterMenu || m.showDiskUsage
+}
+
+// View draws the screen, preceded by any pending OSC 52 sequence so the
+// renderer writes it to the terminal between frames.
+func (m model) View() string {
+	return m.clipboardSeq + m.view()
+}
+
+func (m model) view() string {
+	if m.width == 0 || m.height == 0 {
+		return lipgloss.NewStyle().Foreground(clrLoading).Render("loading…")
+	}
+	if m.presentation != nil {
+		return m.renderPresentation()
+	}
+	if c := m.contextMenu; c != nil && len(m.entries) > 0 {
+		// Draw everything else, then the menu over it.
+		m.contextMenu = nil
+		return overlayAt(m.view(), c.render(m.entries[m.selected].name), c.x, c.y)
+	}
+
+	// ── dimensions ──────────────────────────────────────────────────────────
+	leftW, rightW, bodyH := m.layoutDimensions()
+
+	// ── top bar: breadcrumb path ─────────────────────────────────────────────
+	topBar := m.renderTopBar(m.width)
+
+	if m.dualPane && !m.panelOpen() {
+		return topBar + "\n" + m.renderDualPane(bodyH) + "\n" + m.renderBottomBar(m.width)
+	}
+
+	// ── left pane: file list ─────────────────────────────────────────────────
+	leftPane := m.renderFileList(leftW, bodyH)
+	if m.hidePreview && !m.panelOpen() {
+		return topBar + "\n" + leftPane + "\n" + m.renderBottomBar(m.width)
+	}
+
+	// ── right pane: preview ───────────────────────────────────────────────────
+	rightPane := m.renderPreviewPane(rightW, bodyH)
+
+	// ── bottom bar ────────────────────────────────────────────────────────────
+	bottomBar := m.renderBottomBar(m.width)
+
+	sepStyle := lipgloss.NewStyle().Foreground(clrBorder)
+	sepLine := sepStyle.Render("│")
+	sepLines := make([]string, bodyH)
+	for i := range sepLines {
+		sepLines[i] = sepLine
+	}
+	sep := strings.Join(sepLines, "\n")
+	body := lipgloss.JoinHorizontal(lipgloss.Top, leftPane, sep, rightPane)
+
+	if m.confirmingDelete {
+		dialog := m.renderDeleteDialog(m.width, bodyH)
+		return topBar + "\n" + dialog + "\n" + bottomBar
+	}
+	if len(m.discardTargets) > 0 {
+		dialog := m.renderDiscardDialog(m.width, bodyH)
+		return topBar + "\n" + dialog + "\n" + bottomBar
+	}
+	if m.prompt == promptPermanentDelete {
+		dialog := m.renderPermanentDeleteDialog(m.width, bodyH)
+		return topBar + "\n" + dialog + "\n" + bottomBar
+	}
+	if m.showJobs {
+		return topBar + "\n" + m.renderJobsPanel(m.width, bodyH) + "\n" + bottomBar
 	}
+	if m.showBookmarks {
+		return topBar + "\n" + m.renderBookmarksPanel(m.width, bodyH) + "\n" + bottomBar
+	}
+	if m.showHelp {
+		return topBar + "\n" + m.renderHelp(m.width, bodyH) + "\n" + bottomBar
+	}
+	if m.showMessages {
+		return topBar + "\n" + m.renderMessages(m.width, bodyH) + "\n" + bottomBar
+	}
+	if m.showChanges {
+		return topBar + "\n" + m.renderChangesPanel(m.width, bodyH) + "\n" + bottomBar
+	}
+	if m.showJump {
+		return topBar + "\n" + m.renderJumpPanel(m.width, bodyH) + "\n" + bottomBar
+	}
+	if m.showFilterMenu {
+		return topBar + "\n" + m.renderFilterMenu(m.width, bodyH) + "\n" + bottomBar
+	}
+	if m.showDiskUsage {
+		return topBar + "\n" + m.renderDiskUsage(m.width, bodyH) + "\n" + bottomBar
+	}
+
+	return topBar + "\n" + body + "\n" + bottomBar
+}
+
+func (m model) renderDeleteDialog(width, height int) string {
+	fileName, meta := m.deleteSummary()
+	return renderConfirmDialog(width, height, "Move to Trash?", fileName, "Selected with backspace  •  "+meta, "move")
+}
+
+// renderConfirmDialog draws a y/n confirmation for a destructive action on
+// the named entries; action labels the confirming key.
+func renderConfirmDialog(width, height int, titleText, fileName, meta, action string) string {
+	dialogWidth := min(72, max(42, width-8))
+	fileLabel := trimVisual(fileName, dialogWidth-12)
 
 	title := lipgloss.NewStyle().
 		Foreground(clrDanger).
 		Bold(true).
-		Render("Move to Trash?")
+		Render(titleText)
 	nameLine := lipgloss.NewStyle().
 		Foreground(clrAccentFg).
 		Bold(true).
 		Render(fileLabel)
 	metaLine := lipgloss.NewStyle().
 		Foreground(clrMuted).
-		Render("Selected with backspace  •  " + meta)
+		Render(meta)
 	hintLine := lipgloss.NewStyle().
 		Foreground(clrHintText).
 		Render("Enter or y confirms. Esc or n cancels.")
@@ -669,7 +2639,7 @@ func (m model) renderDeleteDialog(width, height int) string {
 		Background(clrDanger).
 		Padding(0, 1).
 		Bold(true).
-		Render(" enter / y move ")
+		Render(" enter / y " + action + " ")
 	actionSecondary := lipgloss.NewStyle().
 		Foreground(clrHintText).
 		Background(clrSurfaceAlt).
@@ -693,7 +2663,94 @@ func (m model) renderDeleteDialog(width, height int) string {
 			actionPrimary + "  " + actionSecondary,
 		}, "\n"))
 
-	boxLines := strings.Split(dialogBox, "\n")
+	return centerOverlay(dialogBox, width, height)
+}
+
+// renderPermanentDeleteDialog asks the user to type the file name (or the
+// number of marked items) before anything is removed for good.
+func (m model) renderPermanentDeleteDialog(width, height int) string {
+	dialogWidth := min(72, max(42, width-8))
+	fileName, meta := m.deleteSummary()
+	fileLabel := trimVisual(fileName, dialogWidth-12)
+
+	title := lipgloss.NewStyle().
+		Foreground(clrDanger).
+		Bold(true).
+		Render("Delete Permanently?")
+	nameLine := lipgloss.NewStyle().
+		Foreground(clrAccentFg).
+		Bold(true).
+		Render(fileLabel)
+	metaLine := lipgloss.NewStyle().
+		Foreground(clrMuted).
+		Render("Bypasses the trash and cannot be undone  •  " + meta)
+	hintLine := lipgloss.NewStyle().
+		Foreground(clrHintText).
+		Render("Type " + lipgloss.NewStyle().Foreground(clrDanger).Bold(true).Render(m.permanentDeleteConfirmation()) + " to confirm:")
+
+	inputW := dialogWidth - 8
+	input := lipgloss.NewStyle().
+		Foreground(clrAccentFg).
+		Background(clrSurfaceAlt).
+		Width(inputW).
+		Render(trimVisual(m.promptValue, inputW-1) + "▌")
+
+	actionPrimary := lipgloss.NewStyle().
+		Foreground(clrAccentFg).
+		Background(clrDanger).
+		Padding(0, 1).
+		Bold(true).
+		Render(" enter delete ")
+	actionSecondary := lipgloss.NewStyle().
+		Foreground(clrHintText).
+		Background(clrSurfaceAlt).
+		Padding(0, 1).
+		Render(" esc cancel ")
+
+	dialogBox := lipgloss.NewStyle().
+		Width(dialogWidth).
+		Border(lipgloss.ThickBorder()).
+		BorderForeground(clrDanger).
+		Background(clrDangerSoft).
+		Padding(1, 2).
+		Render(strings.Join([]string{
+			title,
+			"",
+			nameLine,
+			metaLine,
+			"",
+			hintLine,
+			input,
+			"",
+			actionPrimary + "  " + actionSecondary,
+		}, "\n"))
+
+	return centerOverlay(dialogBox, width, height)
+}
+
+// deleteSummary describes deleteTargets for the confirmation dialogs.
+func (m model) deleteSummary() (string, string) {
+	if len(m.deleteTargets) == 1 {
+		meta := "file"
+		if info, err := os.Lstat(m.deleteTargets[0]); err == nil {
+			if info.IsDir() {
+				meta = "folder"
+			} else {
+				meta = humanSize(info.Size())
+			}
+		}
+		return filepath.Base(m.deleteTargets[0]), meta
+	}
+	names := make([]string, 0, len(m.deleteTargets))
+	for _, path := range m.deleteTargets {
+		names = append(names, filepath.Base(path))
+	}
+	return strings.Join(names, ", "), fmt.Sprintf("%d marked items", len(m.deleteTargets))
+}
+
+// centerOverlay places a rendered box in the middle of a width×height area.
+func centerOverlay(box string, width, height int) string {
+	boxLines := strings.Split(box, "\n")
 	boxHeight := len(boxLines)
 	topPad := max(0, (height-boxHeight)/2)
 	leftPad := max(0, (width-lipgloss.Width(boxLines[0]))/2)
@@ -721,11 +2778,25 @@ func (m model) renderTopBar(width int) string {
 	if m.showHidden {
 		count += " (hidden shown)"
 	}
+	if len(m.marked) > 0 {
+		count = fmt.Sprintf("%d marked · ", len(m.marked)) + count
+	}
+	if labels := m.activeFilterLabels(); len(labels) > 0 {
+		count = "only " + strings.Join(labels, ", ") + " · " + count
+	}
+	if running, pct := m.jobSummary(); running > 0 {
+		count = fmt.Sprintf("⟳ %d job(s) %d%% · ", running, pct) + count
+	}
 	rawCount := countStyle.Render(count)
 	countW := lipgloss.Width(rawCount)
 
-	// Available width for breadcrumb: total - 1 left padding - 1 space before count - countW
-	breadcrumbBudget := width - 1 - 1 - countW
+	tabStrip := m.renderTabStrip(width / 2)
+	tabStripW := lipgloss.Width(tabStrip)
+	gitLabel := m.renderVCSLabel()
+	gitW := lipgloss.Width(gitLabel)
+
+	// Available width for breadcrumb: total - 2 padding - 1 space before count - countW
+	breadcrumbBudget := width - 2 - 1 - countW - tabStripW - gitW
 	if breadcrumbBudget < 4 {
 		breadcrumbBudget = 4
 	}
@@ -774,9 +2845,10 @@ func (m model) renderTopBar(width int) string {
 		breadcrumb = ellipsis + sepStyle.Render(" › ") + strings.Join(kept, sepStyle.Render(" › "))
 	}
 
-	// Compose bar: breadcrumb left, count right
+	// Compose bar: tabs, breadcrumb and branch left, count right
+	breadcrumb = tabStrip + breadcrumb + gitLabel
 	breadcrumbW := lipgloss.Width(breadcrumb)
-	gap := width - 1 - breadcrumbW - countW // 1 = left padding
+	gap := width - 2 - breadcrumbW - countW // 2 = left + right padding
 	if gap < 1 {
 		gap = 1
 	}
@@ -790,19 +2862,60 @@ func (m model) renderTopBar(width int) string {
 
 // renderFileList draws the left pane with icons, names, sizes, and mod times.
 func (m model) renderFileList(w, h int) string {
+	title := "Explorer"
+	if m.deepSearch {
+		title = "Find: " + m.deepQuery
+		if m.deepGrep {
+			title = "Grep: " + m.deepQuery
+		}
+		if m.deepRunning {
+			title += " …"
+		}
+	}
+	return m.renderFileListPane(w, h, title, clrBorder)
+}
+
+// renderFileListPane draws the file list with the given title and border
+// colour; dual-pane mode uses them to tell the panes apart.
+func (m model) renderFileListPane(w, h int, paneTitle string, border lipgloss.Color) string {
 	paneStyle := lipgloss.NewStyle().
 		Width(w).
 		Height(h).
 		Border(lipgloss.RoundedBorder()).
-		BorderForeground(clrBorder)
+		BorderForeground(border)
 	innerW := max(8, w-2)
 	innerH := max(3, h-2)
 
 	// Column layout within the left pane:
-	//   [icon+name ............ size  ]
-	// Size column is 9 chars wide ("1023.9 KB" = 9 chars max), separated by a space.
+	//   [mark icon+name ...... [mode owner group] mtime  size ]
+	// Size column is 9 chars wide ("1023.9 KB" = 9 chars max). The mtime and
+	// detail columns are dropped, mtime first, when they would squeeze names
+	// below minListNameW.
 	sizeW := 9
-	nameW := max(8, innerW-sizeW-3)
+	timeW := mtimeColumnWidth(m.mtimeColumn)
+	modeW, ownerW, groupW := 0, 0, 0
+	detailW := 0
+	if m.showDetails {
+		for _, e := range m.entries {
+			modeW = max(modeW, len(e.mode.String()))
+			ownerW = max(ownerW, min(len(e.owner), 10))
+			groupW = max(groupW, min(len(e.group), 10))
+		}
+		detailW = modeW + ownerW + groupW + 3
+	}
+	if innerW-2-sizeW-timeW-detailW < minListNameW {
+		timeW = 0
+	}
+	if innerW-2-sizeW-detailW < minListNameW {
+		detailW = 0
+	}
+	// In a repository a one-cell git status badge leads each name.
+	gitW := 0
+	if m.vcs != nil && m.vcsDir == m.cwd {
+		gitW = 1
+	}
+	nameW := max(1, innerW-2-sizeW-timeW-detailW-gitW)
+	now := time.Now()
 
 	mutedStyle := lipgloss.NewStyle().Foreground(clrMuted)
 
@@ -811,7 +2924,7 @@ func (m model) renderFileList(w, h int) string {
 	// Panel title
 	titleStyle := lipgloss.NewStyle().Foreground(clrTitle).Bold(true)
 	countStyle := lipgloss.NewStyle().Foreground(clrMuted)
-	title := titleStyle.Render("Explorer")
+	title := titleStyle.Render(trimVisual(paneTitle, max(1, innerW-6)))
 	count := countStyle.Render(fmt.Sprintf("%d", len(m.entries)))
 	titleGap := innerW - lipgloss.Width(title) - lipgloss.Width(count)
 	if titleGap < 1 {
@@ -834,33 +2947,7 @@ func (m model) renderFileList(w, h int) string {
 			listH = 1
 		}
 
-		// First pass: compute window assuming no indicators
-		start, end := visibleWindow(m.selected, len(m.entries), listH)
-		needTop := start > 0
-		needBot := end < len(m.entries)
-
-		// If indicators are needed, shrink the window to make room for them.
-		// We may need to do this iteratively (showing top indicator can reveal bottom need).
-		for {
-			capacity := listH
-			if needTop {
-				capacity--
-			}
-			if needBot {
-				capacity--
-			}
-			if capacity < 1 {
-				capacity = 1
-			}
-			start, end = visibleWindow(m.selected, len(m.entries), capacity)
-			newNeedTop := start > 0
-			newNeedBot := end < len(m.entries)
-			if newNeedTop == needTop && newNeedBot == needBot {
-				break
-			}
-			needTop = newNeedTop
-			needBot = newNeedBot
-		}
+		start, end, needTop, needBot := m.visibleEntries(listH)
 
 		if needTop {
 			lines = append(lines, scrollStyle.Render(fmt.Sprintf("  ↑ %d more", start)))
@@ -870,20 +2957,51 @@ func (m model) renderFileList(w, h int) string {
 			e := m.entries[i]
 			cat := categorise(e)
 			icon := fileIconExt(cat, filepath.Ext(e.name))
+			if e.repo != "" {
+				icon = repoIcon()
+			}
 			colStyle := entryNameStyle(e)
+			if e.ignored && !m.showIgnored {
+				colStyle = lipgloss.NewStyle().Foreground(clrDim)
+			}
 
 			displayName := e.name
 			if e.isDir {
 				displayName = e.name + "/"
 			}
-			rawEntry := icon + displayName
+			rawEntry := strings.Repeat("  ", e.depth) + icon + displayName
 
 			// Size field – right-aligned in sizeW columns
 			sizeStr := ""
 			if !e.isDir {
 				sizeStr = humanSize(e.size)
+			} else if n, ok := m.dirItemCount(e); ok {
+				sizeStr = formatItemCount(n, sizeW)
 			}
 			sizeField := fmt.Sprintf("%*s", sizeW, sizeStr)
+			timeField := ""
+			if timeW > 0 {
+				timeField = fmt.Sprintf("%*s", timeW, formatMtime(e.modTime, now, m.mtimeColumn))
+			}
+			namePadded := padRight(trimVisual(rawEntry, nameW), nameW)
+			badge, plainBadge := "", ""
+			if gitW > 0 {
+				xy := m.fileStatus(e.path, e.isDir)
+				badge, plainBadge = renderStatusBadge(xy), ansi.Strip(renderStatusBadge(xy))
+			}
+			detailField := ""
+			if detailW > 0 {
+				detailField = " " + padRight(e.mode.String(), modeW) +
+					" " + padRight(trimVisual(e.owner, ownerW), ownerW) +
+					" " + padRight(trimVisual(e.group, groupW), groupW)
+			}
+
+			// Marked entries carry a bar in the left padding column.
+			marked := m.marked[e.path]
+			markCell := " "
+			if marked {
+				markCell = "▌"
+			}
 
 			if i == m.selected {
 				// Selected row: full-width highlight using visual width.
@@ -891,22 +3009,24 @@ func (m model) renderFileList(w, h int) string {
 					Foreground(clrAccentFg).
 					Background(clrAccent).
 					Bold(true).
-					Padding(0, 1)
-				// Measure the raw visual width of icon+name, pad to fill name column
-				entryVisW := lipgloss.Width(rawEntry)
-				nameColW := innerW - sizeW - 2
-				padding := ""
-				if entryVisW < nameColW {
-					padding = strings.Repeat(" ", nameColW-entryVisW)
-				}
-				namepart := trimVisual(rawEntry, nameColW)
-				row := selBg.Render(namepart + padding + sizeField)
+					PaddingRight(1)
+				markPart := selBg.UnsetPaddingRight().Render(markCell)
+				if marked {
+					markPart = selBg.UnsetPaddingRight().Foreground(clrMedia).Render(markCell)
+				}
+				row := markPart + selBg.Render(plainBadge+namePadded+detailField+timeField+sizeField)
 				lines = append(lines, row)
 			} else {
-				nameField := trimVisual(rawEntry, nameW)
-				namePart := lipgloss.NewStyle().PaddingLeft(1).Inherit(colStyle).Render(nameField)
+				markStyle := lipgloss.NewStyle()
+				if marked {
+					markStyle = markStyle.Foreground(clrMedia)
+					colStyle = colStyle.Foreground(clrMedia)
+				}
+				namePart := markStyle.Render(markCell) + badge + colStyle.Render(namePadded)
+				detailPart := mutedStyle.Render(detailField)
+				timePart := mutedStyle.Render(timeField)
 				sizePart := lipgloss.NewStyle().Foreground(clrSize).Render(sizeField)
-				lines = append(lines, namePart+sizePart)
+				lines = append(lines, namePart+detailPart+timePart+sizePart)
 			}
 		}
 
@@ -918,13 +3038,60 @@ func (m model) renderFileList(w, h int) string {
 	return paneStyle.Render(strings.Join(lines, "\n"))
 }
 
+// minListNameW is the narrowest name column the optional list columns may
+// leave before they are dropped.
+const minListNameW = 16
+
+// mtimeColumnWidth is the width of the mtime column, including its leading
+// gap, for the given format.
+func mtimeColumnWidth(format string) int {
+	switch format {
+	case "off":
+		return 0
+	case "absolute":
+		return len(" Jan 02 15:04")
+	}
+	return len(" 11mo ago")
+}
+
+// formatMtime renders t for the list's mtime column: absolute, or relative
+// to now ("5m ago", "3d ago", "2y ago").
+func formatMtime(t, now time.Time, format string) string {
+	if format == "absolute" {
+		if t.Year() != now.Year() {
+			return t.Format("Jan 02  2006")
+		}
+		return t.Format("Jan 02 15:04")
+	}
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return "now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d/time.Hour))
+	case d < 7*24*time.Hour:
+		return fmt.Sprintf("%dd ago", int(d/(24*time.Hour)))
+	case d < 30*24*time.Hour:
+		return fmt.Sprintf("%dw ago", int(d/(7*24*time.Hour)))
+	case d < 365*24*time.Hour:
+		return fmt.Sprintf("%dmo ago", int(d/(30*24*time.Hour)))
+	}
+	return fmt.Sprintf("%dy ago", int(d/(365*24*time.Hour)))
+}
+
 // renderPreviewPane draws the right pane with header and preview content.
 func (m model) renderPreviewPane(w, h int) string {
+	border := clrBorderStrong
+	if m.previewFocused {
+		border = clrAccent
+	}
 	paneStyle := lipgloss.NewStyle().
 		Width(w).
 		Height(h).
 		Border(lipgloss.RoundedBorder()).
-		BorderForeground(clrBorderStrong)
+		BorderForeground(border)
 	innerW := max(12, w-2)
 	innerH := max(3, h-2)
 
@@ -953,7 +3120,14 @@ func (m model) renderPreviewPane(w, h int) string {
 			meta = e.modTime.Format("Jan 02 15:04")
 		}
 		if m.loading {
-			meta = lipgloss.NewStyle().Foreground(clrLoading).Render("loading…")
+			meta = m.loadingText("loading")
+		}
+		if m.scratch != "" {
+			meta = m.scratch
+		}
+		if m.previewSearch != "" {
+			counter := fmt.Sprintf("/%s %d/%d", m.previewSearch, min(m.previewMatch+1, len(m.previewMatches)), len(m.previewMatches))
+			meta = trimVisual(counter, max(8, w/3)) + "  " + meta
 		}
 		headerRight = mutedStyle.Render(meta)
 	} else {
@@ -984,16 +3158,25 @@ func (m model) renderPreviewPane(w, h int) string {
 		previewBody = mutedStyle.Render("  (no preview available)")
 	}
 	if m.loading {
-		previewBody = lipgloss.NewStyle().Foreground(clrLoading).Render("  loading preview…")
+		previewBody = "  " + m.loadingText("loading preview…")
+	} else if len(m.previewMatches) > 0 {
+		previewBody = m.highlightPreviewMatches(previewBody)
 	}
 
 	// Reserve one row for the scroll indicator when scrolled
 	contentH := previewH
 	var scrollIndicator string
-	if m.previewOffset > 0 {
+	if m.previewOffset > 0 || m.previewColumn > 0 {
 		contentH--
+		var where []string
+		if m.previewOffset > 0 {
+			where = append(where, fmt.Sprintf("↑ line %d", m.previewOffset+1))
+		}
+		if m.previewColumn > 0 {
+			where = append(where, fmt.Sprintf("← column %d", m.previewColumn+1))
+		}
 		scrollIndicator = lipgloss.NewStyle().Foreground(clrScrollbar).Render(
-			fmt.Sprintf("  ↑ line %d", m.previewOffset+1),
+			"  " + strings.Join(where, "  "),
 		)
 	}
 	if contentH < 1 {
@@ -1001,6 +3184,13 @@ func (m model) renderPreviewPane(w, h int) string {
 	}
 
 	sliced := m.slicePreview(previewBody, contentH)
+	if m.previewColumn > 0 && !m.loading {
+		rows := strings.Split(sliced, "\n")
+		for i, row := range rows {
+			rows[i] = ansi.Cut(row, m.previewColumn, m.previewColumn+innerW)
+		}
+		sliced = strings.Join(rows, "\n")
+	}
 	if scrollIndicator != "" {
 		sliced = scrollIndicator + "\n" + sliced
 	}
@@ -1014,6 +3204,9 @@ func (m model) renderPreviewPane(w, h int) string {
 				rawLines[i] = truncate.String(line, uint(innerW))
 			}
 		}
+		if m.previewSelecting {
+			highlightSelection(rawLines, m.previewSelStart, m.previewSelEnd, innerW)
+		}
 		sliced = strings.Join(rawLines, "\n")
 	}
 
@@ -1026,9 +3219,28 @@ func (m model) renderPreviewPane(w, h int) string {
 func (m model) renderBottomBar(width int) string {
 	// ── status / search line ─────────────────────────────────────────────────
 	var statusLine string
-	if m.searching {
+	if m.prompt != promptNone && m.prompt != promptPermanentDelete {
+		labelStyle := lipgloss.NewStyle().Foreground(clrAccent).Bold(true)
+		valueStyle := lipgloss.NewStyle().Foreground(clrAccentFg)
+		cursor := lipgloss.NewStyle().Foreground(clrAccent).Render("▌")
+		label := labelStyle.Render(promptLabels[m.prompt])
+		value := m.promptValue
+		// Keep the tail of long input visible next to the cursor.
+		budget := width - 3 - lipgloss.Width(label)
+		if budget > 1 && lipgloss.Width(value) > budget {
+			runes := []rune(value)
+			for len(runes) > 0 && lipgloss.Width(string(runes))+1 > budget {
+				runes = runes[1:]
+			}
+			value = "…" + string(runes)
+		}
+		statusLine = lipgloss.NewStyle().
+			Width(width).
+			Padding(0, 1).
+			Render(label + valueStyle.Render(value) + cursor)
+	} else if m.searching {
 		searchStyle := lipgloss.NewStyle().Foreground(clrAccent).Bold(true)
-		queryStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("255"))
+		queryStyle := lipgloss.NewStyle().Foreground(clrAccentFg)
 		cursor := lipgloss.NewStyle().Foreground(clrAccent).Render("▌")
 		prompt := searchStyle.Render("/ ") + queryStyle.Render(m.searchQuery) + cursor
 		statusLine = lipgloss.NewStyle().
@@ -1042,6 +3254,9 @@ func (m model) renderBottomBar(width int) string {
 		if statusText == "ready" {
 			statusIcon = "◆"
 			statusStyle = lipgloss.NewStyle().Foreground(clrExec)
+		} else if m.statusLevel() == statusError {
+			statusIcon = "✗"
+			statusStyle = lipgloss.NewStyle().Foreground(clrDanger)
 		}
 		maxStatusW := width - 3
 		if maxStatusW < 1 {
@@ -1057,7 +3272,20 @@ func (m model) renderBottomBar(width int) string {
 	// ── key hints ────────────────────────────────────────────────────────────
 	type hint struct{ key, desc string }
 	var hints []hint
-	if m.searching {
+	if len(m.promptCompletions) > 0 {
+		for _, c := range m.promptCompletions {
+			hints = append(hints, hint{c, ""})
+		}
+	} else if m.prompt != promptNone {
+		hints = []hint{
+			{"enter", "confirm"},
+			{"esc", "cancel"},
+			{"^u", "clear"},
+		}
+		if m.prompt == promptGoto {
+			hints = append(hints, hint{"tab", "complete"})
+		}
+	} else if m.searching {
 		hints = []hint{
 			{"esc", "cancel"},
 			{"backspace", "delete"},
@@ -1070,10 +3298,14 @@ func (m model) renderBottomBar(width int) string {
 			{"enter/l", "open"},
 			{"h", "up"},
 			{"backspace", "trash"},
+			{"space", "mark"},
+			{"yy/pp", "copy/paste"},
+			{"R", "rename"},
 			{"/", "search"},
 			{".", "hidden"},
 			{"^d/u", "scroll"},
 			{"r", "reload"},
+			{"?", "help"},
 			{"q", "quit"},
 		}
 	}
@@ -1115,6 +3347,74 @@ func (m model) renderBottomBar(width int) string {
 
 // ── helpers ────────────────────────────────────────────────────────────────────
 
+// listWindow returns the [start, end) range of entries a list of height rows
+// shows, and whether it needs the ↑/↓ more indicators, which take a row each.
+func listWindow(selected, total, height int) (start, end int, needTop, needBot bool) {
+	// First pass: compute window assuming no indicators
+	start, end = visibleWindow(selected, total, height)
+	needTop = start > 0
+	needBot = end < total
+
+	// If indicators are needed, shrink the window to make room for them.
+	// We may need to do this iteratively (showing top indicator can reveal bottom need).
+	for {
+		capacity := height
+		if needTop {
+			capacity--
+		}
+		if needBot {
+			capacity--
+		}
+		if capacity < 1 {
+			capacity = 1
+		}
+		start, end = visibleWindow(selected, total, capacity)
+		newNeedTop := start > 0
+		newNeedBot := end < total
+		if newNeedTop == needTop && newNeedBot == needBot {
+			return
+		}
+		needTop = newNeedTop
+		needBot = newNeedBot
+	}
+}
+
+// visibleEntries is the live list's window: centred on the selection, or
+// where the mouse wheel has scrolled it.
+func (m model) visibleEntries(rows int) (start, end int, needTop, needBot bool) {
+	if !m.listScrolled {
+		return listWindow(m.selected, len(m.entries), rows)
+	}
+	// The list may have shrunk under the scrolled view since, as when a
+	// reload drops entries.
+	start = max(0, min(m.listTop, len(m.entries)-1))
+	needTop = start > 0
+	capacity := rows
+	if needTop {
+		capacity--
+	}
+	if start+capacity < len(m.entries) {
+		needBot = true
+		capacity--
+	}
+	end = min(len(m.entries), start+max(1, capacity))
+	return start, end, needTop, needBot
+}
+
+// scrollList moves the list's view by d entries without moving the
+// selection, stopping where the last entry shows.
+func (m *model) scrollList(d, rows int) {
+	if !m.listScrolled {
+		m.listTop, _, _, _ = listWindow(m.selected, len(m.entries), rows)
+		m.listScrolled = true
+	}
+	last := 0
+	if len(m.entries) > rows {
+		last = len(m.entries) - (rows - 1) // the ↑ more line takes a row
+	}
+	m.listTop = max(0, min(m.listTop+d, last))
+}
+
 // visibleWindow returns [start, end) range of entries to show given height.
 func visibleWindow(selected, total, height int) (int, int) {
 	if total <= height {
@@ -1172,59 +3472,253 @@ func padRight(s string, n int) string {
 // from the current terminal size. Centralises the layout math used by View,
 // isInPreviewPane, and requestPreview.
 func (m model) layoutDimensions() (leftW, rightW, bodyH int) {
-	leftW = max(26, m.width/3)
+	leftW = max(minListW, m.width/3)
+	if m.listRatio > 0 {
+		leftW = max(minListW, min(int(m.listRatio*float64(m.width)+0.5), m.width-minPreviewW))
+	}
 	rightW = m.width - leftW - 1
+	if m.hidePreview {
+		leftW, rightW = m.width-2, 0 // the list's border sits outside its width
+	}
 	bodyH = max(4, m.height-4)
 	return
 }
 
-func (m model) isInPreviewPane(x, y int) bool {
+// previewRect returns the preview pane's position and size: right of the file
+// list normally, docked below the two lists in dual-pane mode (zero height
+// when the terminal is too short and the preview is collapsed).
+func (m model) previewRect() (int, int, int, int) {
 	leftW, rightW, bodyH := m.layoutDimensions()
-	previewStartX := leftW + 1
-	previewEndX := previewStartX + rightW - 1
-	previewStartY := 1 // top bar
-	previewEndY := previewStartY + bodyH
-
-	return x >= previewStartX && x <= previewEndX && y >= previewStartY && y <= previewEndY
+	if m.hidePreview {
+		return 0, 0, 0, 0
+	}
+	if m.dualPane {
+		listH, previewH := dualPaneHeights(bodyH)
+		return 0, 1 + listH + 2, m.width, previewH
+	}
+	return leftW + 1, 1, rightW, bodyH
 }
 
-func (m model) previewBodyRect() (startX, startY, width, height int) {
-	leftW, rightW, bodyH := m.layoutDimensions()
-	startX = leftW + 2
-	startY = 3
-	width = max(1, rightW-2)
-	height = max(1, bodyH-4)
-	return
+// mouseClick is where and when a mouse button was pressed.
+type mouseClick struct {
+	x, y int
+	at   time.Time
 }
 
-func (m model) isInPreviewBody(x, y int) bool {
-	startX, startY, width, height := m.previewBodyRect()
-	endX := startX + width - 1
-	endY := startY + height - 1
-	return x >= startX && x <= endX && y >= startY && y <= endY
-}
+// multiClickInterval is the longest gap between the clicks of a double or
+// triple click.
+const multiClickInterval = 400 * time.Millisecond
 
-func (m model) previewBodyPoint(x, y int) selectionPoint {
-	startX, startY, width, height := m.previewBodyRect()
-	col := x - startX
-	row := y - startY
-	col = max(0, min(col, width))
-	row = max(0, min(row, height-1))
-	return selectionPoint{x: col, y: row}
+// countClick records a left click and returns how many have landed on the
+// same cell in quick succession: 1 for a single click, 2 for a double.
+func (m *model) countClick(x, y int) int {
+	now := time.Now()
+	if m.lastClick.x == x && m.lastClick.y == y && now.Sub(m.lastClick.at) <= multiClickInterval {
+		m.clicks++
+	} else {
+		m.clicks = 1
+	}
+	m.lastClick = mouseClick{x: x, y: y, at: now}
+	return m.clicks
 }
 
-func (m model) selectedPreviewText() string {
-	start := m.previewSelStart
-	end := m.previewSelEnd
+// listPaneAt maps a point to a row of the file lists' entry area, below the
+// title and divider, which is rows tall. other is set for the inactive list
+// in dual-pane mode. Panes are drawn with their border outside the width
+// they're given.
+func (m model) listPaneAt(x, y int) (row, rows int, other, ok bool) {
+	leftW, _, bodyH := m.layoutDimensions()
+	paneW, listH := leftW+2, bodyH
+	if m.dualPane {
+		listH, _ = dualPaneHeights(bodyH)
+		if m.hidePreview {
+			listH = bodyH
+		}
+		paneW = (m.width-1)/2 + 2
+		if x > paneW {
+			// Right of the separator: the right-hand list.
+			x -= paneW + 1
+			other = !m.focusRight
+		} else {
+			other = m.focusRight
+		}
+	}
+	row = y - 4 // top bar, border, title and divider
+	rows = max(1, max(3, listH-2)-2)
+	if x < 0 || x >= paneW || row < 0 || row >= rows {
+		return 0, 0, false, false
+	}
+	return row, rows, other, true
+}
+
+// clickList selects the entry under a click in the file list, pages the
+// list when an ↑/↓ more indicator is clicked, and reports open for a
+// double click on an entry. ok is false when the click missed the list.
+func (m *model) clickList(x, y int) (cmd tea.Cmd, open, ok bool) {
+	row, rows, other, ok := m.listPaneAt(x, y)
+	if !ok {
+		return nil, false, false
+	}
+	clicks := m.countClick(x, y)
+	if other {
+		cmd = m.swapPanes()
+	}
+	if len(m.entries) == 0 {
+		return cmd, false, true
+	}
+	start, end, needTop, needBot := m.visibleEntries(rows)
+	if needTop {
+		if row == 0 {
+			return tea.Batch(cmd, m.navigate(max(0, m.selected-(end-start)))), false, true
+		}
+		row--
+	}
+	idx := start + row
+	switch {
+	case idx < end && idx == m.selected && clicks == 2:
+		return cmd, true, true
+	case idx < end:
+		return tea.Batch(cmd, m.navigate(idx)), false, true
+	case idx == end && needBot:
+		return tea.Batch(cmd, m.navigate(min(len(m.entries)-1, m.selected+(end-start)))), false, true
+	}
+	return cmd, false, true
+}
+
+func (m model) isInPreviewPane(x, y int) bool {
+	previewStartX, previewStartY, w, h := m.previewRect()
+	if h == 0 {
+		return false
+	}
+	previewEndX := previewStartX + w - 1
+	previewEndY := previewStartY + h
+
+	return x >= previewStartX && x <= previewEndX && y >= previewStartY && y <= previewEndY
+}
+
+func (m model) previewBodyRect() (startX, startY, width, height int) {
+	x, y, w, h := m.previewRect()
+	startX = x + 1
+	startY = y + 2
+	width = max(1, w-2)
+	height = max(1, h-4)
+	return
+}
+
+func (m model) isInPreviewBody(x, y int) bool {
+	startX, startY, width, height := m.previewBodyRect()
+	endX := startX + width - 1
+	endY := startY + height - 1
+	return x >= startX && x <= endX && y >= startY && y <= endY
+}
+
+func (m model) previewBodyPoint(x, y int) selectionPoint {
+	startX, startY, width, height := m.previewBodyRect()
+	col := x - startX
+	row := y - startY
+	col = max(0, min(col, width))
+	row = max(0, min(row, height-1))
+	return selectionPoint{x: col, y: row}
+}
+
+// copyPreviewSelection copies the selected part of the preview.
+func (m *model) copyPreviewSelection() {
+	selected := m.selectedPreviewText()
+	if selected == "" {
+		return
+	}
+	note, err := m.copyToClipboard(selected)
+	if err != nil {
+		m.setError("copy failed: " + err.Error())
+		return
+	}
+	m.status = fmt.Sprintf("copied %d chars", utf8.RuneCountInString(ansi.Strip(selected)))
+	if m.previewSelStyled {
+		m.status += " with colours"
+	}
+	m.status += note
+}
+
+// selectPreviewSpan selects the word at p, or its whole line, up to the last
+// character drawn on it.
+func (m *model) selectPreviewSpan(p selectionPoint, word bool) {
+	_, _, width, height := m.previewBodyRect()
+	lines := m.visiblePreviewLinesForCopy(width, height, false)
+	if p.y < 0 || p.y >= len(lines) {
+		return
+	}
+	cells := []rune{} // one per column; wide runes fill theirs with 0
+	for _, r := range lines[p.y] {
+		cells = append(cells, r)
+		for range ansi.StringWidth(string(r)) - 1 {
+			cells = append(cells, 0)
+		}
+	}
+	end := len(cells)
+	for end > 0 && (cells[end-1] == ' ' || cells[end-1] == 0) {
+		end--
+	}
+	start := 0
+	if word {
+		if p.x >= end || !isWordRune(cells[p.x]) {
+			return
+		}
+		start, end = p.x, p.x+1
+		for start > 0 && (cells[start-1] == 0 || isWordRune(cells[start-1])) {
+			start--
+		}
+		for end < len(cells) && (cells[end] == 0 || isWordRune(cells[end])) {
+			end++
+		}
+	}
+	m.previewSelStart = selectionPoint{x: start, y: p.y}
+	m.previewSelEnd = selectionPoint{x: end, y: p.y}
+}
+
+// isWordRune reports whether r belongs to a word for double-click selection.
+// Paths and dotted names count as one word; quotes and brackets end it.
+func isWordRune(r rune) bool {
+	return r != 0 && !unicode.IsSpace(r) && !strings.ContainsRune("\"'`()[]{}<>,;│", r)
+}
+
+// orderedSelection returns a selection's ends in reading order.
+func orderedSelection(start, end selectionPoint) (selectionPoint, selectionPoint) {
 	if start.y > end.y || (start.y == end.y && start.x > end.x) {
-		start, end = end, start
+		return end, start
+	}
+	return start, end
+}
+
+// highlightSelection draws the selected columns of the preview body's rows
+// in the accent colour, as they'll be copied.
+func highlightSelection(rows []string, start, end selectionPoint, width int) {
+	start, end = orderedSelection(start, end)
+	sel := lipgloss.NewStyle().Background(clrAccent).Foreground(clrAccentFg)
+	for y := max(0, start.y); y <= end.y && y < len(rows); y++ {
+		from, to := 0, width
+		if y == start.y {
+			from = start.x
+		}
+		if y == end.y {
+			to = end.x
+		}
+		line := rows[y]
+		to = min(to, ansi.StringWidth(line))
+		if to <= from {
+			continue
+		}
+		rows[y] = ansi.Truncate(line, from, "") + sel.Render(ansi.Strip(ansi.Cut(line, from, to))) + ansi.TruncateLeft(line, to, "")
 	}
+}
+
+func (m model) selectedPreviewText() string {
+	start, end := orderedSelection(m.previewSelStart, m.previewSelEnd)
 	if start == end {
 		return ""
 	}
 
 	_, _, width, height := m.previewBodyRect()
-	lines := m.visiblePreviewLinesForCopy(width, height)
+	lines := m.visiblePreviewLinesForCopy(width, height, m.previewSelStyled)
 	if len(lines) == 0 {
 		return ""
 	}
@@ -1246,12 +3740,22 @@ func (m model) selectedPreviewText() string {
 		if partEnd < partStart {
 			partEnd = partStart
 		}
-		out = append(out, sliceByColumns(line, partStart, partEnd))
+		if !m.previewSelStyled {
+			out = append(out, sliceByColumns(line, partStart, partEnd))
+			continue
+		}
+		part := ansi.Cut(line, partStart, partEnd)
+		if strings.Contains(part, "\x1b[") {
+			part += "\x1b[0m" // don't let a colour run on past the line
+		}
+		out = append(out, part)
 	}
 	return strings.Join(out, "\n")
 }
 
-func (m model) visiblePreviewLinesForCopy(width, height int) []string {
+// visiblePreviewLinesForCopy returns the preview body's rows as drawn,
+// plain or, if styled, with their ANSI styling.
+func (m model) visiblePreviewLinesForCopy(width, height int, styled bool) []string {
 	if width <= 0 || height <= 0 {
 		return nil
 	}
@@ -1266,7 +3770,7 @@ func (m model) visiblePreviewLinesForCopy(width, height int) []string {
 
 	contentH := height
 	lines := make([]string, 0, height)
-	if m.previewOffset > 0 {
+	if m.previewOffset > 0 || m.previewColumn > 0 {
 		contentH--
 		lines = append(lines, fmt.Sprintf("  ↑ line %d", m.previewOffset+1))
 	}
@@ -1277,6 +3781,11 @@ func (m model) visiblePreviewLinesForCopy(width, height int) []string {
 	tmp := m
 	sliced := tmp.slicePreview(previewBody, contentH)
 	bodyLines := strings.Split(sliced, "\n")
+	if m.previewColumn > 0 && !m.loading {
+		for i, line := range bodyLines {
+			bodyLines[i] = ansi.Cut(line, m.previewColumn, m.previewColumn+width)
+		}
+	}
 	lines = append(lines, bodyLines...)
 
 	if len(lines) > height {
@@ -1287,6 +3796,10 @@ func (m model) visiblePreviewLinesForCopy(width, height int) []string {
 	}
 
 	for i, line := range lines {
+		if styled {
+			lines[i] = ansi.Truncate(line, width, "")
+			continue
+		}
 		plain := ansi.Strip(line)
 		lines[i] = sliceByColumns(plain, 0, width)
 	}
@@ -1326,11 +3839,60 @@ func byteIndexForColumn(s string, col int) int {
 	return len(s)
 }
 
-func copyToClipboard(text string) error {
+// clipboardSeqHold is how long an OSC 52 sequence stays ahead of the frames,
+// long enough for the renderer to draw at least one of them.
+const clipboardSeqHold = 100 * time.Millisecond
+
+// clipboardSentMsg clears the OSC 52 sequence seq once it has been drawn.
+type clipboardSentMsg struct{ seq string }
+
+// copyToClipboard copies text with the system clipboard tools or, when they
+// don't apply, by queueing an OSC 52 sequence for the next frame. The
+// returned note is appended to the status in that case, since whether the
+// terminal honours it can't be checked.
+func (m *model) copyToClipboard(text string) (string, error) {
 	if text == "" {
-		return nil
+		return "", nil
+	}
+
+	mode := userConfig.clipboard
+	if env := os.Getenv("SEER_CLIPBOARD"); env != "" {
+		mode = env
+	}
+	switch {
+	case mode == "system":
+		return "", copySystemClipboard(text)
+	case mode != "osc52" && !inSSHSession():
+		// Over SSH the system tools would copy on the remote machine.
+		if copySystemClipboard(text) == nil {
+			return "", nil
+		}
+	}
+	m.clipboardSeq = osc52Sequence(text)
+	return " (sent to terminal clipboard)", nil
+}
+
+// inSSHSession reports whether seer runs over SSH.
+func inSSHSession() bool {
+	return os.Getenv("SSH_TTY") != "" || os.Getenv("SSH_CONNECTION") != ""
+}
+
+// osc52Sequence returns the OSC 52 escape sequence asking the terminal to
+// set its clipboard, which works over SSH and in containers when the terminal
+// supports it. tmux and screen need it passed through to their terminal.
+func osc52Sequence(text string) string {
+	seq := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a"
+	switch {
+	case os.Getenv("TMUX") != "":
+		seq = "\x1bPtmux;" + strings.ReplaceAll(seq, "\x1b", "\x1b\x1b") + "\x1b\\"
+	case strings.HasPrefix(os.Getenv("TERM"), "screen"):
+		seq = "\x1bP" + seq + "\x1b\\"
 	}
+	return seq
+}
 
+// copySystemClipboard copies with the platform's clipboard tool.
+func copySystemClipboard(text string) error {
 	switch runtime.GOOS {
 	case "darwin":
 		return runClipboardCommand(text, "pbcopy")
@@ -1367,7 +3929,7 @@ func runClipboardCommand(text, name string, args ...string) error {
 }
 
 func (m *model) changeDir(path string) error {
-	entries, err := listDir(path, m.showHidden)
+	entries, err := m.loadEntries(path)
 	if err != nil {
 		return err
 	}
@@ -1376,832 +3938,15605 @@ func (m *model) changeDir(path string) error {
 	m.entries = entries
 	m.selected = 0
 	m.previewOffset = 0
+	m.previewColumn = 0
+	m.listScrolled = false
 	m.searchQuery = ""
 	m.searching = false
 	m.status = path
+	m.recordVisit(path)
 	return nil
 }
 
-// applySearch filters entries by the current searchQuery (case-insensitive substring).
-// Returns all entries unchanged when the query is empty.
+// applySearch filters entries by the active quick filters, then by any
+// operators in searchQuery (ext:, size>, before:, …), then by the remaining
+// text: fuzzy and ranked by score, or case-insensitive substring when
+// substringSearch is set. Case sensitivity follows searchCase.
 func (m model) applySearch(entries []entry) []entry {
-	if m.searchQuery == "" {
+	entries = m.applyQuickFilters(m.dropGitIgnored(entries))
+	text, preds := parseSearchQuery(m.searchQuery)
+	if len(preds) > 0 {
+		var kept []entry
+		for _, e := range entries {
+			if matchesAll(preds, e) {
+				kept = append(kept, e)
+			}
+		}
+		entries = kept
+	}
+	if text == "" {
 		return entries
 	}
-	q := strings.ToLower(m.searchQuery)
-	var out []entry
-	for _, e := range entries {
-		if strings.Contains(strings.ToLower(e.name), q) {
-			out = append(out, e)
+	sensitive := m.caseSensitive(text)
+	if m.substringSearch {
+		q := text
+		if !sensitive {
+			q = strings.ToLower(text)
 		}
+		var out []entry
+		for _, e := range entries {
+			name := e.name
+			if !sensitive {
+				name = strings.ToLower(name)
+			}
+			if strings.Contains(name, q) {
+				out = append(out, e)
+			}
+		}
+		return out
 	}
-	return out
-}
 
-// cacheSet stores a preview result and evicts the oldest entry when the cache
-// exceeds previewCacheMax entries.
-func (m *model) cacheSet(key, value string) {
-	if _, exists := m.cache[key]; !exists {
-		m.cacheOrder = append(m.cacheOrder, key)
+	type scored struct {
+		e     entry
+		score int
 	}
-	m.cache[key] = value
-	for len(m.cacheOrder) > previewCacheMax {
-		oldest := m.cacheOrder[0]
-		m.cacheOrder = m.cacheOrder[1:]
-		delete(m.cache, oldest)
+	var matches []scored
+	for _, e := range entries {
+		if score, ok := fuzzyScore(text, e.name, sensitive); ok {
+			matches = append(matches, scored{e, score})
+		}
+	}
+	// The tree view keeps its hierarchy order; flat lists rank by score.
+	if !m.treeMode {
+		sort.SliceStable(matches, func(i, j int) bool {
+			if matches[i].score != matches[j].score {
+				return matches[i].score > matches[j].score
+			}
+			return len(matches[i].e.name) < len(matches[j].e.name)
+		})
 	}
+	out := make([]entry, len(matches))
+	for i, s := range matches {
+		out[i] = s.e
+	}
+	return out
 }
 
-func (m *model) requestPreview() tea.Cmd {
-	if len(m.entries) == 0 {
-		m.preview = ""
-		m.loading = false
-		return nil
+// caseSensitive reports whether query should match case-sensitively: always
+// or never per searchCase, or under smart case (the default) only when the
+// query contains an uppercase letter.
+func (m model) caseSensitive(query string) bool {
+	switch m.searchCase {
+	case "sensitive":
+		return true
+	case "ignore":
+		return false
 	}
+	return strings.IndexFunc(query, unicode.IsUpper) >= 0
+}
 
-	picked := m.entries[m.selected]
-	cacheKey := previewKey(picked.path, picked.modTime, picked.size, m.width, m.height)
-	if val, ok := m.cache[cacheKey]; ok {
-		m.preview = val
-		m.loading = false
-		return nil
+// ── search operators ──────────────────────────────────────────────────────────
+
+// entryPredicate is one structured condition parsed from the search query.
+type entryPredicate func(e entry) bool
+
+// parseSearchQuery splits a query into free text and operator predicates.
+// Recognised operators:
+//
+//	ext:go,md        extension (comma-separated alternatives)
+//	type:dir|file    entry kind
+//	size>10mb        size comparison with >, >=, <, <= (k/m/g/t suffixes)
+//	before:2024-01-01, after:2024-01-01   modification date
+//
+// Tokens that don't parse as operators are kept as text, so a typo narrows
+// the listing to nothing rather than being silently dropped.
+func parseSearchQuery(query string) (string, []entryPredicate) {
+	var text []string
+	var preds []entryPredicate
+	for _, tok := range strings.Fields(query) {
+		if p, ok := parseSearchOperator(tok); ok {
+			preds = append(preds, p)
+		} else {
+			text = append(text, tok)
+		}
 	}
+	return strings.Join(text, " "), preds
+}
 
-	m.requestID++
-	requestID := m.requestID
-	m.loading = true
-	path := picked.path
-	_, rightW, bodyH := m.layoutDimensions()
-	width := max(40, rightW)
-	height := max(8, bodyH)
-
-	return func() tea.Msg {
-		content, err := buildPreview(path, width, height)
-		return previewLoadedMsg{
-			requestID: requestID,
-			cacheKey:  cacheKey,
-			content:   content,
-			err:       err,
+func parseSearchOperator(tok string) (entryPredicate, bool) {
+	lower := strings.ToLower(tok)
+	switch {
+	case strings.HasPrefix(lower, "ext:"):
+		var exts []string
+		for _, x := range strings.Split(lower[len("ext:"):], ",") {
+			if x = strings.TrimPrefix(x, "."); x != "" {
+				exts = append(exts, "."+x)
+			}
+		}
+		if len(exts) == 0 {
+			return nil, false
+		}
+		return func(e entry) bool {
+			if e.isDir {
+				return false
+			}
+			ext := strings.ToLower(filepath.Ext(e.name))
+			for _, x := range exts {
+				if ext == x {
+					return true
+				}
+			}
+			return false
+		}, true
+	case lower == "type:dir" || lower == "type:d":
+		return func(e entry) bool { return e.isDir }, true
+	case lower == "type:file" || lower == "type:f":
+		return func(e entry) bool { return !e.isDir }, true
+	case strings.HasPrefix(lower, "before:"), strings.HasPrefix(lower, "after:"):
+		name, value, _ := strings.Cut(lower, ":")
+		day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return nil, false
+		}
+		if name == "before" {
+			return func(e entry) bool { return e.modTime.Before(day) }, true
+		}
+		next := day.AddDate(0, 0, 1)
+		return func(e entry) bool { return !e.modTime.Before(next) }, true
+	case strings.HasPrefix(lower, "size"):
+		rest := lower[len("size"):]
+		var op string
+		for _, candidate := range []string{">=", "<=", ">", "<"} {
+			if strings.HasPrefix(rest, candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			return nil, false
+		}
+		n, ok := parseByteSize(rest[len(op):])
+		if !ok {
+			return nil, false
 		}
+		return func(e entry) bool {
+			if e.isDir {
+				return false
+			}
+			switch op {
+			case ">=":
+				return e.size >= n
+			case "<=":
+				return e.size <= n
+			case ">":
+				return e.size > n
+			default:
+				return e.size < n
+			}
+		}, true
 	}
+	return nil, false
 }
 
-func (m *model) slicePreview(in string, h int) string {
-	if h <= 0 {
-		return ""
-	}
-	lines := strings.Split(in, "\n")
-	maxStart := max(0, len(lines)-h)
-	if m.previewOffset > maxStart {
-		m.previewOffset = maxStart
+// parseByteSize parses sizes like "512", "10k", "1.5mb" or "2G" using
+// binary multiples, matching humanSize.
+func parseByteSize(s string) (int64, bool) {
+	s = strings.TrimSuffix(strings.ToLower(s), "b")
+	mult := float64(1)
+	if s != "" {
+		if i := strings.IndexByte("kmgt", s[len(s)-1]); i >= 0 {
+			mult = math.Pow(1024, float64(i+1))
+			s = s[:len(s)-1]
+		}
 	}
-	if m.previewOffset < 0 {
-		m.previewOffset = 0
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return 0, false
 	}
-	start := m.previewOffset
-	end := min(len(lines), start+h)
-	return strings.Join(lines[start:end], "\n")
+	return int64(v * mult), true
 }
 
-func (m *model) clampPreviewOffset() {
-	if m.previewOffset < 0 {
-		m.previewOffset = 0
-	}
-	if m.preview == "" {
-		m.previewOffset = 0
-		return
-	}
-	lines := strings.Split(m.preview, "\n")
-	viewport := m.previewViewportHeight()
-	maxStart := max(0, len(lines)-viewport)
-	if m.previewOffset > maxStart {
-		m.previewOffset = maxStart
+func matchesAll(preds []entryPredicate, e entry) bool {
+	for _, p := range preds {
+		if !p(e) {
+			return false
+		}
 	}
+	return true
 }
 
-func (m model) previewViewportHeight() int {
-	bodyH := max(4, m.height-4)
-	return max(1, bodyH-4)
+// ── deep search ───────────────────────────────────────────────────────────────
+
+const (
+	deepSearchWorkers    = 8
+	maxDeepSearchResults = 5000
+	fdBatchSize          = 128
+)
+
+// deepSearchMsg carries a batch of results from the walk identified by id.
+// next waits for the following batch; it is nil once the walk has finished.
+type deepSearchMsg struct {
+	id   int
+	hits []searchHit
+	next tea.Cmd
 }
 
-// ── preview builders ──────────────────────────────────────────────────────────
+// searchHit is one result: a file or directory, plus the matching lines
+// with context for content searches.
+type searchHit struct {
+	entry entry
+	lines []grepLine
+}
 
-func buildPreview(path string, width, height int) (string, error) {
-	info, err := os.Stat(path)
-	if err != nil {
-		return "", err
+// startDeepSearch walks the tree under cwd for names containing query (or,
+// with grep, files whose contents match it) and streams matches into the
+// list, replacing any search still running.
+func (m *model) startDeepSearch(query string, grep bool) tea.Cmd {
+	if m.deepCancel != nil {
+		m.deepCancel()
 	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.deepID++
+	m.deepCancel = cancel
+	m.deepSearch = true
+	m.deepRunning = true
+	m.deepQuery = query
+	m.deepGrep = grep
+	m.grepLines = make(map[string][]grepLine)
+	m.searching = false
+	m.searchQuery = ""
+	m.allEntries = nil
+	m.entries = nil
+	m.selected = 0
+	m.status = "searching for " + query + "…"
 
-	if info.IsDir() {
-		return buildDirPreview(path)
+	m.deepSensitive = m.caseSensitive(query)
+	results := make(chan []searchHit, 64)
+	if grep {
+		go grepSearch(ctx, m.cwd, query, m.deepSensitive, m.showHidden, results)
+	} else {
+		go nameSearch(ctx, m.cwd, query, m.deepSensitive, m.showHidden, results)
 	}
+	return waitForDeepResults(m.deepID, results)
+}
 
-	ext := strings.ToLower(filepath.Ext(path))
-	if imageExts[ext] {
-		if img, ok := imagePreview(path, width, height); ok {
-			return img, nil
+// waitForDeepResults receives the next batch, coalescing whatever else is
+// already queued so a fast walk doesn't flood Update with messages.
+func waitForDeepResults(id int, results <-chan []searchHit) tea.Cmd {
+	return func() tea.Msg {
+		batch, ok := <-results
+		if !ok {
+			return deepSearchMsg{id: id}
+		}
+		for {
+			select {
+			case more, ok := <-results:
+				if !ok {
+					return deepSearchMsg{id: id, hits: batch}
+				}
+				batch = append(batch, more...)
+			default:
+				return deepSearchMsg{id: id, hits: batch, next: waitForDeepResults(id, results)}
+			}
 		}
-		return fmt.Sprintf("image file: %s\nsize: %s\n\npreview unavailable for this format", filepath.Base(path), humanSize(info.Size())), nil
 	}
+}
 
-	f, err := os.Open(path)
-	if err != nil {
-		return "", err
+func (m *model) handleDeepSearch(msg deepSearchMsg) tea.Cmd {
+	if msg.id != m.deepID || !m.deepSearch {
+		return nil // a cancelled search
 	}
-	defer f.Close()
-
-	buf := make([]byte, maxPreviewBytes)
-	n, readErr := f.Read(buf)
-	if readErr != nil && readErr != io.EOF {
-		return "", readErr
+	hadEntries := len(m.entries) > 0
+	for _, hit := range msg.hits {
+		m.allEntries = append(m.allEntries, hit.entry)
+		if hit.lines != nil {
+			m.grepLines[hit.entry.path] = hit.lines
+		}
 	}
-	buf = buf[:n]
-
-	if isLikelyBinary(buf) {
-		return fmt.Sprintf("binary file: %s\nsize: %s\nmodified: %s", filepath.Base(path), humanSize(info.Size()), info.ModTime().Format(time.RFC822)), nil
+	m.entries = m.applySearch(m.allEntries)
+	if msg.next == nil {
+		m.deepRunning = false
+		m.status = fmt.Sprintf("%d matches for %q under %s", len(m.allEntries), m.deepQuery, filepath.Base(m.cwd))
+		if len(m.allEntries) >= maxDeepSearchResults {
+			m.status += " (limit reached)"
+		}
+	} else {
+		m.status = fmt.Sprintf("searching for %q… %d matches", m.deepQuery, len(m.allEntries))
 	}
-
-	text := string(buf)
-	if !utf8.ValidString(text) {
-		return fmt.Sprintf("non-utf8 text file: %s\nsize: %s", filepath.Base(path), humanSize(info.Size())), nil
+	var preview tea.Cmd
+	if !hadEntries && len(m.entries) > 0 {
+		preview = m.requestPreview()
 	}
-	// Normalize Windows-style line endings so \r doesn't corrupt terminal rendering.
-	text = strings.ReplaceAll(text, "\r\n", "\n")
-	text = strings.ReplaceAll(text, "\r", "\n")
+	return tea.Batch(msg.next, preview)
+}
 
-	switch ext {
-	case ".md", ".markdown", ".mdx":
-		return renderMarkdownPreview(text, width, n == maxPreviewBytes), nil
-	case ".mmd", ".mermaid":
-		return renderMermaidNative(text), nil
-	case ".json":
-		return renderJSONPreview(text, n == maxPreviewBytes), nil
+// exitDeepSearch cancels the walk and returns to the directory listing.
+func (m *model) exitDeepSearch() tea.Cmd {
+	if m.deepCancel != nil {
+		m.deepCancel()
+		m.deepCancel = nil
 	}
-
-	if highlighted := highlight(path, text); highlighted != "" {
-		if n == maxPreviewBytes {
-			highlighted += "\n\n... preview truncated ..."
-		}
-		return highlighted, nil
+	m.deepSearch = false
+	m.deepRunning = false
+	if err := m.changeDir(m.cwd); err != nil {
+		m.setError(err.Error())
 	}
+	return m.requestPreview()
+}
 
-	if n == maxPreviewBytes {
-		text += "\n\n... preview truncated ..."
+// openSelected enters the selected directory, expanding it instead in tree
+// view, or refreshes the selected file's preview. In deep search it opens the
+// match where it lives.
+func (m *model) openSelected() tea.Cmd {
+	if len(m.entries) == 0 {
+		return nil
 	}
-	return text, nil
+	if m.deepSearch {
+		return m.openDeepResult()
+	}
+	picked := m.entries[m.selected]
+	if picked.isDir && m.treeMode && !m.searching {
+		m.expandSelected()
+	} else if picked.isDir {
+		if err := m.changeDir(picked.path); err != nil {
+			m.setError(err.Error())
+		}
+	}
+	return m.requestPreview()
 }
 
-func buildDirPreview(path string) (string, error) {
-	entries, err := os.ReadDir(path)
-	if err != nil {
-		return "", err
+// openDeepResult leaves deep search in the selected match's directory with
+// the match selected.
+func (m *model) openDeepResult() tea.Cmd {
+	if len(m.entries) == 0 {
+		return nil
 	}
-
-	// Styled directory preview
-	dirStyle := lipgloss.NewStyle().Foreground(clrDir).Bold(true)
-	mutedStyle := lipgloss.NewStyle().Foreground(clrMuted)
-	dimStyle := lipgloss.NewStyle().Foreground(clrDim)
-
-	var sb strings.Builder
-	sb.WriteString(dirStyle.Render(fileIconExt(catDir, "")+filepath.Base(path)+"/") + "\n")
-	sb.WriteString(mutedStyle.Render(fmt.Sprintf("  %d items", len(entries))) + "\n")
-	sb.WriteString(dimStyle.Render("  "+strings.Repeat("─", 30)) + "\n\n")
-
-	limit := min(len(entries), maxDirPreview)
-	for i := 0; i < limit; i++ {
-		e := entries[i]
-		name := e.Name()
-		fakeEntry := entry{name: name, isDir: e.IsDir()}
-		var line string
-		if e.IsDir() {
-			line = entryNameStyle(fakeEntry).Render("  " + fileIconExt(catDir, "") + name + "/")
-		} else {
-			// Categorise by name only (no stat for speed).
-			cat := categorise(fakeEntry)
-			col := entryNameStyle(fakeEntry)
-			line = col.Render("  " + fileIconExt(cat, filepath.Ext(name)) + name)
-		}
-		sb.WriteString(line + "\n")
+	path := m.entries[m.selected].path
+	if m.deepCancel != nil {
+		m.deepCancel()
+		m.deepCancel = nil
 	}
-	if len(entries) > limit {
-		sb.WriteString(mutedStyle.Render(fmt.Sprintf("\n  … and %d more", len(entries)-limit)) + "\n")
+	m.deepSearch = false
+	m.deepRunning = false
+	if err := m.changeDir(filepath.Dir(path)); err != nil {
+		m.setError(err.Error())
+		return nil
 	}
-
-	return strings.TrimRight(sb.String(), "\n"), nil
+	m.selectPath(path)
+	return m.requestPreview()
 }
 
-func imagePreview(path string, width, height int) (string, bool) {
-	f, err := os.Open(path)
-	if err != nil {
-		return "", false
+// nameSearch finds entries under root whose names contain query, using fd
+// when it is installed (which also honours .gitignore) and a pure-Go walk
+// otherwise. Result names are paths relative to root. The channel is closed
+// when the search finishes or ctx is cancelled.
+func nameSearch(ctx context.Context, root, query string, sensitive, showHidden bool, results chan<- []searchHit) {
+	defer close(results)
+	for _, name := range []string{"fd", "fdfind"} {
+		if bin, err := exec.LookPath(name); err == nil {
+			fdSearch(ctx, bin, root, query, sensitive, showHidden, results)
+			return
+		}
 	}
-	defer f.Close()
+	deepSearchWalk(ctx, root, query, sensitive, showHidden, results)
+}
 
-	img, _, err := image.Decode(f)
+// fdSearch streams fd's output, sending hits in batches of fdBatchSize.
+func fdSearch(ctx context.Context, bin, root, query string, sensitive, showHidden bool, results chan<- []searchHit) {
+	caseFlag := "--ignore-case"
+	if sensitive {
+		caseFlag = "--case-sensitive"
+	}
+	args := []string{"--fixed-strings", caseFlag, "--color", "never",
+		"--max-results", strconv.Itoa(maxDeepSearchResults)}
+	if showHidden {
+		args = append(args, "--hidden")
+	} else {
+		for _, pattern := range userConfig.hidden {
+			args = append(args, "--exclude", pattern)
+		}
+	}
+	args = append(args, "--", query)
+	cmd := exec.CommandContext(ctx, bin, args...)
+	cmd.Dir = root
+	out, err := cmd.StdoutPipe()
 	if err != nil {
-		return "", false
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		return
 	}
+	defer cmd.Wait()
 
-	rendered := renderImageASCII(img, width, height)
-	if rendered == "" {
-		return "", false
+	var batch []searchHit
+	flush := func() bool {
+		if len(batch) == 0 {
+			return true
+		}
+		select {
+		case results <- batch:
+			batch = nil
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		rel := strings.TrimPrefix(strings.TrimRight(scanner.Text(), "/"+string(filepath.Separator)), "./")
+		if rel == "" {
+			continue
+		}
+		full := filepath.Join(root, rel)
+		info, err := os.Lstat(full)
+		if err != nil {
+			continue
+		}
+		batch = append(batch, searchHit{entry: entry{
+			name:    rel,
+			path:    full,
+			isDir:   info.IsDir(),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		}})
+		if len(batch) >= fdBatchSize && !flush() {
+			return
+		}
 	}
-	return rendered, true
+	flush()
 }
 
-func renderMarkdownPreview(markdown string, width int, truncated bool) string {
-	prepared := replaceMermaidFences(markdown)
-	rendered := prepared
-	r, err := glamour.NewTermRenderer(
-		glamour.WithStandardStyle("tokyo-night"),
-		glamour.WithWordWrap(max(24, width-2)),
-		glamour.WithTableWrap(true),
-		glamour.WithEmoji(),
+// deepSearchWalk reads directories with a fixed pool of workers, sending one
+// batch of matches per directory.
+func deepSearchWalk(ctx context.Context, root, query string, sensitive, showHidden bool, results chan<- []searchHit) {
+	if !sensitive {
+		query = strings.ToLower(query)
+	}
+
+	var (
+		mu      sync.Mutex
+		cond    = sync.NewCond(&mu)
+		queue   = []string{root}
+		pending = 1 // directories queued or being read
+		found   atomic.Int64
 	)
-	if err == nil {
-		if out, renderErr := r.Render(prepared); renderErr == nil {
-			rendered = out
+	stop := context.AfterFunc(ctx, func() {
+		mu.Lock()
+		cond.Broadcast()
+		mu.Unlock()
+	})
+	defer stop()
+
+	worker := func() {
+		for {
+			mu.Lock()
+			for len(queue) == 0 && pending > 0 && ctx.Err() == nil {
+				cond.Wait()
+			}
+			if len(queue) == 0 || ctx.Err() != nil {
+				mu.Unlock()
+				return
+			}
+			dir := queue[len(queue)-1]
+			queue = queue[:len(queue)-1]
+			mu.Unlock()
+
+			items, _ := os.ReadDir(dir)
+			var batch []searchHit
+			var subdirs []string
+			for _, item := range items {
+				name := item.Name()
+				if !showHidden && isHiddenDirEntry(item) {
+					continue
+				}
+				full := filepath.Join(dir, name)
+				if item.IsDir() {
+					subdirs = append(subdirs, full)
+				}
+				match := name
+				if !sensitive {
+					match = strings.ToLower(name)
+				}
+				if !strings.Contains(match, query) {
+					continue
+				}
+				info, err := item.Info()
+				if err != nil {
+					continue
+				}
+				rel, _ := filepath.Rel(root, full)
+				batch = append(batch, searchHit{entry: entry{
+					name:    rel,
+					path:    full,
+					isDir:   item.IsDir(),
+					size:    info.Size(),
+					modTime: info.ModTime(),
+				}})
+			}
+			if len(batch) > 0 && found.Add(int64(len(batch))) <= maxDeepSearchResults {
+				select {
+				case results <- batch:
+				case <-ctx.Done():
+				}
+			}
+
+			mu.Lock()
+			if found.Load() < maxDeepSearchResults {
+				queue = append(queue, subdirs...)
+				pending += len(subdirs)
+			}
+			pending--
+			cond.Broadcast()
+			mu.Unlock()
 		}
 	}
 
-	if truncated {
-		rendered += "\n\n... preview truncated ..."
+	var wg sync.WaitGroup
+	for range deepSearchWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker()
+		}()
 	}
-
-	return rendered
+	wg.Wait()
 }
 
-// ── JSON renderer ─────────────────────────────────────────────────────────────
+// ── content search ────────────────────────────────────────────────────────────
 
-// JSON color tokens
-var (
-	jsonKey     = lipgloss.NewStyle().Foreground(lipgloss.Color("147"))            // periwinkle – keys
-	jsonStr     = lipgloss.NewStyle().Foreground(lipgloss.Color("114"))            // sage green – string values
-	jsonNum     = lipgloss.NewStyle().Foreground(lipgloss.Color("222"))            // pale gold – numbers
-	jsonBool    = lipgloss.NewStyle().Foreground(lipgloss.Color("215")).Bold(true) // amber – booleans
-	jsonNull    = lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Bold(true) // dim – null
-	jsonBracket = lipgloss.NewStyle().Foreground(lipgloss.Color("244"))            // grey – brackets
-	jsonMuted   = lipgloss.NewStyle().Foreground(lipgloss.Color("240"))            // dim – punctuation / ellipsis
+const (
+	grepContextLines      = 2
+	maxGrepMatchesPerFile = 50
+	maxGrepFileBytes      = 4 * 1024 * 1024
 )
 
-func renderJSONPreview(text string, truncated bool) string {
-	// Parse into a generic value
-	var v interface{}
-	if err := json.Unmarshal([]byte(strings.TrimSpace(text)), &v); err != nil {
-		// Not valid JSON — show the error and fall back to raw text
-		errStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("203"))
-		return errStyle.Render("  invalid JSON: "+err.Error()) + "\n\n" + text
-	}
-
-	var sb strings.Builder
-	writeJSON(&sb, v, 0)
-	out := sb.String()
+type grepLine struct {
+	num   int
+	text  string
+	match bool
+}
 
-	if truncated {
-		out += "\n" + jsonMuted.Render("  … file truncated, showing partial parse")
+func countGrepMatches(lines []grepLine) int {
+	n := 0
+	for _, l := range lines {
+		if l.match {
+			n++
+		}
 	}
-	return out
+	return n
 }
 
-// writeJSON recursively pretty-prints a JSON value with colour.
-func writeJSON(sb *strings.Builder, v interface{}, depth int) {
-	indent := strings.Repeat("  ", depth)
-	childIndent := strings.Repeat("  ", depth+1)
+// grepSearch finds files under root containing query with ripgrep when it is
+// installed, or a pure-Go walk otherwise, matching case only when sensitive.
+func grepSearch(ctx context.Context, root, query string, sensitive, showHidden bool, results chan<- []searchHit) {
+	defer close(results)
+	if _, err := exec.LookPath("rg"); err == nil {
+		ripgrepSearch(ctx, root, query, sensitive, showHidden, results)
+		return
+	}
+	goGrepSearch(ctx, root, query, sensitive, showHidden, results)
+}
 
-	switch val := v.(type) {
-	case map[string]interface{}:
-		if len(val) == 0 {
-			sb.WriteString(jsonBracket.Render("{}"))
-			return
+// ripgrepSearch streams `rg --json` output, emitting one hit per file when
+// ripgrep reports the end of that file's matches.
+func ripgrepSearch(ctx context.Context, root, query string, sensitive, showHidden bool, results chan<- []searchHit) {
+	caseFlag := "--ignore-case"
+	if sensitive {
+		caseFlag = "--case-sensitive"
+	}
+	args := []string{"--json", caseFlag, "--fixed-strings",
+		"--context", strconv.Itoa(grepContextLines),
+		"--max-count", strconv.Itoa(maxGrepMatchesPerFile),
+		"--max-filesize", strconv.Itoa(maxGrepFileBytes)}
+	if showHidden {
+		args = append(args, "--hidden")
+	} else {
+		for _, pattern := range userConfig.hidden {
+			args = append(args, "--glob", "!"+pattern)
 		}
-		sb.WriteString(jsonBracket.Render("{") + "\n")
-		// Sort keys for deterministic output
-		keys := make([]string, 0, len(val))
-		for k := range val {
-			keys = append(keys, k)
+	}
+	args = append(args, "--", query, ".")
+	cmd := exec.CommandContext(ctx, "rg", args...)
+	cmd.Dir = root
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		return
+	}
+	defer cmd.Wait()
+
+	type rgText struct {
+		Text string `json:"text"`
+	}
+	var event struct {
+		Type string `json:"type"`
+		Data struct {
+			Path       rgText `json:"path"`
+			Lines      rgText `json:"lines"`
+			LineNumber int    `json:"line_number"`
+		} `json:"data"`
+	}
+	var lines []grepLine
+	scanner := bufio.NewScanner(out)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		event.Type = ""
+		if json.Unmarshal(scanner.Bytes(), &event) != nil {
+			continue
 		}
-		sort.Strings(keys)
-		for i, k := range keys {
-			sb.WriteString(childIndent)
-			sb.WriteString(jsonKey.Render(`"` + k + `"`))
-			sb.WriteString(jsonMuted.Render(": "))
-			writeJSON(sb, val[k], depth+1)
-			if i < len(keys)-1 {
-				sb.WriteString(jsonMuted.Render(","))
+		switch event.Type {
+		case "begin":
+			lines = nil
+		case "match", "context":
+			lines = append(lines, grepLine{
+				num:   event.Data.LineNumber,
+				text:  strings.TrimRight(event.Data.Lines.Text, "\r\n"),
+				match: event.Type == "match",
+			})
+		case "end":
+			path := filepath.Join(root, event.Data.Path.Text)
+			if hit, ok := grepHit(root, path, lines); ok {
+				select {
+				case results <- []searchHit{hit}:
+				case <-ctx.Done():
+					return
+				}
 			}
-			sb.WriteString("\n")
 		}
-		sb.WriteString(indent + jsonBracket.Render("}"))
+	}
+}
 
-	case []interface{}:
-		if len(val) == 0 {
-			sb.WriteString(jsonBracket.Render("[]"))
-			return
+// goGrepSearch is the fallback when ripgrep is unavailable. It skips binary
+// and very large files.
+func goGrepSearch(ctx context.Context, root, query string, sensitive, showHidden bool, results chan<- []searchHit) {
+	needle := query
+	fold := !sensitive
+	if fold {
+		needle = strings.ToLower(query)
+	}
+	filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
-		sb.WriteString(jsonBracket.Render("[") + "\n")
-		// Cap array preview at 100 items to avoid enormous output
-		limit := len(val)
-		capped := false
-		if limit > 100 {
-			limit = 100
-			capped = true
+		if err != nil {
+			return nil
 		}
-		for i := 0; i < limit; i++ {
-			sb.WriteString(childIndent)
-			writeJSON(sb, val[i], depth+1)
-			if i < len(val)-1 {
-				sb.WriteString(jsonMuted.Render(","))
+		if path != root && !showHidden && isHiddenDirEntry(d) {
+			if d.IsDir() {
+				return filepath.SkipDir
 			}
-			sb.WriteString("\n")
+			return nil
 		}
-		if capped {
-			sb.WriteString(childIndent + jsonMuted.Render(fmt.Sprintf("… %d more items", len(val)-limit)) + "\n")
+		if !d.Type().IsRegular() {
+			return nil
 		}
-		sb.WriteString(indent + jsonBracket.Render("]"))
-
-	case string:
-		// Escape double quotes inside the string for display
-		escaped := strings.ReplaceAll(val, `"`, `\"`)
-		sb.WriteString(jsonStr.Render(`"` + escaped + `"`))
-
-	case float64:
-		// Render as integer when there's no fractional part
-		if val == float64(int64(val)) {
-			sb.WriteString(jsonNum.Render(fmt.Sprintf("%d", int64(val))))
-		} else {
-			sb.WriteString(jsonNum.Render(fmt.Sprintf("%g", val)))
+		if info, err := d.Info(); err != nil || info.Size() > maxGrepFileBytes {
+			return nil
 		}
-
-	case bool:
-		if val {
-			sb.WriteString(jsonBool.Render("true"))
-		} else {
-			sb.WriteString(jsonBool.Render("false"))
+		data, err := os.ReadFile(path)
+		if err != nil || isLikelyBinary(data[:min(len(data), 8192)]) {
+			return nil
 		}
+		lines := grepText(string(data), needle, fold)
+		if hit, ok := grepHit(root, path, lines); ok {
+			select {
+			case results <- []searchHit{hit}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+}
 
-	case nil:
-		sb.WriteString(jsonNull.Render("null"))
-
-	default:
-		sb.WriteString(fmt.Sprintf("%v", val))
+// grepText returns the lines of text containing needle, each with up to
+// grepContextLines lines of context on either side.
+func grepText(text, needle string, fold bool) []grepLine {
+	all := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	keep := make(map[int]bool)
+	matches := 0
+	for i, line := range all {
+		if fold {
+			line = strings.ToLower(line)
+		}
+		if !strings.Contains(line, needle) {
+			continue
+		}
+		keep[i] = true
+		if matches++; matches >= maxGrepMatchesPerFile {
+			break
+		}
 	}
+	if len(keep) == 0 {
+		return nil
+	}
+	shown := make(map[int]bool)
+	for i := range keep {
+		for j := max(0, i-grepContextLines); j <= min(len(all)-1, i+grepContextLines); j++ {
+			shown[j] = true
+		}
+	}
+	var lines []grepLine
+	for i := range all {
+		if shown[i] {
+			lines = append(lines, grepLine{num: i + 1, text: all[i], match: keep[i]})
+		}
+	}
+	return lines
 }
 
-func renderImageASCII(img image.Image, width, height int) string {
-	b := img.Bounds()
-	if b.Dx() <= 0 || b.Dy() <= 0 {
-		return ""
+func grepHit(root, path string, lines []grepLine) (searchHit, bool) {
+	if countGrepMatches(lines) == 0 {
+		return searchHit{}, false
 	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return searchHit{}, false
+	}
+	rel, _ := filepath.Rel(root, path)
+	return searchHit{
+		entry: entry{name: rel, path: path, size: info.Size(), modTime: info.ModTime()},
+		lines: lines,
+	}, true
+}
 
-	outW := max(16, width-2)
-	outH := max(8, height-3)
-
-	if supportsTrueColor() {
-		return renderImageTrueColor(img, outW, outH)
+// formatGrepLines renders a file's matches with line numbers, dimming context
+// lines, highlighting the query, and marking gaps between groups.
+func formatGrepLines(lines []grepLine, query string, sensitive bool) string {
+	numStyle := lipgloss.NewStyle().Foreground(clrMuted)
+	contextStyle := lipgloss.NewStyle().Foreground(clrMuted)
+	matchStyle := lipgloss.NewStyle().Foreground(clrFile)
+	hitStyle := lipgloss.NewStyle().Background(clrAccent).Foreground(clrAccentFg).Bold(true)
+	gapStyle := lipgloss.NewStyle().Foreground(clrDim)
+
+	width := len(strconv.Itoa(lines[len(lines)-1].num))
+	var b strings.Builder
+	for i, l := range lines {
+		if i > 0 && l.num != lines[i-1].num+1 {
+			b.WriteString(gapStyle.Render(strings.Repeat(" ", width)+" ┈") + "\n")
+		}
+		text := strings.ReplaceAll(l.text, "\t", "    ")
+		num := numStyle.Render(fmt.Sprintf("%*d", width, l.num))
+		if !l.match {
+			b.WriteString(num + " " + contextStyle.Render(text) + "\n")
+			continue
+		}
+		b.WriteString(num + lipgloss.NewStyle().Foreground(clrAccent).Render("▌") +
+			highlightQuery(text, query, sensitive, matchStyle, hitStyle) + "\n")
 	}
-	return renderImageGray(img, outW, outH)
+	return strings.TrimRight(b.String(), "\n")
 }
 
-func rgbValues(c color.Color) (int, int, int) {
-	r, g, b, _ := c.RGBA()
-	return int(r >> 8), int(g >> 8), int(b >> 8)
+// highlightQuery styles each occurrence of query in text.
+func highlightQuery(text, query string, sensitive bool, base, hit lipgloss.Style) string {
+	haystack := text
+	needle := query
+	if !sensitive {
+		haystack = strings.ToLower(text)
+		needle = strings.ToLower(query)
+	}
+	if needle == "" || len(haystack) != len(text) {
+		return base.Render(text)
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(haystack, needle)
+		if i < 0 {
+			b.WriteString(base.Render(text))
+			return b.String()
+		}
+		b.WriteString(base.Render(text[:i]) + hit.Render(text[i:i+len(needle)]))
+		text, haystack = text[i+len(needle):], haystack[i+len(needle):]
+	}
 }
 
-func renderImageTrueColor(img image.Image, outW, outH int) string {
-	b := img.Bounds()
-	scaledH := outH * 2
+// ── quick filters ─────────────────────────────────────────────────────────────
 
-	var sb strings.Builder
-	for row := 0; row < outH; row++ {
-		upperY := b.Min.Y + ((row*2)*(b.Dy()-1))/max(1, scaledH-1)
-		lowerY := b.Min.Y + ((row*2+1)*(b.Dy()-1))/max(1, scaledH-1)
+// quickFilter narrows the listing to one kind of entry. Active kind filters
+// combine as a union; "modified today" further restricts that set.
+type quickFilter struct {
+	key   string
+	label string
+	kind  bool // false for restrictions applied on top of the kind filters
+	match func(e entry) bool
+}
 
-		lastFgR, lastFgG, lastFgB := -1, -1, -1
-		lastBgR, lastBgG, lastBgB := -1, -1, -1
+var quickFilterDefs = []quickFilter{
+	{key: "d", label: "directories", kind: true, match: func(e entry) bool { return e.isDir }},
+	{key: "i", label: "images", kind: true, match: func(e entry) bool { return categorise(e) == catImage }},
+	{key: "c", label: "code", kind: true, match: func(e entry) bool { return categorise(e) == catCode }},
+	{key: "o", label: "documents", kind: true, match: func(e entry) bool { return categorise(e) == catDoc }},
+	{key: "t", label: "modified today", match: func(e entry) bool {
+		y1, m1, d1 := e.modTime.Date()
+		y2, m2, d2 := time.Now().Date()
+		return y1 == y2 && m1 == m2 && d1 == d2
+	}},
+}
 
-		for x := 0; x < outW; x++ {
-			sx := b.Min.X + (x*(b.Dx()-1))/max(1, outW-1)
-			fgR, fgG, fgB := rgbValues(img.At(sx, upperY))
-			bgR, bgG, bgB := rgbValues(img.At(sx, lowerY))
+func (m model) applyQuickFilters(entries []entry) []entry {
+	if len(m.quickFilters) == 0 {
+		return entries
+	}
+	var out []entry
+	for _, e := range entries {
+		kindSet, kindMatch, ok := false, false, true
+		for _, f := range quickFilterDefs {
+			if !m.quickFilters[f.key] {
+				continue
+			}
+			if f.kind {
+				kindSet = true
+				kindMatch = kindMatch || f.match(e)
+			} else if !f.match(e) {
+				ok = false
+			}
+		}
+		if ok && (!kindSet || kindMatch) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
 
-			if fgR != lastFgR || fgG != lastFgG || fgB != lastFgB || bgR != lastBgR || bgG != lastBgG || bgB != lastBgB {
-				writeTrueColorANSI(&sb, fgR, fgG, fgB, bgR, bgG, bgB)
-				lastFgR, lastFgG, lastFgB = fgR, fgG, fgB
-				lastBgR, lastBgG, lastBgB = bgR, bgG, bgB
+func (m model) activeFilterLabels() []string {
+	var labels []string
+	for _, f := range quickFilterDefs {
+		if m.quickFilters[f.key] {
+			labels = append(labels, f.label)
+		}
+	}
+	return labels
+}
+
+// updateFilterMenu toggles filters by key; the listing updates live.
+func (m *model) updateFilterMenu(msg tea.KeyMsg) tea.Cmd {
+	switch key := msg.String(); key {
+	case "esc", "enter", "f", "q":
+		m.showFilterMenu = false
+		return nil
+	case "x":
+		m.quickFilters = make(map[string]bool)
+	default:
+		found := false
+		for _, f := range quickFilterDefs {
+			if f.key == key {
+				found = true
 			}
-			sb.WriteRune('▀')
 		}
+		if !found {
+			return nil
+		}
+		if m.quickFilters[key] {
+			delete(m.quickFilters, key)
+		} else {
+			m.quickFilters[key] = true
+		}
+	}
+	m.entries = m.applySearch(m.allEntries)
+	m.selected = 0
+	m.previewOffset = 0
+	m.previewColumn = 0
+	if labels := m.activeFilterLabels(); len(labels) > 0 {
+		m.status = "only " + strings.Join(labels, ", ")
+	} else {
+		m.status = "filters cleared"
+	}
+	return m.requestPreview()
+}
 
-		sb.WriteString("\x1b[0m")
-		if row < outH-1 {
-			sb.WriteByte('\n')
+func (m model) renderFilterMenu(width, height int) string {
+	titleStyle := lipgloss.NewStyle().Foreground(clrTitle).Bold(true)
+	mutedStyle := lipgloss.NewStyle().Foreground(clrMuted)
+	keyStyle := lipgloss.NewStyle().Foreground(clrHintKey).Bold(true)
+	onStyle := lipgloss.NewStyle().Foreground(clrAccent).Bold(true)
+
+	lines := []string{titleStyle.Render("Filter"), ""}
+	for _, f := range quickFilterDefs {
+		box := mutedStyle.Render("[ ]")
+		label := lipgloss.NewStyle().Foreground(clrFile).Render(f.label)
+		if m.quickFilters[f.key] {
+			box = onStyle.Render("[x]")
+			label = onStyle.Render(f.label)
 		}
+		lines = append(lines, keyStyle.Render(f.key)+"  "+box+" "+label)
 	}
+	lines = append(lines, "", mutedStyle.Render("key toggles  ·  x clear  ·  esc close"))
 
-	return sb.String()
+	box := lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(clrBorderStrong).
+		Padding(1, 3).
+		Render(strings.Join(lines, "\n"))
+	return centerOverlay(box, width, height)
 }
 
-func renderImageGray(img image.Image, outW, outH int) string {
-	b := img.Bounds()
-	chars := []rune(" .:-=+*#%@")
+// ── fuzzy matching ────────────────────────────────────────────────────────────
+
+// fuzzyScore matches query against s as a subsequence (case-insensitive
+// unless caseSensitive) and scores the match: consecutive runs, word-boundary
+// hits (after _-. or a space, or a camelCase hump), and an early first match
+// rank higher, and a plain substring beats any scattered match.
+func fuzzyScore(query, s string, caseSensitive bool) (int, bool) {
+	rs := []rune(s)
+	qs, folded := []rune(query), rs
+	if !caseSensitive {
+		qs = []rune(strings.ToLower(query))
+		folded = []rune(strings.ToLower(s))
+	}
+	if len(qs) == 0 {
+		return 0, true
+	}
 
-	var sb strings.Builder
-	for y := 0; y < outH; y++ {
-		sy := b.Min.Y + (y*(b.Dy()-1))/max(1, outH-1)
-		for x := 0; x < outW; x++ {
-			sx := b.Min.X + (x*(b.Dx()-1))/max(1, outW-1)
-			lum := luminance(img.At(sx, sy))
-			idx := int(lum * float64(len(chars)-1) / 255.0)
-			if idx < 0 {
-				idx = 0
+	score, qi, prev, first := 0, 0, -2, -1
+	for i := 0; i < len(folded) && qi < len(qs); i++ {
+		if folded[i] != qs[qi] {
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		score++
+		if i == prev+1 {
+			score += 5
+		}
+		if i == 0 || strings.ContainsRune("_-. /", rs[i-1]) ||
+			(unicode.IsUpper(rs[i]) && unicode.IsLower(rs[i-1])) {
+			score += 8
+		}
+		prev = i
+		qi++
+	}
+	if qi < len(qs) {
+		return 0, false
+	}
+	score -= min(first, 10)
+	if strings.Contains(string(folded), string(qs)) {
+		score += 20
+	}
+	return score, true
+}
+
+// ── prompt ────────────────────────────────────────────────────────────────────
+
+// openPrompt starts an inline prompt pre-filled with value.
+func (m *model) openPrompt(kind promptKind, value, target string) {
+	m.prompt = kind
+	m.promptValue = value
+	m.promptTarget = target
+}
+
+func (m *model) closePrompt() {
+	if m.prompt == promptPermanentDelete {
+		m.deleteTargets = nil
+	}
+	m.prompt = promptNone
+	m.promptValue = ""
+	m.promptTarget = ""
+	m.promptCompletions = nil
+}
+
+// updatePrompt edits the prompt input; enter submits and esc cancels.
+func (m *model) updatePrompt(msg tea.KeyMsg) tea.Cmd {
+	if msg.String() == "tab" && m.prompt == promptGoto {
+		m.promptValue, m.promptCompletions = completePath(m.cwd, m.promptValue)
+		return nil
+	}
+	m.promptCompletions = nil
+	switch msg.String() {
+	case "esc", "ctrl+c":
+		m.closePrompt()
+		m.status = "cancelled"
+		return nil
+	case "enter":
+		return m.submitPrompt()
+	case "backspace":
+		if runes := []rune(m.promptValue); len(runes) > 0 {
+			m.promptValue = string(runes[:len(runes)-1])
+		}
+		return nil
+	case "ctrl+u":
+		m.promptValue = ""
+		return nil
+	}
+	if msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace {
+		m.promptValue += string(msg.Runes)
+	}
+	return nil
+}
+
+// submitPrompt dispatches the finished input to the action that opened the
+// prompt. The prompt is closed unless the action reports a fixable error.
+func (m *model) submitPrompt() tea.Cmd {
+	value := m.promptValue
+	target := m.promptTarget
+	switch m.prompt {
+	case promptPermanentDelete:
+		if strings.TrimSpace(value) != m.permanentDeleteConfirmation() {
+			m.setError("confirmation does not match")
+			return nil
+		}
+		cmd := m.deletePermanently()
+		m.closePrompt()
+		return cmd
+	case promptRename:
+		newName, err := m.renameEntry(target, value)
+		if err != nil {
+			m.setError("rename: " + err.Error())
+			return nil
+		}
+		m.closePrompt()
+		m.status = "renamed to " + newName
+		return m.requestPreview()
+	case promptGoto:
+		if err := m.goToPath(value); err != nil {
+			m.setError("go to: " + err.Error())
+			return nil
+		}
+		m.closePrompt()
+		return m.requestPreview()
+	case promptFind:
+		if strings.TrimSpace(value) == "" {
+			m.status = "find: enter part of a file name"
+			return nil
+		}
+		m.closePrompt()
+		return m.startDeepSearch(strings.TrimSpace(value), false)
+	case promptGrep:
+		if strings.TrimSpace(value) == "" {
+			m.status = "grep: enter text to search for"
+			return nil
+		}
+		m.closePrompt()
+		return m.startDeepSearch(value, true)
+	case promptJSONQuery:
+		m.closePrompt()
+		return m.applyJSONQuery(value, target)
+	case promptPreviewSearch:
+		m.closePrompt()
+		m.startPreviewSearch(value, target)
+		return nil
+	case promptArchive:
+		cmd, err := m.compress(value)
+		if err != nil {
+			m.setError("archive: " + err.Error())
+			return nil
+		}
+		m.closePrompt()
+		return cmd
+	}
+	m.closePrompt()
+	return nil
+}
+
+// goToPath changes to the directory named by input (absolute, ~-relative, or
+// relative to cwd). A file path opens its directory with the file selected.
+func (m *model) goToPath(input string) error {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return errors.New("enter a path")
+	}
+	path := expandHome(input)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(m.cwd, path)
+	}
+	path = filepath.Clean(path)
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return m.changeDir(path)
+	}
+	if err := m.changeDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	m.selectName(filepath.Base(path))
+	return nil
+}
+
+// completePath extends input to the longest common prefix of the matching
+// entries in its directory. A unique directory match gets a trailing slash.
+// When several entries match, their names are returned as candidates.
+func completePath(cwd, input string) (string, []string) {
+	dirPart, prefix := "", input
+	if i := strings.LastIndex(input, "/"); i >= 0 {
+		dirPart, prefix = input[:i+1], input[i+1:]
+	} else if input == "~" {
+		return "~/", nil
+	}
+	dir := expandHome(dirPart)
+	if dir == "" {
+		dir = "."
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(cwd, dir)
+	}
+	items, err := os.ReadDir(dir)
+	if err != nil {
+		return input, nil
+	}
+
+	var matches []string
+	for _, item := range items {
+		name := item.Name()
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if strings.HasPrefix(name, ".") && !strings.HasPrefix(prefix, ".") {
+			continue
+		}
+		if item.IsDir() || isDirSymlink(filepath.Join(dir, name), item) {
+			name += "/"
+		}
+		matches = append(matches, name)
+	}
+	switch len(matches) {
+	case 0:
+		return input, nil
+	case 1:
+		return dirPart + matches[0], nil
+	}
+	common := matches[0]
+	for _, name := range matches[1:] {
+		for !strings.HasPrefix(name, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	for !utf8.ValidString(common) {
+		common = common[:len(common)-1]
+	}
+	sort.Strings(matches)
+	return dirPart + common, matches
+}
+
+func isDirSymlink(path string, item os.DirEntry) bool {
+	if item.Type()&os.ModeSymlink == 0 {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// ── file operations ───────────────────────────────────────────────────────────
+
+// permanentDeleteConfirmation is the text the user must type to confirm a
+// permanent delete: the file name, or the item count for a marked batch.
+func (m model) permanentDeleteConfirmation() string {
+	if len(m.deleteTargets) == 1 {
+		return filepath.Base(m.deleteTargets[0])
+	}
+	return strconv.Itoa(len(m.deleteTargets))
+}
+
+// deletePermanently starts a job removing every delete target.
+func (m *model) deletePermanently() tea.Cmd {
+	paths := m.deleteTargets
+	m.deleteTargets = nil
+	for _, path := range paths {
+		delete(m.marked, path)
+	}
+	return m.startJob("delete "+countNoun(len(paths), "item")+" permanently", deleteJob(paths))
+}
+
+// deleteJob removes paths and everything beneath them, counting the bytes
+// freed as progress.
+func deleteJob(paths []string) jobFunc {
+	return func(ctx context.Context, j *job) (string, error) {
+		removed := 0
+		var lastErr error
+		for _, path := range paths {
+			if err := removeTree(ctx, j, path); err != nil {
+				if ctx.Err() != nil {
+					return "", ctx.Err()
+				}
+				lastErr = err
+				continue
 			}
-			if idx >= len(chars) {
-				idx = len(chars) - 1
+			removed++
+		}
+		if lastErr != nil && removed > 0 {
+			return "", fmt.Errorf("deleted %d, %d failed: %v", removed, len(paths)-removed, lastErr)
+		}
+		return "", lastErr
+	}
+}
+
+// removeTree removes path like os.RemoveAll, but checks ctx before each entry
+// so a large tree can be cancelled part way.
+func removeTree(ctx context.Context, j *job, path string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		children, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		for _, c := range children {
+			if err := removeTree(ctx, j, filepath.Join(path, c.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if !info.IsDir() {
+		j.done.Add(info.Size())
+	}
+	return nil
+}
+
+// linkEntries creates symlinks in cwd to the yanked entries, or to the marked
+// entries when nothing is yanked. Relative links point via a path relative to
+// cwd so they survive moving the tree as a whole.
+func (m *model) linkEntries(relative bool) {
+	sources := m.register
+	if len(sources) == 0 && len(m.marked) > 0 {
+		sources = m.targetPaths()
+	}
+	if len(sources) == 0 {
+		m.status = "nothing yanked or marked to link"
+		return
+	}
+
+	linked := 0
+	var lastErr error
+	var lastName string
+	for _, src := range sources {
+		target := src
+		if relative {
+			rel, err := filepath.Rel(m.cwd, src)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			target = rel
+		}
+		dest := uniquePath(m.cwd, filepath.Base(src))
+		if err := os.Symlink(target, dest); err != nil {
+			lastErr = err
+			continue
+		}
+		lastName = filepath.Base(dest)
+		linked++
+	}
+
+	kind := "absolute"
+	if relative {
+		kind = "relative"
+	}
+	switch {
+	case lastErr != nil && linked == 0:
+		m.setError("link failed: " + lastErr.Error())
+	case lastErr != nil:
+		m.setError(fmt.Sprintf("linked %d, %d failed: %v", linked, len(sources)-linked, lastErr))
+	default:
+		m.status = fmt.Sprintf("created %d %s link(s)", linked, kind)
+	}
+	if linked > 0 {
+		if err := m.reloadEntries(); err != nil {
+			m.setError(err.Error())
+		}
+		m.selectName(lastName)
+	}
+}
+
+// confirmTrash asks before moving the selected or marked entries to the
+// trash.
+func (m *model) confirmTrash() tea.Cmd {
+	if len(m.entries) == 0 {
+		return nil
+	}
+	m.confirmingDelete = true
+	m.deleteTargets = m.targetPaths()
+	m.status = "confirm move to trash"
+	return nil
+}
+
+// renameSelected prompts for the selected entry's new name.
+func (m *model) renameSelected() tea.Cmd {
+	if len(m.entries) > 0 {
+		picked := m.entries[m.selected]
+		m.openPrompt(promptRename, picked.name, picked.path)
+	}
+	return nil
+}
+
+// renameEntry renames path to newName within the same directory and moves
+// the selection to the renamed entry.
+func (m *model) renameEntry(path, newName string) (string, error) {
+	newName = strings.TrimSpace(newName)
+	oldName := filepath.Base(path)
+	switch {
+	case newName == "":
+		return "", errors.New("name cannot be empty")
+	case newName == "." || newName == "..":
+		return "", fmt.Errorf("%q is not a valid name", newName)
+	case strings.ContainsRune(newName, filepath.Separator) || strings.ContainsRune(newName, '/'):
+		return "", errors.New("name cannot contain a path separator")
+	case newName == oldName:
+		return "", errors.New("name unchanged")
+	}
+
+	dest := filepath.Join(filepath.Dir(path), newName)
+	// A case-only rename finds the source itself on case-insensitive
+	// filesystems, so it is not a collision.
+	if !strings.EqualFold(newName, oldName) {
+		if _, err := os.Lstat(dest); err == nil {
+			return "", fmt.Errorf("%s already exists", newName)
+		}
+	}
+	if err := os.Rename(path, dest); err != nil {
+		return "", err
+	}
+
+	if err := m.reloadEntries(); err != nil {
+		return "", err
+	}
+	m.selectName(newName)
+	m.previewOffset = 0
+	m.previewColumn = 0
+	return newName, nil
+}
+
+// toggleMark flips the marked state of path.
+func (m *model) toggleMark(path string) {
+	if m.marked[path] {
+		delete(m.marked, path)
+	} else {
+		m.marked[path] = true
+	}
+}
+
+// targetPaths returns the entries an operation should act on: every marked
+// path (sorted), or the selected entry when nothing is marked.
+func (m model) targetPaths() []string {
+	if len(m.marked) > 0 {
+		paths := make([]string, 0, len(m.marked))
+		for path := range m.marked {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		return paths
+	}
+	if len(m.entries) == 0 {
+		return nil
+	}
+	return []string{m.entries[m.selected].path}
+}
+
+// reloadEntries re-reads the current directory, keeping the selection on the
+// same entry when it still exists.
+func (m *model) reloadEntries() error {
+	var prevPath string
+	if m.selected < len(m.entries) {
+		prevPath = m.entries[m.selected].path
+	}
+	var entries []entry
+	if m.deepSearch {
+		// Results are a snapshot of the tree; just drop vanished ones.
+		for _, e := range m.allEntries {
+			if _, err := os.Lstat(e.path); err == nil {
+				entries = append(entries, e)
+			}
+		}
+	} else {
+		var err error
+		if entries, err = m.loadEntries(m.cwd); err != nil {
+			return err
+		}
+	}
+	m.allEntries = entries
+	m.entries = m.applySearch(entries)
+	m.selectPath(prevPath)
+	m.vcsDir = "" // changes may have made the tree dirty or clean
+	m.gitIgnoreStale = true
+	if m.dualPane {
+		m.refreshOtherPane()
+	}
+	return nil
+}
+
+// selectPath moves the selection to the visible entry at path, or clamps the
+// current selection when it is gone.
+func (m *model) selectPath(path string) {
+	for i, e := range m.entries {
+		if e.path == path {
+			m.selected = i
+			return
+		}
+	}
+	if m.selected >= len(m.entries) {
+		m.selected = max(0, len(m.entries)-1)
+	}
+}
+
+// selectName moves the selection to the visible entry called name, or clamps
+// the current selection when it is gone.
+func (m *model) selectName(name string) {
+	for i, e := range m.entries {
+		if e.name == name {
+			m.selected = i
+			return
+		}
+	}
+	if m.selected >= len(m.entries) {
+		m.selected = max(0, len(m.entries)-1)
+	}
+}
+
+// cacheSet stores a preview result and evicts the oldest entry when the cache
+// exceeds previewCacheMax entries.
+func (m *model) cacheSet(key, value string) {
+	if _, exists := m.cache[key]; !exists {
+		m.cacheOrder = append(m.cacheOrder, key)
+	}
+	m.cache[key] = value
+	for len(m.cacheOrder) > previewCacheMax {
+		oldest := m.cacheOrder[0]
+		m.cacheOrder = m.cacheOrder[1:]
+		delete(m.cache, oldest)
+	}
+}
+
+// previewBuildSize is the pane size previews are built for.
+func (m model) previewBuildSize() (int, int) {
+	_, _, previewW, previewH := m.previewRect()
+	return max(40, previewW), max(8, previewH)
+}
+
+// prefetchRadius is how many entries either side of the selection have
+// their previews built ahead of time.
+const prefetchRadius = 2
+
+// prefetchSlots bounds how many prefetches build at once, so they don't
+// crowd out the preview actually being looked at.
+var prefetchSlots = make(chan struct{}, 2)
+
+// prefetchedMsg delivers a preview built ahead of time for the cache.
+type prefetchedMsg struct {
+	pending  string // key in m.prefetching
+	cacheKey string
+	content  string
+	err      error
+}
+
+// cheapPreview reports whether an entry's preview is a directory listing or
+// text rendered in-process, judged from its name alone. Media, images,
+// compressed files, man pages, diagrams and configured previewers all shell
+// out or decode far more than they show.
+func cheapPreview(e entry) bool {
+	if e.isDir {
+		return true
+	}
+	if !e.mode.IsRegular() {
+		return false
+	}
+	if _, ok := matchPreviewer(e.path); ok {
+		return false
+	}
+	for _, ext := range []string{strings.ToLower(filepath.Ext(e.name)), e.sniffed} {
+		if imageExts[ext] || audioExts[ext] || videoExts[ext] || compressedExts[ext] != "" {
+			return false
+		}
+		switch ext {
+		case ".svg", ".man", ".roff", ".puml", ".plantuml", ".d2":
+			return false
+		}
+		// Numbered sections may be man pages, which mandoc formats.
+		if len(ext) == 2 && ext[1] >= '0' && ext[1] <= '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// prefetchAdjacent warms the cache with the previews of the entries around
+// the selection, so moving to them shows them at once. Only directories and
+// text rendered in-process are built ahead; anything needing an external tool
+// or a media decoder waits until it is selected.
+func (m *model) prefetchAdjacent() tea.Cmd {
+	if m.hidePreview || len(m.entries) == 0 || m.gitLogView || m.gitBlameView || m.gitDiffView {
+		return nil
+	}
+	// Neighbours open with the plain view; zoom and follow belong to the
+	// selected file.
+	opts := m.previewOptions()
+	opts.zoom, opts.follow = imageZoom{}, false
+	width, height := m.previewBuildSize()
+
+	var cmds []tea.Cmd
+	for d := 1; d <= prefetchRadius; d++ {
+		for _, i := range []int{m.selected + d, m.selected - d} {
+			if i < 0 || i >= len(m.entries) {
+				continue
+			}
+			e := m.entries[i]
+			if !cheapPreview(e) {
+				continue
+			}
+			key := previewKey(e.path, e.modTime, e.size, width, height, opts)
+			if _, ok := m.cachedPreview(e, width, height, opts); ok || m.prefetching[key] {
+				continue
+			}
+			m.prefetching[key] = true
+			cmds = append(cmds, func() tea.Msg {
+				prefetchSlots <- struct{}{}
+				defer func() { <-prefetchSlots }()
+				content, sized, err := buildPreview(e.path, width, height, opts)
+				return prefetchedMsg{
+					pending:  key,
+					cacheKey: builtPreviewKey(e, width, height, opts, sized),
+					content:  content,
+					err:      err,
+				}
+			})
+		}
+	}
+	return tea.Batch(cmds...)
+}
+
+// requestPreview loads the selected entry's preview and, alongside it, any
+// directory item counts the list is still missing.
+func (m *model) requestPreview() tea.Cmd {
+	return tea.Batch(m.loadPreview(), m.requestDirCounts(), m.requestVCSStatus(), m.requestGitIgnored())
+}
+
+func (m *model) loadPreview() tea.Cmd {
+	m.scratch = ""
+	if len(m.entries) == 0 || m.hidePreview {
+		m.preview = ""
+		m.loading = false
+		return nil
+	}
+
+	picked := m.entries[m.selected]
+	if x := m.jsonExplorer; x != nil {
+		if x.path == picked.path {
+			m.renderJSONExplorer()
+			return nil
+		}
+		m.jsonExplorer = nil
+	}
+	if x := m.markdownLinks; x != nil {
+		if x.path == picked.path {
+			m.renderMarkdownLinks()
+			return nil
+		}
+		m.markdownLinks = nil
+	}
+	if o := m.markdownOutline; o != nil && o.path != picked.path {
+		m.markdownOutline = nil
+	}
+	if a := m.gifAnim; a != nil && a.path != picked.path {
+		m.gifAnim = nil // stops its tick loop
+	}
+	if z := m.imageZoom; z != nil && z.path != picked.path {
+		m.imageZoom = nil
+	}
+	if f := m.follow; f != nil && f.path != picked.path {
+		m.follow = nil // stops its tick loop
+	}
+	m.previewMore = nil
+	if m.previewSearch != "" && m.previewSearchPath != picked.path {
+		m.previewSearch, m.previewMatches = "", nil
+	}
+	if lines, ok := m.grepLines[picked.path]; ok && m.deepGrep {
+		// Content search results preview their matches, not the file.
+		m.requestID++
+		m.loading = false
+		m.preview = formatGrepLines(lines, m.deepQuery, m.deepSensitive)
+		m.scratch = fmt.Sprintf("%d matching lines", countGrepMatches(lines))
+		return nil
+	}
+	opts := m.previewOptions()
+	width, height := m.previewBuildSize()
+	animate := m.startGIF(picked, width, height)
+	if val, ok := m.cachedPreview(picked, width, height, opts); ok {
+		m.setPreview(val)
+		m.loading = false
+		return tea.Batch(animate, m.prefetchAdjacent())
+	}
+
+	m.requestID++
+	requestID := m.requestID
+	m.loading = true
+	m.loadingSince = time.Now()
+
+	return tea.Batch(animate, m.scheduleSpinnerTick(), func() tea.Msg {
+		content, sized, err := buildPreview(picked.path, width, height, opts)
+		return previewLoadedMsg{
+			requestID: requestID,
+			cacheKey:  builtPreviewKey(picked, width, height, opts, sized),
+			content:   content,
+			err:       err,
+		}
+	})
+}
+
+// spinnerFrames is the bubbles MiniDot spinner.
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+const spinnerInterval = time.Second / 12
+
+// scheduleSpinnerTick keeps a single animation tick alive while a preview is
+// loading.
+func (m *model) scheduleSpinnerTick() tea.Cmd {
+	if m.spinnerTicking || !m.loading {
+		return nil
+	}
+	m.spinnerTicking = true
+	return tea.Tick(spinnerInterval, func(time.Time) tea.Msg { return spinnerTickMsg{} })
+}
+
+// loadingText is the animated loading indicator, with the time spent so far
+// once a preview takes longer than a second.
+func (m model) loadingText(label string) string {
+	text := spinnerFrames[m.spinnerFrame%len(spinnerFrames)] + " " + label
+	if elapsed := time.Since(m.loadingSince); elapsed >= time.Second {
+		text += fmt.Sprintf(" %.1fs", elapsed.Seconds())
+	}
+	return lipgloss.NewStyle().Foreground(clrLoading).Render(text)
+}
+
+func (m *model) slicePreview(in string, h int) string {
+	if h <= 0 {
+		return ""
+	}
+	if head, body, ok := strings.Cut(in, "\n"+frozenPreviewMark+"\n"); ok {
+		// Keep the frozen header in view when there is room for any body.
+		headH := strings.Count(head, "\n") + 1
+		if headH < h {
+			return head + "\n" + m.slicePreview(body, h-headH)
+		}
+		in = head + "\n" + body
+	}
+	lines := strings.Split(in, "\n")
+	maxStart := max(0, len(lines)-h)
+	if m.previewOffset > maxStart {
+		m.previewOffset = maxStart
+	}
+	if m.previewOffset < 0 {
+		m.previewOffset = 0
+	}
+	start := m.previewOffset
+	end := min(len(lines), start+h)
+	return strings.Join(lines[start:end], "\n")
+}
+
+// setPreview shows rendered preview content, soft-wrapped if wrapping is on
+// for the file. Content led by tailPreviewMark opens scrolled to the end
+// unless the user has already scrolled.
+func (m *model) setPreview(content string) {
+	body, tail := strings.CutPrefix(content, tailPreviewMark+"\n")
+	if tail {
+		content = body
+	}
+	if i := strings.LastIndex(content, "\n"+followPreviewMark); i >= 0 {
+		if offset, err := strconv.ParseInt(content[i+1+len(followPreviewMark):], 10, 64); err == nil {
+			if f := m.follow; f != nil && len(m.entries) > 0 && m.entries[m.selected].path == f.path {
+				f.size = offset
+			}
+			content = content[:i]
+		}
+	}
+	m.previewMore = nil
+	if i := strings.LastIndex(content, "\n"+morePreviewMark); i >= 0 && len(m.entries) > 0 {
+		if offset, err := strconv.ParseInt(content[i+1+len(morePreviewMark):], 10, 64); err == nil {
+			m.previewMore = &previewStream{path: m.entries[m.selected].path, offset: offset}
+			content = content[:i]
+		}
+	}
+	if len(m.entries) > 0 && m.wrapPaths[m.entries[m.selected].path] {
+		// Wrapping the content itself keeps scrolling, line numbers and
+		// copying in step with what's on screen.
+		_, _, w, _ := m.previewRect()
+		content = ansi.Wrap(content, max(12, w-2), "")
+	}
+	if tail && m.previewOffset == 0 {
+		m.previewOffset = strings.Count(content, "\n")
+	}
+	m.preview = content
+	if m.previewSearch != "" {
+		m.previewMatches = findPreviewMatches(content, m.previewSearch)
+		m.previewMatch = min(m.previewMatch, max(0, len(m.previewMatches)-1))
+	}
+	if o := m.markdownOutline; o != nil && len(m.entries) > 0 && m.entries[m.selected].path == o.path {
+		o.base = m.preview
+		m.renderMarkdownOutline()
+	}
+	m.clampPreviewOffset()
+}
+
+// scrollPreview scrolls the preview by n lines, loading more of a long file
+// when scrolling down reaches its end.
+func (m *model) scrollPreview(n int) tea.Cmd {
+	m.previewOffset += n
+	m.clampPreviewOffset()
+	if n > 0 {
+		return m.loadMorePreview()
+	}
+	return nil
+}
+
+// listHalfPage is how far ctrl+d and ctrl+u move the selection in the list.
+func (m model) listHalfPage() int {
+	_, _, bodyH := m.layoutDimensions()
+	return max(1, (bodyH-3)/2)
+}
+
+func (m *model) clampPreviewOffset() {
+	if m.previewOffset < 0 {
+		m.previewOffset = 0
+	}
+	if m.preview == "" {
+		m.previewOffset = 0
+		return
+	}
+	lines := strings.Split(m.preview, "\n")
+	viewport := m.previewViewportHeight()
+	maxStart := max(0, len(lines)-viewport)
+	if m.previewOffset > maxStart {
+		m.previewOffset = maxStart
+	}
+}
+
+// scrollPreviewColumns scrolls the preview sideways by d cells, no further
+// than shows the end of its widest line.
+func (m *model) scrollPreviewColumns(d int) {
+	_, _, w, _ := m.previewRect()
+	widest := 0
+	for line := range strings.SplitSeq(m.preview, "\n") {
+		widest = max(widest, ansi.StringWidth(line))
+	}
+	m.previewColumn = max(0, min(m.previewColumn+d, widest-max(12, w-2)))
+}
+
+func (m model) previewViewportHeight() int {
+	bodyH := max(4, m.height-4)
+	return max(1, bodyH-4)
+}
+
+// ── content sniffing ──────────────────────────────────────────────────────────
+
+// sniffBytes is how much of a file is read to recognise it by its content.
+const sniffBytes = 512
+
+// maxSniffedEntries bounds how many files one listing reads to recognise
+// them, so huge directories still open quickly.
+const maxSniffedEntries = 2000
+
+// nameExts gives well-known extensionless file names the extension of their
+// format.
+var nameExts = map[string]string{
+	"makefile":      ".mk",
+	"gnumakefile":   ".mk",
+	"justfile":      ".mk",
+	"dockerfile":    ".dockerfile",
+	"containerfile": ".dockerfile",
+	"rakefile":      ".rb",
+	"gemfile":       ".rb",
+	"vagrantfile":   ".rb",
+	"jenkinsfile":   ".groovy",
+	"pkgbuild":      ".sh",
+}
+
+// interpreterExts maps the program named on a script's #! line to the
+// extension of its language.
+var interpreterExts = map[string]string{
+	"sh":     ".sh",
+	"bash":   ".sh",
+	"dash":   ".sh",
+	"ksh":    ".sh",
+	"zsh":    ".zsh",
+	"fish":   ".fish",
+	"python": ".py",
+	"node":   ".js",
+	"nodejs": ".js",
+	"deno":   ".ts",
+	"bun":    ".js",
+	"ruby":   ".rb",
+	"perl":   ".pl",
+	"lua":    ".lua",
+	"php":    ".php",
+}
+
+// imageMagic lists the leading bytes of the image formats the preview
+// decodes. BMP and WebP are checked separately: their signatures have gaps.
+var imageMagic = []struct {
+	prefix string
+	ext    string
+}{
+	{"\x89PNG\r\n\x1a\n", ".png"},
+	{"\xff\xd8\xff", ".jpg"},
+	{"GIF87a", ".gif"},
+	{"GIF89a", ".gif"},
+	{"II*\x00", ".tiff"},
+	{"MM\x00*", ".tiff"},
+}
+
+// sniffFile recognises the file at path by its name or its first bytes; see
+// sniffExt.
+func sniffFile(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	head := make([]byte, sniffBytes)
+	n, _ := io.ReadFull(f, head)
+	return sniffExt(filepath.Base(path), string(head[:n]))
+}
+
+// sniffExt returns the extension of the format name and head (the start of
+// the file) are in: a well-known file name, an image signature, or the
+// interpreter on a #! line. It returns "" when none of them match.
+func sniffExt(name, head string) string {
+	if ext, ok := nameExts[strings.ToLower(name)]; ok {
+		return ext
+	}
+	for _, m := range imageMagic {
+		if strings.HasPrefix(head, m.prefix) {
+			return m.ext
+		}
+	}
+	if len(head) >= 12 && head[:4] == "RIFF" && head[8:12] == "WEBP" {
+		return ".webp"
+	}
+	if len(head) >= 14 && head[:2] == "BM" && head[6:10] == "\x00\x00\x00\x00" {
+		return ".bmp" // "BM", file size, then reserved zeros
+	}
+	line, ok := strings.CutPrefix(head, "#!")
+	if !ok {
+		return ""
+	}
+	line, _, _ = strings.Cut(line, "\n")
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+	prog := filepath.Base(fields[0])
+	if prog == "env" {
+		// #!/usr/bin/env [-S] prog
+		prog = ""
+		for _, f := range fields[1:] {
+			if !strings.HasPrefix(f, "-") && !strings.Contains(f, "=") {
+				prog = f
+				break
+			}
+		}
+	}
+	// python3, python3.12, perl5 → python, perl
+	return interpreterExts[strings.TrimRight(prog, "0123456789.")]
+}
+
+// ── streamed previews ─────────────────────────────────────────────────────────
+
+// morePreviewMark starts the last line of a preview that stops short of the
+// end of its file; the byte offset to continue from follows it.
+const morePreviewMark = "\x1c"
+
+// previewStream is where the next chunk of a long preview starts.
+type previewStream struct {
+	path    string
+	offset  int64
+	loading bool
+}
+
+// previewChunkMsg carries the next rendered chunk, itself ending with a
+// morePreviewMark unless it reached the end of the file.
+type previewChunkMsg struct {
+	s       *previewStream
+	content string
+	err     error
+}
+
+// loadMorePreview fetches the next chunk of the preview once it has been
+// scrolled to within a screen of the loaded end.
+func (m *model) loadMorePreview() tea.Cmd {
+	s := m.previewMore
+	if s == nil || s.loading {
+		return nil
+	}
+	viewport := m.previewViewportHeight()
+	if m.previewOffset+2*viewport < strings.Count(m.preview, "\n")+1 {
+		return nil
+	}
+	s.loading = true
+	return func() tea.Msg {
+		content, err := renderPreviewChunk(s.path, s.offset)
+		return previewChunkMsg{s: s, content: content, err: err}
+	}
+}
+
+// renderPreviewChunk renders up to maxPreviewBytes of whole lines from
+// offset on.
+func renderPreviewChunk(path string, offset int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	buf := make([]byte, maxPreviewBytes)
+	n, err := f.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	buf = buf[:n]
+	more := err == nil
+	if more {
+		if i := bytes.LastIndexByte(buf, '\n'); i > 0 {
+			buf = buf[:i+1]
+		}
+	}
+	text := strings.ToValidUTF8(string(buf), "\uFFFD")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.TrimSuffix(strings.ReplaceAll(text, "\r", "\n"), "\n")
+	out := text
+	if highlighted := highlight(path, text); highlighted != "" {
+		out = strings.TrimSuffix(highlighted, "\n")
+	}
+	if more {
+		out += "\n" + morePreviewMark + strconv.FormatInt(offset+int64(len(buf)), 10)
+	}
+	return out, nil
+}
+
+// ── follow mode ───────────────────────────────────────────────────────────────
+
+const (
+	followInterval = 500 * time.Millisecond
+	// maxFollowLines bounds the preview while following; older lines are
+	// dropped from the top.
+	maxFollowLines = 10000
+)
+
+// followState tails a file: size is how far it has been read. The tail
+// preview sets it to where its own read ended, and each read after moves it
+// to a line boundary.
+type followState struct {
+	path string
+	size int64
+}
+
+type followTickMsg struct{ f *followState }
+
+// followDataMsg carries the complete lines appended since the last read,
+// which started at from. For files whose secrets are masked, context holds
+// the lines before them back to the last unindented one, so a YAML block
+// scalar begun in an earlier read is still recognised.
+type followDataMsg struct {
+	f       *followState
+	from    int64
+	text    string
+	context string
+	size    int64
+	err     error
+}
+
+func followTick(f *followState) tea.Cmd {
+	return tea.Tick(followInterval, func(time.Time) tea.Msg { return followTickMsg{f: f} })
+}
+
+// toggleFollow starts or stops following the selected file.
+func (m *model) toggleFollow() tea.Cmd {
+	if m.follow != nil {
+		m.follow = nil
+		m.status = "follow off"
+		return m.requestPreview()
+	}
+	if len(m.entries) == 0 || m.entries[m.selected].isDir {
+		return nil
+	}
+	if m.gitLogView || m.gitBlameView || m.gitDiffView {
+		m.status = "follow: leave the git view first"
+		return nil
+	}
+	path := m.entries[m.selected].path
+	info, err := os.Stat(path)
+	if err != nil {
+		m.setError("follow: " + err.Error())
+		return nil
+	}
+	// A guess until the tail preview reports where it read to.
+	m.follow = &followState{path: path, size: info.Size()}
+	m.previewOffset = 0 // the tail preview opens at the end
+	m.status = "following " + filepath.Base(path) + " · T stops"
+	return tea.Batch(m.requestPreview(), followTick(m.follow))
+}
+
+// readFollow reads the complete lines written to a followed file since the
+// last read.
+func readFollow(f *followState) tea.Cmd {
+	path, from := f.path, f.size
+	return func() tea.Msg {
+		file, err := os.Open(path)
+		if err != nil {
+			return followDataMsg{f: f, err: err}
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			return followDataMsg{f: f, err: err}
+		}
+		size := info.Size()
+		if size <= from {
+			return followDataMsg{f: f, from: from, size: size}
+		}
+		// A burst larger than a preview only shows its end.
+		start := from
+		if size-start > maxPreviewBytes {
+			start = size - maxPreviewBytes
+		}
+		buf := make([]byte, size-start)
+		n, err := file.ReadAt(buf, start)
+		if err != nil && err != io.EOF {
+			return followDataMsg{f: f, err: err}
+		}
+		buf = buf[:n]
+		// Leave a partial last line for the next read.
+		end := bytes.LastIndexByte(buf, '\n')
+		if end < 0 {
+			return followDataMsg{f: f, from: from, size: from}
+		}
+		msg := followDataMsg{f: f, from: from, text: string(buf[:end]), size: start + int64(end) + 1}
+		if start == from && hasSecrets(path) {
+			msg.context = readSecretContext(file, start)
+		}
+		return msg
+	}
+}
+
+// readSecretContext returns the lines of file before offset end, back to
+// the last one that isn't indented, or "" if that is more than
+// maxPreviewBytes back.
+func readSecretContext(file *os.File, end int64) string {
+	start := end - maxPreviewBytes
+	if start < 0 {
+		start = 0
+	}
+	buf := make([]byte, end-start)
+	n, err := file.ReadAt(buf, start)
+	if err != nil && err != io.EOF || n < len(buf) {
+		return ""
+	}
+	for i := len(buf) - 1; i >= 0; i-- {
+		lineStart := i == 0 && start == 0 || i > 0 && buf[i-1] == '\n'
+		if lineStart && buf[i] != ' ' && buf[i] != '\t' && buf[i] != '\n' {
+			return string(buf[i:])
+		}
+	}
+	return ""
+}
+
+// appendFollowed renders newly written lines onto the end of the preview,
+// keeping it scrolled to the bottom if it was there. Secrets are masked,
+// reading context as followDataMsg describes.
+func (m *model) appendFollowed(text, context string) {
+	atEnd := m.previewOffset >= strings.Count(m.preview, "\n")+1-m.previewViewportHeight()
+	text = strings.ToValidUTF8(strings.ReplaceAll(text, "\r\n", "\n"), "\uFFFD")
+	if !m.revealSecrets && hasSecrets(m.follow.path) {
+		context = strings.ToValidUTF8(strings.ReplaceAll(context, "\r\n", "\n"), "\uFFFD")
+		masked, _ := maskSecrets(context + text)
+		lines := strings.Split(masked, "\n")
+		text = strings.Join(lines[strings.Count(context, "\n"):], "\n")
+	}
+	var rendered string
+	if isLogFile(m.follow.path) {
+		rendered = renderLogLines(text)
+	} else {
+		rendered = highlight(m.follow.path, text)
+	}
+	content := strings.TrimSuffix(m.preview, "\n") + "\n" + strings.TrimSuffix(rendered, "\n")
+	if lines := strings.Split(content, "\n"); len(lines) > maxFollowLines {
+		dropped := len(lines) - maxFollowLines
+		content = strings.Join(lines[dropped:], "\n")
+		m.previewOffset = max(0, m.previewOffset-dropped)
+	}
+	if !atEnd {
+		m.setPreview(content)
+		return
+	}
+	m.previewOffset = 0
+	m.previewColumn = 0
+	m.setPreview(tailPreviewMark + "\n" + content)
+}
+
+// ── preview search ────────────────────────────────────────────────────────────
+
+// startPreviewSearch finds query in the preview of path and jumps to the
+// first match at or below the current scroll position. An empty query ends
+// the search.
+func (m *model) startPreviewSearch(query, path string) {
+	m.previewSearch, m.previewSearchPath, m.previewMatches = query, path, nil
+	if query == "" {
+		m.status = "preview search cleared"
+		return
+	}
+	m.previewMatches = findPreviewMatches(m.preview, query)
+	if len(m.previewMatches) == 0 {
+		m.status = "no matches for " + query
+		return
+	}
+	m.previewMatch = len(m.previewMatches) - 1
+	for i, line := range m.previewMatches {
+		if line >= m.previewOffset {
+			m.previewMatch = i
+			break
+		}
+	}
+	m.showPreviewMatch()
+}
+
+// jumpPreviewMatch moves by delta matches, wrapping around the ends.
+func (m *model) jumpPreviewMatch(delta int) {
+	n := len(m.previewMatches)
+	if n == 0 {
+		m.status = "no matches for " + m.previewSearch
+		return
+	}
+	m.previewMatch = ((m.previewMatch+delta)%n + n) % n
+	m.showPreviewMatch()
+}
+
+// showPreviewMatch scrolls the current match into view with a little
+// context above it.
+func (m *model) showPreviewMatch() {
+	m.previewOffset = max(0, m.previewMatches[m.previewMatch]-2)
+	m.clampPreviewOffset()
+	m.status = fmt.Sprintf("match %d of %d · n/N next/previous", m.previewMatch+1, len(m.previewMatches))
+}
+
+// previewScrollLines returns the part of a preview that scrolls, past any
+// frozen header, and the lines before it.
+func previewScrollLines(content string) (head string, lines []string) {
+	if h, body, ok := strings.Cut(content, "\n"+frozenPreviewMark+"\n"); ok {
+		return h, strings.Split(body, "\n")
+	}
+	return "", strings.Split(content, "\n")
+}
+
+// findPreviewMatches lists the scrollable lines of content containing query,
+// ignoring case unless the query has an uppercase letter.
+func findPreviewMatches(content, query string) []int {
+	_, lines := previewScrollLines(content)
+	var matches []int
+	for i, line := range lines {
+		if len(matchSpans(ansi.Strip(line), query)) > 0 {
+			matches = append(matches, i)
+		}
+	}
+	return matches
+}
+
+// matchSpans returns the byte ranges of query in text, smart-case.
+func matchSpans(text, query string) [][2]int {
+	if query == "" {
+		return nil
+	}
+	haystack, needle := text, query
+	if strings.ToLower(query) == query {
+		// Lowercasing can change byte lengths outside ASCII; such text is
+		// matched as written.
+		if lower := strings.ToLower(text); len(lower) == len(text) {
+			haystack = lower
+		}
+	}
+	var spans [][2]int
+	for from := 0; ; {
+		i := strings.Index(haystack[from:], needle)
+		if i < 0 {
+			return spans
+		}
+		start := from + i
+		spans = append(spans, [2]int{start, start + len(needle)})
+		from = start + len(needle)
+	}
+}
+
+// highlightPreviewMatches marks the search matches in content. Lines with
+// a match lose their own colours so the highlight reads clearly.
+func (m model) highlightPreviewMatches(content string) string {
+	head, lines := previewScrollLines(content)
+	hit := lipgloss.NewStyle().Foreground(clrAccentFg).Background(clrMuted)
+	current := lipgloss.NewStyle().Foreground(clrAccentFg).Background(clrAccent).Bold(true)
+	for k, i := range m.previewMatches {
+		if i >= len(lines) {
+			break
+		}
+		style := hit
+		if k == m.previewMatch {
+			style = current
+		}
+		plain := ansi.Strip(lines[i])
+		var sb strings.Builder
+		last := 0
+		for _, span := range matchSpans(plain, m.previewSearch) {
+			sb.WriteString(plain[last:span[0]])
+			sb.WriteString(style.Render(plain[span[0]:span[1]]))
+			last = span[1]
+		}
+		sb.WriteString(plain[last:])
+		lines[i] = sb.String()
+	}
+	if head != "" {
+		return head + "\n" + frozenPreviewMark + "\n" + strings.Join(lines, "\n")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ── background jobs ───────────────────────────────────────────────────────────
+
+type jobState int
+
+const (
+	jobRunning jobState = iota
+	jobSucceeded
+	jobFailed
+	jobCancelled
+)
+
+// job is a long-running operation executed off the Update loop. The worker
+// updates the atomic progress counters; everything else is owned by Update.
+type job struct {
+	id      int
+	title   string
+	started time.Time
+	ended   time.Time
+	total   atomic.Int64 // expected units (bytes); 0 when unknown
+	done    atomic.Int64
+	state   jobState
+	result  string
+	err     error
+	cancel  context.CancelFunc
+}
+
+// jobFunc performs the work of a job, reporting progress through j and
+// returning early with ctx.Err() when cancelled. The returned string is a
+// short result summary, or a multi-line report shown in the preview.
+type jobFunc func(ctx context.Context, j *job) (string, error)
+
+const (
+	jobTickInterval = 250 * time.Millisecond
+	maxFinishedJobs = 20
+)
+
+// startJob runs fn in the background and returns the commands that execute it
+// and keep the progress display ticking.
+func (m *model) startJob(title string, fn jobFunc) tea.Cmd {
+	m.nextJobID++
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &job{id: m.nextJobID, title: title, started: time.Now(), cancel: cancel}
+	m.jobs = append(m.jobs, j)
+	m.status = "started: " + title
+
+	run := func() tea.Msg {
+		result, err := fn(ctx, j)
+		cancel()
+		return jobDoneMsg{id: j.id, result: result, err: err}
+	}
+	return tea.Batch(run, m.scheduleJobTick())
+}
+
+// scheduleJobTick keeps a single re-render tick alive while jobs are running.
+func (m *model) scheduleJobTick() tea.Cmd {
+	if m.jobTicking {
+		return nil
+	}
+	running, _ := m.jobSummary()
+	if running == 0 {
+		return nil
+	}
+	m.jobTicking = true
+	return tea.Tick(jobTickInterval, func(time.Time) tea.Msg { return jobTickMsg{} })
+}
+
+func (m *model) handleJobDone(msg jobDoneMsg) tea.Cmd {
+	var j *job
+	for _, candidate := range m.jobs {
+		if candidate.id == msg.id {
+			j = candidate
+		}
+	}
+	if j == nil {
+		return nil
+	}
+	j.ended = time.Now()
+	j.result = msg.result
+	j.err = msg.err
+	switch {
+	case errors.Is(msg.err, context.Canceled):
+		j.state = jobCancelled
+		m.status = "cancelled: " + j.title
+	case msg.err != nil:
+		j.state = jobFailed
+		m.setError(j.title + ": " + msg.err.Error())
+	default:
+		j.state = jobSucceeded
+		m.status = "done: " + j.title
+		if msg.result != "" && !strings.Contains(msg.result, "\n") {
+			m.status += " — " + msg.result
+		}
+	}
+	m.pruneJobs()
+
+	if err := m.reloadEntries(); err != nil {
+		m.setError(err.Error())
+	}
+	if j.state == jobSucceeded && strings.Contains(msg.result, "\n") {
+		// Multi-line reports (e.g. checksums) are shown like plugin output.
+		return m.handlePluginDone(pluginDoneMsg{name: j.title, output: msg.result})
+	}
+	return m.requestPreview()
+}
+
+// pruneJobs drops the oldest finished jobs beyond maxFinishedJobs.
+func (m *model) pruneJobs() {
+	finished := 0
+	for _, j := range m.jobs {
+		if j.state != jobRunning {
+			finished++
+		}
+	}
+	kept := m.jobs[:0]
+	for _, j := range m.jobs {
+		if j.state != jobRunning && finished > maxFinishedJobs {
+			finished--
+			continue
+		}
+		kept = append(kept, j)
+	}
+	m.jobs = kept
+	m.jobCursor = max(0, min(m.jobCursor, len(m.jobs)-1))
+}
+
+// jobSummary returns the number of running jobs and their combined progress.
+func (m model) jobSummary() (int, int) {
+	running := 0
+	var done, total int64
+	for _, j := range m.jobs {
+		if j.state != jobRunning {
+			continue
+		}
+		running++
+		done += j.done.Load()
+		total += j.total.Load()
+	}
+	if total <= 0 {
+		return running, 0
+	}
+	return running, int(min64(100, done*100/total))
+}
+
+// updateJobsPanel handles keys while the jobs panel is open.
+func (m *model) updateJobsPanel(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "esc", "w", "q":
+		m.showJobs = false
+	case "j", "down":
+		m.jobCursor = min(m.jobCursor+1, max(0, len(m.jobs)-1))
+	case "k", "up":
+		m.jobCursor = max(0, m.jobCursor-1)
+	case "x", "delete":
+		if m.jobCursor < len(m.jobs) {
+			j := m.jobs[m.jobCursor]
+			if j.state == jobRunning {
+				j.cancel()
+				m.status = "cancelling: " + j.title
+			}
+		}
+	case "c":
+		running := m.jobs[:0]
+		for _, j := range m.jobs {
+			if j.state == jobRunning {
+				running = append(running, j)
+			}
+		}
+		m.jobs = running
+		m.jobCursor = max(0, min(m.jobCursor, len(m.jobs)-1))
+	}
+	return nil
+}
+
+// renderJobsPanel draws the jobs overlay: one row per job with a progress
+// bar, throughput, and elapsed time or outcome.
+func (m model) renderJobsPanel(width, height int) string {
+	panelW := min(90, max(48, width-8))
+	innerW := panelW - 6
+	titleStyle := lipgloss.NewStyle().Foreground(clrTitle).Bold(true)
+	mutedStyle := lipgloss.NewStyle().Foreground(clrMuted)
+
+	lines := []string{titleStyle.Render("Jobs"), ""}
+	if len(m.jobs) == 0 {
+		lines = append(lines, mutedStyle.Render("No background jobs."))
+	}
+	maxRows := max(1, (height-10)/2)
+	start, end := visibleWindow(m.jobCursor, len(m.jobs), maxRows)
+	for i := start; i < end; i++ {
+		j := m.jobs[i]
+		lines = append(lines, renderJobRow(j, innerW, i == m.jobCursor)...)
+	}
+	lines = append(lines, "", mutedStyle.Render("j/k select  ·  x cancel  ·  c clear finished  ·  esc close"))
+
+	box := lipgloss.NewStyle().
+		Width(panelW).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(clrBorderStrong).
+		Padding(1, 2).
+		Render(strings.Join(lines, "\n"))
+	return centerOverlay(box, width, height)
+}
+
+func renderJobRow(j *job, width int, selected bool) []string {
+	done, total := j.done.Load(), j.total.Load()
+	end := j.ended
+	if j.state == jobRunning {
+		end = time.Now()
+	}
+	elapsed := end.Sub(j.started)
+
+	var icon string
+	var iconStyle lipgloss.Style
+	switch j.state {
+	case jobRunning:
+		icon, iconStyle = "⟳", lipgloss.NewStyle().Foreground(clrLoading)
+	case jobSucceeded:
+		icon, iconStyle = "✓", lipgloss.NewStyle().Foreground(clrExec)
+	case jobFailed:
+		icon, iconStyle = "✗", lipgloss.NewStyle().Foreground(clrDanger)
+	default:
+		icon, iconStyle = "–", lipgloss.NewStyle().Foreground(clrMuted)
+	}
+	titleStyle := lipgloss.NewStyle().Foreground(clrFile)
+	if selected {
+		titleStyle = titleStyle.Background(clrAccent).Foreground(clrAccentFg).Bold(true)
+	}
+	title := iconStyle.Render(icon) + " " + titleStyle.Render(trimVisual(j.title, width-2))
+
+	rate := ""
+	if secs := elapsed.Seconds(); secs > 0 && done > 0 {
+		rate = humanSize(int64(float64(done)/secs)) + "/s"
+	}
+	var detail string
+	switch j.state {
+	case jobRunning:
+		detail = fmt.Sprintf("%s  %s", rate, elapsed.Truncate(time.Second))
+	case jobFailed:
+		detail = j.err.Error()
+	case jobCancelled:
+		detail = "cancelled"
+	default:
+		detail = elapsed.Truncate(100 * time.Millisecond).String()
+	}
+
+	pct := 0
+	if total > 0 {
+		pct = int(min64(100, done*100/total))
+	} else if j.state == jobSucceeded {
+		pct = 100
+	}
+	barW := max(10, width/2)
+	filled := barW * pct / 100
+	bar := lipgloss.NewStyle().Foreground(clrAccent).Render(strings.Repeat("█", filled)) +
+		lipgloss.NewStyle().Foreground(clrDim).Render(strings.Repeat("░", barW-filled))
+	info := fmt.Sprintf(" %3d%%  ", pct) + trimVisual(detail, max(1, width-barW-7))
+	return []string{title, "  " + bar + lipgloss.NewStyle().Foreground(clrMuted).Render(info)}
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// jobProgress counts bytes written through it into j.done and aborts the
+// copy once ctx is cancelled.
+type jobProgress struct {
+	ctx context.Context
+	j   *job
+}
+
+func (p jobProgress) Write(b []byte) (int, error) {
+	if err := p.ctx.Err(); err != nil {
+		return 0, err
+	}
+	p.j.done.Add(int64(len(b)))
+	return len(b), nil
+}
+
+// treeSize sums the size of regular files under the given paths.
+func treeSize(ctx context.Context, paths []string) (int64, error) {
+	var total int64
+	for _, root := range paths {
+		err := filepath.WalkDir(root, func(_ string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if d.Type().IsRegular() {
+				if info, err := d.Info(); err == nil {
+					total += info.Size()
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// copyJob copies (or moves) sources into destDir, picking collision-safe
+// names when an entry of the same name already exists.
+func copyJob(sources []string, destDir string, move bool) jobFunc {
+	return func(ctx context.Context, j *job) (string, error) {
+		for _, src := range sources {
+			if withinDir(src, destDir) {
+				return "", fmt.Errorf("cannot copy %s into itself", filepath.Base(src))
+			}
+		}
+		total, err := treeSize(ctx, sources)
+		if err != nil {
+			return "", err
+		}
+		j.total.Store(total)
+
+		for _, src := range sources {
+			if move && filepath.Dir(src) == destDir {
+				continue // already in place
+			}
+			dest := uniquePath(destDir, filepath.Base(src))
+			if move {
+				// A same-device move is a rename; fall back to copy+delete.
+				if err := os.Rename(src, dest); err == nil {
+					if size, err := treeSize(ctx, []string{dest}); err == nil {
+						j.done.Add(size)
+					}
+					continue
+				}
+			}
+			if err := copyTree(ctx, j, src, dest); err != nil {
+				return "", err
+			}
+			if move {
+				if err := os.RemoveAll(src); err != nil {
+					return "", err
+				}
+			}
+		}
+		verb := "copied"
+		if move {
+			verb = "moved"
+		}
+		return fmt.Sprintf("%s %d item(s), %s", verb, len(sources), humanSize(total)), nil
+	}
+}
+
+// copyTree recursively copies src to dest, preserving modes, modification
+// times, and symlinks.
+func copyTree(ctx context.Context, j *job, src, dest string) error {
+	return filepath.WalkDir(src, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.Type()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0o700)
+		case d.Type().IsRegular():
+			if err := copyFile(ctx, j, path, target, info); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func copyFile(ctx context.Context, j *job, src, dest string, info os.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeStream(dest, io.TeeReader(in, jobProgress{ctx: ctx, j: j}), info.Mode().Perm(), info.ModTime())
+}
+
+// writeStream creates dest (which must not exist) from r, then applies the
+// given mode and modification time. A partial file is removed on error.
+func writeStream(dest string, r io.Reader, mode os.FileMode, mtime time.Time) error {
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		os.Remove(dest)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dest, mtime, mtime)
+}
+
+// checksumJob computes SHA-256 digests of the regular files under paths and
+// returns them in sha256sum format.
+func checksumJob(paths []string) jobFunc {
+	return func(ctx context.Context, j *job) (string, error) {
+		total, err := treeSize(ctx, paths)
+		if err != nil {
+			return "", err
+		}
+		j.total.Store(total)
+
+		var lines []string
+		for _, root := range paths {
+			err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if !d.Type().IsRegular() {
+					return nil
+				}
+				f, err := os.Open(path)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				h := sha256.New()
+				if _, err := io.Copy(h, io.TeeReader(f, jobProgress{ctx: ctx, j: j})); err != nil {
+					return err
+				}
+				name := path
+				if rel, err := filepath.Rel(filepath.Dir(root), path); err == nil {
+					name = rel
+				}
+				lines = append(lines, fmt.Sprintf("%x  %s", h.Sum(nil), name))
+				return nil
+			})
+			if err != nil {
+				return "", err
+			}
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+}
+
+// uniquePath returns dir/name, or "stem 2.ext", "stem 3.ext", … when taken.
+func uniquePath(dir, name string) string {
+	candidate := filepath.Join(dir, name)
+	if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+		return candidate
+	}
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	if stem == "" {
+		stem, ext = name, ""
+	}
+	for i := 2; ; i++ {
+		candidate = filepath.Join(dir, fmt.Sprintf("%s %d%s", stem, i, ext))
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
+
+// ── archives ──────────────────────────────────────────────────────────────────
+
+type archiveFormat int
+
+const (
+	archiveNone archiveFormat = iota
+	archiveZip
+	archiveTar
+	archiveTarGz
+	archiveTarZst
+	archiveZst // a single zstd-compressed file
+)
+
+// archiveSuffixes is checked in order, so compound extensions come first.
+var archiveSuffixes = []struct {
+	suffix string
+	format archiveFormat
+}{
+	{".tar.gz", archiveTarGz},
+	{".tgz", archiveTarGz},
+	{".tar.zst", archiveTarZst},
+	{".tzst", archiveTarZst},
+	{".tar", archiveTar},
+	{".zip", archiveZip},
+	{".zst", archiveZst},
+}
+
+// archiveFormatOf reports the archive format of name and the name with the
+// archive extension removed.
+func archiveFormatOf(name string) (archiveFormat, string) {
+	lower := strings.ToLower(name)
+	for _, s := range archiveSuffixes {
+		if strings.HasSuffix(lower, s.suffix) && len(name) > len(s.suffix) {
+			return s.format, name[:len(name)-len(s.suffix)]
+		}
+	}
+	return archiveNone, name
+}
+
+// extractJob unpacks archive into a new, collision-safe directory in destDir
+// named after the archive. A bare .zst file is decompressed next to it. The
+// partial output is removed if extraction fails or is cancelled.
+func extractJob(archive, destDir string) jobFunc {
+	return func(ctx context.Context, j *job) (string, error) {
+		format, stem := archiveFormatOf(filepath.Base(archive))
+		dest := uniquePath(destDir, stem)
+
+		if format == archiveZst {
+			// writeStream creates the file exclusively and cleans up after itself.
+			if err := extractStream(ctx, j, archive, dest, format); err != nil {
+				return "", err
+			}
+			return "extracted to " + filepath.Base(dest), nil
+		}
+
+		if err := os.Mkdir(dest, 0o755); err != nil {
+			return "", err
+		}
+		var err error
+		if format == archiveZip {
+			err = extractZip(ctx, j, archive, dest)
+		} else {
+			err = extractStream(ctx, j, archive, dest, format)
+		}
+		if err != nil {
+			os.RemoveAll(dest)
+			return "", err
+		}
+		return "extracted to " + filepath.Base(dest), nil
+	}
+}
+
+// extractStream handles the formats read sequentially: tar, optionally
+// compressed, and bare zstd. Progress is measured in archive bytes read.
+func extractStream(ctx context.Context, j *job, archive, dest string, format archiveFormat) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil {
+		j.total.Store(info.Size())
+	}
+	var r io.Reader = io.TeeReader(f, jobProgress{ctx: ctx, j: j})
+
+	switch format {
+	case archiveTarGz:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	case archiveTarZst, archiveZst:
+		zr, err := zstdReader(ctx, r)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	if format == archiveZst {
+		mtime := time.Now()
+		if info, err := f.Stat(); err == nil {
+			mtime = info.ModTime()
+		}
+		return writeStream(dest, r, 0o644, mtime)
+	}
+	return untar(ctx, r, dest)
+}
+
+func untar(ctx context.Context, r io.Reader, dest string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		target, err := archiveTarget(dest, hdr.Name)
+		if err != nil {
+			return err
+		}
+		mode := os.FileMode(hdr.Mode).Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, mode|0o700)
+		case tar.TypeReg:
+			if mode == 0 {
+				mode = 0o644
+			}
+			if err = os.MkdirAll(filepath.Dir(target), 0o755); err == nil {
+				err = writeStream(target, tr, mode, hdr.ModTime)
+			}
+		case tar.TypeSymlink:
+			err = archiveSymlink(dest, target, hdr.Linkname)
+		case tar.TypeLink:
+			var src string
+			if src, err = archiveTarget(dest, hdr.Linkname); err == nil {
+				err = os.Link(src, target)
+			}
+		default:
+			// Devices, fifos and the like are skipped.
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// extractZip unpacks a zip archive. Progress is measured in uncompressed
+// bytes since the central directory gives the total up front.
+func extractZip(ctx context.Context, j *job, archive, dest string) error {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	var total int64
+	for _, zf := range zr.File {
+		total += int64(zf.UncompressedSize64)
+	}
+	j.total.Store(total)
+
+	for _, zf := range zr.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		target, err := archiveTarget(dest, zf.Name)
+		if err != nil {
+			return err
+		}
+		mode := zf.Mode()
+		if zf.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, mode.Perm()|0o700); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return err
+		}
+		if mode&os.ModeSymlink != 0 {
+			link, err := io.ReadAll(io.LimitReader(rc, 4096))
+			rc.Close()
+			if err == nil {
+				err = archiveSymlink(dest, target, string(link))
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		perm := mode.Perm()
+		if perm == 0 {
+			perm = 0o644
+		}
+		err = writeStream(target, io.TeeReader(rc, jobProgress{ctx: ctx, j: j}), perm, zf.Modified)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// archiveTarget resolves an archive member name inside dest, rejecting
+// absolute names and ".." components that would escape it, and paths that
+// lead out of dest, or onto a symlink, through links extracted earlier.
+func archiveTarget(dest, name string) (string, error) {
+	target := filepath.Join(dest, filepath.FromSlash(name))
+	if !withinDir(dest, target) || !resolvesWithin(dest, filepath.Dir(target)) {
+		return "", fmt.Errorf("unsafe path in archive: %s", name)
+	}
+	if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return "", fmt.Errorf("unsafe path in archive: %s", name)
+	}
+	return target, nil
+}
+
+// resolvesWithin reports whether path, with symlinks followed, lies inside
+// dest. Only the part of path that already exists is resolved; the rest is
+// created as plain directories.
+func resolvesWithin(dest, path string) bool {
+	realDest, err := filepath.EvalSymlinks(dest)
+	if err != nil {
+		return false
+	}
+	real, err := resolveExisting(path)
+	return err == nil && withinDir(realDest, real)
+}
+
+// resolveExisting follows the symlinks in the longest existing prefix of
+// path and appends the rest unchanged.
+func resolveExisting(path string) (string, error) {
+	existing := path
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return "", fmt.Errorf("%s: no existing parent", path)
+		}
+		existing = parent
+	}
+	real, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", err
+	}
+	rest, err := filepath.Rel(existing, path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(real, rest), nil
+}
+
+func withinDir(dir, path string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// archiveSymlink creates a symlink only if its target stays inside dest, so
+// later members cannot be written through it to arbitrary locations.
+func archiveSymlink(dest, target, link string) error {
+	if filepath.IsAbs(link) || !withinDir(dest, filepath.Join(filepath.Dir(target), link)) {
+		return fmt.Errorf("unsafe symlink in archive: %s", link)
+	}
+	// The link is followed from where its directory really is.
+	if dir, err := resolveExisting(filepath.Dir(target)); err != nil || !resolvesWithin(dest, filepath.Join(dir, link)) {
+		return fmt.Errorf("unsafe symlink in archive: %s", link)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	return os.Symlink(link, target)
+}
+
+// zstdReader decompresses r through the zstd command, since the standard
+// library has no zstd decoder.
+func zstdReader(ctx context.Context, r io.Reader) (io.ReadCloser, error) {
+	return commandDecompressor(ctx, r, "zstd")
+}
+
+// compressedExts maps single-file compression extensions to their format.
+var compressedExts = map[string]string{".gz": "gzip", ".bz2": "bzip2", ".xz": "xz", ".zst": "zstd"}
+
+// decompressReader decodes r in the given compressedExts format.
+func decompressReader(ctx context.Context, format string, r io.Reader) (io.ReadCloser, error) {
+	switch format {
+	case "gzip":
+		return gzip.NewReader(r)
+	case "bzip2":
+		return io.NopCloser(bzip2.NewReader(r)), nil
+	case "xz":
+		return commandDecompressor(ctx, r, "xz")
+	case "zstd":
+		return zstdReader(ctx, r)
+	}
+	return nil, fmt.Errorf("unknown compression %q", format)
+}
+
+// commandDecompressor streams r through bin -dc, for formats the standard
+// library cannot decode.
+func commandDecompressor(ctx context.Context, r io.Reader, bin string) (io.ReadCloser, error) {
+	if _, err := exec.LookPath(bin); err != nil {
+		return nil, fmt.Errorf("%s is not installed", bin)
+	}
+	cmd := exec.CommandContext(ctx, bin, "-dc")
+	cmd.Stdin = r
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &commandReader{ReadCloser: out, cmd: cmd, stderr: &stderr}, nil
+}
+
+// commandReader is a command's stdout that waits for the command on Close.
+type commandReader struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	stderr *strings.Builder
+}
+
+func (c *commandReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if err == io.EOF {
+		// Surface decoder failures instead of a silently short stream.
+		if werr := c.wait(); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+func (c *commandReader) Close() error {
+	c.ReadCloser.Close()
+	return c.wait()
+}
+
+func (c *commandReader) wait() error {
+	if c.cmd.ProcessState != nil {
+		return nil
+	}
+	if err := c.cmd.Wait(); err != nil {
+		if msg := strings.TrimSpace(c.stderr.String()); msg != "" {
+			return errors.New(msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// compress starts a job packaging the targeted entries into name (in cwd),
+// whose extension picks the format.
+func (m *model) compress(name string) (tea.Cmd, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.ContainsRune(name, filepath.Separator) || strings.ContainsRune(name, '/') {
+		return nil, errors.New("enter a file name")
+	}
+	format, _ := archiveFormatOf(name)
+	if format != archiveZip && format != archiveTarGz {
+		return nil, errors.New("name must end in .zip, .tar.gz or .tgz")
+	}
+	dest := filepath.Join(m.cwd, name)
+	if _, err := os.Lstat(dest); err == nil {
+		return nil, fmt.Errorf("%s already exists", name)
+	}
+	sources := m.targetPaths()
+	for _, src := range sources {
+		if withinDir(src, dest) {
+			return nil, fmt.Errorf("cannot write the archive inside %s", filepath.Base(src))
+		}
+	}
+	title := fmt.Sprintf("compress %d item(s) → %s", len(sources), name)
+	return m.startJob(title, compressJob(sources, dest, format)), nil
+}
+
+// compressJob writes sources into a new zip or tar.gz archive at dest, each
+// stored under its base name. Progress is measured in source bytes read; the
+// partial archive is removed on failure or cancellation.
+func compressJob(sources []string, dest string, format archiveFormat) jobFunc {
+	return func(ctx context.Context, j *job) (string, error) {
+		total, err := treeSize(ctx, sources)
+		if err != nil {
+			return "", err
+		}
+		j.total.Store(total)
+
+		f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return "", err
+		}
+		if format == archiveZip {
+			err = writeZip(ctx, j, f, sources)
+		} else {
+			err = writeTarGz(ctx, j, f, sources)
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(dest)
+			return "", err
+		}
+		size := int64(0)
+		if info, err := os.Stat(dest); err == nil {
+			size = info.Size()
+		}
+		return fmt.Sprintf("%s, %s", filepath.Base(dest), humanSize(size)), nil
+	}
+}
+
+// walkArchiveSources visits every path under sources with its slash-separated
+// name inside the archive.
+func walkArchiveSources(ctx context.Context, sources []string, fn func(path, name string, info os.FileInfo) error) error {
+	for _, src := range sources {
+		base := filepath.Dir(src)
+		err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(base, path)
+			if err != nil {
+				return err
+			}
+			return fn(path, filepath.ToSlash(rel), info)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeZip(ctx context.Context, j *job, w io.Writer, sources []string) error {
+	zw := zip.NewWriter(w)
+	err := walkArchiveSources(ctx, sources, func(path, name string, info os.FileInfo) error {
+		hdr, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		switch {
+		case info.IsDir():
+			hdr.Name += "/"
+			_, err = zw.CreateHeader(hdr)
+			return err
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			out, err := zw.CreateHeader(hdr)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(out, link)
+			return err
+		case !info.Mode().IsRegular():
+			return nil
+		}
+		hdr.Method = zip.Deflate
+		out, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		return copyFileTo(ctx, j, out, path)
+	})
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func writeTarGz(ctx context.Context, j *job, w io.Writer, sources []string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	err := walkArchiveSources(ctx, sources, func(path, name string, info os.FileInfo) error {
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			var err error
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		} else if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		return copyFileTo(ctx, j, tw, path)
+	})
+	if cerr := tw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := gz.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// copyFileTo streams the file at path into w, counting progress.
+func copyFileTo(ctx context.Context, j *job, w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, io.TeeReader(f, jobProgress{ctx: ctx, j: j}))
+	return err
+}
+
+// extract starts an extraction job for each targeted archive, extracting it
+// next to the archive.
+func (m *model) extract() tea.Cmd {
+	var cmds []tea.Cmd
+	for _, path := range m.targetPaths() {
+		if format, _ := archiveFormatOf(filepath.Base(path)); format == archiveNone {
+			continue
+		}
+		cmds = append(cmds, m.startJob("extract "+filepath.Base(path), extractJob(path, filepath.Dir(path))))
+	}
+	if len(cmds) == 0 {
+		m.setError("not an archive (zip, tar, tar.gz, tgz, zst)")
+		return nil
+	}
+	return tea.Batch(cmds...)
+}
+
+// ── tabs ──────────────────────────────────────────────────────────────────────
+
+// tabState is what a background tab remembers. The preview cache is shared by
+// all tabs since it is keyed by path.
+type tabState struct {
+	cwd           string
+	selectedName  string
+	searchQuery   string
+	searching     bool
+	previewOffset int
+}
+
+// saveTab stores the live browsing state into the active tab.
+func (m *model) saveTab() {
+	t := tabState{
+		cwd:           m.cwd,
+		searchQuery:   m.searchQuery,
+		searching:     m.searching,
+		previewOffset: m.previewOffset,
+	}
+	if m.selected < len(m.entries) {
+		t.selectedName = m.entries[m.selected].name
+	}
+	m.tabs[m.activeTab] = t
+}
+
+// restoreTab reloads the active tab's directory and state.
+func (m *model) restoreTab() tea.Cmd {
+	t := m.tabs[m.activeTab]
+	entries, err := m.loadEntries(t.cwd)
+	if err != nil {
+		m.setError(err.Error())
+	} else {
+		m.status = fmt.Sprintf("tab %d: %s", m.activeTab+1, t.cwd)
+	}
+	m.cwd = t.cwd
+	m.allEntries = entries
+	m.searchQuery = t.searchQuery
+	m.searching = t.searching
+	m.entries = m.applySearch(entries)
+	m.selected = 0
+	m.selectName(t.selectedName)
+	m.previewOffset = t.previewOffset
+	return m.requestPreview()
+}
+
+func (m *model) switchTab(i int) tea.Cmd {
+	if i == m.activeTab {
+		return nil
+	}
+	m.saveTab()
+	m.activeTab = i
+	return m.restoreTab()
+}
+
+// newTab opens a tab on the current directory and switches to it.
+func (m *model) newTab() tea.Cmd {
+	m.saveTab()
+	t := m.tabs[m.activeTab]
+	t.searchQuery, t.searching = "", false
+	m.tabs = append(m.tabs, t)
+	m.activeTab = len(m.tabs) - 1
+	return m.restoreTab()
+}
+
+func (m *model) closeTab() tea.Cmd {
+	if len(m.tabs) == 1 {
+		m.setError("cannot close the last tab")
+		return nil
+	}
+	m.tabs = append(m.tabs[:m.activeTab], m.tabs[m.activeTab+1:]...)
+	m.activeTab = min(m.activeTab, len(m.tabs)-1)
+	return m.restoreTab()
+}
+
+// renderTabStrip returns the tab labels shown before the breadcrumb, or ""
+// when only one tab is open. Labels drop the directory name when the strip
+// would be wider than maxW.
+func (m model) renderTabStrip(maxW int) string {
+	if len(m.tabs) < 2 {
+		return ""
+	}
+	strip := m.tabStrip(true)
+	if lipgloss.Width(strip) > maxW {
+		strip = m.tabStrip(false)
+	}
+	return strip
+}
+
+func (m model) tabStrip(withNames bool) string {
+	activeStyle := lipgloss.NewStyle().Background(clrAccent).Foreground(clrAccentFg).Bold(true)
+	inactiveStyle := lipgloss.NewStyle().Foreground(clrMuted)
+	var parts []string
+	for i, t := range m.tabs {
+		dir := t.cwd
+		if i == m.activeTab {
+			dir = m.cwd
+		}
+		label := fmt.Sprintf(" %d ", i+1)
+		if withNames {
+			label = fmt.Sprintf(" %d %s ", i+1, trimVisual(filepath.Base(dir), 12))
+		}
+		if i == m.activeTab {
+			parts = append(parts, activeStyle.Render(label))
+		} else {
+			parts = append(parts, inactiveStyle.Render(label))
+		}
+	}
+	return strings.Join(parts, "") + "  "
+}
+
+// ── disk usage ────────────────────────────────────────────────────────────────
+
+// duNode is one entry in a disk usage scan. Directory sizes are cumulative
+// and children are kept sorted largest first.
+type duNode struct {
+	name     string
+	path     string
+	isDir    bool
+	size     int64
+	parent   *duNode
+	children []*duNode
+}
+
+type duScanMsg struct {
+	id   int
+	root *duNode
+	err  error
+}
+
+type duTickMsg struct{}
+
+func duTick() tea.Cmd {
+	return tea.Tick(jobTickInterval, func(time.Time) tea.Msg { return duTickMsg{} })
+}
+
+// startDiskUsage opens the disk usage view and scans cwd in the background.
+func (m *model) startDiskUsage() tea.Cmd {
+	if m.duCancel != nil {
+		m.duCancel()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.duID++
+	m.duCancel = cancel
+	m.duScanning = true
+	m.duScanned = new(atomic.Int64)
+	m.duRoot, m.duDir, m.duCursor = nil, nil, 0
+	m.showDiskUsage = true
+
+	id, root, scanned := m.duID, m.cwd, m.duScanned
+	scan := func() tea.Msg {
+		node, err := scanDiskUsage(ctx, root, filepath.Base(root), nil, scanned)
+		return duScanMsg{id: id, root: node, err: err}
+	}
+	return tea.Batch(scan, duTick())
+}
+
+func (m *model) handleDiskUsageScan(msg duScanMsg) tea.Cmd {
+	if msg.id != m.duID {
+		return nil
+	}
+	m.duScanning = false
+	m.duCancel = nil
+	if msg.err != nil {
+		m.showDiskUsage = false
+		m.setError("disk usage: " + msg.err.Error())
+		return nil
+	}
+	m.duRoot, m.duDir, m.duCursor = msg.root, msg.root, 0
+	m.status = fmt.Sprintf("%s in %d files", humanSize(msg.root.size), m.duScanned.Load())
+	return nil
+}
+
+// scanDiskUsage sizes path recursively without following symlinks.
+// Unreadable subdirectories count as empty rather than failing the scan.
+func scanDiskUsage(ctx context.Context, path, name string, parent *duNode, scanned *atomic.Int64) (*duNode, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	node := &duNode{name: name, path: path, isDir: info.IsDir(), parent: parent}
+	if !node.isDir {
+		node.size = info.Size()
+		scanned.Add(1)
+		return node, nil
+	}
+	items, _ := os.ReadDir(path)
+	for _, item := range items {
+		child, err := scanDiskUsage(ctx, filepath.Join(path, item.Name()), item.Name(), node, scanned)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			continue
+		}
+		node.size += child.size
+		node.children = append(node.children, child)
+	}
+	sortDiskUsage(node.children)
+	return node, nil
+}
+
+func sortDiskUsage(nodes []*duNode) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if nodes[i].size != nodes[j].size {
+			return nodes[i].size > nodes[j].size
+		}
+		return nodes[i].name < nodes[j].name
+	})
+}
+
+// duForget removes a deleted path from the scanned tree, subtracting its
+// size from every ancestor.
+func (m *model) duForget(path string) {
+	if m.duDir == nil {
+		return
+	}
+	for i, child := range m.duDir.children {
+		if child.path != path {
+			continue
+		}
+		m.duDir.children = append(m.duDir.children[:i:i], m.duDir.children[i+1:]...)
+		for p := m.duDir; p != nil; p = p.parent {
+			p.size -= child.size
+			sortDiskUsage(p.children)
+		}
+		m.duCursor = max(0, min(m.duCursor, len(m.duDir.children)-1))
+		return
+	}
+}
+
+func (m *model) updateDiskUsage(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "esc", "q", "U":
+		if m.duCancel != nil {
+			m.duCancel()
+			m.duCancel = nil
+		}
+		m.duID++ // drop the result of a scan still in flight
+		m.duScanning = false
+		m.showDiskUsage = false
+		return nil
+	case "r":
+		if m.duRoot != nil {
+			return m.startDiskUsage()
+		}
+	}
+	if m.duDir == nil {
+		return nil
+	}
+	children := m.duDir.children
+	switch msg.String() {
+	case "j", "down":
+		m.duCursor = min(m.duCursor+1, max(0, len(children)-1))
+	case "k", "up":
+		m.duCursor = max(0, m.duCursor-1)
+	case "g", "home":
+		m.duCursor = 0
+	case "G", "end":
+		m.duCursor = max(0, len(children)-1)
+	case "l", "right", "enter":
+		if m.duCursor < len(children) && children[m.duCursor].isDir {
+			m.duDir, m.duCursor = children[m.duCursor], 0
+		}
+	case "h", "left", "backspace":
+		if parent := m.duDir.parent; parent != nil {
+			for i, child := range parent.children {
+				if child == m.duDir {
+					m.duCursor = i
+				}
+			}
+			m.duDir = parent
+		}
+	case "d", "delete":
+		if m.duCursor < len(children) {
+			m.deleteTargets = []string{children[m.duCursor].path}
+			m.confirmingDelete = true
+		}
+	case "o":
+		// Leave the view with the picked entry selected in the file list.
+		if m.duCursor < len(children) {
+			path := children[m.duCursor].path
+			m.showDiskUsage = false
+			if err := m.changeDir(filepath.Dir(path)); err != nil {
+				m.setError(err.Error())
+				return nil
+			}
+			m.selectPath(path)
+			return m.requestPreview()
+		}
+	}
+	return nil
+}
+
+// renderDiskUsage draws the disk usage view: the current directory's
+// entries, largest first, each with a bar proportional to the largest.
+func (m model) renderDiskUsage(width, height int) string {
+	panelW := min(100, max(48, width-8))
+	innerW := panelW - 6
+	titleStyle := lipgloss.NewStyle().Foreground(clrTitle).Bold(true)
+	mutedStyle := lipgloss.NewStyle().Foreground(clrMuted)
+	sizeStyle := lipgloss.NewStyle().Foreground(clrSize)
+	barStyle := lipgloss.NewStyle().Foreground(clrAccent)
+	dimStyle := lipgloss.NewStyle().Foreground(clrDim)
+
+	var lines []string
+	switch {
+	case m.duScanning:
+		lines = []string{
+			titleStyle.Render("Disk usage"), "",
+			mutedStyle.Render(fmt.Sprintf("Scanning… %d files", m.duScanned.Load())),
+		}
+	case m.duDir == nil:
+		lines = []string{titleStyle.Render("Disk usage"), "", mutedStyle.Render("Nothing scanned.")}
+	default:
+		rel, err := filepath.Rel(filepath.Dir(m.duRoot.path), m.duDir.path)
+		if err != nil {
+			rel = m.duDir.path
+		}
+		header := titleStyle.Render("Disk usage  ") + mutedStyle.Render(trimVisual(rel, innerW-24))
+		total := sizeStyle.Render(humanSize(m.duDir.size))
+		lines = []string{padRight(header, innerW-lipgloss.Width(total)) + total, ""}
+
+		children := m.duDir.children
+		if len(children) == 0 {
+			lines = append(lines, mutedStyle.Render("(empty directory)"))
+		}
+		var largest int64
+		if len(children) > 0 {
+			largest = children[0].size
+		}
+		barW := min(24, innerW/4)
+		nameW := max(8, innerW-barW-18)
+		start, end := visibleWindow(m.duCursor, len(children), max(1, height-10))
+		for i := start; i < end; i++ {
+			c := children[i]
+			filled := 0
+			if largest > 0 {
+				filled = int(int64(barW) * c.size / largest)
+			}
+			pct := 0.0
+			if m.duDir.size > 0 {
+				pct = float64(c.size) * 100 / float64(m.duDir.size)
+			}
+			name := c.name
+			if c.isDir {
+				name += "/"
+			}
+			size := fmt.Sprintf("%9s", humanSize(c.size))
+			share := fmt.Sprintf(" %5.1f%% ", pct)
+			bar := strings.Repeat("█", filled) + strings.Repeat("░", barW-filled)
+			label := " " + padRight(trimVisual(name, nameW), nameW)
+			if i == m.duCursor {
+				sel := lipgloss.NewStyle().Background(clrAccent).Foreground(clrAccentFg).Bold(true)
+				lines = append(lines, sel.Render(size+share+bar+label))
+				continue
+			}
+			nameStyle := lipgloss.NewStyle().Foreground(clrFile)
+			if c.isDir {
+				nameStyle = lipgloss.NewStyle().Foreground(clrDir)
+			}
+			lines = append(lines, sizeStyle.Render(size)+mutedStyle.Render(share)+
+				barStyle.Render(strings.Repeat("█", filled))+dimStyle.Render(strings.Repeat("░", barW-filled))+
+				nameStyle.Render(label))
+		}
+	}
+	lines = append(lines, "", mutedStyle.Render("l/h in/out  ·  d trash  ·  o show in list  ·  r rescan  ·  esc close"))
+
+	box := lipgloss.NewStyle().
+		Width(panelW).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(clrBorderStrong).
+		Padding(1, 2).
+		Render(strings.Join(lines, "\n"))
+	return centerOverlay(box, width, height)
+}
+
+// ── version control ───────────────────────────────────────────────────────────
+
+// vcsState is the state of the working copy holding a directory, as shown in
+// the top bar and the list's status badges.
+type vcsState struct {
+	kind          string // the vcs name: "git", "hg" or "jj"
+	root          string // top-level directory of the working copy
+	branch        string // branch, bookmark or change; a short hash when detached
+	ahead, behind int    // commits relative to the upstream branch (git only)
+	dirty         bool   // changed, staged or untracked files
+	// files maps the absolute path of each changed file to its two-letter
+	// status: index then working tree, as in `git status --short`. Systems
+	// without an index report every change in the working-tree letter.
+	files map[string]string
+}
+
+// vcs is a version control system whose working copies seer shows the
+// state of.
+type vcs interface {
+	// name is both the system's command and its vcsState kind.
+	name() string
+	// marker is the entry that marks the root of a working copy.
+	marker() string
+	// status reads the state of the working copy at root.
+	status(ctx context.Context, root string) (*vcsState, error)
+}
+
+// vcsBackends are tried in order at each level when looking for the working
+// copy holding a directory. jj comes first: its repositories usually also
+// have a .git.
+var vcsBackends = []vcs{jjVCS{}, gitVCS{}, hgVCS{}}
+
+// findWorkingCopy walks up from dir to the nearest working copy root.
+func findWorkingCopy(dir string) (vcs, string) {
+	for {
+		for _, v := range vcsBackends {
+			if _, err := os.Stat(filepath.Join(dir, v.marker())); err == nil {
+				return v, dir
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, ""
+		}
+		dir = parent
+	}
+}
+
+// vcsStatusMsg delivers the working copy state of dir; info is nil when dir
+// is not inside a working copy or its vcs isn't installed.
+type vcsStatusMsg struct {
+	dir  string
+	info *vcsState
+}
+
+// requestVCSStatus reads the working copy state of cwd in the background
+// unless it is already known or on its way.
+func (m *model) requestVCSStatus() tea.Cmd {
+	if m.vcsDir == m.cwd || m.deepSearch {
+		return nil
+	}
+	m.vcsDir = m.cwd
+	dir := m.cwd
+	return func() tea.Msg {
+		return vcsStatusMsg{dir: dir, info: readVCSStatus(dir)}
+	}
+}
+
+// readVCSStatus finds the working copy holding dir and reads its state.
+func readVCSStatus(dir string) *vcsState {
+	v, root := findWorkingCopy(dir)
+	if v == nil || !commandExists(v.name()) {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), previewerTimeout)
+	defer cancel()
+	info, err := v.status(ctx, root)
+	if err != nil {
+		return nil
+	}
+	info.kind, info.root = v.name(), root
+	return info
+}
+
+// inGitRepo reports whether cwd is in a git working copy, which the
+// staging, blame and diff commands need.
+func (m model) inGitRepo() bool {
+	return m.vcs != nil && m.vcsDir == m.cwd && m.vcs.kind == "git"
+}
+
+// gitVCS reads `git status`.
+type gitVCS struct{}
+
+func (gitVCS) name() string   { return "git" }
+func (gitVCS) marker() string { return ".git" }
+
+func (gitVCS) status(ctx context.Context, root string) (*vcsState, error) {
+	// --no-optional-locks keeps a background status from getting in the
+	// way of git commands the user runs meanwhile.
+	out, err := exec.CommandContext(ctx, "git", "--no-optional-locks", "-C", root, "status", "--porcelain=v2", "--branch", "-z").Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseGitStatus(root, string(out)), nil
+}
+
+// hgVCS reads Mercurial's `hg status`, which has no staging area.
+type hgVCS struct{}
+
+func (hgVCS) name() string   { return "hg" }
+func (hgVCS) marker() string { return ".hg" }
+
+func (hgVCS) status(ctx context.Context, root string) (*vcsState, error) {
+	head, err := hgCommand(ctx, root, "log", "-r", ".", "-T", "{branch}\n{activebookmark}")
+	if err != nil {
+		return nil, err
+	}
+	out, err := hgCommand(ctx, root, "status", "--print0")
+	if err != nil {
+		return nil, err
+	}
+	info := &vcsState{files: make(map[string]string)}
+	branch, bookmark, _ := strings.Cut(head, "\n")
+	info.branch = branch
+	if bookmark != "" {
+		info.branch = bookmark
+	}
+	// "M path": Modified, Added, Removed, ! missing, ? untracked.
+	codes := map[byte]string{'M': ".M", 'A': ".A", 'R': ".D", '!': ".D", '?': "??"}
+	for _, rec := range strings.Split(out, "\x00") {
+		if len(rec) < 3 {
+			continue
+		}
+		if xy, ok := codes[rec[0]]; ok {
+			info.files[filepath.Join(root, filepath.FromSlash(rec[2:]))] = xy
+			info.dirty = true
+		}
+	}
+	return info, nil
+}
+
+// hgCommand runs hg in root with the user's aliases and output tweaks
+// turned off, so paths come out relative to root.
+func hgCommand(ctx context.Context, root string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "hg", args...)
+	cmd.Dir = root
+	cmd.Env = append(os.Environ(), "HGPLAIN=1")
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// jjVCS reads Jujutsu, whose working copy is itself a change: its files
+// are the ones that change modifies.
+type jjVCS struct{}
+
+func (jjVCS) name() string   { return "jj" }
+func (jjVCS) marker() string { return ".jj" }
+
+func (jjVCS) status(ctx context.Context, root string) (*vcsState, error) {
+	head, err := jjCommand(ctx, root, "log", "-r", "@", "--no-graph", "-T", `separate(" ", bookmarks, change_id.shortest(8))`)
+	if err != nil {
+		return nil, err
+	}
+	out, err := jjCommand(ctx, root, "diff", "-r", "@", "--summary")
+	if err != nil {
+		return nil, err
+	}
+	info := &vcsState{branch: strings.TrimSpace(head), files: make(map[string]string)}
+	// "M path": Modified, Added, Deleted, Renamed/Copied as "R {a => b}".
+	for _, line := range strings.Split(out, "\n") {
+		if len(line) < 3 || line[1] != ' ' {
+			continue
+		}
+		path := line[2:]
+		if i := strings.Index(path, " => "); i >= 0 {
+			// "dir/{old => new}/file" or "old => new"
+			lb, rb := strings.LastIndex(path[:i], "{"), strings.Index(path[i:], "}")
+			if lb >= 0 && rb >= 0 {
+				path = path[:lb] + path[i+4:i+rb] + path[i+rb+1:]
+			} else {
+				path = path[i+4:]
+			}
+		}
+		info.files[filepath.Join(root, filepath.FromSlash(path))] = "." + line[:1]
+		info.dirty = true
+	}
+	return info, nil
+}
+
+// jjCommand runs jj in root without colour or a pager, so paths come out
+// relative to root.
+func jjCommand(ctx context.Context, root string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "jj", append([]string{"--no-pager", "--color=never"}, args...)...)
+	cmd.Dir = root
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// ── git ───────────────────────────────────────────────────────────────────────
+
+// parseGitStatus reads the branch headers and change records of
+// `git status --porcelain=v2 --branch -z`, whose paths are relative to the
+// repository root.
+func parseGitStatus(root, out string) *vcsState {
+	info := &vcsState{root: root, files: make(map[string]string)}
+	var oid string
+	records := strings.Split(out, "\x00")
+	for i := 0; i < len(records); i++ {
+		line := records[i]
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "# branch.oid "):
+			oid = strings.TrimPrefix(line, "# branch.oid ")
+		case strings.HasPrefix(line, "# branch.head "):
+			info.branch = strings.TrimPrefix(line, "# branch.head ")
+		case strings.HasPrefix(line, "# branch.ab "):
+			fmt.Sscanf(strings.TrimPrefix(line, "# branch.ab "), "+%d -%d", &info.ahead, &info.behind)
+		case strings.HasPrefix(line, "#"):
+		default:
+			info.dirty = true
+			// "1 XY sub mH mI mW hH hI path", "2 XY … score path" then the
+			// original path as its own record, "u XY … path", "? path".
+			if len(line) < 4 {
+				continue
+			}
+			xy, path := line[2:4], ""
+			switch line[0] {
+			case '1':
+				path = gitStatusPath(line, 8)
+			case '2':
+				path = gitStatusPath(line, 9)
+				i++ // the rename's source
+			case 'u':
+				path = gitStatusPath(line, 10)
+			case '?':
+				xy, path = "??", line[2:]
+			}
+			if path != "" {
+				info.files[filepath.Join(root, filepath.FromSlash(path))] = xy
+			}
+		}
+	}
+	if info.branch == "(detached)" && len(oid) >= 7 {
+		info.branch = oid[:7]
+	}
+	return info
+}
+
+// maxGitLogCommits bounds the history shown by the git log preview.
+const maxGitLogCommits = 500
+
+// renderGitLog lists the recent commits touching path, newest first: short
+// hash, date, author and subject.
+func renderGitLog(path string) (string, error) {
+	if !commandExists("git") {
+		return "git log needs git installed", nil
+	}
+	dir := path
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		dir = filepath.Dir(path)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), previewerTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "git", "-C", dir, "log", "-n", strconv.Itoa(maxGitLogCommits),
+		"--date=short", "--format=%h%x1f%ad%x1f%an%x1f%s", "--", path).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "git log: " + strings.TrimSpace(string(exitErr.Stderr)), nil
+		}
+		return "", err
+	}
+
+	type commit struct{ hash, date, author, subject string }
+	var commits []commit
+	authorW := 0
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		f := strings.SplitN(line, "\x1f", 4)
+		if len(f) < 4 {
+			continue
+		}
+		c := commit{f[0], f[1], trimVisual(f[2], 18), f[3]}
+		authorW = max(authorW, lipgloss.Width(c.author))
+		commits = append(commits, c)
+	}
+	if len(commits) == 0 {
+		return jsonMuted.Render("  no commits touch " + filepath.Base(path)), nil
+	}
+
+	hashStyle := lipgloss.NewStyle().Foreground(clrConfig)
+	authorStyle := lipgloss.NewStyle().Foreground(clrDoc)
+	var sb strings.Builder
+	title := countNoun(len(commits), "commit")
+	if len(commits) == maxGitLogCommits {
+		title = fmt.Sprintf("latest %d commits", maxGitLogCommits)
+	}
+	sb.WriteString(jsonMuted.Render("  git log · " + title + " · alt+l returns"))
+	sb.WriteString("\n")
+	for _, c := range commits {
+		sb.WriteString("\n")
+		sb.WriteString(hashStyle.Render(c.hash) + " " + jsonMuted.Render(c.date) + " " +
+			authorStyle.Render(padRight(c.author, authorW)) + " " + c.subject)
+	}
+	return sb.String(), nil
+}
+
+// renderGitBlame shows path's highlighted source with a gutter naming the
+// commit, author and age of each line. A commit's run of lines is labelled
+// once. There is no header, so line n of the blame is line n of the file
+// and switching views keeps the scroll position.
+func renderGitBlame(path string, size int64) (string, error) {
+	if !commandExists("git") {
+		return "git blame needs git installed", nil
+	}
+	args := []string{"-C", filepath.Dir(path), "blame", "--line-porcelain"}
+	if size > maxPreviewBytes {
+		// Blame what the normal preview shows first.
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		buf := make([]byte, maxPreviewBytes)
+		n, _ := io.ReadFull(f, buf)
+		f.Close()
+		args = append(args, "-L", fmt.Sprintf("1,%d", max(1, bytes.Count(buf[:n], []byte("\n")))))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), previewerTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "git", append(args, "--", filepath.Base(path))...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "git blame: " + strings.TrimSpace(string(exitErr.Stderr)), nil
+		}
+		return "", err
+	}
+
+	type blameLine struct {
+		hash, author string
+		when         time.Time
+	}
+	var lines []blameLine
+	var text strings.Builder
+	var cur blameLine
+	for _, line := range strings.Split(string(out), "\n") {
+		switch {
+		case strings.HasPrefix(line, "\t"):
+			text.WriteString(strings.TrimSuffix(line[1:], "\r"))
+			text.WriteString("\n")
+			lines = append(lines, cur)
+			cur = blameLine{}
+		case strings.HasPrefix(line, "author "):
+			cur.author = strings.TrimPrefix(line, "author ")
+		case strings.HasPrefix(line, "author-time "):
+			if sec, err := strconv.ParseInt(strings.TrimPrefix(line, "author-time "), 10, 64); err == nil {
+				cur.when = time.Unix(sec, 0)
+			}
+		case cur.hash == "" && len(line) >= 40 && !strings.Contains(line[:40], " "):
+			cur.hash = line[:40]
+		}
+	}
+	if len(lines) == 0 {
+		return jsonMuted.Render("  nothing to blame in " + filepath.Base(path)), nil
+	}
+
+	source := strings.TrimSuffix(text.String(), "\n")
+	if highlighted := highlight(path, source); highlighted != "" {
+		source = highlighted
+	}
+	hashStyle := lipgloss.NewStyle().Foreground(clrConfig)
+	authorStyle := lipgloss.NewStyle().Foreground(clrDoc)
+	sepStyle := lipgloss.NewStyle().Foreground(clrBorder)
+	const authorW, ageW = 12, 8
+	blank := strings.Repeat(" ", 8+authorW+1+ageW)
+	now := time.Now()
+	var sb strings.Builder
+	for i, src := range strings.Split(source, "\n") {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		gutter := blank
+		if i < len(lines) && (i == 0 || lines[i].hash != lines[i-1].hash) {
+			l := lines[i]
+			if strings.Trim(l.hash, "0") == "" {
+				gutter = jsonMuted.Render(padRight("uncommitted", len(blank)))
+			} else {
+				gutter = hashStyle.Render(l.hash[:7]) + " " + authorStyle.Render(padRight(l.author, authorW)) + " " +
+					jsonMuted.Render(fmt.Sprintf("%*s", ageW, formatMtime(l.when, now, "relative")))
+			}
+		}
+		sb.WriteString(gutter + sepStyle.Render(" │ ") + src)
+	}
+	return sb.String(), nil
+}
+
+// renderGitDiff shows the uncommitted changes to path, staged or not, as a
+// coloured diff. An untracked file shows as wholly added.
+func renderGitDiff(path string, width int) (string, error) {
+	if !commandExists("git") {
+		return "git diff needs git installed", nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), previewerTimeout)
+	defer cancel()
+	dir := filepath.Dir(path)
+	out, err := exec.CommandContext(ctx, "git", "-C", dir, "diff", "--no-color", "HEAD", "--", path).Output()
+	if err == nil && len(out) == 0 {
+		// Untracked, or unchanged: compare with nothing. Exit status 1
+		// just means the two differ.
+		out, err = exec.CommandContext(ctx, "git", "-C", dir, "diff", "--no-color", "--no-index", "--", os.DevNull, path).Output()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			err = nil
+		}
+		if err == nil {
+			if xy, _ := exec.CommandContext(ctx, "git", "-C", dir, "status", "--porcelain", "--", path).Output(); len(xy) == 0 {
+				return jsonMuted.Render("  no uncommitted changes to " + filepath.Base(path)), nil
+			}
+		}
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "git diff: " + strings.TrimSpace(string(exitErr.Stderr)), nil
+		}
+		return "", err
+	}
+	truncated := len(out) > maxPreviewBytes
+	if truncated {
+		out = out[:bytes.LastIndexByte(out[:maxPreviewBytes], '\n')+1]
+	}
+	return renderDiffPreview(strings.TrimSuffix(string(out), "\n"), width, truncated), nil
+}
+
+// setGitDiffView turns the diff view on or off; it replaces the log and
+// blame views.
+func (m *model) setGitDiffView(on bool) {
+	m.gitDiffView = on
+	if on {
+		m.follow = nil
+		m.gitLogView, m.gitBlameView = false, false
+		m.status = "git diff"
+	} else {
+		m.status = "preview"
+	}
+	m.previewOffset = 0
+	m.previewColumn = 0
+}
+
+// changedPaths lists the repository's changed and untracked files, sorted.
+func (m model) changedPaths() []string {
+	if m.vcs == nil {
+		return nil
+	}
+	paths := make([]string, 0, len(m.vcs.files))
+	for path := range m.vcs.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// updateChangesPanel handles keys while the changed-files list is open.
+func (m *model) updateChangesPanel(msg tea.KeyMsg) tea.Cmd {
+	paths := m.changedPaths()
+	switch msg.String() {
+	case "esc", "q", "alt+g":
+		m.showChanges = false
+	case "j", "down":
+		m.changesCursor = min(m.changesCursor+1, max(0, len(paths)-1))
+	case "k", "up":
+		m.changesCursor = max(0, m.changesCursor-1)
+	case "enter", "l":
+		if m.changesCursor >= len(paths) {
+			return nil
+		}
+		path := paths[m.changesCursor]
+		m.showChanges = false
+		if err := m.changeDir(filepath.Dir(path)); err != nil {
+			m.setError(err.Error())
+			return nil
+		}
+		m.selectPath(path)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() && m.vcs != nil && m.vcs.kind == "git" {
+			m.setGitDiffView(true)
+		}
+		return m.requestPreview()
+	}
+	return nil
+}
+
+// renderChangesPanel lists the changed files of the whole repository with
+// their status badges and paths relative to its root.
+func (m model) renderChangesPanel(width, height int) string {
+	panelW := min(90, max(40, width-8))
+	innerW := panelW - 6
+	titleStyle := lipgloss.NewStyle().Foreground(clrTitle).Bold(true)
+	mutedStyle := lipgloss.NewStyle().Foreground(clrMuted)
+
+	paths := m.changedPaths()
+	title := "Changes"
+	if m.vcs != nil {
+		title += " in " + filepath.Base(m.vcs.root)
+	}
+	lines := []string{titleStyle.Render(title), ""}
+	if len(paths) == 0 {
+		lines = append(lines, mutedStyle.Render("The working tree is clean."))
+	}
+	start, end := visibleWindow(m.changesCursor, len(paths), max(1, height-10))
+	for i := start; i < end; i++ {
+		xy := m.vcs.files[paths[i]]
+		rel, err := filepath.Rel(m.vcs.root, paths[i])
+		if err != nil {
+			rel = paths[i]
+		}
+		rel = trimVisual(rel, innerW-5)
+		code := strings.ReplaceAll(xy, ".", " ") // as git status --short shows it
+		row := renderStatusBadge(xy) + " " + mutedStyle.Render(code) + " " + rel
+		if i == m.changesCursor {
+			row = lipgloss.NewStyle().Background(clrAccent).Foreground(clrAccentFg).Bold(true).
+				Render(padRight(ansi.Strip(renderStatusBadge(xy))+" "+code+" "+rel, innerW))
+		}
+		lines = append(lines, row)
+	}
+	lines = append(lines, "", mutedStyle.Render("enter jump and show the diff  ·  esc close"))
+
+	box := lipgloss.NewStyle().
+		Width(panelW).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(clrBorderStrong).
+		Padding(1, 2).
+		Render(strings.Join(lines, "\n"))
+	return centerOverlay(box, width, height)
+}
+
+// repoKind reports whether dir is the root of its own git working tree: a
+// ".git" directory makes it a "repo", and a ".git" file's "gitdir:" line
+// makes it a "submodule" when it points into a modules directory and a linked
+// "worktree" otherwise.
+func repoKind(dir string) string {
+	gitPath := filepath.Join(dir, ".git")
+	info, err := os.Lstat(gitPath)
+	switch {
+	case err != nil:
+		return ""
+	case info.IsDir():
+		return "repo"
+	case !info.Mode().IsRegular():
+		return ""
+	}
+	data, err := os.ReadFile(gitPath)
+	if err != nil {
+		return ""
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	gitdir, ok := strings.CutPrefix(strings.TrimSpace(line), "gitdir:")
+	if !ok {
+		return ""
+	}
+	if strings.Contains(filepath.ToSlash(strings.TrimSpace(gitdir)), "/modules/") {
+		return "submodule"
+	}
+	return "worktree"
+}
+
+// repoIcon marks directories that are repositories of their own.
+func repoIcon() string {
+	if nerdFonts {
+		return "\ue5fb " // folder with the git logo
+	}
+	return "± "
+}
+
+// gitHead describes the checked-out commit of the repository at dir: its
+// branch (or "detached"), short hash and subject.
+func gitHead(dir string) string {
+	if !commandExists("git") {
+		return "install git for its branch"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), previewerTimeout)
+	defer cancel()
+	branch, err := exec.CommandContext(ctx, "git", "-C", dir, "symbolic-ref", "--short", "-q", "HEAD").Output()
+	head := strings.TrimSpace(string(branch))
+	if err != nil || head == "" {
+		head = "detached"
+	}
+	commit, err := exec.CommandContext(ctx, "git", "-C", dir, "log", "-1", "--format=%h %s").Output()
+	if err != nil || len(commit) == 0 {
+		return head + " · no commits"
+	}
+	return head + " @ " + strings.TrimSpace(string(commit))
+}
+
+// gitJob runs a git command in dir as a background job.
+func gitJob(dir string, args ...string) jobFunc {
+	return func(ctx context.Context, j *job) (string, error) {
+		return "", gitRun(ctx, dir, args...)
+	}
+}
+
+// gitRun runs a git command in dir, returning its error output as the error
+// when it fails.
+func gitRun(ctx context.Context, dir string, args ...string) error {
+	out, err := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	if err != nil && len(bytes.TrimSpace(out)) > 0 {
+		msg, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+		return errors.New(strings.TrimPrefix(msg, "fatal: "))
+	}
+	return err
+}
+
+// gitStage stages the marked entries or the selection (stage) or takes them
+// back out of the index, leaving the working tree as it is.
+func (m *model) gitStage(stage bool) tea.Cmd {
+	if !m.inGitRepo() {
+		m.setError("not in a git repository")
+		return nil
+	}
+	paths := m.targetPaths()
+	if len(paths) == 0 {
+		return nil
+	}
+	args, verb := append([]string{"add", "--all", "--"}, paths...), "stage"
+	if !stage {
+		args, verb = append([]string{"restore", "--staged", "--"}, paths...), "unstage"
+	}
+	// The job's reload when done refreshes the badges.
+	return m.startJob(verb+" "+countNoun(len(paths), "path"), gitJob(m.cwd, args...))
+}
+
+// confirmDiscard asks before restoring the changed files among (or inside)
+// the marked entries or the selection to their staged or committed content.
+// Untracked files are left alone: git has nothing to restore them to.
+func (m *model) confirmDiscard() {
+	if !m.inGitRepo() {
+		m.setError("not in a git repository")
+		return
+	}
+	var paths []string
+	for _, target := range m.targetPaths() {
+		prefix := target + string(filepath.Separator)
+		for path, xy := range m.vcs.files {
+			if (path == target || strings.HasPrefix(path, prefix)) && xy != "??" && xy[1] != '.' {
+				paths = append(paths, path)
+			}
+		}
+	}
+	sort.Strings(paths)
+	if len(paths) == 0 {
+		m.status = "discard: no unstaged changes to tracked files"
+		return
+	}
+	m.discardTargets = paths
+}
+
+// renderDiscardDialog asks whether to throw away the working-tree changes
+// to discardTargets.
+func (m model) renderDiscardDialog(width, height int) string {
+	names := make([]string, 0, len(m.discardTargets))
+	for _, path := range m.discardTargets {
+		names = append(names, filepath.Base(path))
+	}
+	meta := "Unstaged changes are lost  •  " + countNoun(len(names), "file")
+	return renderConfirmDialog(width, height, "Discard Changes?", strings.Join(names, ", "), meta, "discard")
+}
+
+// gitStatusPath returns the path of a porcelain v2 record, which follows n
+// space-separated fields and may itself contain spaces.
+func gitStatusPath(line string, n int) string {
+	fields := strings.SplitN(line, " ", n+1)
+	if len(fields) <= n {
+		return ""
+	}
+	return fields[n]
+}
+
+// fileStatus returns the status of path in the current repository: its
+// two-letter code, "" when unchanged. A directory holding changes reports
+// "••".
+func (m model) fileStatus(path string, isDir bool) string {
+	g := m.vcs
+	if g == nil || len(g.files) == 0 {
+		return ""
+	}
+	if xy, ok := g.files[path]; ok {
+		return xy
+	}
+	if !isDir {
+		return ""
+	}
+	prefix := path + string(filepath.Separator)
+	for p := range g.files {
+		if strings.HasPrefix(p, prefix) {
+			return "••"
+		}
+	}
+	return ""
+}
+
+// renderStatusBadge is the one-cell status marker drawn before an entry's
+// name: unstaged changes in the danger colour, staged ones in green.
+func renderStatusBadge(xy string) string {
+	switch {
+	case xy == "":
+		return " "
+	case xy == "••":
+		return jsonMuted.Render("•")
+	case xy == "??":
+		return lipgloss.NewStyle().Foreground(clrDanger).Render("?")
+	case xy[0] == 'U' || xy[1] == 'U' || xy == "AA" || xy == "DD":
+		return lipgloss.NewStyle().Foreground(clrDanger).Bold(true).Render("!")
+	case xy[1] != '.':
+		return lipgloss.NewStyle().Foreground(clrDanger).Render(xy[1:])
+	}
+	return lipgloss.NewStyle().Foreground(clrExec).Render(xy[:1])
+}
+
+// renderVCSLabel is the branch, ahead/behind counts and dirty marker shown
+// after the breadcrumb, or "" outside a repository.
+func (m model) renderVCSLabel() string {
+	g := m.vcs
+	if g == nil || m.vcsDir != m.cwd {
+		return ""
+	}
+	icon := "⎇ "
+	if nerdFonts {
+		icon = "\ue0a0 "
+	}
+	if g.kind != "git" {
+		icon += g.kind + " "
+	}
+	label := "  " + icon + g.branch
+	if g.ahead > 0 {
+		label += fmt.Sprintf(" ↑%d", g.ahead)
+	}
+	if g.behind > 0 {
+		label += fmt.Sprintf(" ↓%d", g.behind)
+	}
+	out := lipgloss.NewStyle().Foreground(clrAccent).Render(label)
+	if g.dirty {
+		out += lipgloss.NewStyle().Foreground(clrDanger).Render(" ●")
+	}
+	return out
+}
+
+// ── directory counts ──────────────────────────────────────────────────────────
+
+const (
+	dirCountWorkers = 4
+	// maxDirCountBatch bounds one background batch; the rest are picked up
+	// by later requests as the selection moves.
+	maxDirCountBatch = 256
+)
+
+// dirCount is a cached item count, valid while the directory's mtime and
+// the hidden-file setting it was counted with are unchanged.
+type dirCount struct {
+	modTime time.Time
+	hidden  bool
+	n       int
+}
+
+type dirCountsMsg struct {
+	counts map[string]dirCount
+}
+
+func (m model) dirItemCount(e entry) (int, bool) {
+	c, ok := m.dirCounts[e.path]
+	if !ok || !c.modTime.Equal(e.modTime) || c.hidden != m.showHidden {
+		return 0, false
+	}
+	return c.n, true
+}
+
+// requestDirCounts counts the children of listed directories without a valid
+// cached count, nearest the selection first, on a small worker pool.
+func (m *model) requestDirCounts() tea.Cmd {
+	type pending struct {
+		path    string
+		modTime time.Time
+	}
+	var jobs []pending
+	for i := range 2 * len(m.entries) {
+		// Walk outwards from the selection: selected, +1, -1, +2, -2, …
+		idx := m.selected + (i+1)/2
+		if i%2 == 0 {
+			idx = m.selected - i/2
+		}
+		if idx < 0 || idx >= len(m.entries) {
+			continue
+		}
+		e := m.entries[idx]
+		if !e.isDir || m.countingDirs[e.path] {
+			continue
+		}
+		if _, ok := m.dirItemCount(e); ok {
+			continue
+		}
+		m.countingDirs[e.path] = true
+		jobs = append(jobs, pending{e.path, e.modTime})
+		if len(jobs) == maxDirCountBatch {
+			break
+		}
+	}
+	if len(jobs) == 0 {
+		return nil
+	}
+	hidden := m.showHidden
+	return func() tea.Msg {
+		counts := make(map[string]dirCount, len(jobs))
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		next := make(chan pending)
+		for range dirCountWorkers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := range next {
+					n, err := countDirItems(j.path, hidden)
+					if err != nil {
+						n = -1
+					}
+					mu.Lock()
+					counts[j.path] = dirCount{modTime: j.modTime, hidden: hidden, n: n}
+					mu.Unlock()
+				}
+			}()
+		}
+		for _, j := range jobs {
+			next <- j
+		}
+		close(next)
+		wg.Wait()
+		return dirCountsMsg{counts: counts}
+	}
+}
+
+// countDirItems counts dir's children, skipping hidden ones unless hidden.
+func countDirItems(dir string, hidden bool) (int, error) {
+	items, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	if hidden {
+		return len(items), nil
+	}
+	n := 0
+	for _, item := range items {
+		if !isHiddenDirEntry(item) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// formatItemCount renders n for the size column, shortening to the bare
+// number when "n items" doesn't fit in w. Unreadable directories (n < 0)
+// show nothing.
+func formatItemCount(n, w int) string {
+	switch {
+	case n < 0:
+		return ""
+	case n == 1:
+		return "1 item"
+	}
+	if s := fmt.Sprintf("%d items", n); len(s) <= w {
+		return s
+	}
+	return strconv.Itoa(n)
+}
+
+// ── tree view ─────────────────────────────────────────────────────────────────
+
+// loadEntries lists dir for the file list: flat, or in tree view with the
+// contents of expanded directories spliced in below them.
+func (m model) loadEntries(dir string) ([]entry, error) {
+	entries, err := listDir(dir, m.showHidden)
+	if err != nil {
+		return nil, err
+	}
+	entries = m.dropIgnored(entries)
+	if !m.treeMode {
+		return entries, nil
+	}
+	return m.expandTree(entries, 0), nil
+}
+
+// dropIgnored removes ignored entries when ignore_mode is "hide" and they
+// haven't been revealed with I.
+func (m model) dropIgnored(entries []entry) []entry {
+	if m.showIgnored || userConfig.ignoreMode != "hide" {
+		return entries
+	}
+	kept := entries[:0]
+	for _, e := range entries {
+		if !e.ignored {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// dropGitIgnored removes the entries git is known to ignore when
+// hideGitIgnored is set, along with the tree view's children of an ignored
+// directory. Entries not yet checked stay until requestGitIgnored's answer
+// arrives.
+func (m model) dropGitIgnored(entries []entry) []entry {
+	if !m.hideGitIgnored || len(m.gitIgnored) == 0 {
+		return entries
+	}
+	kept := make([]entry, 0, len(entries))
+	skipBelow := -1 // depth of an ignored directory whose children follow
+	for _, e := range entries {
+		if skipBelow >= 0 && e.depth > skipBelow {
+			continue
+		}
+		skipBelow = -1
+		if m.gitIgnored[e.path] {
+			skipBelow = e.depth
+			continue
+		}
+		kept = append(kept, e)
+	}
+	return kept
+}
+
+// gitIgnoredMsg answers requestGitIgnored: which of the checked paths git
+// ignores.
+type gitIgnoredMsg struct {
+	checked []string
+	ignored map[string]bool
+}
+
+// requestGitIgnored asks git in the background about the listed paths it
+// hasn't been asked about yet, or about all of them once gitIgnoreStale is
+// set. Both panes' listings are checked.
+func (m *model) requestGitIgnored() tea.Cmd {
+	if !m.hideGitIgnored || m.deepSearch || !commandExists("git") {
+		return nil
+	}
+	if m.gitIgnored == nil {
+		m.gitIgnored = make(map[string]bool)
+	}
+	listings := map[string][]entry{m.cwd: m.allEntries}
+	if m.dualPane {
+		listings[m.otherPane.cwd] = append(listings[m.otherPane.cwd], m.otherPane.allEntries...)
+	}
+	batches := make(map[string][]string)
+	var checked []string
+	for dir, entries := range listings {
+		for _, e := range entries {
+			_, known := m.gitIgnored[e.path]
+			if known && !m.gitIgnoreStale {
+				continue
+			}
+			if !known {
+				m.gitIgnored[e.path] = false // asked; shown until answered
+			}
+			batches[dir] = append(batches[dir], e.path)
+			checked = append(checked, e.path)
+		}
+	}
+	m.gitIgnoreStale = false
+	if len(checked) == 0 {
+		return nil
+	}
+	return func() tea.Msg {
+		ignored := make(map[string]bool)
+		for dir, paths := range batches {
+			for _, p := range checkGitIgnored(dir, paths) {
+				ignored[p] = true
+			}
+		}
+		return gitIgnoredMsg{checked: checked, ignored: ignored}
+	}
+}
+
+// applyGitIgnored records git's answer and filters both panes again if it
+// changed what they show.
+func (m *model) applyGitIgnored(msg gitIgnoredMsg) tea.Cmd {
+	changed := false
+	for _, p := range msg.checked {
+		if m.gitIgnored[p] != msg.ignored[p] {
+			m.gitIgnored[p] = msg.ignored[p]
+			changed = true
+		}
+	}
+	if !changed || !m.hideGitIgnored {
+		return nil
+	}
+	var prevPath string
+	if m.selected < len(m.entries) {
+		prevPath = m.entries[m.selected].path
+	}
+	m.entries = m.applySearch(m.allEntries)
+	m.selectPath(prevPath)
+	if m.dualPane {
+		p := &m.otherPane
+		filter := *m
+		filter.searchQuery = p.searchQuery
+		p.entries = filter.applySearch(p.allEntries)
+		p.selected = max(0, min(p.selected, len(p.entries)-1))
+	}
+	if len(m.entries) > 0 && m.entries[m.selected].path == prevPath {
+		return nil
+	}
+	return m.loadPreview() // the selected entry was hidden
+}
+
+// checkGitIgnored returns which of paths, all within dir, git ignores, in
+// one `git check-ignore` run. A path inside a submodule fails the whole run,
+// so then each directory is asked on its own. Outside a repository nothing
+// is ignored.
+func checkGitIgnored(dir string, paths []string) []string {
+	if ignored, ok := gitCheckIgnore(dir, paths); ok {
+		return ignored
+	}
+	byDir := make(map[string][]string)
+	for _, p := range paths {
+		byDir[filepath.Dir(p)] = append(byDir[filepath.Dir(p)], p)
+	}
+	var ignored []string
+	for d, ps := range byDir {
+		if names, ok := gitCheckIgnore(d, ps); ok {
+			ignored = append(ignored, names...)
+		}
+	}
+	return ignored
+}
+
+// gitCheckIgnore runs `git check-ignore` in dir on absolute paths, which it
+// echoes back when ignored. ok is false when git refused the batch.
+func gitCheckIgnore(dir string, paths []string) (ignored []string, ok bool) {
+	var input strings.Builder
+	for _, p := range paths {
+		input.WriteString(p)
+		input.WriteByte(0)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), previewerTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "check-ignore", "-z", "--stdin")
+	cmd.Stdin = strings.NewReader(input.String())
+	out, err := cmd.Output()
+	// Exit status 1 means nothing is ignored.
+	var exit *exec.ExitError
+	if err != nil && !(errors.As(err, &exit) && exit.ExitCode() == 1) {
+		return nil, false
+	}
+	for _, p := range strings.Split(string(out), "\x00") {
+		if p != "" {
+			ignored = append(ignored, p)
+		}
+	}
+	return ignored, true
+}
+
+func (m model) expandTree(entries []entry, depth int) []entry {
+	out := make([]entry, 0, len(entries))
+	for _, e := range entries {
+		e.depth = depth
+		out = append(out, e)
+		if !e.isDir || !m.expanded[e.path] {
+			continue
+		}
+		// Unreadable directories simply show no children.
+		if children, err := listDir(e.path, m.showHidden); err == nil {
+			out = append(out, m.expandTree(m.dropIgnored(children), depth+1)...)
+		}
+	}
+	return out
+}
+
+// expandSelected opens the selected directory in place, or moves onto its
+// first child when it is already open.
+func (m *model) expandSelected() {
+	picked := m.entries[m.selected]
+	if m.expanded[picked.path] {
+		if m.selected+1 < len(m.entries) && m.entries[m.selected+1].depth > picked.depth {
+			m.selected++
+			m.previewOffset = 0
+			m.previewColumn = 0
+		}
+		return
+	}
+	m.expanded[picked.path] = true
+	if err := m.reloadEntries(); err != nil {
+		m.setError(err.Error())
+	}
+}
+
+// collapseSelected closes the selected directory, or the directory containing
+// the selection. It reports false at the top level so h falls back to
+// going up a directory.
+func (m *model) collapseSelected() bool {
+	if len(m.entries) == 0 {
+		return false
+	}
+	picked := m.entries[m.selected]
+	target := picked.path
+	if !picked.isDir || !m.expanded[picked.path] {
+		if picked.depth == 0 {
+			return false
+		}
+		target = filepath.Dir(picked.path)
+	}
+	delete(m.expanded, target)
+	// Forget expanded descendants too so reopening starts collapsed.
+	for path := range m.expanded {
+		if withinDir(target, path) {
+			delete(m.expanded, path)
+		}
+	}
+	if err := m.reloadEntries(); err != nil {
+		m.setError(err.Error())
+	}
+	m.selectPath(target)
+	m.previewOffset = 0
+	m.previewColumn = 0
+	return true
+}
+
+// ── dual pane ─────────────────────────────────────────────────────────────────
+
+// paneState is the inactive side in dual-pane mode, kept complete so it can
+// be rendered and swapped in without re-reading the directory.
+type paneState struct {
+	cwd           string
+	allEntries    []entry
+	entries       []entry
+	selected      int
+	searchQuery   string
+	searching     bool
+	previewOffset int
+}
+
+// dualPaneHeights splits the body between the two lists and the preview
+// docked below them. Short terminals collapse the preview entirely.
+func dualPaneHeights(bodyH int) (int, int) {
+	if bodyH < 20 {
+		return bodyH, 0
+	}
+	previewH := bodyH * 2 / 5
+	return bodyH - previewH - 2, previewH
+}
+
+// toggleDualPane switches dual-pane mode; the other pane starts on the
+// current directory.
+func (m *model) toggleDualPane() tea.Cmd {
+	m.dualPane = !m.dualPane
+	if !m.dualPane {
+		m.status = "single pane"
+		return m.requestPreview()
+	}
+	m.focusRight = false
+	m.otherPane = paneState{cwd: m.cwd, allEntries: m.allEntries, entries: m.allEntries}
+	m.status = "dual pane: tab switches, F5 copies, F6 moves to the other pane"
+	return m.requestPreview()
+}
+
+// swapPanes moves focus to the other pane by exchanging it with the live state.
+func (m *model) swapPanes() tea.Cmd {
+	live := paneState{
+		cwd:           m.cwd,
+		allEntries:    m.allEntries,
+		entries:       m.entries,
+		selected:      m.selected,
+		searchQuery:   m.searchQuery,
+		searching:     m.searching,
+		previewOffset: m.previewOffset,
+	}
+	p := m.otherPane
+	m.otherPane = live
+	m.cwd = p.cwd
+	m.allEntries = p.allEntries
+	m.entries = p.entries
+	m.selected = min(p.selected, max(0, len(p.entries)-1))
+	m.searchQuery = p.searchQuery
+	m.searching = p.searching
+	m.previewOffset = p.previewOffset
+	m.focusRight = !m.focusRight
+	m.status = m.cwd
+	return m.requestPreview()
+}
+
+// refreshOtherPane re-reads the inactive pane's directory, keeping its
+// selection on the same name.
+func (m *model) refreshOtherPane() {
+	p := &m.otherPane
+	var prevName string
+	if p.selected < len(p.entries) {
+		prevName = p.entries[p.selected].name
+	}
+	entries, err := m.loadEntries(p.cwd)
+	if err != nil {
+		return
+	}
+	filter := *m
+	filter.searchQuery = p.searchQuery
+	p.allEntries = entries
+	p.entries = filter.applySearch(entries)
+	p.selected = min(p.selected, max(0, len(p.entries)-1))
+	for i, e := range p.entries {
+		if e.name == prevName {
+			p.selected = i
+			break
+		}
+	}
+}
+
+// transferToOtherPane copies (or moves) the marked or selected entries into
+// the other pane's directory as a background job.
+func (m *model) transferToOtherPane(move bool) tea.Cmd {
+	sources := m.targetPaths()
+	if len(sources) == 0 {
+		return nil
+	}
+	dest := m.otherPane.cwd
+	if dest == m.cwd {
+		m.status = "both panes show the same directory"
+		return nil
+	}
+	verb := "copy"
+	if move {
+		verb = "move"
+		m.marked = make(map[string]bool)
+	}
+	title := fmt.Sprintf("%s %d item(s) → %s", verb, len(sources), filepath.Base(dest))
+	return m.startJob(title, copyJob(sources, dest, move))
+}
+
+func (m model) renderDualPane(bodyH int) string {
+	listH, previewH := dualPaneHeights(bodyH)
+	if m.hidePreview {
+		listH, previewH = bodyH, 0
+	}
+	leftW := (m.width - 1) / 2
+	rightW := m.width - 1 - leftW
+
+	other := m
+	other.cwd = m.otherPane.cwd
+	other.entries = m.otherPane.entries
+	other.selected = m.otherPane.selected
+	other.searchQuery = m.otherPane.searchQuery
+	other.searching = m.otherPane.searching
+	other.listScrolled = false
+
+	leftPane, rightPane := m, other
+	leftBorder, rightBorder := clrAccent, clrBorder
+	if m.focusRight {
+		leftPane, rightPane = other, m
+		leftBorder, rightBorder = clrBorder, clrAccent
+	}
+	left := leftPane.renderFileListPane(leftW, listH, paneLabel(leftPane.cwd), leftBorder)
+	right := rightPane.renderFileListPane(rightW, listH, paneLabel(rightPane.cwd), rightBorder)
+
+	sepLines := make([]string, listH)
+	for i := range sepLines {
+		sepLines[i] = lipgloss.NewStyle().Foreground(clrBorder).Render("│")
+	}
+	body := lipgloss.JoinHorizontal(lipgloss.Top, left, strings.Join(sepLines, "\n"), right)
+	if previewH == 0 {
+		return body
+	}
+	return body + "\n" + m.renderPreviewPane(m.width, previewH)
+}
+
+// paneLabel is a dual-pane title: the directory's base name.
+func paneLabel(dir string) string {
+	if base := filepath.Base(dir); base != "" && base != "." {
+		return base
+	}
+	return dir
+}
+
+// ── pane split ────────────────────────────────────────────────────────────────
+
+// The file list's share of the terminal width is stored as a fraction, so a
+// split chosen by dragging the separator or with { and } survives restarts
+// and resizes.
+
+const (
+	minListW    = 26 // the narrowest the file list gets
+	minPreviewW = 30 // the narrowest the preview is squeezed to
+)
+
+func splitPath() string {
+	return filepath.Join(seerStateDir(), "split")
+}
+
+// loadListRatio reads the saved split, or 0 for the default third.
+func loadListRatio() (float64, error) {
+	data, err := os.ReadFile(splitPath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	ratio, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+	if err != nil || ratio <= 0 || ratio >= 1 {
+		return 0, fmt.Errorf("invalid split %q", strings.TrimSpace(string(data)))
+	}
+	return ratio, nil
+}
+
+func saveListRatio(ratio float64) error {
+	path := splitPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(strconv.FormatFloat(ratio, 'f', 4, 64)+"\n"), 0o644)
+}
+
+// setListWidth moves the split so the file list is leftW cells wide, within
+// the limits layoutDimensions keeps to.
+func (m *model) setListWidth(leftW int) {
+	if m.width <= 0 {
+		return
+	}
+	leftW = max(minListW, min(leftW, m.width-minPreviewW))
+	m.listRatio = float64(leftW) / float64(m.width)
+}
+
+// resizeList widens the file list by delta cells (a negative delta narrows
+// it) and keeps the new split.
+func (m *model) resizeList(delta int) tea.Cmd {
+	if m.dualPane || m.hidePreview {
+		m.status = "no preview to resize against"
+		return nil
+	}
+	leftW, _, _ := m.layoutDimensions()
+	m.setListWidth(leftW + delta)
+	return m.saveSplit()
+}
+
+// saveSplit reports and stores the current split, and re-renders the preview
+// for its new width.
+func (m *model) saveSplit() tea.Cmd {
+	leftW, _, _ := m.layoutDimensions()
+	m.status = fmt.Sprintf("list width %d", leftW)
+	if err := saveListRatio(m.listRatio); err != nil {
+		m.setError("split: " + err.Error())
+	}
+	return m.requestPreview()
+}
+
+// separatorAt reports whether a point is on the separator between the list
+// and the preview, or on the list's right border beside it.
+func (m model) separatorAt(x, y int) bool {
+	if m.dualPane || m.hidePreview {
+		return false
+	}
+	leftW, _, bodyH := m.layoutDimensions()
+	// The list's border is drawn outside its width; the separator follows.
+	return (x == leftW+1 || x == leftW+2) && y >= 1 && y <= bodyH+2
+}
+
+// ── bookmarks ─────────────────────────────────────────────────────────────────
+
+// Bookmarks are stored one per line as "<key>\t<directory>".
+func bookmarksPath() string {
+	return filepath.Join(seerStateDir(), "bookmarks")
+}
+
+// isBookmarkKey accepts a single ASCII letter or digit.
+func isBookmarkKey(key string) bool {
+	if len(key) != 1 {
+		return false
+	}
+	c := key[0]
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func loadBookmarks() (map[string]string, error) {
+	bookmarks := make(map[string]string)
+	data, err := os.ReadFile(bookmarksPath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return bookmarks, nil
+		}
+		return bookmarks, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		key, dir, ok := strings.Cut(line, "\t")
+		if ok && isBookmarkKey(key) && dir != "" {
+			bookmarks[key] = dir
+		}
+	}
+	return bookmarks, nil
+}
+
+func saveBookmarks(bookmarks map[string]string) error {
+	var b strings.Builder
+	for _, key := range sortedBookmarkKeys(bookmarks) {
+		fmt.Fprintf(&b, "%s\t%s\n", key, bookmarks[key])
+	}
+	path := bookmarksPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
+
+func sortedBookmarkKeys(bookmarks map[string]string) []string {
+	keys := make([]string, 0, len(bookmarks))
+	for key := range bookmarks {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m *model) setBookmark(key string) {
+	m.bookmarks[key] = m.cwd
+	if err := saveBookmarks(m.bookmarks); err != nil {
+		m.setError("bookmark not saved: " + err.Error())
+		return
+	}
+	m.status = fmt.Sprintf("bookmarked %s as '%s", m.cwd, key)
+}
+
+func (m *model) jumpToBookmark(key string) tea.Cmd {
+	dir, ok := m.bookmarks[key]
+	if !ok {
+		m.status = "no bookmark '" + key
+		return nil
+	}
+	if err := m.changeDir(dir); err != nil {
+		m.setError(err.Error())
+		return nil
+	}
+	return m.requestPreview()
+}
+
+// updateBookmarksPanel handles keys while the bookmark list is open. Pressing
+// a bookmark's own key jumps to it directly.
+func (m *model) updateBookmarksPanel(msg tea.KeyMsg) tea.Cmd {
+	keys := sortedBookmarkKeys(m.bookmarks)
+	switch msg.String() {
+	case "esc", "B", "q":
+		m.showBookmarks = false
+	case "j", "down":
+		m.bookmarkCursor = min(m.bookmarkCursor+1, max(0, len(keys)-1))
+	case "k", "up":
+		m.bookmarkCursor = max(0, m.bookmarkCursor-1)
+	case "enter", "l":
+		if m.bookmarkCursor < len(keys) {
+			m.showBookmarks = false
+			return m.jumpToBookmark(keys[m.bookmarkCursor])
+		}
+	case "x", "delete", "backspace":
+		if m.bookmarkCursor < len(keys) {
+			key := keys[m.bookmarkCursor]
+			delete(m.bookmarks, key)
+			if err := saveBookmarks(m.bookmarks); err != nil {
+				m.setError("bookmarks not saved: " + err.Error())
+			} else {
+				m.status = "removed bookmark '" + key
+			}
+			m.bookmarkCursor = max(0, min(m.bookmarkCursor, len(keys)-2))
+		}
+	default:
+		if key := msg.String(); isBookmarkKey(key) {
+			if _, ok := m.bookmarks[key]; ok {
+				m.showBookmarks = false
+				return m.jumpToBookmark(key)
+			}
+		}
+	}
+	return nil
+}
+
+func (m model) renderBookmarksPanel(width, height int) string {
+	panelW := min(80, max(40, width-8))
+	innerW := panelW - 6
+	titleStyle := lipgloss.NewStyle().Foreground(clrTitle).Bold(true)
+	mutedStyle := lipgloss.NewStyle().Foreground(clrMuted)
+	keyStyle := lipgloss.NewStyle().Foreground(clrAccent).Bold(true)
+
+	lines := []string{titleStyle.Render("Bookmarks"), ""}
+	keys := sortedBookmarkKeys(m.bookmarks)
+	if len(keys) == 0 {
+		lines = append(lines, mutedStyle.Render("No bookmarks. Press m<key> in a directory to add one."))
+	}
+	start, end := visibleWindow(m.bookmarkCursor, len(keys), max(1, height-10))
+	for i := start; i < end; i++ {
+		dir := trimVisual(m.bookmarks[keys[i]], innerW-4)
+		row := keyStyle.Render(keys[i]) + "  " + lipgloss.NewStyle().Foreground(clrDir).Render(dir)
+		if i == m.bookmarkCursor {
+			row = lipgloss.NewStyle().Background(clrAccent).Foreground(clrAccentFg).Bold(true).
+				Render(keys[i] + "  " + dir)
+		}
+		lines = append(lines, row)
+	}
+	lines = append(lines, "", mutedStyle.Render("enter/key jump  ·  x delete  ·  esc close"))
+
+	box := lipgloss.NewStyle().
+		Width(panelW).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(clrBorderStrong).
+		Padding(1, 2).
+		Render(strings.Join(lines, "\n"))
+	return centerOverlay(box, width, height)
+}
+
+// ── frecency ──────────────────────────────────────────────────────────────────
+
+// Visited directories are ranked zoxide-style: visit count weighted by how
+// recently the directory was last visited. The state file stores one
+// "<count>\t<unix time>\t<path>" line per directory.
+
+const (
+	maxFrecencyEntries = 1000
+	// frecencySaveDelay batches the saves of a quick run of directory
+	// changes into one write.
+	frecencySaveDelay = 2 * time.Second
+)
+
+type frecencyEntry struct {
+	count float64
+	last  time.Time
+}
+
+func (f frecencyEntry) score(now time.Time) float64 {
+	age := now.Sub(f.last)
+	switch {
+	case age < time.Hour:
+		return f.count * 4
+	case age < 24*time.Hour:
+		return f.count * 2
+	case age < 7*24*time.Hour:
+		return f.count / 2
+	default:
+		return f.count / 4
+	}
+}
+
+func frecencyPath() string {
+	return filepath.Join(seerStateDir(), "frecency")
+}
+
+func loadFrecency() (map[string]frecencyEntry, error) {
+	entries := make(map[string]frecencyEntry)
+	data, err := os.ReadFile(frecencyPath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return entries, nil
+		}
+		return entries, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		count, err1 := strconv.ParseFloat(fields[0], 64)
+		last, err2 := strconv.ParseInt(fields[1], 10, 64)
+		if err1 != nil || err2 != nil || fields[2] == "" {
+			continue
+		}
+		entries[fields[2]] = frecencyEntry{count: count, last: time.Unix(last, 0)}
+	}
+	return entries, nil
+}
+
+// frecencySaveMsg fires frecencySaveDelay after the table first changes.
+type frecencySaveMsg struct{}
+
+// frecencySavedMsg reports the background write of the table.
+type frecencySavedMsg struct{ err error }
+
+// saveFrecency writes the entries, dropping the lowest-ranked beyond
+// maxFrecencyEntries.
+func saveFrecency(entries map[string]frecencyEntry) error {
+	return writeFrecency(encodeFrecency(entries))
+}
+
+// saveFrecencyLater writes the table in the background once it has changed,
+// leaving m's map free for the UI goroutine.
+func (m *model) saveFrecencyLater() tea.Cmd {
+	m.frecencySaveQueued = false
+	if !m.frecencyDirty {
+		return nil
+	}
+	m.frecencyDirty = false
+	data := encodeFrecency(m.frecency)
+	return func() tea.Msg { return frecencySavedMsg{err: writeFrecency(data)} }
+}
+
+// encodeFrecency formats the entries for the state file, dropping the
+// lowest-ranked beyond maxFrecencyEntries from the map as well.
+func encodeFrecency(entries map[string]frecencyEntry) string {
+	paths := rankedFrecency(entries, "")
+	if len(paths) > maxFrecencyEntries {
+		for _, p := range paths[maxFrecencyEntries:] {
+			delete(entries, p)
+		}
+		paths = paths[:maxFrecencyEntries]
+	}
+	var b strings.Builder
+	for _, p := range paths {
+		e := entries[p]
+		fmt.Fprintf(&b, "%s\t%d\t%s\n", strconv.FormatFloat(e.count, 'f', -1, 64), e.last.Unix(), p)
+	}
+	return b.String()
+}
+
+// writeFrecency replaces the state file through a rename, so a write cut
+// short by quitting leaves the previous table rather than half of one.
+func writeFrecency(data string) error {
+	path := frecencyPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".frecency-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0o644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// rankedFrecency returns the directories matching query, best first.
+func rankedFrecency(entries map[string]frecencyEntry, query string) []string {
+	now := time.Now()
+	var paths []string
+	for p := range entries {
+		if query == "" || subsequenceMatch(query, p) {
+			paths = append(paths, p)
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		si, sj := entries[paths[i]].score(now), entries[paths[j]].score(now)
+		if si != sj {
+			return si > sj
+		}
+		return paths[i] < paths[j]
+	})
+	return paths
+}
+
+// subsequenceMatch reports whether the runes of query appear in s in order,
+// ignoring case.
+func subsequenceMatch(query, s string) bool {
+	s = strings.ToLower(s)
+	for _, r := range strings.ToLower(query) {
+		i := strings.IndexRune(s, r)
+		if i < 0 {
+			return false
+		}
+		s = s[i+utf8.RuneLen(r):]
+	}
+	return true
+}
+
+func (m *model) recordVisit(dir string) {
+	e := m.frecency[dir]
+	e.count++
+	e.last = time.Now()
+	m.frecency[dir] = e
+	m.frecencyDirty = true
+}
+
+// zoxideImportMsg carries the scores listed by `zoxide query --list --score`.
+type zoxideImportMsg struct {
+	scores map[string]float64
+	err    error
+}
+
+// importZoxide lists zoxide's directories and scores in the background.
+func importZoxide() tea.Cmd {
+	return func() tea.Msg {
+		out, err := exec.Command("zoxide", "query", "--list", "--score").Output()
+		if err != nil {
+			return zoxideImportMsg{err: err}
+		}
+		scores := make(map[string]float64)
+		for _, line := range strings.Split(string(out), "\n") {
+			scoreText, dir, ok := strings.Cut(strings.TrimSpace(line), " ")
+			score, err := strconv.ParseFloat(scoreText, 64)
+			if !ok || err != nil {
+				continue
+			}
+			scores[strings.TrimSpace(dir)] = score
+		}
+		return zoxideImportMsg{scores: scores}
+	}
+}
+
+// mergeZoxide merges imported zoxide scores into the frecency table, keeping
+// the higher count for directories present in both. zoxide's scores already
+// weigh in recency, so new directories count as visited long ago rather than
+// outranking the ones visited lately.
+func (m *model) mergeZoxide(msg zoxideImportMsg) {
+	if msg.err != nil {
+		m.setError("zoxide import failed: " + msg.err.Error())
+		return
+	}
+	imported := 0
+	for dir, score := range msg.scores {
+		e, exists := m.frecency[dir]
+		if exists && e.count >= score {
+			continue
+		}
+		if !exists {
+			e.last = time.Unix(0, 0)
+		}
+		e.count = score
+		m.frecency[dir] = e
+		imported++
+	}
+	if imported > 0 {
+		m.frecencyDirty = true
+	}
+	m.status = fmt.Sprintf("imported %d directories from zoxide", imported)
+}
+
+// updateJumpPanel edits the jump query; enter changes to the highlighted
+// directory.
+func (m *model) updateJumpPanel(msg tea.KeyMsg) tea.Cmd {
+	matches := rankedFrecency(m.frecency, m.jumpQuery)
+	switch msg.String() {
+	case "esc", "ctrl+c":
+		m.showJump = false
+		return nil
+	case "down", "ctrl+n":
+		m.jumpCursor = min(m.jumpCursor+1, max(0, len(matches)-1))
+		return nil
+	case "up", "ctrl+p":
+		m.jumpCursor = max(0, m.jumpCursor-1)
+		return nil
+	case "enter":
+		if m.jumpCursor >= len(matches) {
+			return nil
+		}
+		dir := matches[m.jumpCursor]
+		if err := m.changeDir(dir); err != nil {
+			// Forget directories that no longer exist.
+			delete(m.frecency, dir)
+			m.frecencyDirty = true
+			m.setError(err.Error())
+			return nil
+		}
+		m.showJump = false
+		return m.requestPreview()
+	case "ctrl+o":
+		m.status = "importing from zoxide…"
+		return importZoxide()
+	case "backspace":
+		if runes := []rune(m.jumpQuery); len(runes) > 0 {
+			m.jumpQuery = string(runes[:len(runes)-1])
+		}
+	case "ctrl+u":
+		m.jumpQuery = ""
+	default:
+		if msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace {
+			m.jumpQuery += string(msg.Runes)
+		}
+	}
+	m.jumpCursor = 0
+	return nil
+}
+
+func (m model) renderJumpPanel(width, height int) string {
+	panelW := min(90, max(48, width-8))
+	innerW := panelW - 6
+	titleStyle := lipgloss.NewStyle().Foreground(clrTitle).Bold(true)
+	mutedStyle := lipgloss.NewStyle().Foreground(clrMuted)
+	cursor := lipgloss.NewStyle().Foreground(clrAccent).Render("▌")
+
+	query := lipgloss.NewStyle().Foreground(clrAccent).Bold(true).Render("› ") +
+		lipgloss.NewStyle().Foreground(clrAccentFg).Render(m.jumpQuery) + cursor
+	lines := []string{titleStyle.Render("Jump to directory"), "", query, ""}
+
+	matches := rankedFrecency(m.frecency, m.jumpQuery)
+	if len(matches) == 0 {
+		lines = append(lines, mutedStyle.Render("No matching directories."))
+	}
+	now := time.Now()
+	start, end := visibleWindow(m.jumpCursor, len(matches), max(1, height-12))
+	for i := start; i < end; i++ {
+		score := fmt.Sprintf("%6.1f  ", m.frecency[matches[i]].score(now))
+		dir := trimVisual(matches[i], innerW-lipgloss.Width(score))
+		if i == m.jumpCursor {
+			lines = append(lines, lipgloss.NewStyle().Background(clrAccent).Foreground(clrAccentFg).Bold(true).
+				Render(score+dir))
+			continue
+		}
+		lines = append(lines, mutedStyle.Render(score)+lipgloss.NewStyle().Foreground(clrDir).Render(dir))
+	}
+	lines = append(lines, "", mutedStyle.Render("↑/↓ select  ·  enter jump  ·  ^o import zoxide  ·  esc close"))
+
+	box := lipgloss.NewStyle().
+		Width(panelW).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(clrBorderStrong).
+		Padding(1, 2).
+		Render(strings.Join(lines, "\n"))
+	return centerOverlay(box, width, height)
+}
+
+// ── context menu ──────────────────────────────────────────────────────────────
+
+// contextMenuItem is an action of the right-click menu, run on the selected
+// entry; an item without one shows the entry's properties. hint names the
+// key that does the same.
+type contextMenuItem struct {
+	label string
+	hint  string
+	run   func(*model) tea.Cmd
+}
+
+var contextMenuItems = []contextMenuItem{
+	{"Open", "enter", (*model).openSelected},
+	{"Open with app", "o", (*model).openWithApp},
+	{"Rename", "R", (*model).renameSelected},
+	{"Delete", "del", (*model).confirmTrash},
+	{"Copy path", "yp", func(m *model) tea.Cmd { m.copyPathText("yp"); return nil }},
+	{"Properties", "", nil},
+}
+
+// contextMenu is the popup opened by right-clicking an entry, drawn with its
+// top-left corner at x, y. info holds the entry's properties once they are
+// asked for.
+type contextMenu struct {
+	x, y   int
+	cursor int
+	info   []string
+}
+
+// openContextMenu selects the entry under a right click and opens the menu
+// there. ok is false when the click missed the list's entries.
+func (m *model) openContextMenu(x, y int) (cmd tea.Cmd, ok bool) {
+	row, rows, other, ok := m.listPaneAt(x, y)
+	if !ok {
+		return nil, false
+	}
+	if other {
+		cmd = m.swapPanes()
+	}
+	start, end, needTop, _ := m.visibleEntries(rows)
+	if needTop {
+		row--
+	}
+	if row < 0 || start+row >= end {
+		return cmd, true
+	}
+	cmd = tea.Batch(cmd, m.navigate(start+row))
+	m.contextMenu = &contextMenu{x: x, y: y}
+	m.placeContextMenu()
+	return cmd, true
+}
+
+// placeContextMenu moves the menu so all of it is on screen.
+func (m *model) placeContextMenu() {
+	c := m.contextMenu
+	box := c.render(m.entries[m.selected].name)
+	c.x = max(0, min(c.x, m.width-lipgloss.Width(box)))
+	c.y = max(0, min(c.y, m.height-lipgloss.Height(box)))
+}
+
+func (m *model) updateContextMenu(msg tea.KeyMsg) tea.Cmd {
+	c := m.contextMenu
+	if c.info != nil {
+		m.contextMenu = nil
+		return nil
+	}
+	switch msg.String() {
+	case "esc", "q":
+		m.contextMenu = nil
+	case "j", "down", "tab":
+		c.cursor = (c.cursor + 1) % len(contextMenuItems)
+	case "k", "up", "shift+tab":
+		c.cursor = (c.cursor + len(contextMenuItems) - 1) % len(contextMenuItems)
+	case "enter", "l", " ":
+		return m.runContextMenuItem(c.cursor)
+	}
+	return nil
+}
+
+// clickContextMenu runs the menu item under a left click; any other click
+// closes the menu.
+func (m *model) clickContextMenu(x, y int) tea.Cmd {
+	c := m.contextMenu
+	i := y - c.y - 1 // the border's top row
+	if c.info == nil && i >= 0 && i < len(contextMenuItems) &&
+		x > c.x && x < c.x+lipgloss.Width(c.render(""))-1 {
+		return m.runContextMenuItem(i)
+	}
+	m.contextMenu = nil
+	return nil
+}
+
+func (m *model) runContextMenuItem(i int) tea.Cmd {
+	item := contextMenuItems[i]
+	if item.run == nil {
+		m.contextMenu.info = entryProperties(m.entries[m.selected])
+		m.placeContextMenu()
+		return nil
+	}
+	m.contextMenu = nil
+	return item.run(m)
+}
+
+// entryProperties describes an entry for the menu's properties view.
+func entryProperties(e entry) []string {
+	kind := "file"
+	if e.isDir {
+		kind = "directory"
+	}
+	size := humanSize(e.size)
+	if e.isDir {
+		if items, err := os.ReadDir(e.path); err == nil {
+			size = countNoun(len(items), "item")
+		}
+	}
+	props := [][2]string{
+		{"name", e.name},
+		{"kind", kind},
+		{"size", size},
+		{"mode", e.mode.String()},
+	}
+	if e.owner != "" {
+		props = append(props, [2]string{"owner", e.owner + ":" + e.group})
+	}
+	props = append(props, [2]string{"modified", e.modTime.Format("2006-01-02 15:04:05")})
+	if target, err := os.Readlink(e.path); err == nil {
+		props = append(props, [2]string{"link to", target})
+	}
+	props = append(props, [2]string{"path", e.path})
+
+	keyStyle := lipgloss.NewStyle().Foreground(clrMuted)
+	lines := make([]string, len(props))
+	for i, p := range props {
+		lines[i] = keyStyle.Render(padRight(p[0], 9)) + trimVisual(p[1], 48)
+	}
+	return lines
+}
+
+// render draws the menu, or the properties of name once they're shown.
+func (c contextMenu) render(name string) string {
+	var lines []string
+	if c.info != nil {
+		title := lipgloss.NewStyle().Foreground(clrTitle).Bold(true).Render(trimVisual(name, 48))
+		lines = append(append([]string{title, ""}, c.info...), "", jsonMuted.Render("any key closes"))
+	} else {
+		labelW, hintW := 0, 0
+		for _, item := range contextMenuItems {
+			labelW = max(labelW, len(item.label))
+			hintW = max(hintW, len(item.hint))
+		}
+		hintStyle := lipgloss.NewStyle().Foreground(clrMuted)
+		selStyle := lipgloss.NewStyle().Background(clrAccent).Foreground(clrAccentFg).Bold(true)
+		for i, item := range contextMenuItems {
+			label, hint := padRight(item.label, labelW+2), fmt.Sprintf("%*s", hintW, item.hint)
+			if i == c.cursor {
+				lines = append(lines, selStyle.Render(label+hint))
+			} else {
+				lines = append(lines, label+hintStyle.Render(hint))
+			}
+		}
+	}
+	return lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(clrBorderStrong).
+		Padding(0, 1).
+		Render(strings.Join(lines, "\n"))
+}
+
+// overlayAt draws box over base with its top-left corner at x, y.
+func overlayAt(base, box string, x, y int) string {
+	lines := strings.Split(base, "\n")
+	for i, row := range strings.Split(box, "\n") {
+		if y+i >= len(lines) {
+			break
+		}
+		line := lines[y+i]
+		left := ansi.Truncate(line, x, "")
+		left += strings.Repeat(" ", x-ansi.StringWidth(left))
+		lines[y+i] = left + row + ansi.TruncateLeft(line, x+ansi.StringWidth(row), "")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ── key sequences ─────────────────────────────────────────────────────────────
+
+// handleKeySequence runs two-key commands (vim/ranger style).
+func (m *model) handleKeySequence(seq string) tea.Cmd {
+	switch seq {
+	case "yy", "dd":
+		m.register = m.targetPaths()
+		m.registerCut = seq == "dd"
+		verb := "yanked"
+		if m.registerCut {
+			verb = "cut"
+		}
+		m.status = fmt.Sprintf("%s %d item(s)", verb, len(m.register))
+		return nil
+	case "yp", "yn", "yd":
+		m.copyPathText(seq)
+		return nil
+	case "yc":
+		m.copyFileContents()
+		return nil
+	case "pp":
+		return m.paste()
+	case "pl", "pL":
+		m.linkEntries(seq == "pL")
+		return m.requestPreview()
+	}
+	if len(seq) == 2 && isBookmarkKey(seq[1:]) {
+		switch seq[0] {
+		case 'm':
+			m.setBookmark(seq[1:])
+			return nil
+		case '\'':
+			return m.jumpToBookmark(seq[1:])
+		case 'M':
+			m.setPositionMark(seq[1:])
+			return nil
+		case '`':
+			return m.jumpToPositionMark(seq[1:])
+		}
+	}
+	m.setError("unknown key sequence: " + seq)
+	return nil
+}
+
+// setPositionMark remembers the selected entry under key for this session.
+func (m *model) setPositionMark(key string) {
+	if len(m.entries) == 0 {
+		return
+	}
+	m.positionMarks[key] = m.entries[m.selected].path
+	m.status = fmt.Sprintf("mark `%s set on %s", key, m.entries[m.selected].name)
+}
+
+// jumpToPositionMark selects the marked entry, changing directory first when
+// it lives elsewhere.
+func (m *model) jumpToPositionMark(key string) tea.Cmd {
+	path, ok := m.positionMarks[key]
+	if !ok {
+		m.status = "no mark `" + key
+		return nil
+	}
+	if dir := filepath.Dir(path); dir != m.cwd {
+		if err := m.changeDir(dir); err != nil {
+			m.setError(err.Error())
+			return nil
+		}
+	}
+	m.selectPath(path)
+	m.previewOffset = 0
+	m.previewColumn = 0
+	return m.requestPreview()
+}
+
+// copyPathText puts the absolute path ("yp"), file name ("yn"), or parent
+// directory ("yd") of the selection on the clipboard. With marks, yp and yn
+// copy one line per marked entry.
+func (m *model) copyPathText(seq string) {
+	paths := m.targetPaths()
+	if len(paths) == 0 {
+		return
+	}
+	var lines []string
+	switch seq {
+	case "yp":
+		lines = paths
+	case "yn":
+		for _, p := range paths {
+			lines = append(lines, filepath.Base(p))
+		}
+	case "yd":
+		dir := m.cwd
+		if len(m.entries) > 0 {
+			dir = filepath.Dir(m.entries[m.selected].path)
+		}
+		lines = []string{dir}
+	}
+	text := strings.Join(lines, "\n")
+	note, err := m.copyToClipboard(text)
+	if err != nil {
+		m.setError("copy failed: " + err.Error())
+		return
+	}
+	if len(lines) == 1 {
+		m.status = "copied " + text + note
+	} else {
+		m.status = fmt.Sprintf("copied %d lines%s", len(lines), note)
+	}
+}
+
+// copyFileContents puts the raw contents of the selected text file on the
+// clipboard, refusing binaries and files over maxClipboardBytes.
+func (m *model) copyFileContents() {
+	if len(m.entries) == 0 {
+		return
+	}
+	picked := m.entries[m.selected]
+	if picked.isDir {
+		m.setError("cannot copy the contents of a directory")
+		return
+	}
+	info, err := os.Stat(picked.path)
+	if err != nil {
+		m.setError(err.Error())
+		return
+	}
+	if info.Size() > maxClipboardBytes {
+		m.setError(fmt.Sprintf("file too large to copy (%s, limit %s)", humanSize(info.Size()), humanSize(maxClipboardBytes)))
+		return
+	}
+	data, err := os.ReadFile(picked.path)
+	if err != nil {
+		m.setError(err.Error())
+		return
+	}
+	if isLikelyBinary(data) {
+		m.setError("not copying binary file")
+		return
+	}
+	note, err := m.copyToClipboard(string(data))
+	if err != nil {
+		m.setError("copy failed: " + err.Error())
+		return
+	}
+	m.status = fmt.Sprintf("copied contents of %s (%s)%s", picked.name, humanSize(int64(len(data))), note)
+}
+
+// paste copies (or moves, after dd) the register into cwd as a background job.
+func (m *model) paste() tea.Cmd {
+	if len(m.register) == 0 {
+		m.status = "nothing yanked"
+		return nil
+	}
+	sources := append([]string(nil), m.register...)
+	move := m.registerCut
+	if move {
+		// Moving entries into the directory they are in does nothing.
+		sources = slices.DeleteFunc(sources, func(src string) bool { return filepath.Dir(src) == m.cwd })
+		if len(sources) == 0 {
+			m.status = "cut entries are already here"
+			return nil
+		}
+		m.register = nil
+		m.registerCut = false
+	}
+	verb := "copy"
+	if move {
+		verb = "move"
+	}
+	title := fmt.Sprintf("%s %d item(s) → %s", verb, len(sources), filepath.Base(m.cwd))
+	return m.startJob(title, copyJob(sources, m.cwd, move))
+}
+
+// ── external programs ─────────────────────────────────────────────────────────
+
+// editorCommand returns $VISUAL, then $EDITOR, then a platform default.
+func editorCommand() string {
+	for _, key := range []string{"VISUAL", "EDITOR"} {
+		if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+			return v
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return "notepad"
+	}
+	return "vi"
+}
+
+// editFile suspends the TUI and runs the editor on path. The editor value
+// may carry arguments (e.g. "code -w"), so it goes through the shell.
+func editFile(path string) tea.Cmd {
+	editor := editorCommand()
+	cmd := shellCommand(context.Background(), editor+" "+shellQuote(path))
+	return tea.ExecProcess(cmd, func(err error) tea.Msg {
+		return externalDoneMsg{name: editor, err: err}
+	})
+}
+
+// openerRule maps an extension (".pdf") or file-name glob ("*.tar.*") to a
+// command used instead of the system opener. {} in the command is replaced by
+// the quoted path; without it the path is appended.
+type openerRule struct {
+	pattern string
+	command string
+}
+
+func (r openerRule) matches(name string) bool {
+	if strings.HasPrefix(r.pattern, ".") {
+		return strings.EqualFold(filepath.Ext(name), r.pattern)
+	}
+	ok, _ := filepath.Match(r.pattern, name)
+	return ok
+}
+
+// systemOpener returns the platform's "open with default application" command.
+func systemOpener(path string) *exec.Cmd {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", path)
+	case "windows":
+		return exec.Command("cmd", "/c", "start", "", path)
+	default:
+		return exec.Command("xdg-open", path)
+	}
+}
+
+// openWithApp opens the selected entry with openPath.
+func (m *model) openWithApp() tea.Cmd {
+	if len(m.entries) == 0 {
+		return nil
+	}
+	picked := m.entries[m.selected]
+	if name, err := openPath(picked.path); err != nil {
+		m.setError("open failed: " + err.Error())
+	} else {
+		m.status = "opened " + picked.name + " with " + name
+	}
+	return nil
+}
+
+// openPath launches the configured opener for path, or the system opener,
+// detached from the terminal so GUI programs don't block the TUI. It returns
+// the name of the program started.
+func openPath(path string) (string, error) {
+	var cmd *exec.Cmd
+	name := "the default application"
+	for _, rule := range userConfig.openers {
+		if !rule.matches(filepath.Base(path)) || strings.TrimSpace(rule.command) == "" {
+			continue
+		}
+		name = strings.Fields(rule.command)[0]
+		line := rule.command
+		if strings.Contains(line, "{}") {
+			line = strings.ReplaceAll(line, "{}", shellQuote(path))
+		} else {
+			line += " " + shellQuote(path)
+		}
+		cmd = shellCommand(context.Background(), line)
+		break
+	}
+	if cmd == nil {
+		cmd = systemOpener(path)
+	}
+	cmd.Dir = filepath.Dir(path)
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	go cmd.Wait() // reap the child; its exit status is not reported
+	return name, nil
+}
+
+// ── keymap ────────────────────────────────────────────────────────────────────
+
+// keyBinding is one action of the main view. keys[0] is the key the action is
+// handled under; the rest are alternates. Sequences such as "yy" or "m<key>"
+// are listed for the help overlay but can't be remapped.
+type keyBinding struct {
+	category string
+	action   string
+	keys     []string
+	desc     string
+}
+
+var keyCategories = []string{"navigation", "preview", "search", "file ops", "git", "view", "tabs & panes"}
+
+var keyBindings = []keyBinding{
+	{"navigation", "down", []string{"j", "down"}, "move down (5j moves five); scrolls a focused preview"},
+	{"navigation", "up", []string{"k", "up"}, "move up"},
+	{"navigation", "top", []string{"g", "home"}, "jump to the top"},
+	{"navigation", "bottom", []string{"G", "end"}, "jump to the bottom (5G to the 5th entry)"},
+	{"navigation", "open", []string{"enter", "l", "right"}, "open directory or explore the preview"},
+	{"navigation", "parent", []string{"h", "left"}, "parent directory"},
+	{"navigation", "goto", []string{":"}, "go to a path"},
+	{"navigation", "home-dir", []string{"~"}, "go to a path, starting at ~/"},
+	{"navigation", "jump", []string{"z"}, "frequently visited directories"},
+	{"navigation", "bookmarks", []string{"B"}, "bookmark list"},
+	{"navigation", "bookmark", []string{"m<key>", "'<key>"}, "bookmark directory / jump to bookmark"},
+	{"navigation", "position-mark", []string{"M<key>", "`<key>"}, "set / jump to a position mark"},
+	{"navigation", "reload", []string{"r"}, "reload directory"},
+	{"navigation", "quit", []string{"q", "ctrl+c"}, "quit"},
+
+	{"preview", "scroll-down", []string{"ctrl+d"}, "half a page down in the focused pane"},
+	{"preview", "scroll-up", []string{"ctrl+u"}, "half a page up in the focused pane"},
+	{"preview", "scroll-left", []string{"<"}, "scroll preview left"},
+	{"preview", "scroll-right", []string{">"}, "scroll preview right"},
+	{"preview", "source", []string{"s"}, "toggle source view"},
+	{"preview", "wrap", []string{"W"}, "soft-wrap long lines"},
+	{"preview", "follow", []string{"T"}, "follow the file like tail -f"},
+	{"preview", "json-query", []string{"J"}, "query a JSON preview"},
+	{"preview", "outline", []string{"O"}, "Markdown outline and folds"},
+	{"preview", "present", []string{"alt+p"}, "present Markdown as slides"},
+	{"preview", "zoom-in", []string{"+", "="}, "zoom image in"},
+	{"preview", "zoom-out", []string{"-"}, "zoom image out"},
+	{"preview", "secrets", []string{"*"}, "reveal / mask secret values"},
+
+	{"search", "search", []string{"/"}, "search / filter the list"},
+	{"search", "substring", []string{"ctrl+f"}, "toggle fuzzy / substring matching"},
+	{"search", "search-case", []string{"alt+c"}, "cycle search case"},
+	{"search", "find", []string{"F"}, "find files by name"},
+	{"search", "grep", []string{"S"}, "search file contents"},
+	{"search", "preview-search", []string{"alt+/"}, "search the preview"},
+	{"search", "next-match", []string{"n"}, "next preview match"},
+	{"search", "prev-match", []string{"N"}, "previous preview match"},
+
+	{"file ops", "mark", []string{"space"}, "mark / unmark and move down"},
+	{"file ops", "mark-all", []string{"ctrl+a"}, "mark all"},
+	{"file ops", "invert-marks", []string{"v"}, "invert marks"},
+	{"file ops", "trash", []string{"delete", "backspace"}, "move to trash"},
+	{"file ops", "delete", []string{"D", "shift+delete"}, "delete permanently"},
+	{"file ops", "open-with", []string{"o"}, "open with the configured opener"},
+	{"file ops", "edit", []string{"e"}, "edit in $EDITOR"},
+	{"file ops", "rename", []string{"R", "f2"}, "rename"},
+	{"file ops", "yank", []string{"yy", "dd", "pp"}, "yank / cut / paste"},
+	{"file ops", "copy-path", []string{"yp", "yn", "yd"}, "copy path / name / directory"},
+	{"file ops", "copy-contents", []string{"yc"}, "copy file contents"},
+	{"file ops", "symlink", []string{"pl", "pL"}, "symlink yanked entries here"},
+	{"file ops", "extract", []string{"x"}, "extract archive"},
+	{"file ops", "compress", []string{"Z"}, "compress marked entries"},
+	{"file ops", "checksums", []string{"C"}, "SHA-256 checksums"},
+	{"file ops", "jobs", []string{"w"}, "jobs panel"},
+	{"file ops", "disk-usage", []string{"U"}, "disk usage"},
+
+	{"git", "history", []string{"alt+l"}, "history of the selection"},
+	{"git", "blame", []string{"alt+b"}, "blame the preview"},
+	{"git", "diff", []string{"alt+d"}, "uncommitted changes"},
+	{"git", "changes", []string{"alt+g"}, "changed files in the repository"},
+	{"git", "stage", []string{"alt+s"}, "stage"},
+	{"git", "unstage", []string{"alt+u"}, "unstage"},
+	{"git", "discard", []string{"alt+x"}, "discard unstaged changes"},
+	{"git", "git-ignored", []string{"alt+i"}, "hide / show git-ignored entries"},
+
+	{"view", "hidden", []string{"."}, "toggle hidden files"},
+	{"view", "ignored", []string{"I"}, "reveal ignored entries"},
+	{"view", "details", []string{"i"}, "mode, owner and group columns"},
+	{"view", "filter", []string{"f"}, "filter menu"},
+	{"view", "tree", []string{"t"}, "tree view"},
+	{"view", "hide-preview", []string{"P"}, "hide / show the preview pane"},
+	{"view", "messages", []string{"alt+m"}, "recent status messages"},
+	{"view", "help", []string{"?"}, "this help"},
+
+	{"tabs & panes", "dual-pane", []string{"|"}, "dual-pane mode"},
+	{"tabs & panes", "switch-pane", []string{"tab"}, "focus the preview or list (dual pane: switch pane)"},
+	{"tabs & panes", "shrink-list", []string{"{"}, "narrow the list"},
+	{"tabs & panes", "grow-list", []string{"}"}, "widen the list"},
+	{"tabs & panes", "copy-to-pane", []string{"f5"}, "copy to the other pane"},
+	{"tabs & panes", "move-to-pane", []string{"f6"}, "move to the other pane"},
+	{"tabs & panes", "new-tab", []string{"ctrl+t"}, "new tab"},
+	{"tabs & panes", "close-tab", []string{"ctrl+w"}, "close tab"},
+	{"tabs & panes", "prev-tab", []string{"["}, "previous tab"},
+	{"tabs & panes", "next-tab", []string{"]"}, "next tab"},
+	{"tabs & panes", "go-to-tab", []string{"alt+<n>"}, "switch to tab n (1–9)"},
+}
+
+// keyMsgFor returns the key message bubbletea reports as key: a single
+// character, a named key like "enter" or "ctrl+d", or either with "alt+".
+func keyMsgFor(key string) (tea.KeyMsg, bool) {
+	switch key {
+	case "space":
+		key = " "
+	case "shift+delete":
+		key = "alt+insert" // see the D case in Update
+	}
+	alt := false
+	if rest, ok := strings.CutPrefix(key, "alt+"); ok && rest != "" {
+		alt, key = true, rest
+	}
+	if r := []rune(key); len(r) == 1 {
+		return tea.KeyMsg{Type: tea.KeyRunes, Runes: r, Alt: alt}, true
+	}
+	for t := tea.KeyType(-128); t < 128; t++ {
+		if t.String() == key {
+			return tea.KeyMsg{Type: t, Alt: alt}, true
+		}
+	}
+	return tea.KeyMsg{}, false
+}
+
+// parseKeymap reads the [keys] section, where each action is bound to a
+// comma-separated list of extra keys, e.g. `trash = "x, ctrl+x"`. It returns
+// the extra keys mapped to the key the action is handled under.
+func parseKeymap(entries []configEntry) (map[string]string, error) {
+	remap := make(map[string]string)
+	for _, kv := range entries {
+		i := slices.IndexFunc(keyBindings, func(b keyBinding) bool { return b.action == kv.key })
+		if i < 0 {
+			return nil, fmt.Errorf("keys: %q is not an action", kv.key)
+		}
+		if _, ok := keyMsgFor(keyBindings[i].keys[0]); !ok {
+			return nil, fmt.Errorf("keys: %s is a key sequence and can't be remapped", kv.key)
+		}
+		for _, key := range splitConfigList(kv.value) {
+			if _, ok := keyMsgFor(key); !ok {
+				return nil, fmt.Errorf("keys: %q is not a key", key)
+			}
+			remap[key] = keyBindings[i].keys[0]
+		}
+	}
+	return remap, nil
+}
+
+// remapKey translates a key bound in [keys] to the key its action is handled
+// under. Other keys are returned unchanged.
+func remapKey(msg tea.KeyMsg) tea.KeyMsg {
+	if target, ok := userConfig.keys[msg.String()]; ok {
+		if mapped, ok := keyMsgFor(target); ok {
+			return mapped
+		}
+	}
+	return msg
+}
+
+// bindingKeys lists the keys that trigger b: its defaults and any extra keys
+// bound to it in [keys].
+func bindingKeys(b keyBinding) []string {
+	keys := slices.Clone(b.keys)
+	var extra []string
+	for key, target := range userConfig.keys {
+		if target == b.keys[0] {
+			extra = append(extra, key)
+		}
+	}
+	sort.Strings(extra)
+	return append(keys, extra...)
+}
+
+// helpLines renders the keymap grouped by category, one binding per line.
+func helpLines(innerW int) []string {
+	headStyle := lipgloss.NewStyle().Foreground(clrTitle).Bold(true)
+	keyStyle := lipgloss.NewStyle().Foreground(clrAccent).Bold(true)
+	descStyle := lipgloss.NewStyle().Foreground(clrFile)
+	mutedStyle := lipgloss.NewStyle().Foreground(clrMuted)
+	keyW := 0
+	for _, b := range keyBindings {
+		keyW = max(keyW, lipgloss.Width(strings.Join(bindingKeys(b), " / ")))
+	}
+	keyW = min(keyW, innerW/2)
+	actionW := 0
+	for _, b := range keyBindings {
+		actionW = max(actionW, len(b.action))
+	}
+	// Action names, for binding extra keys in [keys], go on the right when
+	// there is room.
+	descW := innerW - keyW - 2
+	showActions := descW >= actionW+2+24
+	if showActions {
+		descW -= actionW + 2
+	}
+	var lines []string
+	for _, category := range keyCategories {
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, headStyle.Render(category))
+		for _, b := range keyBindings {
+			if b.category != category {
+				continue
+			}
+			keys := trimVisual(strings.Join(bindingKeys(b), " / "), keyW)
+			keys += strings.Repeat(" ", keyW-lipgloss.Width(keys))
+			desc := descStyle.Render(trimVisual(b.desc, descW))
+			if showActions {
+				pad := descW - lipgloss.Width(desc) + actionW + 2 - len(b.action)
+				desc += strings.Repeat(" ", pad) + mutedStyle.Render(b.action)
+			}
+			lines = append(lines, keyStyle.Render(keys)+"  "+desc)
+		}
+	}
+	return lines
+}
+
+// updateHelp handles keys while the help overlay is open.
+func (m *model) updateHelp(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "esc", "?", "q":
+		m.showHelp = false
+	case "j", "down":
+		m.helpOffset++
+	case "k", "up":
+		m.helpOffset = max(0, m.helpOffset-1)
+	case "ctrl+d", "pagedown", " ":
+		m.helpOffset += max(1, m.height/2)
+	case "ctrl+u", "pageup":
+		m.helpOffset = max(0, m.helpOffset-max(1, m.height/2))
+	case "g", "home":
+		m.helpOffset = 0
+	}
+	_, _, bodyH := m.layoutDimensions()
+	m.helpOffset = min(m.helpOffset, max(0, len(helpLines(80))-max(1, bodyH-10)))
+	return nil
+}
+
+func (m model) renderHelp(width, height int) string {
+	panelW := min(96, max(40, width-8))
+	innerW := panelW - 6
+	mutedStyle := lipgloss.NewStyle().Foreground(clrMuted)
+
+	lines := helpLines(innerW)
+	rows := max(1, height-10)
+	offset := min(m.helpOffset, max(0, len(lines)-rows))
+	shown := lines[offset:min(len(lines), offset+rows)]
+	footer := "j/k scroll  ·  esc close"
+	if len(lines) > rows {
+		footer = fmt.Sprintf("%d–%d of %d  ·  ", offset+1, offset+len(shown), len(lines)) + footer
+	}
+	body := append([]string{lipgloss.NewStyle().Foreground(clrTitle).Bold(true).Render("Keys"), ""}, shown...)
+	body = append(body, "", mutedStyle.Render(footer))
+
+	box := lipgloss.NewStyle().
+		Width(panelW).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(clrBorderStrong).
+		Padding(1, 2).
+		Render(strings.Join(body, "\n"))
+	return centerOverlay(box, width, height)
+}
+
+// ── plugins ───────────────────────────────────────────────────────────────────
+
+// Plugins are executables bound to keys in the [plugins] section of the
+// config, e.g. `"ctrl+g" = "git-summary"`. Bare names resolve inside
+// <config dir>/plugins. A plugin runs in the current directory with the
+// marked paths (or the selected path) as arguments, and receives SEER_CWD,
+// SEER_PATH (the selection), and SEER_PATHS (newline-separated) in its
+// environment. A single line of output
+// is shown in the status bar; longer output replaces the preview.
+
+// pluginTimeout bounds a plugin run so a hung plugin can't keep its result
+// pending forever.
+const pluginTimeout = time.Minute
+
+func pluginDir() string {
+	return filepath.Join(seerConfigDir(), "plugins")
+}
+
+func resolvePlugin(name string) string {
+	name = expandHome(name)
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(pluginDir(), name)
+}
+
+// runPlugin starts the plugin asynchronously and reports via pluginDoneMsg.
+func (m *model) runPlugin(name string) tea.Cmd {
+	var current string
+	if len(m.entries) > 0 {
+		current = m.entries[m.selected].path
+	}
+	paths := m.targetPaths()
+	path := resolvePlugin(name)
+	cwd := m.cwd
+	label := filepath.Base(name)
+	m.status = "running " + label + "…"
+
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), pluginTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, path, paths...)
+		cmd.Dir = cwd
+		cmd.Env = append(os.Environ(),
+			"SEER_CWD="+cwd,
+			"SEER_PATH="+current,
+			"SEER_PATHS="+strings.Join(paths, "\n"),
+		)
+		// As for previewers, don't wait on background processes left
+		// holding the output open.
+		cmd.WaitDelay = time.Second
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		// Only the start of long output is shown, so don't keep the rest.
+		stdout := &cappedBuffer{limit: maxPreviewBytes, full: func() {}}
+		cmd.Stdout = stdout
+		err := cmd.Run()
+		switch {
+		case ctx.Err() == context.DeadlineExceeded:
+			err = fmt.Errorf("timed out after %s", pluginTimeout)
+		case errors.Is(err, exec.ErrWaitDelay):
+			// The plugin itself succeeded.
+			err = nil
+		case err != nil:
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				err = errors.New(msg)
+			}
+		}
+		return pluginDoneMsg{name: label, output: stdout.buf.String(), err: err}
+	}
+}
+
+// handlePluginDone shows plugin output and refreshes the listing in case the
+// plugin changed files.
+func (m *model) handlePluginDone(msg pluginDoneMsg) tea.Cmd {
+	if err := m.reloadEntries(); err != nil {
+		m.setError(err.Error())
+	}
+	if msg.err != nil {
+		m.setError(msg.name + ": " + msg.err.Error())
+		return m.requestPreview()
+	}
+
+	output := strings.TrimRight(strings.ReplaceAll(msg.output, "\r\n", "\n"), "\n")
+	if output == "" {
+		m.status = msg.name + ": done"
+		return m.requestPreview()
+	}
+	if !strings.Contains(output, "\n") {
+		m.status = msg.name + ": " + output
+		return m.requestPreview()
+	}
+
+	// Multi-line output becomes a scratch preview until selection changes.
+	if len(output) > maxPreviewBytes {
+		output = output[:maxPreviewBytes] + "\n\n... preview truncated ..."
+	}
+	m.requestID++ // drop any preview still in flight
+	m.loading = false
+	m.gifAnim = nil
+	m.preview = strings.ToValidUTF8(output, "\uFFFD")
+	m.previewOffset = 0
+	m.previewColumn = 0
+	m.scratch = "plugin: " + msg.name
+	m.status = fmt.Sprintf("%s: %d lines", msg.name, strings.Count(output, "\n")+1)
+	return nil
+}
+
+// ── preview builders ──────────────────────────────────────────────────────────
+
+// previewOptions are the view toggles that change how a file renders.
+type previewOptions struct {
+	source        bool // show source instead of a rendered view
+	revealSecrets bool // leave secret values in config files unmasked
+	zoom          imageZoom
+	follow        bool   // preview the end of the file, as follow mode does
+	gitLog        bool   // show the commits touching the path instead
+	gitBlame      bool   // annotate each line with its last commit
+	gitDiff       bool   // show the file's uncommitted changes
+	folds         string // folded markdown headings, as encodeFolds writes them
+}
+
+func (m model) previewOptions() previewOptions {
+	opts := previewOptions{source: m.sourceView, revealSecrets: m.revealSecrets, gitLog: m.gitLogView, gitBlame: m.gitBlameView, gitDiff: m.gitDiffView}
+	if z := m.imageZoom; z != nil && len(m.entries) > 0 && m.entries[m.selected].path == z.path {
+		opts.zoom = *z
+	}
+	if f := m.follow; f != nil && len(m.entries) > 0 && m.entries[m.selected].path == f.path {
+		opts.follow = true
+	}
+	if len(m.entries) > 0 {
+		opts.folds = encodeFolds(m.markdownFolds[m.entries[m.selected].path])
+	}
+	return opts
+}
+
+func buildPreview(path string, width, height int, opts previewOptions) (string, bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", false, err
+	}
+
+	if opts.gitLog {
+		content, err := renderGitLog(path)
+		return content, false, err
+	}
+	if opts.gitBlame && info.Mode().IsRegular() {
+		content, err := renderGitBlame(path, info.Size())
+		return content, false, err
+	}
+	if opts.gitDiff && info.Mode().IsRegular() {
+		content, err := renderGitDiff(path, width)
+		return content, true, err
+	}
+
+	if info.IsDir() {
+		content, err := buildDirPreview(path)
+		return content, false, err
+	}
+
+	if rule, ok := matchPreviewer(path); ok {
+		content, err := runPreviewer(rule, path, width, height)
+		return content, true, err
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	if info.Mode().IsRegular() && !imageExts[ext] {
+		if sniffed := sniffFile(path); imageExts[sniffed] {
+			ext = sniffed // an image under another name
+		}
+	}
+	if ext == ".svg" && !opts.source {
+		if img, ok := svgPreview(path, width, height); ok {
+			return img, true, nil
+		}
+	}
+	if audioExts[ext] {
+		return renderAudioPreview(path, info.Size(), width, height), true, nil
+	}
+	if videoExts[ext] {
+		return renderVideoPreview(path, info.Size(), width, height), true, nil
+	}
+	if imageExts[ext] {
+		img, err := imagePreview(path, info.ModTime(), width, height, opts.zoom)
+		if err == nil {
+			return img, true, nil
+		}
+		if errors.Is(err, errImageTooLarge) {
+			return fmt.Sprintf("image file: %s\nsize: %s\n\n%v", filepath.Base(path), humanSize(info.Size()), err), false, nil
+		}
+		if _, ok := convertedImageExts[ext]; ok {
+			return fmt.Sprintf("image file: %s\nsize: %s\n\npreview needs %s", filepath.Base(path), humanSize(info.Size()), convertedImageExts[ext]), false, nil
+		}
+		return fmt.Sprintf("image file: %s\nsize: %s\n\npreview unavailable for this format", filepath.Base(path), humanSize(info.Size())), false, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", false, err
+	}
+	defer f.Close()
+
+	// A compressed file is previewed as its contents, named without the
+	// compression extension so the inner extension picks the renderer.
+	var r io.Reader = f
+	name, compression := path, ""
+	if format, ok := compressedExts[ext]; ok && !strings.HasSuffix(strings.ToLower(strings.TrimSuffix(path, filepath.Ext(path))), ".tar") {
+		ctx, cancel := context.WithTimeout(context.Background(), previewerTimeout)
+		defer cancel()
+		dr, err := decompressReader(ctx, format, f)
+		if err != nil {
+			return fmt.Sprintf("%s file: %s\nsize: %s\n\n%v", format, filepath.Base(path), humanSize(info.Size()), err), false, nil
+		}
+		defer dr.Close()
+		r = dr
+		name, compression = strings.TrimSuffix(path, filepath.Ext(path)), format
+		ext = strings.ToLower(filepath.Ext(name))
+	}
+
+	if compression == "" && isLogFile(path) {
+		content, err := renderLogTail(f, info.Size())
+		return content, false, err
+	}
+	if compression == "" && opts.follow {
+		content, err := renderTail(f, info.Size(), func(text string) string {
+			if !opts.revealSecrets && hasSecrets(path) {
+				text, _ = maskSecrets(text)
+			}
+			return highlight(path, text)
+		})
+		return content, false, err
+	}
+
+	buf := make([]byte, maxPreviewBytes)
+	n, readErr := io.ReadFull(r, buf)
+	if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+		if compression == "" {
+			return "", false, readErr
+		}
+		return fmt.Sprintf("%s file: %s\nsize: %s\n\ncannot decompress: %v", compression, filepath.Base(path), humanSize(info.Size()), readErr), false, nil
+	}
+	buf = buf[:n]
+
+	if compression != "" {
+		if isLikelyBinary(buf) {
+			return fmt.Sprintf("%s file: %s\nsize: %s\n\ncompressed binary content", compression, filepath.Base(path), humanSize(info.Size())), false, nil
+		}
+		content, err := renderTextPreview(path, name, ext, buf, info.Size(), width, opts)
+		header := jsonMuted.Render(fmt.Sprintf("  %s · %s compressed", compression, humanSize(info.Size())))
+		return prependPreview(header, content), laidOutForPane(ext, buf, opts), err
+	}
+
+	// Source view skips the decoders, leaving text formats as text and
+	// binary ones to the strings view below.
+	if format := structuredBinaryFormat(ext, buf); format != "" && !opts.source {
+		content, err := renderStructuredBinary(path, format, info.Size())
+		return content, false, err
+	}
+	if protoWireExts[ext] && !opts.source {
+		if out, ok := renderProtobufWire(path, info.Size(), ext == ".bin"); ok {
+			return out, false, nil
+		}
+	}
+
+	if certExts[ext] && !opts.source {
+		if out, ok := renderCertPreview(buf); ok {
+			return out, false, nil
+		}
+	}
+
+	if isLikelyBinary(buf) {
+		if opts.source {
+			content, err := renderBinaryStrings(path)
+			return content, false, err
+		}
+		return fmt.Sprintf("binary file: %s\nsize: %s\nmodified: %s", filepath.Base(path), humanSize(info.Size()), info.ModTime().Format(time.RFC822)), false, nil
+	}
+	content, err := renderTextPreview(path, path, ext, buf, info.Size(), width, opts)
+	return content, laidOutForPane(ext, buf, opts), err
+}
+
+// renderTextPreview renders the first maxPreviewBytes of a text file. name
+// picks the highlighter and differs from path when the file was decompressed.
+// Plain text and code that go on past that end with a morePreviewMark, and
+// the rest streams in as the preview is scrolled.
+func renderTextPreview(path, name, ext string, buf []byte, size int64, width int, opts previewOptions) (string, error) {
+	truncated := len(buf) == maxPreviewBytes
+	if truncated {
+		// End on a whole line, which also keeps a multi-byte character
+		// from being cut in two.
+		if i := bytes.LastIndexByte(buf, '\n'); i > 0 {
+			buf = buf[:i+1]
+		}
+	}
+	text := string(buf)
+	if !utf8.ValidString(text) {
+		return fmt.Sprintf("non-utf8 text file: %s\nsize: %s", filepath.Base(path), humanSize(size)), nil
+	}
+	// Normalize Windows-style line endings so \r doesn't corrupt terminal rendering.
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	if truncated && path == name && streamsInChunks(name, ext, text, opts) {
+		out, err := renderText(path, name, ext, strings.TrimSuffix(text, "\n"), false, width, opts)
+		return out + "\n" + morePreviewMark + strconv.Itoa(len(buf)), err
+	}
+	if !opts.revealSecrets && hasSecrets(name) {
+		if masked, count := maskSecrets(text); count > 0 {
+			out, err := renderText(path, name, ext, masked, truncated, width, opts)
+			note := jsonMuted.Render(fmt.Sprintf("  %s masked · * reveals", countNoun(count, "secret value")))
+			return prependPreview(note, out), err
+		}
+	}
+	return renderText(path, name, ext, text, truncated, width, opts)
+}
+
+// streamsInChunks reports whether a long file renders line by line, as
+// highlighted code or plain text, so later parts can be rendered separately.
+// Formats parsed as a whole, logs (previewed from the end) and files whose
+// secrets are masked preview only their first maxPreviewBytes.
+func streamsInChunks(name, ext, text string, opts previewOptions) bool {
+	switch ext {
+	case ".mmd", ".mermaid", ".dot", ".gv", ".puml", ".plantuml", ".d2", ".csv", ".tsv", ".tab", ".proto", ".diff", ".patch":
+		return false
+	case ".md", ".markdown", ".mdx", ".json", ".html", ".htm", ".xhtml", ".org":
+		return opts.source
+	}
+	if isLogFile(name) || !opts.source && isManPage(ext, text) {
+		return false
+	}
+	return opts.revealSecrets || !hasSecrets(name)
+}
+
+// laidOutForPane reports whether a text format renders to the pane width,
+// so its preview has to be rebuilt when the pane is resized. Highlighted
+// code and the other formats are cached once for every size.
+func laidOutForPane(ext string, buf []byte, opts previewOptions) bool {
+	switch ext {
+	case ".csv", ".tsv", ".tab", ".proto", ".diff", ".patch":
+		return true
+	case ".md", ".markdown", ".mdx", ".html", ".htm", ".xhtml":
+		return !opts.source
+	}
+	return !opts.source && isManPage(ext, string(buf[:min(len(buf), 4096)]))
+}
+
+// renderText dispatches normalised text to the renderer for its format.
+func renderText(path, name, ext, text string, truncated bool, width int, opts previewOptions) (string, error) {
+	if !opts.source && isManPage(ext, text) {
+		if page, err := renderManPage(path, text, width); err == nil {
+			return page, nil
+		}
+		hint := jsonMuted.Render("  install mandoc or groff for formatted man pages")
+		if highlighted := highlight(name, text); highlighted != "" {
+			text = highlighted
+		}
+		return hint + "\n\n" + text, nil
+	}
+
+	switch ext {
+	case ".md", ".markdown", ".mdx":
+		if !opts.source {
+			return renderMarkdownPreview(foldMarkdownSections(text, opts.folds), filepath.Dir(path), width, truncated), nil
+		}
+	case ".mmd", ".mermaid":
+		return renderMermaidNative(text), nil
+	case ".dot", ".gv":
+		return renderDotPreview(text), nil
+	case ".puml", ".plantuml":
+		return renderPlantUMLPreview(text), nil
+	case ".d2":
+		return renderD2Preview(path, text), nil
+	case ".json":
+		if !opts.source {
+			return renderJSONPreview(text, truncated), nil
+		}
+	case ".csv":
+		return renderTablePreview(text, ',', width, truncated), nil
+	case ".tsv", ".tab":
+		return renderTablePreview(text, '\t', width, truncated), nil
+	case ".proto":
+		return renderProtoPreview(name, text, width, truncated), nil
+	case ".html", ".htm", ".xhtml":
+		if !opts.source {
+			return renderHTMLPreview(text, width, truncated), nil
+		}
+	case ".org":
+		if !opts.source {
+			return renderOrgPreview(text, truncated), nil
+		}
+	case ".diff", ".patch":
+		return renderDiffPreview(text, width, truncated), nil
+	}
+	if isLogFile(name) {
+		out := tailPreviewMark + "\n" + renderLogLines(text)
+		if truncated {
+			out += "\n\n... preview truncated ..."
+		}
+		return out, nil
+	}
+
+	if highlighted := highlight(name, text); highlighted != "" {
+		if truncated {
+			highlighted += "\n\n... preview truncated ..."
+		}
+		return highlighted, nil
+	}
+
+	if truncated {
+		text += "\n\n... preview truncated ..."
+	}
+	return text, nil
+}
+
+// ── JSON query ────────────────────────────────────────────────────────────────
+
+// maxJSONQueryBytes bounds the file a query reads; unlike the preview, a
+// query needs the whole document.
+const maxJSONQueryBytes = 32 * 1024 * 1024
+
+// jsonQueryMsg delivers the results of a query run off the UI goroutine.
+type jsonQueryMsg struct {
+	requestID int
+	path      string
+	expr      string
+	content   string
+	results   int
+	masked    int
+	err       error
+}
+
+// applyJSONQuery evaluates expr against the JSON file at path in the
+// background; the results replace its preview when they arrive. An empty
+// expression or "." restores the normal preview.
+func (m *model) applyJSONQuery(expr, path string) tea.Cmd {
+	expr = strings.TrimSpace(expr)
+	if expr == "" || expr == "." {
+		m.jsonQuery = ""
+		return m.requestPreview()
+	}
+	reveal := m.revealSecrets
+	m.requestID++ // drop any preview still loading
+	requestID := m.requestID
+	m.loading = true
+	m.loadingSince = time.Now()
+	return tea.Batch(m.scheduleSpinnerTick(), func() tea.Msg {
+		msg := jsonQueryMsg{requestID: requestID, path: path, expr: expr}
+		v, masked, err := readJSONDocument(path, reveal)
+		if err != nil {
+			msg.err = err
+			return msg
+		}
+		results, err := evalJSONQuery(v, expr)
+		if err != nil {
+			msg.err = err
+			return msg
+		}
+		var sb strings.Builder
+		for i, r := range results {
+			if i > 0 {
+				sb.WriteString("\n")
+			}
+			writeJSON(&sb, r, 0)
+		}
+		msg.content, msg.results, msg.masked = sb.String(), len(results), masked
+		return msg
+	})
+}
+
+// showJSONQuery puts a query's results in place of the preview, or reopens
+// the prompt on the failed expression.
+func (m *model) showJSONQuery(msg jsonQueryMsg) tea.Cmd {
+	if msg.requestID != m.requestID || len(m.entries) == 0 || m.entries[m.selected].path != msg.path {
+		return nil
+	}
+	m.loading = false
+	if msg.err != nil {
+		m.setError("jq: " + msg.err.Error())
+		m.openPrompt(promptJSONQuery, msg.expr, msg.path)
+		if m.jsonQuery == "" {
+			return m.loadPreview() // the query dropped the preview's own load
+		}
+		return nil
+	}
+	m.jsonQuery = msg.expr
+	m.previewOffset = 0
+	m.previewColumn = 0
+	m.setPreview(msg.content)
+	m.scratch = fmt.Sprintf("jq %s  ·  %d results", msg.expr, msg.results)
+	if msg.masked > 0 {
+		m.scratch += fmt.Sprintf("  ·  %d masked", msg.masked)
+	}
+	return nil
+}
+
+// readJSONDocument reads and decodes a whole JSON file for the query and the
+// explorer. Secret values are masked, as in the preview, unless reveal is
+// set; the count of masked values is returned.
+func readJSONDocument(path string, reveal bool) (interface{}, int, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if info.Size() > maxJSONQueryBytes {
+		return nil, 0, fmt.Errorf("file is larger than %s", humanSize(maxJSONQueryBytes))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, 0, err
+	}
+	masked := 0
+	if !reveal && hasSecrets(path) {
+		masked = maskJSONSecrets(v)
+	}
+	return v, masked, nil
+}
+
+// evalJSONQuery runs a small jq subset over v: paths (.a.b, .["k"], .[0],
+// .[-1], .[]), pipes, and the keys, length and type builtins. Like jq it
+// produces a stream of results.
+func evalJSONQuery(v interface{}, expr string) ([]interface{}, error) {
+	values := []interface{}{v}
+	for _, stage := range splitJSONPipeline(expr) {
+		stage = strings.TrimSpace(stage)
+		var next []interface{}
+		for _, val := range values {
+			out, err := evalJSONStage(val, stage)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, out...)
+		}
+		values = next
+	}
+	return values, nil
+}
+
+// splitJSONPipeline splits expr on | outside string literals.
+func splitJSONPipeline(expr string) []string {
+	var stages []string
+	inQuote, start := false, 0
+	for i := 0; i < len(expr); i++ {
+		switch expr[i] {
+		case '\\':
+			i++
+		case '"':
+			inQuote = !inQuote
+		case '|':
+			if !inQuote {
+				stages = append(stages, expr[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(stages, expr[start:])
+}
+
+func evalJSONStage(v interface{}, stage string) ([]interface{}, error) {
+	switch stage {
+	case "keys":
+		switch val := v.(type) {
+		case map[string]interface{}:
+			keys := sortedJSONKeys(val)
+			out := make([]interface{}, len(keys))
+			for i, k := range keys {
+				out[i] = k
+			}
+			return []interface{}{out}, nil
+		case []interface{}:
+			out := make([]interface{}, len(val))
+			for i := range val {
+				out[i] = float64(i)
+			}
+			return []interface{}{out}, nil
+		}
+		return nil, fmt.Errorf("%s has no keys", jsonTypeName(v))
+	case "length":
+		switch val := v.(type) {
+		case map[string]interface{}:
+			return []interface{}{float64(len(val))}, nil
+		case []interface{}:
+			return []interface{}{float64(len(val))}, nil
+		case string:
+			return []interface{}{float64(utf8.RuneCountInString(val))}, nil
+		case float64:
+			return []interface{}{math.Abs(val)}, nil
+		case nil:
+			return []interface{}{float64(0)}, nil
+		}
+		return nil, fmt.Errorf("%s has no length", jsonTypeName(v))
+	case "type":
+		return []interface{}{jsonTypeName(v)}, nil
+	}
+	if !strings.HasPrefix(stage, ".") {
+		return nil, fmt.Errorf("unsupported expression %q", stage)
+	}
+
+	values := []interface{}{v}
+	s := stage
+	for s != "" && s != "." {
+		var step func(interface{}) ([]interface{}, error)
+		switch {
+		case strings.HasPrefix(s, ".["):
+			s = s[1:]
+			continue
+		case s[0] == '.' && len(s) > 1 && s[1] == '"':
+			quoted, err := strconv.QuotedPrefix(s[1:])
+			if err != nil {
+				return nil, fmt.Errorf("bad key in %q", stage)
+			}
+			key, _ := strconv.Unquote(quoted)
+			s = s[1+len(quoted):]
+			step = jsonKeyStep(key)
+		case s[0] == '.':
+			n := 1
+			for n < len(s) {
+				r, size := utf8.DecodeRuneInString(s[n:])
+				if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+					break
+				}
+				n += size
+			}
+			if n == 1 {
+				r, _ := utf8.DecodeRuneInString(s[1:])
+				return nil, fmt.Errorf("unexpected %q in %q", r, stage)
+			}
+			step = jsonKeyStep(s[1:n])
+			s = s[n:]
+		case s[0] == '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("missing ] in %q", stage)
+			}
+			inner := strings.TrimSpace(s[1:end])
+			s = s[end+1:]
+			switch {
+			case inner == "":
+				step = jsonIterateStep
+			case strings.HasPrefix(inner, `"`):
+				key, err := strconv.Unquote(inner)
+				if err != nil {
+					return nil, fmt.Errorf("bad key %s", inner)
+				}
+				step = jsonKeyStep(key)
+			case strings.Contains(inner, ":"):
+				from, to, _ := strings.Cut(inner, ":")
+				bounds := [2]*int{}
+				for i, b := range []string{from, to} {
+					if b = strings.TrimSpace(b); b == "" {
+						continue
+					}
+					n, err := strconv.Atoi(b)
+					if err != nil {
+						return nil, fmt.Errorf("bad slice %q", inner)
+					}
+					bounds[i] = &n
+				}
+				step = jsonSliceStep(bounds[0], bounds[1])
+			default:
+				idx, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("bad index %q", inner)
+				}
+				step = jsonIndexStep(idx)
+			}
+		default:
+			return nil, fmt.Errorf("unexpected %q in %q", s[:1], stage)
+		}
+
+		var next []interface{}
+		for _, val := range values {
+			out, err := step(val)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, out...)
+		}
+		values = next
+	}
+	return values, nil
+}
+
+func jsonKeyStep(key string) func(interface{}) ([]interface{}, error) {
+	return func(v interface{}) ([]interface{}, error) {
+		switch val := v.(type) {
+		case map[string]interface{}:
+			return []interface{}{val[key]}, nil
+		case nil:
+			return []interface{}{nil}, nil
+		}
+		return nil, fmt.Errorf("cannot index %s with %q", jsonTypeName(v), key)
+	}
+}
+
+func jsonIndexStep(idx int) func(interface{}) ([]interface{}, error) {
+	return func(v interface{}) ([]interface{}, error) {
+		switch val := v.(type) {
+		case []interface{}:
+			i := idx
+			if i < 0 {
+				i += len(val)
+			}
+			if i < 0 || i >= len(val) {
+				return []interface{}{nil}, nil
+			}
+			return []interface{}{val[i]}, nil
+		case nil:
+			return []interface{}{nil}, nil
+		}
+		return nil, fmt.Errorf("cannot index %s with a number", jsonTypeName(v))
+	}
+}
+
+// jsonSliceStep takes the elements (or characters) from index from up to to,
+// counting negative indexes from the end; a nil bound is the start or end.
+func jsonSliceStep(from, to *int) func(interface{}) ([]interface{}, error) {
+	bounds := func(n int) (int, int) {
+		lo, hi := 0, n
+		if from != nil {
+			lo = *from
+		}
+		if to != nil {
+			hi = *to
+		}
+		if lo < 0 {
+			lo += n
+		}
+		if hi < 0 {
+			hi += n
+		}
+		lo, hi = max(0, min(lo, n)), max(0, min(hi, n))
+		return lo, max(lo, hi)
+	}
+	return func(v interface{}) ([]interface{}, error) {
+		switch val := v.(type) {
+		case []interface{}:
+			lo, hi := bounds(len(val))
+			return []interface{}{val[lo:hi]}, nil
+		case string:
+			runes := []rune(val)
+			lo, hi := bounds(len(runes))
+			return []interface{}{string(runes[lo:hi])}, nil
+		case nil:
+			return []interface{}{nil}, nil
+		}
+		return nil, fmt.Errorf("cannot slice %s", jsonTypeName(v))
+	}
+}
+
+func jsonIterateStep(v interface{}) ([]interface{}, error) {
+	switch val := v.(type) {
+	case []interface{}:
+		return val, nil
+	case map[string]interface{}:
+		keys := sortedJSONKeys(val)
+		out := make([]interface{}, len(keys))
+		for i, k := range keys {
+			out[i] = val[k]
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("cannot iterate over %s", jsonTypeName(v))
+}
+
+func sortedJSONKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func jsonTypeName(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return "null"
+}
+
+// ── JSON explorer ─────────────────────────────────────────────────────────────
+
+// jsonChunk is how many children of a container are shown at a time; the
+// rest sit behind a "more" row that reveals the next chunk.
+const jsonChunk = 100
+
+// jsonExplorer is a foldable view of a JSON document in the preview pane.
+// Nodes are addressed by JSON Pointer.
+type jsonExplorer struct {
+	path     string
+	root     interface{}
+	expanded map[string]bool
+	limits   map[string]int // pointer → children shown, when above jsonChunk
+	cursor   int
+}
+
+// jsonRow is one visible line: a node, or the "more" row of a container
+// whose remaining children are hidden.
+type jsonRow struct {
+	ptr   string
+	depth int
+	label string
+	index bool // label is an array index rather than an object key
+	value interface{}
+	more  int
+}
+
+// jsonDocumentMsg delivers a document read for the explorer.
+type jsonDocumentMsg struct {
+	requestID int
+	path      string
+	reveal    bool
+	root      interface{}
+	masked    int
+	err       error
+}
+
+// openJSONExplorer reads the JSON file at path in the background and opens
+// the explorer on it when it arrives.
+func (m *model) openJSONExplorer(path string) tea.Cmd {
+	load := m.loadJSONDocument(path, m.revealSecrets)
+	m.loading = true
+	m.loadingSince = time.Now()
+	return tea.Batch(load, m.scheduleSpinnerTick())
+}
+
+func (m *model) loadJSONDocument(path string, reveal bool) tea.Cmd {
+	m.requestID++ // drop any preview still loading
+	requestID := m.requestID
+	return func() tea.Msg {
+		v, masked, err := readJSONDocument(path, reveal)
+		return jsonDocumentMsg{requestID: requestID, path: path, reveal: reveal, root: v, masked: masked, err: err}
+	}
+}
+
+// showJSONDocument opens the explorer on a loaded document, or swaps the
+// document of the open one after secrets are revealed or masked again.
+func (m *model) showJSONDocument(msg jsonDocumentMsg) tea.Cmd {
+	if msg.requestID != m.requestID || len(m.entries) == 0 || m.entries[m.selected].path != msg.path {
+		return nil
+	}
+	m.loading = false
+	x := m.jsonExplorer
+	if msg.err != nil {
+		m.setError("json: " + msg.err.Error())
+		if x == nil {
+			return m.loadPreview() // opening dropped the preview's own load
+		}
+		return nil
+	}
+	if x != nil && x.path == msg.path {
+		x.root = msg.root
+		m.revealSecrets = msg.reveal
+		if m.revealSecrets {
+			m.status = "secrets revealed"
+		} else {
+			m.status = "secrets masked"
+		}
+	} else {
+		if msg.masked > 0 {
+			m.status = countNoun(msg.masked, "secret value") + " masked · * reveals"
+		}
+		m.jsonExplorer = &jsonExplorer{
+			path:     msg.path,
+			root:     msg.root,
+			expanded: map[string]bool{"": true},
+			limits:   make(map[string]int),
+		}
+	}
+	m.renderJSONExplorer()
+	return nil
+}
+
+func (x *jsonExplorer) rows() []jsonRow {
+	var rows []jsonRow
+	var walk func(ptr, label string, index bool, v interface{}, depth int)
+	walk = func(ptr, label string, index bool, v interface{}, depth int) {
+		rows = append(rows, jsonRow{ptr: ptr, depth: depth, label: label, index: index, value: v})
+		if !x.expanded[ptr] {
+			return
+		}
+		limit := max(jsonChunk, x.limits[ptr])
+		switch val := v.(type) {
+		case map[string]interface{}:
+			keys := sortedJSONKeys(val)
+			for _, k := range keys[:min(limit, len(keys))] {
+				walk(ptr+"/"+jsonPointerEscape(k), k, false, val[k], depth+1)
+			}
+			if len(keys) > limit {
+				rows = append(rows, jsonRow{ptr: ptr, depth: depth + 1, more: len(keys) - limit})
+			}
+		case []interface{}:
+			for i, item := range val[:min(limit, len(val))] {
+				walk(ptr+"/"+strconv.Itoa(i), strconv.Itoa(i), true, item, depth+1)
+			}
+			if len(val) > limit {
+				rows = append(rows, jsonRow{ptr: ptr, depth: depth + 1, more: len(val) - limit})
+			}
+		}
+	}
+	walk("", "", false, x.root, 0)
+	return rows
+}
+
+// countNoun formats n with noun, pluralised by adding "s".
+func countNoun(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+func jsonPointerEscape(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+func isJSONContainer(v interface{}) bool {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		return true
+	}
+	return false
+}
+
+func (m *model) updateJSONExplorer(msg tea.KeyMsg) tea.Cmd {
+	x := m.jsonExplorer
+	rows := x.rows()
+	row := rows[x.cursor]
+	switch msg.String() {
+	case "esc", "q":
+		m.jsonExplorer = nil
+		return m.requestPreview()
+	case "*":
+		return m.loadJSONDocument(x.path, !m.revealSecrets)
+	case "j", "down":
+		x.cursor = min(x.cursor+1, len(rows)-1)
+	case "k", "up":
+		x.cursor = max(0, x.cursor-1)
+	case "g", "home":
+		x.cursor = 0
+	case "G", "end":
+		x.cursor = len(rows) - 1
+	case "l", "right", "enter":
+		switch {
+		case row.more > 0:
+			x.limits[row.ptr] = max(jsonChunk, x.limits[row.ptr]) + jsonChunk
+		case isJSONContainer(row.value) && !x.expanded[row.ptr]:
+			x.expanded[row.ptr] = true
+		case isJSONContainer(row.value) && x.cursor+1 < len(rows):
+			x.cursor++
+		}
+	case "h", "left":
+		if row.more == 0 && x.expanded[row.ptr] {
+			delete(x.expanded, row.ptr)
+			break
+		}
+		// Move to the parent; a "more" row's parent is its container.
+		parent := row.ptr
+		if row.more == 0 {
+			if i := strings.LastIndexByte(row.ptr, '/'); i >= 0 {
+				parent = row.ptr[:i]
+			}
+		}
+		for i, r := range rows {
+			if r.ptr == parent && r.more == 0 {
+				x.cursor = i
+				break
+			}
+		}
+	case "L":
+		// Expand everything below the cursor.
+		var open func(ptr string, v interface{})
+		open = func(ptr string, v interface{}) {
+			switch val := v.(type) {
+			case map[string]interface{}:
+				x.expanded[ptr] = true
+				for k, child := range val {
+					open(ptr+"/"+jsonPointerEscape(k), child)
+				}
+			case []interface{}:
+				x.expanded[ptr] = true
+				for i, child := range val {
+					open(ptr+"/"+strconv.Itoa(i), child)
+				}
+			}
+		}
+		open(row.ptr, row.value)
+	case "H":
+		for ptr := range x.expanded {
+			if ptr != "" {
+				delete(x.expanded, ptr)
+			}
+		}
+		x.cursor = 0
+	}
+	m.renderJSONExplorer()
+	return nil
+}
+
+// renderJSONExplorer draws the explorer into the preview, scrolled so the
+// cursor stays visible.
+func (m *model) renderJSONExplorer() {
+	x := m.jsonExplorer
+	rows := x.rows()
+	x.cursor = max(0, min(x.cursor, len(rows)-1))
+
+	selStyle := lipgloss.NewStyle().Background(clrAccent).Foreground(clrAccentFg).Bold(true)
+	indexStyle := lipgloss.NewStyle().Foreground(clrMuted)
+	lines := make([]string, len(rows))
+	for i, r := range rows {
+		indent := strings.Repeat("  ", r.depth)
+		if r.more > 0 {
+			text := fmt.Sprintf("%s  … %d more (l shows %d)", indent, r.more, min(r.more, jsonChunk))
+			if i == x.cursor {
+				lines[i] = selStyle.Render(text)
+			} else {
+				lines[i] = jsonMuted.Render(text)
+			}
+			continue
+		}
+		marker := "  "
+		if isJSONContainer(r.value) {
+			marker = "▸ "
+			if x.expanded[r.ptr] {
+				marker = "▾ "
+			}
+		}
+		label := ""
+		switch {
+		case r.index:
+			label = indexStyle.Render(r.label) + jsonMuted.Render(": ")
+		case r.ptr != "":
+			label = jsonKey.Render(strconv.Quote(r.label)) + jsonMuted.Render(": ")
+		}
+		var value string
+		switch val := r.value.(type) {
+		case map[string]interface{}:
+			value = jsonBracket.Render("{}") + jsonMuted.Render(" "+countNoun(len(val), "key"))
+		case []interface{}:
+			value = jsonBracket.Render("[]") + jsonMuted.Render(" "+countNoun(len(val), "item"))
+		default:
+			var sb strings.Builder
+			writeJSON(&sb, val, 0)
+			value = sb.String()
+		}
+		line := indent + marker + label + value
+		if i == x.cursor {
+			line = selStyle.Render(ansi.Strip(line))
+		}
+		lines[i] = line
+	}
+
+	m.preview = strings.Join(lines, "\n")
+	viewport := m.previewViewportHeight()
+	if x.cursor < m.previewOffset {
+		m.previewOffset = x.cursor
+	} else if x.cursor >= m.previewOffset+viewport {
+		m.previewOffset = x.cursor - viewport + 1
+	}
+	m.scratch = "h/l fold  ·  H/L all  ·  esc done"
+}
+
+// ── MessagePack / CBOR ────────────────────────────────────────────────────────
+
+// maxBinaryDepth bounds nesting so a hostile file can't exhaust the stack.
+const maxBinaryDepth = 512
+
+// cborSelfDescribe is the optional CBOR tag 55799 that marks a CBOR stream.
+var cborSelfDescribe = []byte{0xd9, 0xd9, 0xf7}
+
+// structuredBinaryFormat names the serialisation of a file by extension, or
+// by the CBOR self-describe tag or binary plist magic, or returns "".
+func structuredBinaryFormat(ext string, head []byte) string {
+	switch ext {
+	case ".msgpack", ".mpk":
+		return "MessagePack"
+	case ".cbor":
+		return "CBOR"
+	case ".plist":
+		return "plist"
+	}
+	switch {
+	case bytes.HasPrefix(head, cborSelfDescribe):
+		return "CBOR"
+	case bytes.HasPrefix(head, bplistMagic):
+		return "plist"
+	}
+	return ""
+}
+
+// renderStructuredBinary decodes a MessagePack, CBOR or plist file and
+// renders it with the JSON colouriser.
+func renderStructuredBinary(path, format string, size int64) (string, error) {
+	if size > maxJSONQueryBytes {
+		return fmt.Sprintf("%s file: %s\nsize: %s\n\ntoo large to decode", format, filepath.Base(path), humanSize(size)), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	d := &binDecoder{data: data}
+	var v interface{}
+	switch format {
+	case "CBOR":
+		v, err = d.cbor(0)
+	case "plist":
+		v, err = decodePlist(data)
+		d.pos = -1
+	default:
+		v, err = d.msgpack(0)
+	}
+	header := jsonMuted.Render(fmt.Sprintf("  %s · %s", format, humanSize(size)))
+	if err != nil {
+		errStyle := lipgloss.NewStyle().Foreground(clrDanger)
+		msg := fmt.Sprintf("  invalid %s at byte %d: %v", format, d.pos, err)
+		if d.pos < 0 {
+			msg = fmt.Sprintf("  invalid %s: %v", format, err)
+		}
+		return header + "\n\n" + errStyle.Render(msg), nil
+	}
+	var sb strings.Builder
+	writeJSON(&sb, v, 0)
+	if d.pos >= 0 && d.pos < len(data) {
+		sb.WriteString("\n" + jsonMuted.Render(fmt.Sprintf("  … %d trailing bytes", len(data)-d.pos)))
+	}
+	return header + "\n\n" + sb.String(), nil
+}
+
+// binDecoder decodes MessagePack or CBOR into the value types produced by
+// encoding/json, so writeJSON can render them. Byte strings and extension
+// types are shown as short descriptive strings.
+type binDecoder struct {
+	data []byte
+	pos  int
+}
+
+var errBinaryTruncated = errors.New("unexpected end of data")
+
+func (d *binDecoder) take(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, errBinaryTruncated
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+func (d *binDecoder) uint(size int) (uint64, error) {
+	b, err := d.take(uint64(size))
+	if err != nil {
+		return 0, err
+	}
+	return binaryUint(b), nil
+}
+
+func describeBytes(b []byte) string {
+	const shown = 16
+	s := fmt.Sprintf("<%d bytes: %x", len(b), b[:min(len(b), shown)])
+	if len(b) > shown {
+		s += "…"
+	}
+	return s + ">"
+}
+
+// mapKey renders a non-string key the way it would print as a value.
+func mapKey(k interface{}) string {
+	if s, ok := k.(string); ok {
+		return s
+	}
+	var sb strings.Builder
+	writeJSON(&sb, k, 0)
+	return ansi.Strip(sb.String())
+}
+
+func (d *binDecoder) msgpack(depth int) (interface{}, error) {
+	if depth > maxBinaryDepth {
+		return nil, errors.New("nesting too deep")
+	}
+	b, err := d.take(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		return float64(c), nil
+	case c >= 0xe0:
+		return float64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return d.msgpackMap(uint64(c&0x0f), depth)
+	case c&0xf0 == 0x90:
+		return d.msgpackArray(uint64(c&0x0f), depth)
+	case c&0xe0 == 0xa0:
+		s, err := d.take(uint64(c & 0x1f))
+		return string(s), err
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		raw, err := d.take(n)
+		if err != nil {
+			return nil, err
+		}
+		return describeBytes(raw), nil
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.uint(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.msgpackExt(n)
+	case 0xca:
+		v, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(v))), err
+	case 0xcb:
+		v, err := d.uint(8)
+		return math.Float64frombits(v), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		v, err := d.uint(1 << (c - 0xcc))
+		return float64(v), err
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		v, err := d.uint(size)
+		// Sign-extend from the encoded width.
+		shift := 64 - 8*size
+		return float64(int64(v<<shift) >> shift), err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.msgpackExt(1 << (c - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		s, err := d.take(n)
+		return string(s), err
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.msgpackArray(n, depth)
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.msgpackMap(n, depth)
+	}
+	return nil, fmt.Errorf("unknown type byte 0x%02x", c)
+}
+
+func (d *binDecoder) msgpackArray(n uint64, depth int) (interface{}, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, errBinaryTruncated // every element takes at least a byte
+	}
+	out := make([]interface{}, 0, n)
+	for range n {
+		v, err := d.msgpack(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func (d *binDecoder) msgpackMap(n uint64, depth int) (interface{}, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, errBinaryTruncated
+	}
+	out := make(map[string]interface{}, n)
+	for range n {
+		k, err := d.msgpack(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.msgpack(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		out[mapKey(k)] = v
+	}
+	return out, nil
+}
+
+// msgpackExt decodes an extension payload of n bytes; type -1 is the
+// standard timestamp.
+func (d *binDecoder) msgpackExt(n uint64) (interface{}, error) {
+	typ, err := d.take(1)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := d.take(n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(typ[0]) == -1 {
+		var t time.Time
+		switch len(raw) {
+		case 4:
+			t = time.Unix(int64(binaryUint(raw)), 0)
+		case 8:
+			v := binaryUint(raw)
+			t = time.Unix(int64(v&0x3ffffffff), int64(v>>34))
+		case 12:
+			t = time.Unix(int64(binaryUint(raw[4:])), int64(binaryUint(raw[:4])))
+		}
+		if !t.IsZero() {
+			return t.UTC().Format(time.RFC3339Nano), nil
+		}
+	}
+	return fmt.Sprintf("<ext %d, %d bytes>", int8(typ[0]), len(raw)), nil
+}
+
+func binaryUint(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// errCBORBreak is returned for the 0xff stop code ending indefinite items.
+var errCBORBreak = errors.New("unexpected break")
+
+// cborChunks joins the raw bytes of the definite-length chunks of an
+// indefinite-length byte or text string, up to its break code.
+func (d *binDecoder) cborChunks(major byte) ([]byte, error) {
+	var raw []byte
+	for {
+		b, err := d.take(1)
+		if err != nil {
+			return nil, err
+		}
+		if b[0] == 0xff {
+			return raw, nil
+		}
+		info := b[0] & 0x1f
+		if b[0]>>5 != major || info > 27 {
+			return nil, errors.New("bad string chunk")
+		}
+		n := uint64(info)
+		if info >= 24 {
+			if n, err = d.uint(1 << (info - 24)); err != nil {
+				return nil, err
+			}
+		}
+		chunk, err := d.take(n)
+		if err != nil {
+			return nil, err
+		}
+		raw = append(raw, chunk...)
+	}
+}
+
+func (d *binDecoder) cbor(depth int) (interface{}, error) {
+	if depth > maxBinaryDepth {
+		return nil, errors.New("nesting too deep")
+	}
+	b, err := d.take(1)
+	if err != nil {
+		return nil, err
+	}
+	major, info := b[0]>>5, b[0]&0x1f
+	if b[0] == 0xff {
+		return nil, errCBORBreak
+	}
+
+	var arg uint64
+	indefinite := false
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info <= 27:
+		if arg, err = d.uint(1 << (info - 24)); err != nil {
+			return nil, err
+		}
+	case info == 31 && major >= 2 && major <= 5:
+		indefinite = true
+	default:
+		return nil, fmt.Errorf("invalid additional info %d", info)
+	}
+
+	switch major {
+	case 0:
+		return float64(arg), nil
+	case 1:
+		return -1 - float64(arg), nil
+	case 2, 3:
+		var raw []byte
+		if indefinite {
+			raw, err = d.cborChunks(major)
+		} else {
+			raw, err = d.take(arg)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if major == 2 {
+			return describeBytes(raw), nil
+		}
+		return string(raw), nil
+	case 4:
+		var out []interface{}
+		for i := uint64(0); indefinite || i < arg; i++ {
+			v, err := d.cbor(depth + 1)
+			if indefinite && err == errCBORBreak {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+		if out == nil {
+			out = []interface{}{}
+		}
+		return out, nil
+	case 5:
+		out := make(map[string]interface{})
+		for i := uint64(0); indefinite || i < arg; i++ {
+			k, err := d.cbor(depth + 1)
+			if indefinite && err == errCBORBreak {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.cbor(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			out[mapKey(k)] = v
+		}
+		return out, nil
+	case 6:
+		// Tags annotate the next item; show the item itself.
+		return d.cbor(depth + 1)
+	}
+
+	// Major type 7: simple values and floats.
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		return halfFloat(uint16(arg)), nil
+	case 26:
+		return float64(math.Float32frombits(uint32(arg))), nil
+	case 27:
+		return math.Float64frombits(arg), nil
+	}
+	return fmt.Sprintf("<simple %d>", arg), nil
+}
+
+// halfFloat converts an IEEE 754 half-precision value.
+func halfFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	frac := float64(h & 0x3ff)
+	var v float64
+	switch exp {
+	case 0:
+		v = math.Ldexp(frac, -24)
+	case 31:
+		if frac == 0 {
+			v = math.Inf(1)
+		} else {
+			v = math.NaN()
+		}
+	default:
+		v = math.Ldexp(frac+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -v
+	}
+	return v
+}
+
+// ── plist ─────────────────────────────────────────────────────────────────────
+
+var bplistMagic = []byte("bplist00")
+
+// plistEpoch is the reference date for binary plist dates.
+var plistEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// decodePlist decodes an XML or binary property list into JSON-like values.
+func decodePlist(data []byte) (interface{}, error) {
+	if bytes.HasPrefix(data, bplistMagic) {
+		return decodeBinaryPlist(data)
+	}
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local != "plist" {
+			return decodePlistXML(dec, start, 0)
+		}
+	}
+}
+
+func decodePlistXML(dec *xml.Decoder, start xml.StartElement, depth int) (interface{}, error) {
+	if depth > maxBinaryDepth {
+		return nil, errors.New("nesting too deep")
+	}
+	switch start.Name.Local {
+	case "dict":
+		out := make(map[string]interface{})
+		key := ""
+		for {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := tok.(type) {
+			case xml.StartElement:
+				if t.Name.Local == "key" {
+					if err := dec.DecodeElement(&key, &t); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				v, err := decodePlistXML(dec, t, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				out[key] = v
+			case xml.EndElement:
+				return out, nil
+			}
+		}
+	case "array":
+		out := []interface{}{}
+		for {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch t := tok.(type) {
+			case xml.StartElement:
+				v, err := decodePlistXML(dec, t, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, v)
+			case xml.EndElement:
+				return out, nil
+			}
+		}
+	case "true", "false":
+		if err := dec.Skip(); err != nil {
+			return nil, err
+		}
+		return start.Name.Local == "true", nil
+	}
+
+	var text string
+	if err := dec.DecodeElement(&text, &start); err != nil {
+		return nil, err
+	}
+	text = strings.TrimSpace(text)
+	switch start.Name.Local {
+	case "integer", "real":
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad %s %q", start.Name.Local, text)
+		}
+		return f, nil
+	case "data":
+		raw, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+		if err != nil {
+			return nil, err
+		}
+		return describeBytes(raw), nil
+	}
+	// string, date, and anything unrecognised show as text.
+	return text, nil
+}
+
+// binaryPlist holds the parsed trailer of a bplist00 file.
+type binaryPlist struct {
+	data       []byte
+	offsets    []uint64
+	refSize    int
+	inProgress map[uint64]bool // guards against reference cycles
+}
+
+func decodeBinaryPlist(data []byte) (interface{}, error) {
+	if len(data) < len(bplistMagic)+32 {
+		return nil, errBinaryTruncated
+	}
+	trailer := data[len(data)-32:]
+	offsetSize := int(trailer[6])
+	refSize := int(trailer[7])
+	numObjects := binaryUint(trailer[8:16])
+	top := binaryUint(trailer[16:24])
+	tableOffset := binaryUint(trailer[24:32])
+	if offsetSize < 1 || offsetSize > 8 || refSize < 1 || refSize > 8 ||
+		numObjects == 0 || top >= numObjects ||
+		tableOffset >= uint64(len(data)) || numObjects > (uint64(len(data))-tableOffset)/uint64(offsetSize) {
+		return nil, errors.New("corrupt trailer")
+	}
+	p := &binaryPlist{data: data, refSize: refSize, inProgress: make(map[uint64]bool)}
+	p.offsets = make([]uint64, numObjects)
+	for i := range p.offsets {
+		at := tableOffset + uint64(i*offsetSize)
+		p.offsets[i] = binaryUint(data[at : at+uint64(offsetSize)])
+	}
+	return p.object(top, 0)
+}
+
+func (p *binaryPlist) object(ref uint64, depth int) (interface{}, error) {
+	if ref >= uint64(len(p.offsets)) {
+		return nil, fmt.Errorf("object %d out of range", ref)
+	}
+	if depth > maxBinaryDepth || p.inProgress[ref] {
+		return nil, errors.New("nesting too deep")
+	}
+	p.inProgress[ref] = true
+	defer delete(p.inProgress, ref)
+
+	d := &binDecoder{data: p.data, pos: len(p.data)}
+	if off := p.offsets[ref]; off < uint64(len(p.data)) {
+		d.pos = int(off)
+	}
+	marker, err := d.take(1)
+	if err != nil {
+		return nil, err
+	}
+	kind, info := marker[0]>>4, marker[0]&0x0f
+
+	// count reads the object length, which overflows into a following int
+	// object when the low nibble is 0xf.
+	count := func() (uint64, error) {
+		if info != 0x0f {
+			return uint64(info), nil
+		}
+		m, err := d.take(1)
+		if err != nil {
+			return 0, err
+		}
+		if m[0]>>4 != 0x1 || m[0]&0x0f > 3 {
+			return 0, errors.New("bad length")
+		}
+		return d.uint(1 << (m[0] & 0x0f))
+	}
+	refs := func(n uint64) ([]uint64, error) {
+		if n > uint64(len(p.data)) {
+			return nil, errBinaryTruncated
+		}
+		out := make([]uint64, n)
+		for i := range out {
+			if out[i], err = d.uint(p.refSize); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+
+	switch kind {
+	case 0x0:
+		switch info {
+		case 0x8:
+			return false, nil
+		case 0x9:
+			return true, nil
+		}
+		return nil, nil
+	case 0x1:
+		if info > 3 {
+			return nil, errors.New("bad integer size")
+		}
+		size := 1 << info
+		v, err := d.uint(size)
+		if size == 8 {
+			return float64(int64(v)), err
+		}
+		return float64(v), err
+	case 0x2:
+		switch info {
+		case 2:
+			v, err := d.uint(4)
+			return float64(math.Float32frombits(uint32(v))), err
+		case 3:
+			v, err := d.uint(8)
+			return math.Float64frombits(v), err
+		}
+		return nil, errors.New("bad real size")
+	case 0x3:
+		v, err := d.uint(8)
+		secs := math.Float64frombits(v)
+		return plistEpoch.Add(time.Duration(secs * float64(time.Second))).Format(time.RFC3339), err
+	case 0x4, 0x5, 0x6:
+		n, err := count()
+		if err != nil {
+			return nil, err
+		}
+		if kind == 0x6 {
+			if n > uint64(len(p.data))/2 {
+				return nil, errBinaryTruncated
+			}
+			n *= 2
+		}
+		raw, err := d.take(n)
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case 0x4:
+			return describeBytes(raw), nil
+		case 0x5:
+			return string(raw), nil
+		}
+		units := make([]uint16, len(raw)/2)
+		for i := range units {
+			units[i] = uint16(raw[2*i])<<8 | uint16(raw[2*i+1])
+		}
+		return string(utf16.Decode(units)), nil
+	case 0x8:
+		v, err := d.uint(int(info) + 1)
+		return fmt.Sprintf("<UID %d>", v), err
+	case 0xa:
+		n, err := count()
+		if err != nil {
+			return nil, err
+		}
+		items, err := refs(n)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]interface{}, len(items))
+		for i, r := range items {
+			if out[i], err = p.object(r, depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case 0xd:
+		n, err := count()
+		if err != nil {
+			return nil, err
+		}
+		// Checked before doubling, which could otherwise wrap to 0.
+		if n > uint64(len(p.data))/uint64(p.refSize) {
+			return nil, errBinaryTruncated
+		}
+		all, err := refs(2 * n)
+		if err != nil {
+			return nil, err
+		}
+		out := make(map[string]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			k, err := p.object(all[i], depth+1)
+			if err != nil {
+				return nil, err
+			}
+			v, err := p.object(all[n+i], depth+1)
+			if err != nil {
+				return nil, err
+			}
+			out[mapKey(k)] = v
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("unknown object type 0x%x", kind)
+}
+
+// ── protobuf ──────────────────────────────────────────────────────────────────
+
+// protoWireExts are extensions tried as serialised protobuf messages. .bin is
+// only shown this way when the whole file decodes cleanly.
+var protoWireExts = map[string]bool{".pb": true, ".binpb": true, ".bin": true}
+
+// maxProtoFields caps how many fields the wire decode renders.
+const maxProtoFields = 5000
+
+// protoOutlineItem is one line of a .proto schema outline.
+type protoOutlineItem struct {
+	depth  int
+	kind   string // message, enum, service, oneof, extend, field, value, rpc
+	name   string
+	detail string // field type, or rpc signature
+	number string // field or enum value number
+}
+
+// renderProtoPreview shows an outline of the messages, enums and services in
+// a .proto file above its highlighted source.
+func renderProtoPreview(path, text string, width int, truncated bool) string {
+	syntax, pkg, items := parseProtoOutline(text)
+
+	counts := map[string]int{}
+	for _, it := range items {
+		counts[it.kind]++
+	}
+	var summary []string
+	if syntax != "" {
+		summary = append(summary, syntax)
+	}
+	if pkg != "" {
+		summary = append(summary, "package "+pkg)
+	}
+	for _, kind := range []string{"message", "enum", "service"} {
+		if counts[kind] > 0 {
+			summary = append(summary, countNoun(counts[kind], kind))
+		}
+	}
+
+	keyword := lipgloss.NewStyle().Foreground(clrAccent).Bold(true)
+	name := lipgloss.NewStyle().Foreground(clrTitle).Bold(true)
+	typ := lipgloss.NewStyle().Foreground(clrCode)
+
+	var sb strings.Builder
+	if len(summary) > 0 {
+		sb.WriteString(jsonMuted.Render("  "+strings.Join(summary, " · ")) + "\n\n")
+	}
+	for _, it := range items {
+		sb.WriteString("  " + strings.Repeat("  ", it.depth))
+		switch it.kind {
+		case "field":
+			sb.WriteString(jsonNum.Render(fmt.Sprintf("%3s", it.number)) + "  " + typ.Render(it.detail) + " " + it.name)
+		case "value":
+			sb.WriteString(it.name + jsonMuted.Render(" = ") + jsonNum.Render(it.number))
+		case "rpc":
+			sb.WriteString(keyword.Render("rpc") + " " + name.Render(it.name) + typ.Render(it.detail))
+		default:
+			sb.WriteString(keyword.Render(it.kind) + " " + name.Render(it.name))
+		}
+		sb.WriteString("\n")
+	}
+	if len(items) > 0 {
+		sb.WriteString("\n" + jsonMuted.Render(strings.Repeat("─", max(width, 1))) + "\n\n")
+	}
+
+	source := highlight(path, text)
+	if source == "" {
+		source = text
+	}
+	sb.WriteString(source)
+	if truncated {
+		sb.WriteString("\n\n... preview truncated ...")
+	}
+	return sb.String()
+}
+
+// parseProtoOutline walks the declarations of a .proto file. It understands
+// enough of the grammar for an outline and skips anything else statement by
+// statement, so unusual syntax costs detail rather than the whole outline.
+func parseProtoOutline(text string) (syntax, pkg string, items []protoOutlineItem) {
+	toks := protoTokens(text)
+	var stack []string // kinds of the enclosing blocks; "" for option bodies
+	inside := func() string {
+		if len(stack) == 0 {
+			return ""
+		}
+		return stack[len(stack)-1]
+	}
+	// skipStatement moves past the next ; at this nesting level, or up to
+	// an unmatched }.
+	skipStatement := func(i int) int {
+		depth := 0
+		for ; i < len(toks); i++ {
+			switch toks[i] {
+			case "{":
+				depth++
+			case "}":
+				if depth == 0 {
+					return i
+				}
+				depth--
+				if depth == 0 {
+					return i + 1
+				}
+			case ";":
+				if depth == 0 {
+					return i + 1
+				}
+			}
+		}
+		return i
+	}
+	tok := func(i int) string {
+		if i < len(toks) {
+			return toks[i]
+		}
+		return ""
+	}
+
+	for i := 0; i < len(toks); {
+		t := toks[i]
+		switch {
+		case t == "}":
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			i++
+		case t == ";":
+			i++
+		case t == "syntax" || t == "edition":
+			if tok(i+1) == "=" {
+				syntax = strings.Trim(tok(i+2), `"'`)
+				if t == "edition" {
+					syntax = "edition " + syntax
+				}
+			}
+			i = skipStatement(i)
+		case t == "package" && len(stack) == 0:
+			pkg = tok(i + 1)
+			i = skipStatement(i)
+		case (t == "message" || t == "enum" || t == "service" || t == "oneof" || t == "extend") && tok(i+2) == "{":
+			items = append(items, protoOutlineItem{depth: len(stack), kind: t, name: tok(i + 1)})
+			stack = append(stack, t)
+			i += 3
+		case t == "rpc" && inside() == "service":
+			// rpc Name ( [stream] Req ) returns ( [stream] Resp )
+			end := i + 1
+			for end < len(toks) && toks[end] != ";" && toks[end] != "{" {
+				end++
+			}
+			if end < i+2 || end == len(toks) {
+				// A half-typed rpc without a name or an end.
+				i = skipStatement(i)
+				continue
+			}
+			sig := ""
+			for _, s := range toks[i+2 : end] {
+				switch s {
+				case "(", ")":
+					sig += s
+				case "stream":
+					sig += s + " "
+				case "returns":
+					sig += " returns "
+				default:
+					sig += s
+				}
+			}
+			items = append(items, protoOutlineItem{depth: len(stack), kind: "rpc", name: tok(i + 1), detail: sig})
+			i = skipStatement(i)
+		case t == "option" || t == "reserved" || t == "extensions" || t == "import":
+			i = skipStatement(i)
+		case inside() == "enum":
+			if tok(i+1) == "=" {
+				items = append(items, protoOutlineItem{depth: len(stack), kind: "value", name: t, number: tok(i + 2)})
+			}
+			i = skipStatement(i)
+		case inside() == "message" || inside() == "oneof" || inside() == "extend":
+			end := skipStatement(i)
+			stmt := toks[i:end]
+			eq := -1
+			for j, s := range stmt {
+				if s == "=" {
+					eq = j
+					break
+				}
+			}
+			if eq >= 2 && eq+1 < len(stmt) {
+				typ := strings.Join(stmt[:eq-1], " ")
+				typ = strings.NewReplacer(" < ", "<", " , ", ", ", " >", ">").Replace(typ)
+				items = append(items, protoOutlineItem{depth: len(stack), kind: "field", name: stmt[eq-1], detail: typ, number: stmt[eq+1]})
+			}
+			i = end
+		case t == "{":
+			stack = append(stack, "")
+			i++
+		default:
+			i = skipStatement(i)
+		}
+	}
+	return syntax, pkg, items
+}
+
+// protoTokens splits .proto source into identifiers, numbers, string
+// literals and punctuation, dropping comments.
+func protoTokens(text string) []string {
+	var toks []string
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.HasPrefix(text[i:], "//"):
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(text[i:], "/*"):
+			end := strings.Index(text[i+2:], "*/")
+			if end < 0 {
+				return toks
+			}
+			i += end + 4
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(text) && text[j] != c {
+				if text[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			j = min(j+1, len(text))
+			toks = append(toks, text[i:j])
+			i = j
+		case c == '_' || c == '.' || c == '-' || c == '+' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i + 1
+			for j < len(text) {
+				d := text[j]
+				if d == '_' || d == '.' || d >= '0' && d <= '9' || d >= 'a' && d <= 'z' || d >= 'A' && d <= 'Z' {
+					j++
+					continue
+				}
+				break
+			}
+			toks = append(toks, text[i:j])
+			i = j
+		default:
+			toks = append(toks, string(c))
+			i++
+		}
+	}
+	return toks
+}
+
+// protoField is one decoded field of a serialised protobuf message. value is
+// a uint64 for varint and fixed fields, and a []protoField or []byte for
+// length-delimited ones.
+type protoField struct {
+	num   uint64
+	wire  byte
+	value interface{}
+}
+
+// renderProtobufWire decodes a serialised message without its schema, in
+// the spirit of protoc --decode_raw. strict declines files that do not
+// decode cleanly so they fall back to the plain binary summary.
+func renderProtobufWire(path string, size int64, strict bool) (string, bool) {
+	if size > maxJSONQueryBytes || size == 0 {
+		return "", false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	header := jsonMuted.Render(fmt.Sprintf("  protobuf (raw decode, no schema) · %s", humanSize(size)))
+	fields, err := decodeProtoMessage(data, 0)
+	if err != nil {
+		if strict {
+			return "", false
+		}
+		errStyle := lipgloss.NewStyle().Foreground(clrDanger)
+		return header + "\n\n" + errStyle.Render("  not a protobuf message: "+err.Error()), true
+	}
+	var sb strings.Builder
+	budget := maxProtoFields
+	writeProtoFields(&sb, fields, 0, &budget)
+	if budget < 0 {
+		sb.WriteString(jsonMuted.Render(fmt.Sprintf("… stopped after %d fields", maxProtoFields)) + "\n")
+	}
+	return header + "\n\n" + sb.String(), true
+}
+
+// decodeProtoMessage parses b as a sequence of fields, failing unless every
+// byte is consumed. Groups are not supported.
+func decodeProtoMessage(b []byte, depth int) ([]protoField, error) {
+	if depth > maxBinaryDepth {
+		return nil, errors.New("nesting too deep")
+	}
+	var fields []protoField
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errors.New("bad field key")
+		}
+		b = b[n:]
+		f := protoField{num: key >> 3, wire: byte(key & 7)}
+		if f.num == 0 {
+			return nil, errors.New("field number 0")
+		}
+		switch f.wire {
+		case 0:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return nil, errors.New("bad varint")
+			}
+			f.value, b = v, b[n:]
+		case 1:
+			if len(b) < 8 {
+				return nil, errBinaryTruncated
+			}
+			f.value, b = binary.LittleEndian.Uint64(b), b[8:]
+		case 5:
+			if len(b) < 4 {
+				return nil, errBinaryTruncated
+			}
+			f.value, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || l > uint64(len(b)-n) {
+				return nil, errBinaryTruncated
+			}
+			payload := b[n : n+int(l)]
+			b = b[n+int(l):]
+			f.value = payload
+			if !isPrintableText(payload) {
+				if sub, err := decodeProtoMessage(payload, depth+1); err == nil && len(sub) > 0 {
+					f.value = sub
+				}
+			}
+		default:
+			return nil, fmt.Errorf("unsupported wire type %d", f.wire)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// isPrintableText reports whether b reads as a UTF-8 string.
+func isPrintableText(b []byte) bool {
+	if len(b) == 0 || !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && r != '\n' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// writeProtoFields prints fields in text format, decrementing budget for each
+// field and stopping once it runs out.
+func writeProtoFields(sb *strings.Builder, fields []protoField, depth int, budget *int) {
+	indent := strings.Repeat("  ", depth)
+	for _, f := range fields {
+		if *budget--; *budget < 0 {
+			return
+		}
+		num := jsonKey.Render(strconv.FormatUint(f.num, 10))
+		switch v := f.value.(type) {
+		case []protoField:
+			sb.WriteString(indent + num + " " + jsonBracket.Render("{") + "\n")
+			writeProtoFields(sb, v, depth+1, budget)
+			sb.WriteString(indent + jsonBracket.Render("}") + "\n")
+		case []byte:
+			var s string
+			if len(v) == 0 || isPrintableText(v) {
+				s = jsonStr.Render(strconv.Quote(string(v)))
+			} else {
+				s = jsonMuted.Render(describeBytes(v))
+			}
+			sb.WriteString(indent + num + jsonMuted.Render(": ") + s + "\n")
+		case uint64:
+			s := jsonNum.Render(strconv.FormatUint(v, 10))
+			// Wire values carry no type, so show the other plausible readings.
+			switch f.wire {
+			case 0:
+				if v > math.MaxInt64 {
+					s += jsonMuted.Render(fmt.Sprintf("  # %d", int64(v)))
+				}
+			case 1:
+				s = jsonNum.Render(fmt.Sprintf("0x%016x", v)) + jsonMuted.Render(fmt.Sprintf("  # %g", math.Float64frombits(v)))
+			case 5:
+				s = jsonNum.Render(fmt.Sprintf("0x%08x", v)) + jsonMuted.Render(fmt.Sprintf("  # %g", math.Float32frombits(uint32(v))))
+			}
+			sb.WriteString(indent + num + jsonMuted.Render(": ") + s + "\n")
+		}
+	}
+}
+
+// ── HTML preview ──────────────────────────────────────────────────────────────
+
+// renderHTMLPreview renders an HTML document as wrapped text: headings,
+// lists, quotes, preformatted blocks and tables keep their shape, and links
+// are numbered with their targets listed at the end.
+func renderHTMLPreview(text string, width int, truncated bool) string {
+	doc, err := html.Parse(strings.NewReader(text))
+	if err != nil {
+		errStyle := lipgloss.NewStyle().Foreground(clrDanger)
+		return errStyle.Render("  invalid HTML: "+err.Error()) + "\n\n" + text
+	}
+	r := &htmlRenderer{width: max(width-2, 20), style: lipgloss.NewStyle()}
+	r.walk(doc)
+	r.flush()
+
+	var sb strings.Builder
+	if r.title != "" {
+		sb.WriteString(lipgloss.NewStyle().Foreground(clrTitle).Bold(true).Render(r.title) + "\n\n")
+	}
+	sb.WriteString(strings.Trim(strings.Join(r.lines, "\n"), "\n"))
+	if len(r.links) > 0 {
+		sb.WriteString("\n\n" + jsonMuted.Render("Links") + "\n")
+		for i, href := range r.links {
+			sb.WriteString(jsonMuted.Render(fmt.Sprintf("[%d] ", i+1)) + href + "\n")
+		}
+	}
+	if truncated {
+		sb.WriteString("\n\n... preview truncated ...")
+	}
+	return sb.String()
+}
+
+// htmlRenderer accumulates inline text into a paragraph and wraps it into
+// lines when a block ends.
+type htmlRenderer struct {
+	width  int
+	lines  []string
+	para   []string // styled words, or styled lines inside <pre>
+	style  lipgloss.Style
+	title  string
+	links  []string
+	lists  []int // item counter per open list; -1 for unordered
+	marker string
+	quote  int
+	pre    int
+	cells  int // cells written in the current table row
+	space  bool
+}
+
+// htmlSkipped elements contribute no visible text.
+var htmlSkipped = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Svg: true, atom.Iframe: true, atom.Object: true, atom.Button: true, atom.Select: true,
+}
+
+// htmlBlocks are elements that start and end a line.
+var htmlBlocks = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true, atom.Header: true,
+	atom.Footer: true, atom.Main: true, atom.Nav: true, atom.Aside: true, atom.Form: true,
+	atom.Figure: true, atom.Figcaption: true, atom.Dl: true, atom.Dt: true, atom.Dd: true,
+	atom.Table: true, atom.Details: true, atom.Summary: true, atom.Address: true,
+}
+
+func (r *htmlRenderer) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		r.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			r.walk(c)
+		}
+		return
+	}
+	if htmlSkipped[n.DataAtom] {
+		return
+	}
+	children := func() {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			r.walk(c)
+		}
+	}
+	styled := func(s lipgloss.Style) {
+		saved := r.style
+		r.style = s
+		children()
+		r.style = saved
+	}
+
+	switch n.DataAtom {
+	case atom.Head:
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.DataAtom == atom.Title && c.FirstChild != nil {
+				r.title = strings.Join(strings.Fields(c.FirstChild.Data), " ")
+			}
+		}
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		r.flush()
+		r.gap()
+		level := int(n.Data[1] - '0')
+		r.word(jsonMuted.Render(strings.Repeat("#", level)))
+		s := lipgloss.NewStyle().Foreground(clrTitle).Bold(true)
+		if level == 1 {
+			s = s.Underline(true)
+		}
+		styled(s)
+		r.flush()
+		r.gap()
+	case atom.Br:
+		r.flush()
+	case atom.Hr:
+		r.flush()
+		r.lines = append(r.lines, jsonMuted.Render(strings.Repeat("─", r.width)))
+	case atom.Ul, atom.Ol:
+		r.flush()
+		start := -1
+		if n.DataAtom == atom.Ol {
+			start = 0
+		}
+		r.lists = append(r.lists, start)
+		children()
+		r.flush()
+		r.lists = r.lists[:len(r.lists)-1]
+		if len(r.lists) == 0 {
+			r.gap()
+		}
+	case atom.Li:
+		r.flush()
+		r.marker = "• "
+		if k := len(r.lists) - 1; k >= 0 && r.lists[k] >= 0 {
+			r.lists[k]++
+			r.marker = fmt.Sprintf("%d. ", r.lists[k])
+		}
+		children()
+		r.flush()
+	case atom.Blockquote:
+		r.flush()
+		r.gap()
+		r.quote++
+		styled(r.style.Italic(true))
+		r.flush()
+		r.quote--
+		r.gap()
+	case atom.Pre:
+		r.flush()
+		r.gap()
+		r.pre++
+		styled(lipgloss.NewStyle().Foreground(clrCode))
+		r.flush()
+		r.pre--
+		r.gap()
+	case atom.Code, atom.Kbd, atom.Samp:
+		styled(r.style.Foreground(clrCode))
+	case atom.Strong, atom.B:
+		styled(r.style.Bold(true))
+	case atom.Em, atom.I, atom.Cite:
+		styled(r.style.Italic(true))
+	case atom.U, atom.Ins:
+		styled(r.style.Underline(true))
+	case atom.Del, atom.S, atom.Strike:
+		styled(r.style.Strikethrough(true))
+	case atom.A:
+		styled(r.style.Foreground(clrAccent).Underline(true))
+		href := htmlAttr(n, "href")
+		if href != "" && !strings.HasPrefix(href, "#") && !strings.HasPrefix(href, "javascript:") {
+			r.links = append(r.links, href)
+			r.space = false
+			r.word(jsonMuted.Render(fmt.Sprintf("[%d]", len(r.links))))
+			r.space = false
+		}
+	case atom.Img:
+		alt := htmlAttr(n, "alt")
+		if alt == "" {
+			alt = filepath.Base(htmlAttr(n, "src"))
+		}
+		r.word(jsonMuted.Render("[image: " + alt + "]"))
+	case atom.Tr:
+		r.flush()
+		r.cells = 0
+		children()
+		r.flush()
+	case atom.Td, atom.Th:
+		if r.cells > 0 {
+			r.space = true
+			r.word(jsonMuted.Render("│"))
+		}
+		r.cells++
+		if n.DataAtom == atom.Th {
+			styled(r.style.Bold(true))
+		} else {
+			children()
+		}
+	default:
+		if !htmlBlocks[n.DataAtom] {
+			children()
+			return
+		}
+		r.flush()
+		if n.DataAtom == atom.P || n.DataAtom == atom.Table || n.DataAtom == atom.Dl {
+			r.gap()
+		}
+		if n.DataAtom == atom.Dd {
+			r.marker = "  "
+		}
+		children()
+		r.flush()
+		if n.DataAtom == atom.P || n.DataAtom == atom.Table || n.DataAtom == atom.Dl {
+			r.gap()
+		}
+	}
+}
+
+// text adds a text node, collapsing whitespace outside <pre>.
+func (r *htmlRenderer) text(s string) {
+	if r.pre > 0 {
+		lines := strings.Split(s, "\n")
+		for i, line := range lines {
+			if i > 0 || len(r.para) == 0 {
+				r.para = append(r.para, "")
+			}
+			r.para[len(r.para)-1] += r.style.Render(strings.ReplaceAll(line, "\t", "    "))
+		}
+		return
+	}
+	if len(s) > 0 && unicode.IsSpace(rune(s[0])) {
+		r.space = true
+	}
+	for _, w := range strings.Fields(s) {
+		r.word(r.style.Render(w))
+		r.space = true
+	}
+	if len(s) > 0 && !unicode.IsSpace(rune(s[len(s)-1])) {
+		r.space = false
+	}
+}
+
+// word appends a styled word, joining it to the previous one when no
+// whitespace separated them in the source.
+func (r *htmlRenderer) word(w string) {
+	if len(r.para) > 0 && !r.space {
+		r.para[len(r.para)-1] += w
+	} else {
+		r.para = append(r.para, w)
+	}
+	r.space = true
+}
+
+// flush wraps the pending paragraph into lines under the current list
+// marker and quote prefix.
+func (r *htmlRenderer) flush() {
+	r.space = false
+	if len(r.para) == 0 {
+		return
+	}
+	prefix := strings.Repeat(jsonMuted.Render("│ "), r.quote)
+	indent := strings.Repeat("  ", max(len(r.lists)-1, 0))
+	first, rest := prefix+indent, prefix+indent
+	if r.marker != "" {
+		first += jsonMuted.Render(r.marker)
+		rest += strings.Repeat(" ", ansi.StringWidth(r.marker))
+		r.marker = ""
+	}
+	var lines []string
+	if r.pre > 0 {
+		lines = r.para
+	} else {
+		avail := max(r.width-ansi.StringWidth(rest), 10)
+		lines = strings.Split(ansi.Wordwrap(strings.Join(r.para, " "), avail, ""), "\n")
+	}
+	for i, line := range lines {
+		if i == 0 {
+			r.lines = append(r.lines, first+line)
+		} else {
+			r.lines = append(r.lines, rest+line)
+		}
+	}
+	r.para = nil
+}
+
+// gap ends the output with a single blank line.
+func (r *htmlRenderer) gap() {
+	if len(r.lines) > 0 && r.lines[len(r.lines)-1] != "" {
+		r.lines = append(r.lines, "")
+	}
+}
+
+func htmlAttr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return strings.TrimSpace(a.Val)
+		}
+	}
+	return ""
+}
+
+// ── binary strings ────────────────────────────────────────────────────────────
+
+const (
+	defaultStringsMin  = 4
+	maxStringsScanSize = 64 * 1024 * 1024
+)
+
+// renderBinaryStrings lists the printable runs in a binary file with their
+// hex offsets, like strings -t x, scanning well past the preview limit since
+// the interesting text in an executable is rarely near the start.
+func renderBinaryStrings(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	minRun := userConfig.stringsMin
+	if minRun <= 0 {
+		minRun = defaultStringsMin
+	}
+	r := bufio.NewReaderSize(io.LimitReader(f, maxStringsScanSize), 64*1024)
+
+	var out strings.Builder
+	var run []rune
+	found, offset, start := 0, int64(0), int64(0)
+	capped := false
+	flush := func() {
+		if len(run) >= minRun {
+			found++
+			if !capped {
+				out.WriteString(jsonMuted.Render(fmt.Sprintf("%8x  ", start)) + string(run) + "\n")
+				capped = out.Len() >= maxPreviewBytes
+			}
+		}
+		run = run[:0]
+	}
+	for {
+		c, size, err := r.ReadRune()
+		if err != nil {
+			break
+		}
+		if (c != utf8.RuneError || size > 1) && (unicode.IsPrint(c) || c == '\t') {
+			if len(run) == 0 {
+				start = offset
+			}
+			run = append(run, c)
+		} else {
+			flush()
+		}
+		offset += int64(size)
+	}
+	flush()
+
+	summary := fmt.Sprintf("  strings · %s · %d runs of %d+ characters", filepath.Base(path), found, minRun)
+	if capped {
+		summary += " · output truncated"
+	} else if offset >= maxStringsScanSize {
+		summary += fmt.Sprintf(" · first %s scanned", humanSize(maxStringsScanSize))
+	}
+	return jsonMuted.Render(summary) + "\n\n" + out.String(), nil
+}
+
+// ── secret masking ────────────────────────────────────────────────────────────
+
+// defaultSecretKeys are the key name parts whose values are masked unless
+// the config's secret_keys replaces them.
+var defaultSecretKeys = []string{"secret", "token", "password", "passwd", "passphrase", "credential", "private", "auth", "key"}
+
+const secretMask = "••••••••"
+
+// isYAMLBlockScalar reports whether value is the | or > indicator starting a
+// YAML block scalar, with its optional chomping and indentation indicators.
+func isYAMLBlockScalar(value string) bool {
+	if value == "" || value[0] != '|' && value[0] != '>' {
+		return false
+	}
+	return strings.Trim(value[1:], "-+123456789") == ""
+}
+
+// hasSecrets reports whether a file is the kind of config whose values are
+// masked: env files and the config category.
+func hasSecrets(name string) bool {
+	base := strings.ToLower(filepath.Base(name))
+	if strings.HasPrefix(base, ".env") || strings.HasSuffix(base, ".env") {
+		return true
+	}
+	switch filepath.Ext(base) {
+	case ".properties", ".cfg", ".npmrc", ".pypirc":
+		return true
+	}
+	return categorise(entry{name: base}) == catConfig
+}
+
+// maskSecrets replaces the values of key = value, key: value and
+// "key": "value" lines whose key names a secret, keeping quotes and
+// trailing commas so structured formats still parse. A YAML block scalar
+// (key: | or key: >) has each of its indented lines masked. It returns the
+// masked text and how many values were hidden.
+func maskSecrets(text string) (string, int) {
+	keys := userConfig.secretKeys
+	if len(keys) == 0 {
+		keys = defaultSecretKeys
+	}
+	lines := strings.Split(text, "\n")
+	count := 0
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";") || strings.HasPrefix(trimmed, "//") {
+			continue
+		}
+		sep := strings.IndexAny(line, "=:")
+		if sep < 0 {
+			continue
+		}
+		key := strings.TrimSpace(line[:sep])
+		key = strings.TrimPrefix(key, "export ")
+		key = strings.TrimPrefix(key, "- ")
+		key = strings.Trim(key, `"' `)
+		if !isSecretKey(key, keys) {
+			continue
+		}
+
+		rest := line[sep+1:]
+		value := strings.TrimSpace(rest)
+		lead := rest[:len(rest)-len(strings.TrimLeft(rest, " \t"))]
+		comma := ""
+		if strings.HasSuffix(value, ",") {
+			value, comma = strings.TrimSuffix(value, ","), ","
+		}
+		if isYAMLBlockScalar(value) {
+			indent := len(line) - len(strings.TrimLeft(line, " \t"))
+			masked := false
+			for ; i+1 < len(lines); i++ {
+				next := lines[i+1]
+				body := strings.TrimLeft(next, " \t")
+				if body != "" && len(next)-len(body) <= indent {
+					break
+				}
+				if body != "" {
+					lines[i+1] = next[:len(next)-len(body)] + secretMask
+					masked = true
+				}
+			}
+			if masked {
+				count++
+			}
+			continue
+		}
+		switch strings.ToLower(value) {
+		case "", `""`, "''", "null", "~", "true", "false", "{", "[":
+			continue
+		}
+		masked := secretMask
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			masked = string(value[0]) + secretMask + string(value[0])
+		}
+		lines[i] = line[:sep+1] + lead + masked + comma
+		count++
+	}
+	return strings.Join(lines, "\n"), count
+}
+
+// maskJSONSecrets replaces the scalar values of secret keys throughout a
+// decoded JSON document, the way maskSecrets does for text, and returns how
+// many it hid.
+func maskJSONSecrets(v interface{}) int {
+	keys := userConfig.secretKeys
+	if len(keys) == 0 {
+		keys = defaultSecretKeys
+	}
+	count := 0
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch val := v.(type) {
+		case map[string]interface{}:
+			for k, child := range val {
+				switch c := child.(type) {
+				case string:
+					if c != "" && isSecretKey(k, keys) {
+						val[k] = secretMask
+						count++
+					}
+				case float64:
+					if isSecretKey(k, keys) {
+						val[k] = secretMask
+						count++
+					}
+				default:
+					walk(child)
+				}
+			}
+		case []interface{}:
+			for _, child := range val {
+				walk(child)
+			}
+		}
+	}
+	walk(v)
+	return count
+}
+
+// isSecretKey reports whether any word of key, split on punctuation and
+// camelCase, ends with one of the secret parts: API_KEY, apiKey and DB_PASSWORD
+// match, AUTHOR does not.
+func isSecretKey(key string, parts []string) bool {
+	var words []string
+	start := 0
+	for i := 1; i <= len(key); i++ {
+		if i == len(key) || strings.IndexByte("_-. ", key[i]) >= 0 ||
+			key[i] >= 'A' && key[i] <= 'Z' && key[i-1] >= 'a' && key[i-1] <= 'z' {
+			words = append(words, strings.ToLower(strings.Trim(key[start:i], "_-. ")))
+			start = i
+		}
+	}
+	for _, w := range words {
+		for _, p := range parts {
+			if p = strings.ToLower(p); p != "" && w != "" && strings.HasSuffix(w, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ── certificates ──────────────────────────────────────────────────────────────
+
+// certExts are decoded as PEM or DER certificates, requests and keys.
+var certExts = map[string]bool{".pem": true, ".crt": true, ".cer": true, ".csr": true, ".der": true, ".key": true}
+
+// certExpiryWarning is how close to expiry a certificate is flagged.
+const certExpiryWarning = 30 * 24 * time.Hour
+
+// renderCertPreview summarises every PEM block in data, or data itself as a
+// DER certificate. Key material is described, never shown. ok is false when
+// nothing could be decoded.
+func renderCertPreview(data []byte) (string, bool) {
+	var sections []string
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		sections = append(sections, describePEMBlock(block))
+	}
+	if len(sections) == 0 {
+		cert, err := x509.ParseCertificate(data)
+		if err != nil {
+			return "", false
+		}
+		sections = append(sections, describeCertificate(cert))
+	}
+	return strings.Join(sections, "\n\n"), true
+}
+
+func describePEMBlock(block *pem.Block) string {
+	title := lipgloss.NewStyle().Foreground(clrTitle).Bold(true)
+	errStyle := lipgloss.NewStyle().Foreground(clrDanger)
+	heading := title.Render(strings.ToLower(block.Type))
+
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return heading + "\n" + errStyle.Render("  "+err.Error())
+		}
+		return describeCertificate(cert)
+	case "CERTIFICATE REQUEST", "NEW CERTIFICATE REQUEST":
+		csr, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil {
+			return heading + "\n" + errStyle.Render("  "+err.Error())
+		}
+		lines := []string{title.Render("certificate request")}
+		lines = append(lines, certField("subject", csr.Subject.String()))
+		lines = append(lines, certNames(csr.DNSNames, csr.IPAddresses, csr.EmailAddresses, csr.URIs)...)
+		lines = append(lines, certField("key", describeKey(csr.PublicKey)))
+		lines = append(lines, certField("signature", csr.SignatureAlgorithm.String()))
+		return strings.Join(lines, "\n")
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return heading + "\n" + errStyle.Render("  "+err.Error())
+		}
+		return heading + "\n" + certField("key", describeKey(key))
+	case "PRIVATE KEY", "RSA PRIVATE KEY", "EC PRIVATE KEY":
+		if _, encrypted := block.Headers["DEK-Info"]; encrypted {
+			return heading + "\n" + certField("key", "encrypted")
+		}
+		var key interface{}
+		var err error
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			key, err = x509.ParseECPrivateKey(block.Bytes)
+		default:
+			key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		}
+		if err != nil {
+			return heading + "\n" + errStyle.Render("  "+err.Error())
+		}
+		if signer, ok := key.(crypto.Signer); ok {
+			key = signer.Public()
+		}
+		return heading + "\n" + certField("key", describeKey(key)) + "\n" + jsonMuted.Render("  key material not shown")
+	case "ENCRYPTED PRIVATE KEY":
+		return heading + "\n" + certField("key", "encrypted (PKCS #8)")
+	}
+	return heading + "\n" + certField("size", humanSize(int64(len(block.Bytes))))
+}
+
+func describeCertificate(cert *x509.Certificate) string {
+	title := lipgloss.NewStyle().Foreground(clrTitle).Bold(true)
+	now := time.Now()
+
+	validity := fmt.Sprintf("%s → %s", cert.NotBefore.Format("2006-01-02"), cert.NotAfter.Format("2006-01-02"))
+	switch left := cert.NotAfter.Sub(now); {
+	case left < 0:
+		validity += "  " + lipgloss.NewStyle().Foreground(clrDanger).Bold(true).Render(fmt.Sprintf("expired %s ago", formatAge(-left)))
+	case now.Before(cert.NotBefore):
+		validity += "  " + lipgloss.NewStyle().Foreground(clrDanger).Render("not yet valid")
+	case left < certExpiryWarning:
+		validity += "  " + lipgloss.NewStyle().Foreground(clrDangerSoft).Bold(true).Render(fmt.Sprintf("expires in %s", formatAge(left)))
+	default:
+		validity += "  " + jsonMuted.Render(fmt.Sprintf("%s left", formatAge(left)))
+	}
+
+	kind := "certificate"
+	if cert.IsCA {
+		kind = "CA certificate"
+	}
+	lines := []string{
+		title.Render(kind),
+		certField("subject", cert.Subject.String()),
+		certField("issuer", cert.Issuer.String()),
+		certField("valid", validity),
+	}
+	lines = append(lines, certNames(cert.DNSNames, cert.IPAddresses, cert.EmailAddresses, cert.URIs)...)
+	lines = append(lines,
+		certField("key", describeKey(cert.PublicKey)),
+		certField("signature", cert.SignatureAlgorithm.String()),
+		certField("serial", fmt.Sprintf("%X", cert.SerialNumber)),
+		certField("sha256", fmt.Sprintf("%X", sha256.Sum256(cert.Raw))),
+	)
+	return strings.Join(lines, "\n")
+}
+
+// formatAge renders a duration in its largest whole unit, as "3 days".
+func formatAge(d time.Duration) string {
+	day := 24 * time.Hour
+	switch {
+	case d < time.Hour:
+		return countNoun(int(d/time.Minute), "minute")
+	case d < day:
+		return countNoun(int(d/time.Hour), "hour")
+	case d < 60*day:
+		return countNoun(int(d/day), "day")
+	case d < 2*365*day:
+		return countNoun(int(d/(30*day)), "month")
+	}
+	return countNoun(int(d/(365*day)), "year")
+}
+
+// certNames lists subject alternative names in one field.
+func certNames(dns []string, ips []net.IP, emails []string, uris []*url.URL) []string {
+	var names []string
+	names = append(names, dns...)
+	for _, ip := range ips {
+		names = append(names, ip.String())
+	}
+	names = append(names, emails...)
+	for _, u := range uris {
+		names = append(names, u.String())
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return []string{certField("names", strings.Join(names, ", "))}
+}
+
+func certField(label, value string) string {
+	return "  " + jsonKey.Render(fmt.Sprintf("%-10s", label)) + value
+}
+
+// describeKey names a public key's algorithm and size.
+func describeKey(key interface{}) string {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", k.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA " + k.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	case *ecdh.PublicKey:
+		return fmt.Sprintf("ECDH %v", k.Curve())
+	}
+	return fmt.Sprintf("%T", key)
+}
+
+// ── log files ─────────────────────────────────────────────────────────────────
+
+// tailPreviewMark on the first line of preview content opens the preview
+// scrolled to the end; setPreview strips it.
+const tailPreviewMark = "\x1d"
+
+// followPreviewMark starts the last line of a tail preview; the byte offset
+// it was read up to follows it, and following the file carries on from
+// there.
+const followPreviewMark = "\x1e"
+
+// logLevelColor maps a level name to its colour.
+func logLevelColor(level string) (lipgloss.TerminalColor, bool) {
+	switch strings.ToUpper(level) {
+	case "FATAL", "PANIC", "CRIT", "CRITICAL", "EMERG", "ALERT", "ERROR", "ERR", "SEVERE":
+		return clrDanger, true
+	case "WARN", "WARNING":
+		return clrConfig, true
+	case "INFO", "NOTICE":
+		return clrExec, true
+	case "DEBUG", "TRACE", "VERBOSE":
+		return clrDim, true
+	}
+	return nil, false
+}
+
+// isLogFile reports whether name looks like a log: *.log, rotated *.log.N,
+// and the usual syslog names.
+func isLogFile(name string) bool {
+	base := strings.ToLower(filepath.Base(name))
+	if strings.HasSuffix(base, ".log") {
+		return true
+	}
+	if stem, n, ok := strings.Cut(base, ".log."); ok && stem != "" {
+		if _, err := strconv.Atoi(n); err == nil {
+			return true
+		}
+	}
+	switch base {
+	case "syslog", "messages", "dmesg", "kern", "auth", "daemon":
+		return true
+	}
+	return false
+}
+
+// prependPreview puts a note line above rendered content, keeping any
+// tailPreviewMark first.
+func prependPreview(note, content string) string {
+	if body, ok := strings.CutPrefix(content, tailPreviewMark+"\n"); ok {
+		return tailPreviewMark + "\n" + note + "\n\n" + body
+	}
+	return note + "\n\n" + content
+}
+
+// renderLogTail previews the end of a log, where the newest entries are,
+// rather than its first maxPreviewBytes.
+func renderLogTail(f *os.File, size int64) (string, error) {
+	return renderTail(f, size, renderLogLines)
+}
+
+// renderTail renders the last maxPreviewBytes of a text file, opening
+// scrolled to the end.
+func renderTail(f *os.File, size int64, render func(string) string) (string, error) {
+	start := size - maxPreviewBytes
+	if start < 0 {
+		start = 0
+	}
+	buf := make([]byte, size-start)
+	n, err := f.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	buf = buf[:n]
+	end := start + int64(n)
+	header := ""
+	if start > 0 {
+		// Drop the partial first line.
+		if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+			buf = buf[i+1:]
+		}
+		header = jsonMuted.Render(fmt.Sprintf("  … showing the last %s of %s", humanSize(int64(len(buf))), humanSize(size))) + "\n"
+	}
+	if isLikelyBinary(buf) {
+		return fmt.Sprintf("binary file: %s\nsize: %s", filepath.Base(f.Name()), humanSize(size)), nil
+	}
+	text := strings.ToValidUTF8(string(buf), "\uFFFD")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	return tailPreviewMark + "\n" + header + render(strings.TrimSuffix(text, "\n")) +
+		"\n" + followPreviewMark + strconv.FormatInt(end, 10), nil
+}
+
+// renderLogLines colours each line's leading timestamp and its level;
+// error lines are coloured throughout.
+func renderLogLines(text string) string {
+	tsStyle := lipgloss.NewStyle().Foreground(clrDoc)
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		ts := logTimestampLen(line)
+		rest := line[ts:]
+		start, end, color := findLogLevel(rest)
+		out := ""
+		if ts > 0 {
+			out = tsStyle.Render(line[:ts])
+		}
+		if color == nil {
+			out += rest
+		} else {
+			levelStyle := lipgloss.NewStyle().Foreground(color).Bold(true)
+			after := rest[end:]
+			if color == clrDanger {
+				after = lipgloss.NewStyle().Foreground(clrDanger).Render(after)
+			}
+			out += rest[:start] + levelStyle.Render(rest[start:end]) + after
+		}
+		lines[i] = out
+	}
+	return strings.Join(lines, "\n")
+}
+
+// findLogLevel locates the first level word in line: an upper-case level
+// name, or the value of a level=/"level": field in any case.
+func findLogLevel(line string) (int, int, lipgloss.TerminalColor) {
+	isLetter := func(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+	for i := 0; i < len(line); {
+		if !isLetter(line[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(line) && isLetter(line[j]) {
+			j++
+		}
+		word := line[i:j]
+		before := strings.TrimRight(strings.ToLower(line[max(0, i-8):i]), `"' `)
+		field := strings.HasSuffix(before, "level=") || strings.HasSuffix(before, "level\":") ||
+			strings.HasSuffix(before, "lvl=") || strings.HasSuffix(before, "severity=")
+		if field || word == strings.ToUpper(word) {
+			if color, ok := logLevelColor(word); ok {
+				return i, j, color
+			}
+		}
+		i = j
+	}
+	return 0, 0, nil
+}
+
+// logTimestampLen returns the length of a timestamp at the start of line:
+// ISO 8601 (2024-05-01T12:00:00.123Z, or with a space), syslog
+// (May  1 12:00:00), or a bracketed group starting with a digit.
+func logTimestampLen(line string) int {
+	if strings.HasPrefix(line, "[") {
+		if end := strings.IndexByte(line, ']'); end > 1 && line[1] >= '0' && line[1] <= '9' {
+			return end + 1
+		}
+		return 0
+	}
+	// match consumes pattern from line at i, where 'd' is a digit, 'a' a
+	// letter, and anything else itself.
+	match := func(i int, pattern string) int {
+		for _, p := range []byte(pattern) {
+			switch {
+			case i >= len(line):
+				return -1
+			case p == 'd' && line[i] >= '0' && line[i] <= '9',
+				p == 'a' && (line[i]|0x20) >= 'a' && (line[i]|0x20) <= 'z',
+				p == line[i]:
+				i++
+			default:
+				return -1
+			}
+		}
+		return i
+	}
+	i := match(0, "dddd-dd-dd")
+	if i < 0 {
+		// Syslog: "May  1 12:00:00" or "May 12 12:00:00".
+		if i = match(0, "aaa dd dd:dd:dd"); i < 0 {
+			i = match(0, "aaa  d dd:dd:dd")
+		}
+		return max(i, 0)
+	}
+	if i < len(line) && (line[i] == 'T' || line[i] == ' ') {
+		if j := match(i+1, "dd:dd:dd"); j > 0 {
+			i = j
+			if i < len(line) && (line[i] == '.' || line[i] == ',') {
+				i++
+				for i < len(line) && line[i] >= '0' && line[i] <= '9' {
+					i++
+				}
+			}
+			if i < len(line) && line[i] == 'Z' {
+				i++
+			} else if j := match(i, "+dd:dd"); j > 0 {
+				i = j
+			} else if j := match(i, "-dd:dd"); j > 0 {
+				i = j
+			}
+		}
+	}
+	return i
+}
+
+// ── man pages ─────────────────────────────────────────────────────────────────
+
+// isManPage reports whether a file is roff man page source. Numbered section
+// extensions also need roff content, since .1 is as likely a rotated log.
+func isManPage(ext, text string) bool {
+	roff := false
+	for _, line := range strings.SplitN(text, "\n", 20) {
+		if strings.HasPrefix(line, `.\"`) || strings.HasPrefix(line, `'\"`) || strings.TrimSpace(line) == "" {
+			continue
+		}
+		roff = strings.HasPrefix(line, ".TH ") || strings.HasPrefix(line, ".Dd ") ||
+			strings.HasPrefix(line, ".Dt ") || strings.HasPrefix(line, ".so ")
+		break
+	}
+	if ext == ".man" || ext == ".roff" {
+		return true
+	}
+	return roff
+}
+
+// renderManPage formats man page source with mandoc or groff at the pane
+// width, turning their overstrike bold and underline into colour. The source
+// is piped in, so compressed pages work once decompressed.
+func renderManPage(path, text string, width int) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), previewerTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if _, err := exec.LookPath("mandoc"); err == nil {
+		cmd = exec.CommandContext(ctx, "mandoc", "-T", "utf8", "-O", fmt.Sprintf("width=%d", width-2))
+	} else if _, err := exec.LookPath("groff"); err == nil {
+		cmd = exec.CommandContext(ctx, "groff", "-mandoc", "-T", "utf8", "-P", "-c", fmt.Sprintf("-rLL=%dn", width-2))
+	} else {
+		return "", errors.New("no roff formatter installed")
+	}
+	// .so requests resolve relative to the man directory above the page.
+	cmd.Dir = filepath.Dir(filepath.Dir(path))
+	cmd.Stdin = strings.NewReader(text)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	if len(out) > maxPreviewBytes {
+		out = out[:maxPreviewBytes]
+	}
+	return overstrikeToANSI(strings.ToValidUTF8(string(out), "")), nil
+}
+
+// overstrikeToANSI converts nroff overstriking, c\bc for bold and _\bc for
+// underline, into styled runs.
+func overstrikeToANSI(s string) string {
+	bold := lipgloss.NewStyle().Foreground(clrTitle).Bold(true)
+	under := lipgloss.NewStyle().Foreground(clrAccent).Underline(true)
+
+	var sb, run strings.Builder
+	var runStyle *lipgloss.Style
+	flush := func() {
+		if runStyle != nil {
+			sb.WriteString(runStyle.Render(run.String()))
+		} else {
+			sb.WriteString(run.String())
+		}
+		run.Reset()
+	}
+	emit := func(style *lipgloss.Style, r rune) {
+		if style != runStyle {
+			flush()
+			runStyle = style
+		}
+		run.WriteRune(r)
+	}
+	rs := []rune(s)
+	for i := 0; i < len(rs); i++ {
+		if i+2 < len(rs) && rs[i+1] == '\b' {
+			style := &bold
+			if rs[i] == '_' && rs[i+2] != '_' {
+				style = &under
+			}
+			i += 2
+			// Bold underline repeats the overstrike; take the last glyph.
+			for i+2 < len(rs) && rs[i+1] == '\b' {
+				i += 2
+			}
+			emit(style, rs[i])
+			continue
+		}
+		if rs[i] == '\b' {
+			continue
+		}
+		emit(nil, rs[i])
+	}
+	flush()
+	return sb.String()
+}
+
+// ── diff preview ──────────────────────────────────────────────────────────────
+
+// diffFileStat counts the changes to one file in a patch.
+type diffFileStat struct {
+	name        string
+	added, gone int
+}
+
+// renderDiffPreview colours a unified diff and heads it with a diffstat.
+func renderDiffPreview(text string, width int, truncated bool) string {
+	add := lipgloss.NewStyle().Foreground(clrExec)
+	del := lipgloss.NewStyle().Foreground(clrDanger)
+	hunk := lipgloss.NewStyle().Foreground(clrAccent)
+	file := lipgloss.NewStyle().Foreground(clrTitle).Bold(true)
+
+	var stats []diffFileStat
+	source := strings.Split(text, "\n")
+	lines := make([]string, len(source))
+	// oldLeft and newLeft count the lines remaining in the current hunk, so
+	// a removed "-- comment" line is not mistaken for a file header.
+	oldLeft, newLeft := 0, 0
+	for i, line := range source {
+		lines[i] = line
+		inHunk := oldLeft > 0 || newLeft > 0
+		switch {
+		case inHunk && strings.HasPrefix(line, "+"):
+			newLeft--
+			if len(stats) > 0 {
+				stats[len(stats)-1].added++
+			}
+			lines[i] = add.Render(line)
+		case inHunk && strings.HasPrefix(line, "-"):
+			oldLeft--
+			if len(stats) > 0 {
+				stats[len(stats)-1].gone++
+			}
+			lines[i] = del.Render(line)
+		case inHunk && (strings.HasPrefix(line, " ") || line == ""):
+			oldLeft--
+			newLeft--
+		case strings.HasPrefix(line, "\\"):
+			// "\ No newline at end of file"
+		case strings.HasPrefix(line, "@@"):
+			oldLeft, newLeft = parseHunkHeader(line)
+			if end := strings.Index(line[2:], "@@"); end >= 0 {
+				lines[i] = hunk.Render(line[:end+4]) + line[end+4:]
+			} else {
+				lines[i] = hunk.Render(line)
+			}
+		case strings.HasPrefix(line, "diff ") || strings.HasPrefix(line, "--- "):
+			lines[i] = file.Render(line)
+		case strings.HasPrefix(line, "+++ "):
+			stats = append(stats, diffFileStat{name: diffFileName(line[4:], source, i)})
+			lines[i] = file.Render(line)
+		default:
+			// Commit headers, index lines and other metadata between files.
+			lines[i] = jsonMuted.Render(line)
+		}
+	}
+
+	var sb strings.Builder
+	if len(stats) > 0 {
+		added, gone, nameW := 0, 0, 0
+		most := 1
+		for _, s := range stats {
+			added += s.added
+			gone += s.gone
+			nameW = max(nameW, ansi.StringWidth(s.name))
+			most = max(most, s.added+s.gone)
+		}
+		countW := len(strconv.Itoa(most))
+		nameW = min(nameW, max(width/2, 12))
+		barW := max(width-nameW-countW-8, 4)
+		for _, s := range stats {
+			n := s.added + s.gone
+			scaled := n
+			if most > barW {
+				scaled = (n*barW + most - 1) / most
+			}
+			plus := 0
+			if n > 0 {
+				plus = (s.added*scaled + n/2) / n
+			}
+			sb.WriteString(fmt.Sprintf(" %s │ %*d ", padRight(trimVisual(s.name, nameW), nameW), countW, n))
+			sb.WriteString(add.Render(strings.Repeat("+", plus)) + del.Render(strings.Repeat("-", scaled-plus)) + "\n")
+		}
+		sb.WriteString(jsonMuted.Render(fmt.Sprintf(" %s changed, ", countNoun(len(stats), "file"))))
+		sb.WriteString(add.Render(fmt.Sprintf("+%d", added)) + jsonMuted.Render(" ") + del.Render(fmt.Sprintf("-%d", gone)))
+		sb.WriteString("\n\n")
+	}
+	sb.WriteString(strings.Join(lines, "\n"))
+	if truncated {
+		sb.WriteString("\n\n... preview truncated ...")
+	}
+	return sb.String()
+}
+
+// parseHunkHeader returns the old and new line counts of a
+// "@@ -l,s +l,s @@" header; a missing count means one line.
+func parseHunkHeader(line string) (int, int) {
+	count := func(r string) int {
+		if _, n, ok := strings.Cut(r, ","); ok {
+			v, _ := strconv.Atoi(n)
+			return v
+		}
+		return 1
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return 0, 0
+	}
+	return count(fields[1]), count(fields[2])
+}
+
+// diffFileName names the file a +++ header refers to, falling back to the
+// --- side for deletions and dropping the a/ b/ prefixes and timestamps.
+func diffFileName(plus string, lines []string, i int) string {
+	name := plus
+	if strings.HasPrefix(name, "/dev/null") && i > 0 && strings.HasPrefix(lines[i-1], "--- ") {
+		name = lines[i-1][4:]
+	}
+	if tab := strings.IndexByte(name, '\t'); tab >= 0 {
+		name = name[:tab]
+	}
+	name = strings.TrimSpace(name)
+	if strings.HasPrefix(name, "a/") || strings.HasPrefix(name, "b/") {
+		name = name[2:]
+	}
+	return name
+}
+
+// ── Org mode ──────────────────────────────────────────────────────────────────
+
+// orgTodoKeywords are the heading keywords coloured as open or finished.
+var orgTodoKeywords = map[string]bool{
+	"TODO": false, "NEXT": false, "WAITING": false, "HOLD": false, "STARTED": false,
+	"DONE": true, "CANCELLED": true, "CANCELED": true,
+}
+
+var orgBullets = []string{"◉", "○", "◆", "◇"}
+
+// renderOrgPreview styles an Org document: headings by level with TODO
+// keywords, priorities and tags; tables aligned; source blocks highlighted;
+// and keywords, drawers and comments dimmed.
+func renderOrgPreview(text string, truncated bool) string {
+	levels := []lipgloss.Color{clrTitle, clrAccent, clrDir, clrCode, clrDoc, clrConfig}
+	open := lipgloss.NewStyle().Foreground(clrDanger).Bold(true)
+	done := lipgloss.NewStyle().Foreground(clrExec).Bold(true)
+	dim := lipgloss.NewStyle().Foreground(clrDim)
+
+	lines := strings.Split(text, "\n")
+	var out []string
+	quote := false
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		upper := strings.ToUpper(trimmed)
+
+		switch {
+		case strings.HasPrefix(upper, "#+BEGIN_SRC") || strings.HasPrefix(upper, "#+BEGIN_EXAMPLE"):
+			lang := ""
+			if f := strings.Fields(trimmed); len(f) > 1 && strings.HasPrefix(upper, "#+BEGIN_SRC") {
+				lang = f[1]
+			}
+			end := i + 1
+			for end < len(lines) && !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(lines[end])), "#+END_") {
+				end++
+			}
+			code := strings.Join(lines[i+1:min(end, len(lines))], "\n")
+			if lexer := lexers.Get(lang); lang != "" && lexer != nil {
+				if h := highlightWith(lexer, code); h != "" {
+					code = strings.TrimSuffix(h, "\n")
+				}
+			} else {
+				code = lipgloss.NewStyle().Foreground(clrCode).Render(code)
+			}
+			if lang != "" {
+				out = append(out, jsonMuted.Render("  "+lang))
+			}
+			for _, c := range strings.Split(code, "\n") {
+				out = append(out, "  "+jsonMuted.Render("│ ")+c)
+			}
+			i = end
+		case strings.HasPrefix(upper, "#+BEGIN_QUOTE"):
+			quote = true
+		case strings.HasPrefix(upper, "#+END_QUOTE"):
+			quote = false
+		case strings.HasPrefix(upper, "#+TITLE:"):
+			title := strings.TrimSpace(trimmed[len("#+TITLE:"):])
+			out = append(out, lipgloss.NewStyle().Foreground(clrTitle).Bold(true).Underline(true).Render(title), "")
+		case strings.HasPrefix(trimmed, "#+"):
+			key, val, _ := strings.Cut(trimmed[2:], ":")
+			out = append(out, jsonMuted.Render(strings.ToLower(key)+":")+dim.Render(val))
+		case trimmed == "#" || strings.HasPrefix(trimmed, "# "):
+			out = append(out, dim.Render(line))
+		case strings.HasPrefix(line, "*") && strings.HasPrefix(strings.TrimLeft(line, "*"), " "):
+			level := len(line) - len(strings.TrimLeft(line, "*"))
+			words := strings.Fields(line[level:])
+			var parts []string
+			if len(words) > 0 {
+				if finished, ok := orgTodoKeywords[words[0]]; ok {
+					if finished {
+						parts = append(parts, done.Render(words[0]))
+					} else {
+						parts = append(parts, open.Render(words[0]))
+					}
+					words = words[1:]
+				}
+			}
+			if len(words) > 0 && strings.HasPrefix(words[0], "[#") && strings.HasSuffix(words[0], "]") {
+				parts = append(parts, lipgloss.NewStyle().Foreground(clrSize).Render(words[0]))
+				words = words[1:]
+			}
+			tags := ""
+			if k := len(words) - 1; k >= 0 && len(words[k]) > 1 && strings.HasPrefix(words[k], ":") && strings.HasSuffix(words[k], ":") {
+				tags = "  " + jsonMuted.Render(words[k])
+				words = words[:k]
+			}
+			style := lipgloss.NewStyle().Foreground(levels[(level-1)%len(levels)]).Bold(true)
+			parts = append(parts, style.Render(strings.Join(words, " ")))
+			bullet := style.Render(orgBullets[(level-1)%len(orgBullets)])
+			if len(out) > 0 && out[len(out)-1] != "" {
+				out = append(out, "")
+			}
+			out = append(out, strings.Repeat("  ", level-1)+bullet+" "+strings.Join(parts, " ")+tags)
+		case strings.HasPrefix(trimmed, "|"):
+			end := i
+			for end < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[end]), "|") {
+				end++
+			}
+			indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+			for _, row := range renderOrgTable(lines[i:end]) {
+				out = append(out, indent+row)
+			}
+			i = end - 1
+		case strings.HasPrefix(trimmed, ":") && strings.HasSuffix(trimmed, ":") && !strings.Contains(trimmed, " "):
+			out = append(out, dim.Render(line)) // drawer delimiters
+		case strings.HasPrefix(trimmed, "SCHEDULED:") || strings.HasPrefix(trimmed, "DEADLINE:") || strings.HasPrefix(trimmed, "CLOSED:"):
+			out = append(out, jsonMuted.Render(line))
+		case strings.HasPrefix(trimmed, ":") && strings.Contains(trimmed, ": "):
+			key, val, _ := strings.Cut(trimmed, ": ")
+			out = append(out, line[:len(line)-len(strings.TrimLeft(line, " \t"))]+dim.Render(key+":")+" "+val)
+		default:
+			indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+			body := line[len(indent):]
+			for _, b := range []string{"- ", "+ "} {
+				if strings.HasPrefix(body, b) {
+					body = jsonMuted.Render("•") + " " + orgCheckbox(body[2:])
+				}
+			}
+			if quote {
+				indent = jsonMuted.Render("│ ") + indent
+			}
+			out = append(out, indent+orgInline(body))
+		}
+	}
+	result := strings.Join(out, "\n")
+	if truncated {
+		result += "\n\n... preview truncated ..."
+	}
+	return result
+}
+
+// orgCheckbox renders a leading list checkbox.
+func orgCheckbox(s string) string {
+	for box, glyph := range map[string]string{"[ ] ": "☐ ", "[X] ": "☑ ", "[x] ": "☑ ", "[-] ": "◩ "} {
+		if strings.HasPrefix(s, box) {
+			return jsonMuted.Render(glyph) + s[len(box):]
+		}
+	}
+	return s
+}
+
+// renderOrgTable aligns the cells of an Org table; |---+---| rows become
+// rules.
+func renderOrgTable(rows []string) []string {
+	var cells [][]string
+	var widths []int
+	for _, row := range rows {
+		row = strings.Trim(strings.TrimSpace(row), "|")
+		if strings.HasPrefix(row, "-") {
+			cells = append(cells, nil)
+			continue
+		}
+		fields := strings.Split(row, "|")
+		for j, f := range fields {
+			fields[j] = strings.TrimSpace(f)
+			if j >= len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[j] = max(widths[j], ansi.StringWidth(fields[j]))
+		}
+		cells = append(cells, fields)
+	}
+	sep := jsonMuted.Render(" │ ")
+	var out []string
+	for r, fields := range cells {
+		if fields == nil {
+			parts := make([]string, len(widths))
+			for j, w := range widths {
+				parts[j] = strings.Repeat("─", w)
+			}
+			out = append(out, jsonMuted.Render(strings.Join(parts, "─┼─")))
+			continue
+		}
+		// A first row followed by a rule is the header.
+		header := r == 0 && len(cells) > 1 && cells[1] == nil
+		parts := make([]string, len(widths))
+		for j, w := range widths {
+			cell := ""
+			if j < len(fields) {
+				cell = fields[j]
+			}
+			if _, err := strconv.ParseFloat(cell, 64); err == nil {
+				parts[j] = strings.Repeat(" ", w-ansi.StringWidth(cell)) + jsonNum.Render(cell)
+				continue
+			}
+			padded := padRight(cell, w)
+			if header {
+				padded = lipgloss.NewStyle().Bold(true).Render(padded)
+			} else {
+				padded = orgInline(cell) + strings.Repeat(" ", w-ansi.StringWidth(cell))
+			}
+			parts[j] = padded
+		}
+		out = append(out, strings.Join(parts, sep))
+	}
+	return out
+}
+
+// orgInline styles *bold*, /italic/, _underline_, +strike+, =verbatim=,
+// ~code~ and [[link][description]] spans.
+func orgInline(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); {
+		if strings.HasPrefix(s[i:], "[[") {
+			if end := strings.Index(s[i:], "]]"); end > 0 {
+				target, desc, ok := strings.Cut(s[i+2:i+end], "][")
+				if !ok {
+					desc = target
+				}
+				sb.WriteString(lipgloss.NewStyle().Foreground(clrAccent).Underline(true).Render(desc))
+				i += end + 2
+				continue
+			}
+		}
+		c := s[i]
+		if strings.IndexByte("*/_+=~", c) >= 0 && (i == 0 || strings.IndexByte(" \t([{'\"-", s[i-1]) >= 0) &&
+			i+1 < len(s) && s[i+1] != ' ' {
+			if end := orgSpanEnd(s, i+1, c); end > 0 {
+				span := s[i+1 : end]
+				style := lipgloss.NewStyle()
+				switch c {
+				case '*':
+					style = style.Bold(true)
+				case '/':
+					style = style.Italic(true)
+				case '_':
+					style = style.Underline(true)
+				case '+':
+					style = style.Strikethrough(true)
+				default:
+					style = style.Foreground(clrCode)
+				}
+				sb.WriteString(style.Render(span))
+				i = end + 1
+				continue
+			}
+		}
+		sb.WriteByte(c)
+		i++
+	}
+	return sb.String()
+}
+
+// orgSpanEnd finds the closing marker of a span opened before start: one
+// preceded by a non-space and followed by a boundary.
+func orgSpanEnd(s string, start int, marker byte) int {
+	for j := start + 1; j < len(s); j++ {
+		if s[j] != marker || s[j-1] == ' ' {
+			continue
+		}
+		if j+1 == len(s) || strings.IndexByte(" \t.,;:!?)]}'\"-", s[j+1]) >= 0 {
+			return j
+		}
+	}
+	return -1
+}
+
+// ── table preview ─────────────────────────────────────────────────────────────
+
+// frozenPreviewMark, on a line of its own, ends a preview's frozen header:
+// slicePreview keeps the lines above it pinned while the rest scrolls.
+const frozenPreviewMark = "\x1e"
+
+const (
+	maxTableColumnW = 40
+	minTableColumnW = 3
+)
+
+// renderTablePreview lays out delimited text as an aligned table with the
+// header row frozen. Columns shrink, widest first, to fit width; columns
+// that still don't fit are dropped and counted in the summary.
+func renderTablePreview(text string, comma rune, width int, truncated bool) string {
+	r := csv.NewReader(strings.NewReader(text))
+	r.Comma = comma
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	rows, err := r.ReadAll()
+	if err != nil && len(rows) == 0 {
+		errStyle := lipgloss.NewStyle().Foreground(clrDanger)
+		return errStyle.Render("  invalid table: "+err.Error()) + "\n\n" + text
+	}
+	if truncated && len(rows) > 1 {
+		rows = rows[:len(rows)-1] // the last record may be cut off
+	}
+	if len(rows) == 0 {
+		return lipgloss.NewStyle().Foreground(clrMuted).Render("  (empty table)")
+	}
+
+	cols := 0
+	for _, row := range rows {
+		cols = max(cols, len(row))
+	}
+	widths := make([]int, cols)
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], min(maxTableColumnW, lipgloss.Width(tableCell(cell))))
+		}
+	}
+	for i := range widths {
+		widths[i] = max(widths[i], 1)
+	}
+
+	// Each column after the first costs its width plus a 3-cell separator.
+	total := func(n int) int {
+		sum := 0
+		for _, w := range widths[:n] {
+			sum += w
+		}
+		return sum + 3*(n-1) + 2
+	}
+	shown := cols
+	for total(shown) > width {
+		widest := 0
+		for i := 1; i < shown; i++ {
+			if widths[i] > widths[widest] {
+				widest = i
+			}
+		}
+		if widths[widest] > minTableColumnW {
+			widths[widest]--
+			continue
+		}
+		if shown == 1 {
+			break
+		}
+		shown--
+	}
+
+	numeric := make([]bool, shown)
+	for i := range numeric {
+		numeric[i] = true
+		for _, row := range rows[1:] {
+			if i < len(row) && row[i] != "" {
+				if _, err := strconv.ParseFloat(strings.TrimSpace(row[i]), 64); err != nil {
+					numeric[i] = false
+					break
+				}
+			}
+		}
+	}
+
+	headStyle := lipgloss.NewStyle().Foreground(clrTitle).Bold(true)
+	sepStyle := lipgloss.NewStyle().Foreground(clrDim)
+	mutedStyle := lipgloss.NewStyle().Foreground(clrMuted)
+	palette := []lipgloss.Color{clrFile, clrConfig, clrDoc, clrCode}
+
+	renderRow := func(row []string, header bool) string {
+		cells := make([]string, shown)
+		for i := range cells {
+			cell := ""
+			if i < len(row) {
+				cell = tableCell(row[i])
+			}
+			cell = trimVisual(cell, widths[i])
+			pad := strings.Repeat(" ", widths[i]-lipgloss.Width(cell))
+			switch {
+			case header:
+				cells[i] = headStyle.Render(cell + pad)
+			case cell == "":
+				cells[i] = pad
+			case numeric[i]:
+				cells[i] = jsonNum.Render(pad + cell)
+			default:
+				cells[i] = lipgloss.NewStyle().Foreground(palette[i%len(palette)]).Render(cell + pad)
+			}
+		}
+		return "  " + strings.Join(cells, sepStyle.Render(" │ "))
+	}
+
+	summary := fmt.Sprintf("%d rows × %d columns", len(rows)-1, cols)
+	if shown < cols {
+		summary += fmt.Sprintf(" (%d hidden)", cols-shown)
+	}
+	if truncated {
+		summary += ", truncated"
+	}
+	rule := make([]string, shown)
+	for i := range rule {
+		rule[i] = strings.Repeat("─", widths[i])
+	}
+
+	lines := []string{
+		"  " + mutedStyle.Render(summary),
+		renderRow(rows[0], true),
+		sepStyle.Render("  " + strings.Join(rule, "─┼─")),
+		frozenPreviewMark,
+	}
+	for _, row := range rows[1:] {
+		lines = append(lines, renderRow(row, false))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// tableCell flattens a cell onto one line for the table preview.
+func tableCell(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", " ")
+	s = strings.ReplaceAll(s, "\n", " ")
+	return strings.ReplaceAll(s, "\t", " ")
+}
+
+// ── custom previewers ─────────────────────────────────────────────────────────
+
+// previewerRule maps a file pattern to an external preview command. Patterns
+// containing "/" match the sniffed MIME type (e.g. "application/pdf",
+// "video/*"); anything else is a glob against the file name (e.g. "*.pdf").
+// In the command, {} is replaced by the shell-quoted path.
+type previewerRule struct {
+	pattern string
+	command string
+}
+
+const previewerTimeout = 5 * time.Second
+
+// matchPreviewer returns the first configured previewer that applies to path.
+func matchPreviewer(path string) (previewerRule, bool) {
+	if len(userConfig.previewers) == 0 {
+		return previewerRule{}, false
+	}
+	name := strings.ToLower(filepath.Base(path))
+	mimeType := ""
+	for _, rule := range userConfig.previewers {
+		pattern := strings.ToLower(rule.pattern)
+		if strings.Contains(pattern, "/") {
+			if mimeType == "" {
+				mimeType = detectMimeType(path)
+			}
+			if ok, _ := filepath.Match(pattern, mimeType); ok {
+				return rule, true
+			}
+			continue
+		}
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return rule, true
+		}
+	}
+	return previewerRule{}, false
+}
+
+// detectMimeType sniffs the first 512 bytes of path, preferring the
+// extension's registered type when sniffing only finds generic data.
+func detectMimeType(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	sniffed := http.DetectContentType(head[:n])
+	if strings.HasPrefix(sniffed, "application/octet-stream") || strings.HasPrefix(sniffed, "text/plain") {
+		if byExt := mime.TypeByExtension(filepath.Ext(path)); byExt != "" {
+			sniffed = byExt
+		}
+	}
+	if i := strings.IndexByte(sniffed, ';'); i >= 0 {
+		sniffed = sniffed[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(sniffed))
+}
+
+// runPreviewer executes a previewer command through the shell and returns its
+// output, bounded by maxPreviewBytes and previewerTimeout. The pane size is
+// passed as SEER_PREVIEW_WIDTH / SEER_PREVIEW_HEIGHT.
+func runPreviewer(rule previewerRule, path string, width, height int) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), previewerTimeout)
+	defer cancel()
+
+	cmd := shellCommand(ctx, strings.ReplaceAll(rule.command, "{}", shellQuote(path)))
+	cmd.Dir = filepath.Dir(path)
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("SEER_PREVIEW_WIDTH=%d", width),
+		fmt.Sprintf("SEER_PREVIEW_HEIGHT=%d", height),
+	)
+	// Don't wait on background processes the command leaves holding its
+	// output open once it has exited or timed out.
+	cmd.WaitDelay = time.Second
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	// Stop a chatty command once we have enough output.
+	stdout := &cappedBuffer{limit: maxPreviewBytes, full: cancel}
+	cmd.Stdout = stdout
+	waitErr := cmd.Run()
+
+	out := stdout.buf.Bytes()
+	truncated := len(out) > maxPreviewBytes
+	if truncated {
+		out = out[:maxPreviewBytes]
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("previewer %q timed out", rule.pattern)
+	}
+	if waitErr != nil && !truncated && len(out) == 0 {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = waitErr.Error()
+		}
+		return "", fmt.Errorf("previewer %q: %s", rule.pattern, msg)
+	}
+
+	text := strings.ToValidUTF8(string(out), "\uFFFD")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.TrimRight(text, "\n")
+	if truncated {
+		text += "\n\n... preview truncated ..."
+	}
+	return text, nil
+}
+
+// shellCommand runs line through the platform shell.
+func shellCommand(ctx context.Context, line string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/c", line)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", line)
+}
+
+// cappedBuffer keeps the first limit+1 bytes written to it, calling full once
+// it holds more than limit, and discards the rest. The buffer isn't embedded
+// so io.Copy can't bypass Write through its ReadFrom.
+type cappedBuffer struct {
+	buf   bytes.Buffer
+	limit int
+	full  func()
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit + 1 - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(room, len(p))])
+		if b.buf.Len() > b.limit {
+			b.full()
+		}
+	}
+	return len(p), nil
+}
+
+// shellQuote quotes s for safe interpolation into a POSIX shell command line.
+func shellQuote(s string) string {
+	if runtime.GOOS == "windows" {
+		return `"` + s + `"`
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func buildDirPreview(path string) (string, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return "", err
+	}
+
+	// Styled directory preview
+	dirStyle := lipgloss.NewStyle().Foreground(clrDir).Bold(true)
+	mutedStyle := lipgloss.NewStyle().Foreground(clrMuted)
+	dimStyle := lipgloss.NewStyle().Foreground(clrDim)
+
+	var sb strings.Builder
+	sb.WriteString(dirStyle.Render(fileIconExt(catDir, "")+filepath.Base(path)+"/") + "\n")
+	sb.WriteString(mutedStyle.Render(fmt.Sprintf("  %d items", len(entries))) + "\n")
+	if kind := repoKind(path); kind != "" {
+		style := entryNameStyle(entry{isDir: true, repo: kind})
+		sb.WriteString(style.UnsetBold().Render("  "+repoIcon()+"git "+kind+" · "+gitHead(path)) + "\n")
+	}
+	sb.WriteString(dimStyle.Render("  "+strings.Repeat("─", 30)) + "\n\n")
+
+	limit := min(len(entries), maxDirPreview)
+	for i := 0; i < limit; i++ {
+		e := entries[i]
+		name := e.Name()
+		fakeEntry := entry{name: name, isDir: e.IsDir()}
+		var line string
+		if e.IsDir() {
+			line = entryNameStyle(fakeEntry).Render("  " + fileIconExt(catDir, "") + name + "/")
+		} else {
+			// Categorise by name only (no stat for speed).
+			cat := categorise(fakeEntry)
+			col := entryNameStyle(fakeEntry)
+			line = col.Render("  " + fileIconExt(cat, filepath.Ext(name)) + name)
+		}
+		sb.WriteString(line + "\n")
+	}
+	if len(entries) > limit {
+		sb.WriteString(mutedStyle.Render(fmt.Sprintf("\n  … and %d more", len(entries)-limit)) + "\n")
+	}
+
+	return strings.TrimRight(sb.String(), "\n"), nil
+}
+
+func imagePreview(path string, modTime time.Time, width, height int, zoom imageZoom) (string, error) {
+	img, err := decodeImage(path, modTime)
+	if err != nil {
+		return "", err
+	}
+	if zoom.factor > 1 {
+		// Only the visible crop is sampled.
+		if sub, ok := img.(interface {
+			SubImage(image.Rectangle) image.Image
+		}); ok {
+			img = sub.SubImage(zoom.crop(img.Bounds()))
+		}
+	}
+
+	rendered := renderImageASCII(img, width, height)
+	if rendered == "" {
+		return "", errors.New("empty image")
+	}
+	return rendered, nil
+}
+
+// defaultImageMaxMegapixels caps decoded image size: 64 MP is a 256 MB
+// RGBA buffer, and above any phone camera's output.
+const defaultImageMaxMegapixels = 64
+
+var errImageTooLarge = errors.New("image too large to preview")
+
+// checkImageSize reads an image's header and refuses one whose pixel count
+// is over the image_max_megapixels budget, before anything allocates it.
+// Headers it can't read are left for the decoder to reject.
+func checkImageSize(r io.Reader) error {
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return nil
+	}
+	limit := userConfig.imageMaxMegapixels
+	if limit == 0 {
+		limit = defaultImageMaxMegapixels
+	}
+	if pixels := int64(cfg.Width) * int64(cfg.Height); pixels > int64(limit)*1_000_000 {
+		return fmt.Errorf("%w: %d×%d is %d megapixels, over the %d MP limit (image_max_megapixels)",
+			errImageTooLarge, cfg.Width, cfg.Height, pixels/1_000_000, limit)
+	}
+	return nil
+}
+
+// decodeImageFile checks an image's size and then decodes it.
+func decodeImageFile(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := checkImageSize(f); err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+// convertedImageExts are formats with no Go decoder, mapped to the tools that
+// can convert them for the preview.
+var convertedImageExts = map[string]string{
+	".heic": "ImageMagick, libheif (heif-dec) or ffmpeg",
+	".heif": "ImageMagick, libheif (heif-dec) or ffmpeg",
+	".avif": "ImageMagick, libheif (heif-dec) or ffmpeg",
+	".jxl":  "ImageMagick, libjxl (djxl) or ffmpeg",
+}
+
+// imageConverter is an external program that writes an image as PNG.
+type imageConverter struct {
+	bin  string
+	exts []string // nil means every format in convertedImageExts
+	args func(in, out string) []string
+}
+
+var imageConverters = []imageConverter{
+	{bin: "magick", args: func(in, out string) []string { return []string{in + "[0]", out} }},
+	{bin: "heif-dec", exts: []string{".heic", ".heif", ".avif"}, args: func(in, out string) []string { return []string{in, out} }},
+	{bin: "heif-convert", exts: []string{".heic", ".heif", ".avif"}, args: func(in, out string) []string { return []string{in, out} }},
+	{bin: "djxl", exts: []string{".jxl"}, args: func(in, out string) []string { return []string{in, out} }},
+	{bin: "ffmpeg", args: func(in, out string) []string {
+		return []string{"-v", "error", "-i", in, "-frames:v", "1", "-y", out}
+	}},
+}
+
+// convertImage decodes a format Go can't read by converting it to a
+// temporary PNG with the first installed converter.
+func convertImage(path string) (image.Image, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, c := range imageConverters {
+		if c.exts != nil && !slices.Contains(c.exts, ext) || !commandExists(c.bin) {
+			continue
+		}
+		dir, err := os.MkdirTemp("", "seer-image-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		out := filepath.Join(dir, "preview.png")
+
+		ctx, cancel := context.WithTimeout(context.Background(), previewerTimeout)
+		err = exec.CommandContext(ctx, c.bin, c.args(path, out)...).Run()
+		cancel()
+		if err != nil {
+			continue
+		}
+		img, err := decodeImageFile(out)
+		if err == nil || errors.Is(err, errImageTooLarge) {
+			return img, err
+		}
+	}
+	return nil, fmt.Errorf("no converter for %s", ext)
+}
+
+func renderMarkdownPreview(markdown, dir string, width int, truncated bool) string {
+	fields, markdown := splitFrontMatter(markdown)
+	prepared, images := markImageLines(replaceMarkdownMath(replaceMermaidFences(markdown)), dir)
+	prepared, tables := markWideTables(prepared, width)
+	rendered := prepared
+	r, err := glamour.NewTermRenderer(
+		glamour.WithStylePath(glamourStyleName),
+		glamour.WithWordWrap(max(24, width-2)),
+		glamour.WithTableWrap(true),
+		glamour.WithEmoji(),
+	)
+	if err == nil {
+		if out, renderErr := r.Render(prepared); renderErr == nil {
+			rendered = out
+		}
+	}
+	rendered = placeMarkdownImages(rendered, images, width)
+	rendered = placeMarkdownTables(rendered, tables)
+	if len(fields) > 0 {
+		rendered = renderFrontMatter(fields, width) + "\n" + rendered
+	}
+
+	if truncated {
+		rendered += "\n\n... preview truncated ..."
+	}
+
+	return rendered
+}
+
+// ── front matter ──────────────────────────────────────────────────────────────
+
+// frontMatterField is one top-level key of a markdown file's YAML front
+// matter, with lists and nested values flattened to a line of text.
+type frontMatterField struct {
+	key   string
+	value string
+}
+
+// splitFrontMatter separates a leading ---…--- YAML block from the rest of
+// a markdown document. Only the YAML that front matter tends to use is
+// understood: scalars, quoted strings, flow and block lists, block scalars
+// and one level of nesting.
+func splitFrontMatter(markdown string) ([]frontMatterField, string) {
+	rest, ok := strings.CutPrefix(strings.TrimPrefix(markdown, "\ufeff"), "---")
+	if !ok {
+		return nil, markdown
+	}
+	first, rest, ok := strings.Cut(rest, "\n")
+	if !ok || strings.TrimSpace(first) != "" {
+		return nil, markdown
+	}
+	var block []string
+	body := ""
+	closed := false
+	for pos := 0; pos <= len(rest); {
+		line, next := rest[pos:], len(rest)+1
+		if end := strings.IndexByte(line, '\n'); end >= 0 {
+			line, next = line[:end], pos+end+1
+		}
+		if t := strings.TrimRight(line, " \t\r"); t == "---" || t == "..." {
+			// The body is everything after the closing line, sliced once.
+			closed = true
+			if next <= len(rest) {
+				body = rest[next:] + "\n"
+			}
+			break
+		}
+		block = append(block, strings.TrimRight(line, "\r"))
+		pos = next
+	}
+	if !closed {
+		return nil, markdown
+	}
+
+	var fields []frontMatterField
+	var parts []string // the current field's list items or nested values
+	sep := ", "        // " " joins the lines of a block scalar
+	flush := func() {
+		if len(fields) > 0 && len(parts) > 0 {
+			f := &fields[len(fields)-1]
+			f.value = strings.TrimSpace(f.value + " " + strings.Join(parts, sep))
+		}
+		parts, sep = nil, ", "
+	}
+	for _, line := range block {
+		t := strings.TrimSpace(line)
+		if t == "" || strings.HasPrefix(t, "#") {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' || strings.HasPrefix(t, "- ") {
+			if len(fields) == 0 {
+				continue
+			}
+			item := strings.TrimSpace(strings.TrimPrefix(t, "-"))
+			if sep == " " {
+				item = t
+			} else if k, v, ok := strings.Cut(item, ": "); ok && !strings.HasPrefix(item, `"`) {
+				item = k + ": " + frontMatterScalar(v)
+			} else {
+				item = frontMatterScalar(item)
+			}
+			if item != "" {
+				parts = append(parts, item)
+			}
+			continue
+		}
+		flush()
+		key, value, _ := strings.Cut(t, ":")
+		value = strings.TrimSpace(value)
+		if value == "|" || value == ">" || value == "|-" || value == ">-" {
+			value, sep = "", " "
+		}
+		fields = append(fields, frontMatterField{key: strings.TrimSpace(key), value: frontMatterScalar(value)})
+	}
+	flush()
+	return fields, strings.TrimPrefix(body, "\n")
+}
+
+// frontMatterScalar unquotes a YAML scalar and flattens a [a, b] list.
+func frontMatterScalar(v string) string {
+	v = strings.TrimSpace(v)
+	if strings.HasPrefix(v, "[") && strings.HasSuffix(v, "]") {
+		var items []string
+		for item := range strings.SplitSeq(v[1:len(v)-1], ",") {
+			if item = frontMatterScalar(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return strings.Join(items, ", ")
+	}
+	if len(v) >= 2 && (v[0] == '"' && v[len(v)-1] == '"' || v[0] == '\'' && v[len(v)-1] == '\'') {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+// renderFrontMatter draws the fields as a header: the title on its own,
+// then the other keys aligned in a column, and a rule below.
+func renderFrontMatter(fields []frontMatterField, width int) string {
+	titleStyle := lipgloss.NewStyle().Foreground(clrTitle).Bold(true)
+	keyStyle := lipgloss.NewStyle().Foreground(clrMuted)
+	ruleStyle := lipgloss.NewStyle().Foreground(clrBorder)
+
+	keyW := 0
+	for _, f := range fields {
+		if !strings.EqualFold(f.key, "title") {
+			keyW = max(keyW, ansi.StringWidth(f.key))
+		}
+	}
+	keyW = min(keyW, 16)
+	valueW := max(16, width-keyW-6)
+
+	var lines []string
+	for _, f := range fields {
+		if strings.EqualFold(f.key, "title") && f.value != "" {
+			lines = append([]string{"  " + titleStyle.Render(trimVisual(f.value, width-4)), ""}, lines...)
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.key, "title") {
+			continue
+		}
+		wrapped := strings.Split(ansi.Wrap(f.value, valueW, ""), "\n")
+		for i, part := range wrapped {
+			key := ""
+			if i == 0 {
+				key = trimVisual(f.key, keyW)
+			}
+			lines = append(lines, "  "+keyStyle.Render(padRight(key, keyW))+"  "+part)
+		}
+	}
+	rule := "  " + ruleStyle.Render(strings.Repeat("─", max(8, min(width-4, 60))))
+	return "\n" + strings.Join(lines, "\n") + "\n" + rule
+}
+
+// ── markdown math ─────────────────────────────────────────────────────────────
+
+// Math in markdown, inline $…$ and display $$…$$, is rewritten as Unicode
+// before rendering: Greek letters and operators by their symbols, scripts as
+// superscript and subscript characters where those exist, fractions and
+// roots in linear form.
+
+// texSymbols maps TeX commands to the characters they typeset.
+var texSymbols = map[string]string{
+	"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ε", "varepsilon": "ε",
+	"zeta": "ζ", "eta": "η", "theta": "θ", "vartheta": "ϑ", "iota": "ι", "kappa": "κ",
+	"lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ", "pi": "π", "varpi": "ϖ", "rho": "ρ",
+	"varrho": "ϱ", "sigma": "σ", "varsigma": "ς", "tau": "τ", "upsilon": "υ", "phi": "φ",
+	"varphi": "φ", "chi": "χ", "psi": "ψ", "omega": "ω",
+	"Gamma": "Γ", "Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ", "Pi": "Π",
+	"Sigma": "Σ", "Upsilon": "Υ", "Phi": "Φ", "Psi": "Ψ", "Omega": "Ω",
+	"times": "×", "cdot": "·", "div": "÷", "pm": "±", "mp": "∓", "ast": "∗", "star": "⋆",
+	"circ": "∘", "bullet": "•", "oplus": "⊕", "otimes": "⊗",
+	"leq": "≤", "le": "≤", "geq": "≥", "ge": "≥", "neq": "≠", "ne": "≠", "approx": "≈",
+	"equiv": "≡", "sim": "∼", "simeq": "≃", "cong": "≅", "propto": "∝", "ll": "≪", "gg": "≫",
+	"infty": "∞", "partial": "∂", "nabla": "∇", "sum": "∑", "prod": "∏", "coprod": "∐",
+	"int": "∫", "iint": "∬", "iiint": "∭", "oint": "∮", "lim": "lim", "max": "max",
+	"min": "min", "sup": "sup", "inf": "inf", "log": "log", "ln": "ln", "exp": "exp",
+	"sin": "sin", "cos": "cos", "tan": "tan", "det": "det", "gcd": "gcd", "mod": "mod",
+	"in": "∈", "notin": "∉", "ni": "∋", "subset": "⊂", "subseteq": "⊆", "supset": "⊃",
+	"supseteq": "⊇", "cup": "∪", "cap": "∩", "setminus": "∖", "emptyset": "∅", "varnothing": "∅",
+	"forall": "∀", "exists": "∃", "nexists": "∄", "neg": "¬", "lnot": "¬", "land": "∧",
+	"wedge": "∧", "lor": "∨", "vee": "∨", "implies": "⟹", "iff": "⟺",
+	"to": "→", "rightarrow": "→", "leftarrow": "←", "leftrightarrow": "↔", "Rightarrow": "⇒",
+	"Leftarrow": "⇐", "Leftrightarrow": "⇔", "mapsto": "↦", "uparrow": "↑", "downarrow": "↓",
+	"ldots": "…", "cdots": "⋯", "vdots": "⋮", "ddots": "⋱", "dots": "…",
+	"langle": "⟨", "rangle": "⟩", "lceil": "⌈", "rceil": "⌉", "lfloor": "⌊", "rfloor": "⌋",
+	"prime": "′", "degree": "°", "angle": "∠", "perp": "⊥", "parallel": "∥", "mid": "∣",
+	"hbar": "ℏ", "ell": "ℓ", "Re": "ℜ", "Im": "ℑ", "aleph": "ℵ", "top": "⊤", "bot": "⊥",
+	"quad": "  ", "qquad": "    ", ",": " ", ";": " ", ":": " ", " ": " ", "!": "",
+	"{": "{", "}": "}", "%": "%", "$": "$", "&": "&", "#": "#", "_": "_", "|": "‖",
+}
+
+// texAccents maps accent commands to combining characters.
+var texAccents = map[string]string{
+	"hat": "̂", "widehat": "̂", "bar": "̄", "overline": "̅",
+	"vec": "⃗", "tilde": "̃", "widetilde": "̃", "dot": "̇", "ddot": "̈",
+}
+
+var texBlackboard = map[rune]string{
+	'R': "ℝ", 'N': "ℕ", 'Z': "ℤ", 'Q': "ℚ", 'C': "ℂ", 'P': "ℙ", 'H': "ℍ", 'E': "𝔼",
+}
+
+var (
+	texSuperscripts = map[rune]rune{
+		'0': '⁰', '1': '¹', '2': '²', '3': '³', '4': '⁴', '5': '⁵', '6': '⁶', '7': '⁷', '8': '⁸', '9': '⁹',
+		'+': '⁺', '-': '⁻', '−': '⁻', '=': '⁼', '(': '⁽', ')': '⁾', 'a': 'ᵃ', 'b': 'ᵇ', 'c': 'ᶜ',
+		'd': 'ᵈ', 'e': 'ᵉ', 'f': 'ᶠ', 'g': 'ᵍ', 'h': 'ʰ', 'i': 'ⁱ', 'j': 'ʲ', 'k': 'ᵏ', 'l': 'ˡ',
+		'm': 'ᵐ', 'n': 'ⁿ', 'o': 'ᵒ', 'p': 'ᵖ', 'r': 'ʳ', 's': 'ˢ', 't': 'ᵗ', 'u': 'ᵘ', 'v': 'ᵛ',
+		'w': 'ʷ', 'x': 'ˣ', 'y': 'ʸ', 'z': 'ᶻ', 'T': 'ᵀ', '′': '′', '*': '*',
+	}
+	texSubscripts = map[rune]rune{
+		'0': '₀', '1': '₁', '2': '₂', '3': '₃', '4': '₄', '5': '₅', '6': '₆', '7': '₇', '8': '₈', '9': '₉',
+		'+': '₊', '-': '₋', '−': '₋', '=': '₌', '(': '₍', ')': '₎', 'a': 'ₐ', 'e': 'ₑ', 'h': 'ₕ',
+		'i': 'ᵢ', 'j': 'ⱼ', 'k': 'ₖ', 'l': 'ₗ', 'm': 'ₘ', 'n': 'ₙ', 'o': 'ₒ', 'p': 'ₚ', 'r': 'ᵣ',
+		's': 'ₛ', 't': 'ₜ', 'u': 'ᵤ', 'v': 'ᵥ', 'x': 'ₓ',
+	}
+)
+
+// vulgarFractions are the fractions Unicode has a single character for.
+var vulgarFractions = map[string]string{
+	"1/2": "½", "1/3": "⅓", "2/3": "⅔", "1/4": "¼", "3/4": "¾", "1/5": "⅕",
+	"1/6": "⅙", "1/8": "⅛", "3/8": "⅜", "5/8": "⅝", "7/8": "⅞",
+}
+
+// texCommand reads the command whose backslash is at s[i]: a run of letters
+// or a single symbol. It returns the name and the index after it.
+func texCommand(s string, i int) (string, int) {
+	j := i + 1
+	for j < len(s) && (s[j] >= 'a' && s[j] <= 'z' || s[j] >= 'A' && s[j] <= 'Z') {
+		j++
+	}
+	if j == i+1 && j < len(s) {
+		_, size := utf8.DecodeRuneInString(s[j:])
+		j += size
+	}
+	return s[i+1 : j], j
+}
+
+// texArg reads one argument from s[i:]: a braced group (without its
+// braces), a command, or a single character.
+func texArg(s string, i int) (string, int) {
+	for i < len(s) && s[i] == ' ' {
+		i++
+	}
+	if i >= len(s) {
+		return "", i
+	}
+	switch s[i] {
+	case '{':
+		depth := 0
+		for j := i; j < len(s); j++ {
+			switch s[j] {
+			case '\\':
+				j++
+			case '{':
+				depth++
+			case '}':
+				depth--
+				if depth == 0 {
+					return s[i+1 : j], j + 1
+				}
+			}
+		}
+		return s[i+1:], len(s)
+	case '\\':
+		_, j := texCommand(s, i)
+		return s[i:j], j
+	}
+	_, size := utf8.DecodeRuneInString(s[i:])
+	return s[i : i+size], i + size
+}
+
+// texScript writes text raised or lowered: as script characters when every
+// character has one, otherwise as ^(text) or _(text).
+func texScript(text string, sup bool) string {
+	table, mark := texSubscripts, "_"
+	if sup {
+		table, mark = texSuperscripts, "^"
+	}
+	var sb strings.Builder
+	for _, r := range text {
+		s, ok := table[r]
+		if !ok {
+			if utf8.RuneCountInString(text) == 1 {
+				return mark + text
+			}
+			return mark + "(" + text + ")"
+		}
+		sb.WriteRune(s)
+	}
+	return sb.String()
+}
+
+// texFraction writes num/den, parenthesising compound parts.
+func texFraction(num, den string) string {
+	if v, ok := vulgarFractions[num+"/"+den]; ok {
+		return v
+	}
+	wrap := func(s string) string {
+		if strings.ContainsAny(s, " +-−·×=") && !(strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")")) {
+			return "(" + s + ")"
+		}
+		return s
+	}
+	return wrap(num) + "/" + wrap(den)
+}
+
+// texToUnicode approximates a TeX math expression in plain Unicode.
+func texToUnicode(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); {
+		switch c := s[i]; c {
+		case '\\':
+			name, next := texCommand(s, i)
+			i = next
+			switch name {
+			case "frac", "dfrac", "tfrac", "cfrac":
+				num, n := texArg(s, i)
+				den, n := texArg(s, n)
+				i = n
+				sb.WriteString(texFraction(texToUnicode(num), texToUnicode(den)))
+			case "binom":
+				top, n := texArg(s, i)
+				bottom, n := texArg(s, n)
+				i = n
+				sb.WriteString("C(" + texToUnicode(top) + ", " + texToUnicode(bottom) + ")")
+			case "sqrt":
+				index := ""
+				if i < len(s) && s[i] == '[' {
+					if end := strings.IndexByte(s[i:], ']'); end > 0 {
+						index, i = s[i+1:i+end], i+end+1
+					}
+				}
+				arg, n := texArg(s, i)
+				i = n
+				inner := texToUnicode(arg)
+				if utf8.RuneCountInString(inner) > 1 {
+					inner = "(" + inner + ")"
+				}
+				if index != "" {
+					sb.WriteString(texScript(texToUnicode(index), true))
+				}
+				sb.WriteString("√" + inner)
+			case "text", "textrm", "textbf", "textit", "mbox":
+				arg, n := texArg(s, i)
+				i = n
+				sb.WriteString(arg)
+			case "mathrm", "mathit", "mathbf", "mathsf", "mathtt", "mathcal", "boldsymbol", "operatorname":
+				arg, n := texArg(s, i)
+				i = n
+				sb.WriteString(texToUnicode(arg))
+			case "mathbb":
+				arg, n := texArg(s, i)
+				i = n
+				for _, r := range arg {
+					if bb, ok := texBlackboard[r]; ok {
+						sb.WriteString(bb)
+					} else {
+						sb.WriteRune(r)
+					}
+				}
+			case "begin", "end":
+				_, i = texArg(s, i) // environment name
+			case "left", "right", "big", "Big", "bigg", "Bigg", "bigl", "bigr", "Bigl", "Bigr", "displaystyle", "limits":
+				if i < len(s) && s[i] == '.' {
+					i++ // an invisible delimiter
+				}
+			case "\\":
+				sb.WriteByte('\n')
+			default:
+				if accent, ok := texAccents[name]; ok {
+					arg, n := texArg(s, i)
+					i = n
+					sb.WriteString(texToUnicode(arg) + accent)
+				} else if sym, ok := texSymbols[name]; ok {
+					sb.WriteString(sym)
+				} else {
+					sb.WriteString(name)
+				}
+			}
+		case '^', '_':
+			arg, n := texArg(s, i+1)
+			i = n
+			sb.WriteString(texScript(texToUnicode(arg), c == '^'))
+		case '{', '}':
+			i++
+		case '~':
+			sb.WriteByte(' ')
+			i++
+		case '&':
+			sb.WriteString("  ")
+			i++
+		case '-':
+			sb.WriteString("−")
+			i++
+		case '\'':
+			sb.WriteString("′")
+			i++
+		default:
+			_, size := utf8.DecodeRuneInString(s[i:])
+			sb.WriteString(s[i : i+size])
+			i += size
+		}
+	}
+	return sb.String()
+}
+
+// markdownEscaper keeps converted math from being read as markdown.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`, "`", "\\`", "|", `\|`, "~", `\~`,
+)
+
+// replaceMarkdownMath rewrites the math in a markdown document: display
+// math becomes a text block, inline math its Unicode form. Code is left
+// alone, as are dollar signs that read as prices ($5 and $10).
+func replaceMarkdownMath(markdown string) string {
+	lines := strings.Split(markdown, "\n")
+	out := make([]string, 0, len(lines))
+	fence := ""
+	var display []string
+	inDisplay := false
+	for _, line := range lines {
+		t := strings.TrimSpace(line)
+		switch {
+		case inDisplay:
+			if before, _, ok := strings.Cut(t, "$$"); ok {
+				display = append(display, before)
+				out = append(out, renderDisplayMath(strings.Join(display, "\n"))...)
+				inDisplay, display = false, nil
+			} else {
+				display = append(display, t)
+			}
+			continue
+		case fence != "":
+			if strings.HasPrefix(t, fence) {
+				fence = ""
+			}
+		case strings.HasPrefix(t, "```") || strings.HasPrefix(t, "~~~"):
+			fence = t[:3]
+		case strings.HasPrefix(t, "$$"):
+			body := t[2:]
+			if end := strings.Index(body, "$$"); end >= 0 {
+				out = append(out, renderDisplayMath(body[:end])...)
+			} else {
+				inDisplay, display = true, []string{body}
+			}
+			continue
+		default:
+			line = replaceInlineMath(line)
+		}
+		out = append(out, line)
+	}
+	if inDisplay {
+		out = append(out, "$$")
+		out = append(out, display...)
+	}
+	return strings.Join(out, "\n")
+}
+
+// renderDisplayMath sets display math as its own text block.
+func renderDisplayMath(tex string) []string {
+	text := strings.TrimSpace(texToUnicode(strings.TrimSpace(tex)))
+	if text == "" {
+		return nil
+	}
+	block := []string{"", "```text"}
+	for line := range strings.SplitSeq(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			block = append(block, line)
+		}
+	}
+	return append(block, "```", "")
+}
+
+// replaceInlineMath converts $…$ spans on a line of markdown. An opening $
+// must be followed by a non-space, and the next $ close it: preceded by a
+// non-space and not followed by a digit.
+func replaceInlineMath(line string) string {
+	if !strings.Contains(line, "$") {
+		return line
+	}
+	var sb strings.Builder
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && i+1 < len(line):
+			sb.WriteString(line[i : i+2])
+			i++
+			continue
+		case c == '`':
+			end := strings.IndexByte(line[i+1:], '`')
+			if end < 0 {
+				break
+			}
+			sb.WriteString(line[i : i+end+2])
+			i += end + 1
+			continue
+		case c == '$' && i+1 < len(line) && line[i+1] != ' ' && line[i+1] != '$':
+			end := -1
+			for j := i + 2; j < len(line); j++ {
+				if line[j] != '$' || line[j-1] == '\\' {
+					continue
+				}
+				// Any other $ ends the search: "$5 and $10" isn't math.
+				if line[j-1] != ' ' && (j+1 == len(line) || line[j+1] < '0' || line[j+1] > '9') {
+					end = j
+				}
+				break
+			}
+			if end > 0 {
+				sb.WriteString(markdownEscaper.Replace(texToUnicode(line[i+1 : end])))
+				i = end
+				continue
+			}
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// ── markdown images ───────────────────────────────────────────────────────────
+
+// Local images on a line of their own are drawn as thumbnails in markdown
+// previews. Each one is swapped for a placeholder word before rendering and
+// the placeholder's line replaced by the thumbnail afterwards.
+
+const (
+	mdImageMaxW = 48
+	mdImageMaxH = 14
+	// mdImageToken prefixes a placeholder; glamour passes it through as a
+	// plain word.
+	mdImageToken = "SEERIMAGE"
+)
+
+// mdImage is a local image referenced by a markdown document.
+type mdImage struct {
+	path string
+	alt  string
+}
+
+// markImageLines replaces lines holding just a local image, ![alt](src) or
+// a linked one, with placeholders, skipping fenced code.
+func markImageLines(markdown, dir string) (string, []mdImage) {
+	lines := strings.Split(markdown, "\n")
+	var images []mdImage
+	fence := ""
+	for i, line := range lines {
+		t := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(t, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(t, "```") || strings.HasPrefix(t, "~~~") {
+			fence = t[:3]
+			continue
+		}
+		if strings.HasPrefix(t, "[![") {
+			// A linked image: [![alt](src)](target)
+			if end := strings.LastIndex(t, "]("); end > 0 && strings.HasSuffix(t, ")") {
+				t = t[1:end]
+			}
+		}
+		if !strings.HasPrefix(t, "![") || !strings.HasSuffix(t, ")") {
+			continue
+		}
+		mid := strings.Index(t, "](")
+		if mid < 0 {
+			continue
+		}
+		alt := t[2:mid]
+		src := ""
+		if f := strings.Fields(t[mid+2 : len(t)-1]); len(f) > 0 {
+			src = strings.Trim(f[0], "<>")
+		}
+		if src == "" || isExternalLink(src) || strings.HasPrefix(src, "data:") {
+			continue
+		}
+		if unescaped, err := url.PathUnescape(src); err == nil {
+			src = unescaped
+		}
+		if !filepath.IsAbs(src) {
+			src = filepath.Join(dir, src)
+		}
+		if !imageExts[strings.ToLower(filepath.Ext(src))] {
+			continue
+		}
+		lines[i] = fmt.Sprintf("%s%d", mdImageToken, len(images))
+		images = append(images, mdImage{path: src, alt: markdownLinkText(alt)})
+	}
+	return strings.Join(lines, "\n"), images
+}
+
+// placeMarkdownImages swaps the rendered placeholders for thumbnails, or
+// for the alt text when an image can't be read.
+func placeMarkdownImages(rendered string, images []mdImage, width int) string {
+	if len(images) == 0 {
+		return rendered
+	}
+	caption := lipgloss.NewStyle().Foreground(clrMuted).Italic(true)
+	lines := strings.Split(rendered, "\n")
+	out := make([]string, 0, len(lines))
+	for _, line := range lines {
+		plain := strings.TrimSpace(ansi.Strip(line))
+		n, err := strconv.Atoi(strings.TrimPrefix(plain, mdImageToken))
+		if !strings.HasPrefix(plain, mdImageToken) || err != nil || n < 0 || n >= len(images) {
+			out = append(out, line)
+			continue
+		}
+		im := images[n]
+		indent := strings.Repeat(" ", strings.Index(ansi.Strip(line), mdImageToken))
+		label := im.alt
+		if label == "" {
+			label = filepath.Base(im.path)
+		}
+		img, err := decodeImageFile(im.path)
+		if err != nil {
+			out = append(out, indent+caption.Render("[image: "+label+"]"))
+			continue
+		}
+		for _, row := range strings.Split(renderImageThumbnail(img, min(mdImageMaxW, width-len(indent)-2), mdImageMaxH), "\n") {
+			out = append(out, indent+row)
+		}
+		out = append(out, indent+caption.Render(label))
+	}
+	return strings.Join(out, "\n")
+}
+
+// renderImageThumbnail draws img within maxW×maxH cells, keeping its aspect
+// ratio (a cell is about twice as tall as it is wide).
+func renderImageThumbnail(img image.Image, maxW, maxH int) string {
+	b := img.Bounds()
+	if b.Dx() <= 0 || b.Dy() <= 0 {
+		return ""
+	}
+	outW := max(4, maxW)
+	outH := max(1, outW*b.Dy()/(2*b.Dx()))
+	if outH > maxH {
+		outH = maxH
+		outW = max(4, outH*2*b.Dx()/b.Dy())
+	}
+	if supportsTrueColor() {
+		return renderImageTrueColor(img, outW, outH)
+	}
+	return renderImageGray(img, outW, outH)
+}
+
+// ── markdown tables ───────────────────────────────────────────────────────────
+
+// glamour squeezes tables into the pane, wrapping or cutting their cells.
+// Tables wider than the pane are drawn here instead, at their natural width,
+// for the preview's horizontal scroll to reveal. Like images, each is
+// swapped for a placeholder word before rendering.
+
+// mdTableToken prefixes a table placeholder.
+const mdTableToken = "SEERTABLE"
+
+// mdTable is a GFM table: its rows, header first, and each column's
+// alignment ('l', 'c', 'r' or 0 for none).
+type mdTable struct {
+	rows  [][]string
+	align []byte
+}
+
+// splitTableRow splits a |-delimited row into trimmed cells, leaving
+// escaped pipes and pipes inside code spans alone.
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var cells []string
+	var cell strings.Builder
+	code := false
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case c == '`':
+			code = !code
+			cell.WriteByte(c)
+		case c == '|' && !code:
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(c)
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// tableAlignments parses a delimiter row such as |:---|:-:|--:|, reporting
+// false if line isn't one.
+func tableAlignments(line string) ([]byte, bool) {
+	if !strings.Contains(line, "-") {
+		return nil, false
+	}
+	cells := splitTableRow(line)
+	align := make([]byte, len(cells))
+	for i, c := range cells {
+		dashes := strings.Trim(c, ":")
+		if dashes == "" || strings.Trim(dashes, "-") != "" {
+			return nil, false
+		}
+		left, right := strings.HasPrefix(c, ":"), strings.HasSuffix(c, ":")
+		switch {
+		case left && right:
+			align[i] = 'c'
+		case right:
+			align[i] = 'r'
+		case left:
+			align[i] = 'l'
+		}
+	}
+	return align, true
+}
+
+// mdTableCell reduces a cell's inline markdown to its text: links to their
+// labels, with emphasis and code markers dropped.
+func mdTableCell(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '[' || s[i] == '!' && strings.HasPrefix(s[i:], "![") {
+			open := i
+			if s[i] == '!' {
+				open++
+			}
+			if mid := strings.Index(s[open:], "]("); mid > 0 {
+				if end := strings.IndexByte(s[open+mid:], ')'); end > 0 {
+					sb.WriteString(s[open+1 : open+mid])
+					i = open + mid + end
+					continue
+				}
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return markdownLinkText(strings.NewReplacer("**", "", "__", "", "~~", "").Replace(sb.String()))
+}
+
+// mdTableWidth is a table's width as renderMarkdownTable draws it.
+func mdTableWidth(t mdTable) int {
+	total := 0
+	for _, w := range mdTableColumnWidths(t) {
+		total += w + 3
+	}
+	return total - 1
+}
+
+func mdTableColumnWidths(t mdTable) []int {
+	widths := make([]int, len(t.align))
+	for _, row := range t.rows {
+		for i := range widths {
+			if i < len(row) {
+				widths[i] = max(widths[i], ansi.StringWidth(row[i]))
+			}
+		}
+	}
+	return widths
+}
+
+// markWideTables replaces tables that won't fit in width with placeholders,
+// skipping fenced code.
+func markWideTables(markdown string, width int) (string, []mdTable) {
+	lines := strings.Split(markdown, "\n")
+	out := make([]string, 0, len(lines))
+	var tables []mdTable
+	fence := ""
+	for i := 0; i < len(lines); i++ {
+		t := strings.TrimSpace(lines[i])
+		if fence != "" {
+			if strings.HasPrefix(t, fence) {
+				fence = ""
+			}
+			out = append(out, lines[i])
+			continue
+		}
+		if strings.HasPrefix(t, "```") || strings.HasPrefix(t, "~~~") {
+			fence = t[:3]
+			out = append(out, lines[i])
+			continue
+		}
+		align, ok := []byte(nil), false
+		if strings.Contains(t, "|") && i+1 < len(lines) {
+			align, ok = tableAlignments(lines[i+1])
+		}
+		header := splitTableRow(t)
+		if !ok || len(header) != len(align) {
+			out = append(out, lines[i])
+			continue
+		}
+		table := mdTable{rows: [][]string{header}, align: align}
+		end := i + 2
+		for ; end < len(lines); end++ {
+			r := strings.TrimSpace(lines[end])
+			if r == "" || !strings.Contains(r, "|") {
+				break
+			}
+			table.rows = append(table.rows, splitTableRow(r))
+		}
+		for _, row := range table.rows {
+			for j := range row {
+				row[j] = mdTableCell(row[j])
+			}
+		}
+		// The preview indents blocks by two cells on each side.
+		if mdTableWidth(table) <= width-4 {
+			out = append(out, lines[i:end]...)
+		} else {
+			out = append(out, "", fmt.Sprintf("%s%d", mdTableToken, len(tables)), "")
+			tables = append(tables, table)
+		}
+		i = end - 1
+	}
+	return strings.Join(out, "\n"), tables
+}
+
+// renderMarkdownTable draws a table with its columns aligned and a rule
+// under the header.
+func renderMarkdownTable(t mdTable) []string {
+	widths := mdTableColumnWidths(t)
+	headStyle := lipgloss.NewStyle().Foreground(clrTitle).Bold(true)
+	sepStyle := lipgloss.NewStyle().Foreground(clrDim)
+	sep := sepStyle.Render(" │ ")
+	out := make([]string, 0, len(t.rows)+1)
+	for r, row := range t.rows {
+		cells := make([]string, len(widths))
+		for i, w := range widths {
+			cell := ""
+			if i < len(row) {
+				cell = row[i]
+			}
+			gap := w - ansi.StringWidth(cell)
+			switch t.align[i] {
+			case 'r':
+				cell = strings.Repeat(" ", gap) + cell
+			case 'c':
+				cell = strings.Repeat(" ", gap/2) + cell + strings.Repeat(" ", gap-gap/2)
+			default:
+				cell += strings.Repeat(" ", gap)
+			}
+			if r == 0 {
+				cell = headStyle.Render(cell)
+			}
+			cells[i] = cell
+		}
+		out = append(out, " "+strings.Join(cells, sep))
+		if r == 0 {
+			rule := make([]string, len(widths))
+			for i, w := range widths {
+				rule[i] = strings.Repeat("─", w)
+			}
+			out = append(out, sepStyle.Render("─"+strings.Join(rule, "─┼─")+"─"))
+		}
+	}
+	return out
+}
+
+// placeMarkdownTables swaps the rendered placeholders for their tables.
+func placeMarkdownTables(rendered string, tables []mdTable) string {
+	if len(tables) == 0 {
+		return rendered
+	}
+	lines := strings.Split(rendered, "\n")
+	out := make([]string, 0, len(lines))
+	for _, line := range lines {
+		plain := strings.TrimSpace(ansi.Strip(line))
+		n, err := strconv.Atoi(strings.TrimPrefix(plain, mdTableToken))
+		if !strings.HasPrefix(plain, mdTableToken) || err != nil || n < 0 || n >= len(tables) {
+			out = append(out, line)
+			continue
+		}
+		indent := strings.Repeat(" ", strings.Index(ansi.Strip(line), mdTableToken))
+		for _, row := range renderMarkdownTable(tables[n]) {
+			out = append(out, indent+row)
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// ── markdown links ────────────────────────────────────────────────────────────
+
+// mdLink is a link in a markdown document: its text and where it points.
+type mdLink struct {
+	text   string
+	target string
+}
+
+// markdownLinks is set while the preview pane has focus for following the
+// links of a rendered markdown file. base is the rendered preview the
+// current link is highlighted in; lines holds each link's line in it, or
+// -1 where the renderer's output doesn't show the link text.
+type markdownLinks struct {
+	path   string
+	base   string
+	links  []mdLink
+	lines  []int
+	cursor int
+}
+
+// parseMarkdownLinks lists the inline, reference, autolinks and bare URLs
+// of a markdown document in reading order. Images and code are skipped.
+func parseMarkdownLinks(src string) []mdLink {
+	lines := strings.Split(src, "\n")
+
+	// Reference definitions: [label]: target "title"
+	refs := make(map[string]string)
+	isDef := make([]bool, len(lines))
+	for i, line := range lines {
+		t := strings.TrimSpace(line)
+		if !strings.HasPrefix(t, "[") || strings.HasPrefix(t, "[^") {
+			continue
+		}
+		end := strings.Index(t, "]:")
+		if end < 0 {
+			continue
+		}
+		if f := strings.Fields(t[end+2:]); len(f) > 0 {
+			refs[strings.ToLower(t[1:end])] = strings.Trim(f[0], "<>")
+			isDef[i] = true
+		}
+	}
+
+	var links []mdLink
+	fence := ""
+	for i, line := range lines {
+		t := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(t, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(t, "```") || strings.HasPrefix(t, "~~~") {
+			fence = t[:3]
+			continue
+		}
+		if isDef[i] {
+			continue
+		}
+		links = append(links, scanMarkdownLinks(line, refs)...)
+	}
+	return links
+}
+
+// scanMarkdownLinks finds the links on one line of markdown.
+func scanMarkdownLinks(line string, refs map[string]string) []mdLink {
+	var links []mdLink
+	// matching returns the index of the bracket closing the one at i.
+	matching := func(i int, open, close byte) int {
+		depth := 0
+		for j := i; j < len(line); j++ {
+			switch line[j] {
+			case '\\':
+				j++
+			case open:
+				depth++
+			case close:
+				depth--
+				if depth == 0 {
+					return j
+				}
+			}
+		}
+		return -1
+	}
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '\\':
+			i++
+		case c == '`':
+			if end := strings.IndexByte(line[i+1:], '`'); end >= 0 {
+				i += end + 1
+			}
+		case c == '<':
+			end := strings.IndexByte(line[i:], '>')
+			if end < 0 {
+				continue
+			}
+			if u := line[i+1 : i+end]; strings.Contains(u, "://") || strings.HasPrefix(u, "mailto:") {
+				links = append(links, mdLink{text: u, target: u})
+				i += end
+			}
+		case c == '[':
+			end := matching(i, '[', ']')
+			if end < 0 {
+				continue
+			}
+			image := i > 0 && line[i-1] == '!'
+			text := line[i+1 : end]
+			target, next := "", end
+			switch {
+			case end+1 < len(line) && line[end+1] == '(':
+				if close := matching(end+1, '(', ')'); close >= 0 {
+					if f := strings.Fields(line[end+2 : close]); len(f) > 0 {
+						target = strings.Trim(f[0], "<>")
+					}
+					next = close
+				}
+			case end+1 < len(line) && line[end+1] == '[':
+				if close := strings.IndexByte(line[end+1:], ']'); close >= 0 {
+					label := line[end+2 : end+1+close]
+					if label == "" {
+						label = text
+					}
+					target, next = refs[strings.ToLower(label)], end+1+close
+				}
+			default:
+				target = refs[strings.ToLower(text)]
+			}
+			if image || strings.HasPrefix(text, "^") {
+				// Images aren't followed, but a link inside the alt text is.
+				i = next
+				continue
+			}
+			if target != "" {
+				links = append(links, mdLink{text: markdownLinkText(text), target: target})
+				i = next
+			}
+		case c == 'h' && (strings.HasPrefix(line[i:], "https://") || strings.HasPrefix(line[i:], "http://")):
+			if i > 0 && line[i-1] != ' ' && line[i-1] != '(' && line[i-1] != '\t' {
+				continue
+			}
+			end := strings.IndexAny(line[i:], " \t)>\"")
+			if end < 0 {
+				end = len(line) - i
+			}
+			u := strings.TrimRight(line[i:i+end], ".,;:!?")
+			links = append(links, mdLink{text: u, target: u})
+			i += len(u) - 1
+		}
+	}
+	return links
+}
+
+// markdownLinkText is a link's text as the renderer shows it: emphasis,
+// code marks and nested images reduced to their words.
+func markdownLinkText(text string) string {
+	if strings.HasPrefix(text, "![") {
+		if end := strings.IndexByte(text, ']'); end > 0 {
+			text = text[2:end]
+		}
+	}
+	text = strings.NewReplacer("*", "", "`", "", "\\", "").Replace(text)
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// linkNeedle is the part of a link looked for in the rendered preview;
+// long text may wrap, so only its start is matched.
+func linkNeedle(l mdLink) string {
+	needle := l.text
+	if needle == "" {
+		needle = l.target
+	}
+	if r := []rune(needle); len(r) > 24 {
+		needle = string(r[:24])
+	}
+	return needle
+}
+
+// isExternalLink reports whether target is a URL for the system opener
+// rather than a path.
+func isExternalLink(target string) bool {
+	return strings.Contains(target, "://") || strings.HasPrefix(target, "mailto:")
+}
+
+// openMarkdownLinks starts picking among the links of the Markdown file at
+// path. It reports false, leaving the key to refresh the preview as it does
+// for other files, when the preview is still loading or there are no links.
+func (m *model) openMarkdownLinks(path string) (bool, error) {
+	if m.loading || m.preview == "" {
+		return false, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	links := parseMarkdownLinks(string(data))
+	if len(links) == 0 {
+		return false, nil
+	}
+	x := &markdownLinks{path: path, base: m.preview, links: links, lines: make([]int, len(links))}
+	plain := strings.Split(ansi.Strip(m.preview), "\n")
+	from := 0
+	for i, l := range links {
+		x.lines[i] = -1
+		for _, needle := range []string{linkNeedle(l), l.target} {
+			for n := from; n < len(plain); n++ {
+				if strings.Contains(plain[n], needle) {
+					x.lines[i], from = n, n
+					break
+				}
+			}
+			if x.lines[i] >= 0 {
+				break
+			}
+		}
+	}
+	// Start at the first link on screen.
+	for i, n := range x.lines {
+		if n >= m.previewOffset {
+			x.cursor = i
+			break
+		}
+	}
+	m.markdownLinks = x
+	m.renderMarkdownLinks()
+	return true, nil
+}
+
+func (m *model) updateMarkdownLinks(msg tea.KeyMsg) tea.Cmd {
+	x := m.markdownLinks
+	switch msg.String() {
+	case "esc", "q":
+		m.markdownLinks = nil
+		m.preview = x.base
+		m.scratch = ""
+		return nil
+	case "j", "down", "tab", "n":
+		x.cursor = (x.cursor + 1) % len(x.links)
+	case "k", "up", "shift+tab", "N":
+		x.cursor = (x.cursor + len(x.links) - 1) % len(x.links)
+	case "g", "home":
+		x.cursor = 0
+	case "G", "end":
+		x.cursor = len(x.links) - 1
+	case "enter", "l", "right":
+		return m.followMarkdownLink(x.links[x.cursor])
+	}
+	m.renderMarkdownLinks()
+	return nil
+}
+
+// followMarkdownLink opens a URL with the system opener, jumps to a heading
+// for a #fragment, or moves the selection to a linked file or directory.
+func (m *model) followMarkdownLink(l mdLink) tea.Cmd {
+	x := m.markdownLinks
+	if isExternalLink(l.target) {
+		cmd := systemOpener(l.target)
+		if err := cmd.Start(); err != nil {
+			m.setError("open: " + err.Error())
+			return nil
+		}
+		go cmd.Wait()
+		m.status = "opened " + l.target
+		return nil
+	}
+
+	target, fragment, _ := strings.Cut(l.target, "#")
+	target, _, _ = strings.Cut(target, "?")
+	if unescaped, err := url.PathUnescape(target); err == nil {
+		target = unescaped
+	}
+	if target == "" {
+		// An anchor in this document: find the heading it names.
+		for n, line := range strings.Split(ansi.Strip(x.base), "\n") {
+			heading := strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "#"))
+			if heading != "" && headingAnchor(heading) == strings.ToLower(fragment) {
+				m.previewOffset = n
+				m.status = "#" + fragment
+				return nil
+			}
+		}
+		m.status = "no heading for #" + fragment
+		return nil
+	}
+
+	switch {
+	case strings.HasPrefix(target, "/") && m.vcs != nil:
+		// Absolute links in a repository are relative to its root.
+		if _, err := os.Stat(filepath.Join(m.vcs.root, target)); err == nil {
+			target = filepath.Join(m.vcs.root, target)
+		}
+	case !filepath.IsAbs(target):
+		target = filepath.Join(filepath.Dir(x.path), target)
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		m.setError("link: " + err.Error())
+		return nil
+	}
+	m.markdownLinks = nil
+	dir := filepath.Dir(target)
+	if info.IsDir() {
+		dir = target
+	}
+	if err := m.changeDir(dir); err != nil {
+		m.setError(err.Error())
+		return nil
+	}
+	if !info.IsDir() {
+		m.selectPath(target)
+	}
+	return m.requestPreview()
+}
+
+// headingAnchor is the GitHub-style anchor of a heading: lower case, with
+// spaces as hyphens and other punctuation dropped.
+func headingAnchor(heading string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(heading) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_':
+			sb.WriteRune(r)
+		case r == ' ':
+			sb.WriteByte('-')
+		}
+	}
+	return sb.String()
+}
+
+// renderMarkdownLinks highlights the current link in the preview and
+// scrolls it into view.
+func (m *model) renderMarkdownLinks() {
+	x := m.markdownLinks
+	l := x.links[x.cursor]
+	lines := strings.Split(x.base, "\n")
+	if n := x.lines[x.cursor]; n >= 0 {
+		line := lines[n]
+		plain := ansi.Strip(line)
+		needle := linkNeedle(l)
+		if !strings.Contains(plain, needle) {
+			needle = l.target
+		}
+		if i := strings.Index(plain, needle); i >= 0 {
+			col, w := ansi.StringWidth(plain[:i]), ansi.StringWidth(needle)
+			sel := lipgloss.NewStyle().Background(clrAccent).Foreground(clrAccentFg).Bold(true)
+			lines[n] = ansi.Cut(line, 0, col) + sel.Render(needle) + ansi.Cut(line, col+w, ansi.StringWidth(line))
+		}
+		viewport := m.previewViewportHeight()
+		if n < m.previewOffset || n >= m.previewOffset+viewport {
+			m.previewOffset = max(0, n-viewport/3)
+		}
+	}
+	m.preview = strings.Join(lines, "\n")
+	m.scratch = fmt.Sprintf("link %d/%d → %s  ·  j/k move  ·  enter follow  ·  esc done", x.cursor+1, len(x.links), l.target)
+}
+
+// ── markdown outline ──────────────────────────────────────────────────────────
+
+// mdHeading is an ATX heading of a markdown document: its level, its text
+// and the source line it's on.
+type mdHeading struct {
+	level int
+	text  string
+	line  int
+}
+
+// frontMatterEnd is the first line after a document's front matter, or 0
+// if it has none.
+func frontMatterEnd(lines []string) int {
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) != "---" {
+		return 0
+	}
+	for i := 1; i < len(lines); i++ {
+		if t := strings.TrimSpace(lines[i]); t == "---" || t == "..." {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// markdownHeadings lists a document's headings, skipping front matter and
+// fenced code.
+func markdownHeadings(lines []string) []mdHeading {
+	var headings []mdHeading
+	fence := ""
+	for i := frontMatterEnd(lines); i < len(lines); i++ {
+		t := strings.TrimSpace(lines[i])
+		if fence != "" {
+			if strings.HasPrefix(t, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(t, "```") || strings.HasPrefix(t, "~~~") {
+			fence = t[:3]
+			continue
+		}
+		level := 0
+		for level < len(t) && t[level] == '#' {
+			level++
+		}
+		if level == 0 || level > 6 || level < len(t) && t[level] != ' ' {
+			continue
+		}
+		text := strings.TrimSpace(strings.TrimRight(strings.TrimSpace(t[level:]), "#"))
+		headings = append(headings, mdHeading{level: level, text: markdownLinkText(text), line: i})
+	}
+	return headings
+}
+
+// sectionEnd is the line after heading i's section: the next heading at
+// the same or a higher level, or the end of the document.
+func sectionEnd(headings []mdHeading, i, lineCount int) int {
+	for _, h := range headings[i+1:] {
+		if h.level <= headings[i].level {
+			return h.line
+		}
+	}
+	return lineCount
+}
+
+// hiddenHeadings marks the headings inside folded sections.
+func hiddenHeadings(headings []mdHeading, folded map[int]bool, lineCount int) []bool {
+	hidden := make([]bool, len(headings))
+	for i := range headings {
+		if !folded[i] || hidden[i] {
+			continue
+		}
+		end := sectionEnd(headings, i, lineCount)
+		for j := i + 1; j < len(headings) && headings[j].line < end; j++ {
+			hidden[j] = true
+		}
+	}
+	return hidden
+}
+
+// encodeFolds writes a set of folded heading indexes as preview options
+// can carry it: sorted and comma-separated.
+func encodeFolds(folded map[int]bool) string {
+	keys := make([]int, 0, len(folded))
+	for i := range folded {
+		keys = append(keys, i)
+	}
+	sort.Ints(keys)
+	parts := make([]string, len(keys))
+	for n, i := range keys {
+		parts[n] = strconv.Itoa(i)
+	}
+	return strings.Join(parts, ",")
+}
+
+// foldMarkdownSections replaces the body of each folded section with a
+// note of how many lines it holds, and marks its heading.
+func foldMarkdownSections(text, folds string) string {
+	if folds == "" {
+		return text
+	}
+	folded := make(map[int]bool)
+	for f := range strings.SplitSeq(folds, ",") {
+		if i, err := strconv.Atoi(f); err == nil {
+			folded[i] = true
+		}
+	}
+	lines := strings.Split(text, "\n")
+	headings := markdownHeadings(lines)
+	hidden := hiddenHeadings(headings, folded, len(lines))
+	skip := make([]bool, len(lines))
+	notes := make(map[int]int) // heading line → lines folded under it
+	for i, h := range headings {
+		if !folded[i] || hidden[i] {
+			continue
+		}
+		end := sectionEnd(headings, i, len(lines))
+		for l := h.line + 1; l < end; l++ {
+			skip[l] = true
+		}
+		n := end - h.line - 1
+		for n > 0 && strings.TrimSpace(lines[h.line+n]) == "" {
+			n--
+		}
+		notes[h.line] = n
+	}
+	out := make([]string, 0, len(lines))
+	for l, line := range lines {
+		if skip[l] {
+			continue
+		}
+		n, ok := notes[l]
+		if !ok {
+			out = append(out, line)
+			continue
+		}
+		out = append(out, line+" …", "", fmt.Sprintf("*⋯ %s folded*", countNoun(n, "line")), "")
+	}
+	return strings.Join(out, "\n")
+}
+
+// markdownOutline is set while the preview pane has focus for folding a
+// markdown document by heading. base is the preview as rendered, before
+// the cursor's heading is highlighted in it.
+type markdownOutline struct {
+	path     string
+	headings []mdHeading
+	lines    int // the document's line count
+	cursor   int
+	base     string
+}
+
+func (m *model) openMarkdownOutline(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(string(data), "\n")
+	headings := markdownHeadings(lines)
+	if len(headings) == 0 {
+		return errors.New("no headings in this file")
+	}
+	m.markdownOutline = &markdownOutline{path: path, headings: headings, lines: len(lines), base: m.preview}
+	m.renderMarkdownOutline()
+	return nil
+}
+
+func (m *model) updateMarkdownOutline(msg tea.KeyMsg) tea.Cmd {
+	o := m.markdownOutline
+	folded := m.markdownFolds[o.path]
+	hidden := hiddenHeadings(o.headings, folded, o.lines)
+	// step moves the cursor to the next visible heading in direction d.
+	step := func(d int) {
+		for i := o.cursor + d; i >= 0 && i < len(o.headings); i += d {
+			if !hidden[i] {
+				o.cursor = i
+				return
+			}
+		}
+	}
+	setFold := func(i int, fold bool) {
+		if m.markdownFolds == nil {
+			m.markdownFolds = make(map[string]map[int]bool)
+		}
+		if m.markdownFolds[o.path] == nil {
+			m.markdownFolds[o.path] = make(map[int]bool)
+		}
+		if fold {
+			m.markdownFolds[o.path][i] = true
+		} else {
+			delete(m.markdownFolds[o.path], i)
+		}
+	}
+	switch msg.String() {
+	case "esc", "q", "O":
+		m.markdownOutline = nil
+		m.preview = o.base
+		m.scratch = ""
+		return nil
+	case "j", "down":
+		step(1)
+	case "k", "up":
+		step(-1)
+	case "g", "home":
+		o.cursor = 0
+	case "G", "end":
+		o.cursor = len(o.headings)
+		step(-1)
+	case "enter", " ", "tab":
+		setFold(o.cursor, !folded[o.cursor])
+		return m.requestPreview()
+	case "l", "right":
+		if folded[o.cursor] {
+			setFold(o.cursor, false)
+			return m.requestPreview()
+		}
+	case "h", "left":
+		if !folded[o.cursor] {
+			setFold(o.cursor, true)
+			return m.requestPreview()
+		}
+		// Already folded: move to the enclosing heading.
+		for i := o.cursor - 1; i >= 0; i-- {
+			if o.headings[i].level < o.headings[o.cursor].level {
+				o.cursor = i
+				break
+			}
+		}
+	case "H":
+		for i := range o.headings {
+			setFold(i, true)
+		}
+		// Only the outermost headings still show; keep the cursor on one.
+		hidden := hiddenHeadings(o.headings, m.markdownFolds[o.path], o.lines)
+		for o.cursor > 0 && hidden[o.cursor] {
+			o.cursor--
+		}
+		return m.requestPreview()
+	case "L":
+		delete(m.markdownFolds, o.path)
+		return m.requestPreview()
+	}
+	m.renderMarkdownOutline()
+	return nil
+}
+
+// renderMarkdownOutline highlights the cursor's heading in the preview and
+// scrolls it into view.
+func (m *model) renderMarkdownOutline() {
+	o := m.markdownOutline
+	lines := strings.Split(o.base, "\n")
+	hidden := hiddenHeadings(o.headings, m.markdownFolds[o.path], o.lines)
+	// Find each visible heading in turn, so repeated titles resolve in order.
+	at := -1
+	from := 0
+	for i, h := range o.headings {
+		if hidden[i] {
+			continue
+		}
+		needle := linkNeedle(mdLink{text: h.text})
+		for n := from; n < len(lines); n++ {
+			if strings.Contains(ansi.Strip(lines[n]), needle) {
+				from = n + 1
+				if i == o.cursor {
+					at = n
+				}
+				break
+			}
+		}
+		if i == o.cursor {
+			break
+		}
+	}
+	if at >= 0 {
+		sel := lipgloss.NewStyle().Background(clrAccent).Foreground(clrAccentFg).Bold(true)
+		lines[at] = sel.Render(ansi.Strip(lines[at]))
+		viewport := m.previewViewportHeight()
+		if at < m.previewOffset || at >= m.previewOffset+viewport {
+			m.previewOffset = max(0, at-viewport/3)
+		}
+	}
+	m.preview = strings.Join(lines, "\n")
+	state := "open"
+	if m.markdownFolds[o.path][o.cursor] {
+		state = "folded"
+	}
+	m.scratch = fmt.Sprintf("heading %d/%d (%s)  ·  enter fold/unfold  ·  H/L all  ·  esc done", o.cursor+1, len(o.headings), state)
+}
+
+// ── presentation ──────────────────────────────────────────────────────────────
+
+// splitSlides cuts a markdown document into slides at --- rules standing
+// on their own, or, without any, before each of its top-level headings.
+// Front matter stays with the first slide, which renders it as a title.
+func splitSlides(markdown string) []string {
+	lines := strings.Split(markdown, "\n")
+	start := frontMatterEnd(lines)
+	cuts := []int{}
+	skip := make(map[int]bool) // rule lines, dropped from the slides
+	fence := ""
+	for i := start; i < len(lines); i++ {
+		t := strings.TrimSpace(lines[i])
+		if fence != "" {
+			if strings.HasPrefix(t, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(t, "```") || strings.HasPrefix(t, "~~~") {
+			fence = t[:3]
+			continue
+		}
+		// Under a line of text, --- underlines a heading instead.
+		if t == "---" && (i == start || strings.TrimSpace(lines[i-1]) == "") {
+			cuts = append(cuts, i)
+			skip[i] = true
+		}
+	}
+	if len(cuts) == 0 {
+		headings := markdownHeadings(lines)
+		// Split at the shallowest level that occurs more than once, so a
+		// lone title heading opens the first slide.
+		level := 0
+		for l := 1; l <= 6 && level == 0; l++ {
+			n := 0
+			for _, h := range headings {
+				if h.level <= l {
+					n++
+				}
+			}
+			if n > 1 {
+				level = l
+			}
+		}
+		for _, h := range headings {
+			if h.level <= level && h.line > start {
+				cuts = append(cuts, h.line)
+			}
+		}
+	}
+	// Cuts with nothing but front matter before them would leave it a
+	// slide of its own.
+	for len(cuts) > 0 && strings.TrimSpace(strings.Join(lines[start:cuts[0]], "")) == "" {
+		cuts = cuts[1:]
+	}
+	var slides []string
+	from := 0
+	for _, cut := range append(cuts, len(lines)) {
+		var body []string
+		for i := from; i < cut; i++ {
+			if !skip[i] {
+				body = append(body, lines[i])
+			}
+		}
+		if slide := strings.Join(body, "\n"); strings.TrimSpace(slide) != "" {
+			slides = append(slides, slide)
+		}
+		from = cut
+	}
+	return slides
+}
+
+// presentation shows a markdown document full-screen, a slide at a time.
+// rendered is the current slide as drawn at the screen's width, and
+// offset how far it is scrolled when it's taller than the screen.
+type presentation struct {
+	path     string
+	slides   []string
+	index    int
+	rendered []string
+	offset   int
+	// cache holds the slides rendered at width by index; a nil entry is
+	// still being rendered.
+	width int
+	cache map[int][]string
+}
+
+// slideRenderedMsg delivers a slide rendered in the background.
+type slideRenderedMsg struct {
+	p     *presentation
+	index int
+	width int
+	lines []string
+}
+
+func (m *model) openPresentation(path string) (tea.Cmd, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	slides := splitSlides(strings.ToValidUTF8(string(data), "�"))
+	if len(slides) == 0 {
+		return nil, errors.New("nothing to present")
+	}
+	m.presentation = &presentation{path: path, slides: slides}
+	return m.showSlide(), nil
+}
+
+func (m *model) updatePresentation(msg tea.KeyMsg) tea.Cmd {
+	p := m.presentation
+	index := p.index
+	switch msg.String() {
+	case "esc", "q", "alt+p":
+		m.presentation = nil
+		return nil
+	case "right", "l", "n", " ", "pgdown", "enter":
+		index++
+	case "left", "h", "p", "N", "pgup", "backspace":
+		index--
+	case "g", "home":
+		index = 0
+	case "G", "end":
+		index = len(p.slides) - 1
+	case "j", "down":
+		p.offset = min(p.offset+1, max(0, len(p.rendered)-m.slideHeight()))
+	case "k", "up":
+		p.offset = max(0, p.offset-1)
+	}
+	if index = max(0, min(index, len(p.slides)-1)); index != p.index {
+		p.index = index
+		return m.showSlide()
+	}
+	return nil
+}
+
+// slideHeight is the number of rows a slide has, above the footer.
+func (m model) slideHeight() int {
+	return max(1, m.height-2)
+}
+
+// showSlide shows the current slide at the screen's size. Slides are
+// rendered in the background and cached, and the next one is rendered ahead.
+func (m *model) showSlide() tea.Cmd {
+	p := m.presentation
+	width := min(100, max(24, m.width-8))
+	if width != p.width || p.cache == nil {
+		p.width, p.cache = width, make(map[int][]string)
+	}
+	p.rendered = p.cache[p.index]
+	p.offset = 0
+	var cmds []tea.Cmd
+	for _, i := range []int{p.index, p.index + 1} {
+		if _, ok := p.cache[i]; ok || i >= len(p.slides) {
+			continue
+		}
+		p.cache[i] = nil
+		slide, dir := p.slides[i], filepath.Dir(p.path)
+		cmds = append(cmds, func() tea.Msg {
+			return slideRenderedMsg{p: p, index: i, width: width, lines: renderSlide(slide, dir, width)}
+		})
+	}
+	return tea.Batch(cmds...)
+}
+
+// showRenderedSlide caches a slide rendered in the background, showing it
+// if it is the current one.
+func (m *model) showRenderedSlide(msg slideRenderedMsg) {
+	p := m.presentation
+	if p != msg.p || p.width != msg.width {
+		return
+	}
+	p.cache[msg.index] = msg.lines
+	if msg.index == p.index {
+		p.rendered = msg.lines
+	}
+}
+
+// renderSlide renders one slide as lines of at most width cells.
+func renderSlide(slide, dir string, width int) []string {
+	out := renderMarkdownPreview(slide, dir, width, false)
+	lines := strings.Split(strings.Trim(out, "\n"), "\n")
+	// glamour pads every line to the full width; trim that so the slide
+	// centres on its text.
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+	}
+	for len(lines) > 0 && strings.TrimSpace(ansi.Strip(lines[len(lines)-1])) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// renderPresentation draws the current slide centred on the screen, with
+// a footer showing where the deck is.
+func (m model) renderPresentation() string {
+	p := m.presentation
+	h := m.slideHeight()
+	lines := p.rendered[min(p.offset, len(p.rendered)):]
+	if len(lines) > h {
+		lines = lines[:h]
+	}
+	slide := lipgloss.Place(m.width, h+1, lipgloss.Center, lipgloss.Center, strings.Join(lines, "\n"))
+
+	muted := lipgloss.NewStyle().Foreground(clrMuted)
+	left := fmt.Sprintf(" %d / %d  ·  %s", p.index+1, len(p.slides), filepath.Base(p.path))
+	if p.offset+h < len(p.rendered) {
+		left += "  ·  ↓ more"
+	}
+	right := "←/→ slides  ·  j/k scroll  ·  esc done "
+	gap := max(1, m.width-ansi.StringWidth(left)-ansi.StringWidth(right))
+	footer := muted.Render(trimVisual(left+strings.Repeat(" ", gap)+right, m.width))
+	return slide + "\n" + footer
+}
+
+// ── image zoom ────────────────────────────────────────────────────────────────
+
+const maxImageZoom = 16
+
+// imageZoom is a magnified view of an image: factor times the fitted size,
+// centred on (x, y) as fractions of the image's width and height.
+type imageZoom struct {
+	path   string
+	factor int
+	x, y   float64
+}
+
+// clamp keeps the view inside the image.
+func (z *imageZoom) clamp() {
+	half := 0.5 / float64(z.factor)
+	z.x = math.Max(half, math.Min(1-half, z.x))
+	z.y = math.Max(half, math.Min(1-half, z.y))
+}
+
+// crop is the part of an image with bounds b that the view shows.
+func (z imageZoom) crop(b image.Rectangle) image.Rectangle {
+	w, h := max(1, b.Dx()/z.factor), max(1, b.Dy()/z.factor)
+	x0 := b.Min.X + int(z.x*float64(b.Dx())) - w/2
+	y0 := b.Min.Y + int(z.y*float64(b.Dy())) - h/2
+	x0 = max(b.Min.X, min(x0, b.Max.X-w))
+	y0 = max(b.Min.Y, min(y0, b.Max.Y-h))
+	return image.Rect(x0, y0, x0+w, y0+h)
+}
+
+// zoomImage multiplies the selected image's zoom by by (a fraction zooms
+// out); zooming out to the fitted view ends zoom mode.
+func (m *model) zoomImage(by float64) tea.Cmd {
+	if len(m.entries) == 0 {
+		return nil
+	}
+	picked := m.entries[m.selected]
+	if picked.isDir || !imageExts[strings.ToLower(filepath.Ext(picked.name))] {
+		return nil
+	}
+	z := m.imageZoom
+	if z == nil {
+		z = &imageZoom{path: picked.path, factor: 1, x: 0.5, y: 0.5}
+	}
+	z.factor = min(maxImageZoom, int(float64(z.factor)*by))
+	if z.factor <= 1 {
+		m.imageZoom = nil
+		m.status = "zoom: fit"
+		return m.requestPreview()
+	}
+	z.clamp()
+	m.imageZoom = z
+	m.status = fmt.Sprintf("zoom: %d× · arrows pan · - out · 0 fit", z.factor)
+	return m.requestPreview()
+}
+
+// updateImageZoom handles keys while an image is zoomed. Keys it doesn't
+// use fall through to the normal bindings.
+func (m *model) updateImageZoom(msg tea.KeyMsg) (tea.Cmd, bool) {
+	z := m.imageZoom
+	// Each arrow press moves a quarter of the visible area.
+	step := 0.25 / float64(z.factor)
+	switch msg.String() {
+	case "+", "=":
+		return m.zoomImage(2), true
+	case "-":
+		return m.zoomImage(0.5), true
+	case "0", "esc":
+		m.imageZoom = nil
+		m.status = "zoom: fit"
+		return m.requestPreview(), true
+	case "left":
+		z.x -= step
+	case "right":
+		z.x += step
+	case "up":
+		z.y -= step
+	case "down":
+		z.y += step
+	default:
+		return nil, false
+	}
+	z.clamp()
+	return m.requestPreview(), true
+}
+
+// decodedImage caches the last image decoded for the preview, so panning
+// and zooming don't decode it again.
+var decodedImage struct {
+	sync.Mutex
+	path    string
+	modTime time.Time
+	img     image.Image
+}
+
+// decodeImage decodes an image file, through an external converter for
+// formats Go can't read.
+func decodeImage(path string, modTime time.Time) (image.Image, error) {
+	decodedImage.Lock()
+	defer decodedImage.Unlock()
+	if decodedImage.img != nil && decodedImage.path == path && decodedImage.modTime.Equal(modTime) {
+		return decodedImage.img, nil
+	}
+
+	img, err := decodeImageFile(path)
+	if err != nil {
+		if _, ok := convertedImageExts[strings.ToLower(filepath.Ext(path))]; !ok || errors.Is(err, errImageTooLarge) {
+			return nil, err
+		}
+		if img, err = convertImage(path); err != nil {
+			return nil, err
+		}
+	}
+	decodedImage.path, decodedImage.modTime, decodedImage.img = path, modTime, img
+	return img, nil
+}
+
+// ── GIF animation ─────────────────────────────────────────────────────────────
+
+const (
+	maxGIFFrames    = 500
+	defaultGIFDelay = 100 * time.Millisecond
+	minimumGIFDelay = 20 * time.Millisecond
+	// maxGIFPixels bounds an animation's frames × canvas size; the frames
+	// within it are shown and the rest dropped.
+	maxGIFPixels = 200_000_000
+)
+
+// gifAnimation holds the pre-rendered frames of the selected GIF. It is
+// replaced, not reset, when the selection or pane size changes, so messages
+// for an old animation are recognised by pointer and dropped.
+type gifAnimation struct {
+	path          string
+	width, height int
+	frames        []string
+	delays        []time.Duration
+	frame         int
+}
+
+type gifFramesMsg struct {
+	anim   *gifAnimation
+	frames []string
+	delays []time.Duration
+}
+
+type gifTickMsg struct{ anim *gifAnimation }
+
+func gifTick(a *gifAnimation, delay time.Duration) tea.Cmd {
+	return tea.Tick(delay, func(time.Time) tea.Msg { return gifTickMsg{anim: a} })
+}
+
+// startGIF decodes the frames of a selected animated GIF in the background.
+// The still preview shows the first frame until they arrive.
+func (m *model) startGIF(picked entry, width, height int) tea.Cmd {
+	if picked.isDir || strings.ToLower(filepath.Ext(picked.name)) != ".gif" {
+		return nil
+	}
+	if m.imageZoom != nil {
+		m.gifAnim = nil // a zoomed GIF shows its first frame
+		return nil
+	}
+	if a := m.gifAnim; a != nil && a.width == width && a.height == height {
+		return nil // already animating, or decoding
+	}
+	a := &gifAnimation{path: picked.path, width: width, height: height}
+	m.gifAnim = a
+	return func() tea.Msg {
+		frames, delays, _ := renderGIFFrames(a.path, width, height)
+		return gifFramesMsg{anim: a, frames: frames, delays: delays}
+	}
+}
+
+// renderGIFFrames composites each frame of a GIF, honouring disposal
+// methods, and renders it for the preview pane. Frames are decoded one at a
+// time, stopping at maxGIFFrames or once maxGIFPixels is spent.
+func renderGIFFrames(path string, width, height int) ([]string, []time.Duration, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	if err := checkImageSize(f); err != nil {
+		return nil, nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	g, err := newGIFFrameReader(f)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	bounds := image.Rect(0, 0, g.width, g.height)
+	var canvas *image.RGBA
+	var frames []string
+	var delays []time.Duration
+	for spent := int64(0); len(frames) < maxGIFFrames; {
+		fr, err := g.next()
+		if err != nil {
+			break // show the frames read so far
+		}
+		if canvas == nil {
+			if bounds.Empty() {
+				bounds = fr.bounds
+			}
+			canvas = image.NewRGBA(bounds)
+		}
+		if spent += int64(bounds.Dx()) * int64(bounds.Dy()); spent > maxGIFPixels {
+			break
+		}
+		frame, err := gif.Decode(bytes.NewReader(fr.data))
+		if err != nil {
+			break
+		}
+		var saved *image.RGBA
+		if fr.disposal == gif.DisposalPrevious {
+			saved = image.NewRGBA(bounds)
+			copy(saved.Pix, canvas.Pix)
+		}
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		frames = append(frames, renderImageASCII(canvas, width, height))
+
+		// Delays are in hundredths of a second; browsers treat tiny ones
+		// as the default, and so do we.
+		delay := defaultGIFDelay
+		if d := time.Duration(fr.delay) * 10 * time.Millisecond; d >= minimumGIFDelay {
+			delay = d
+		}
+		delays = append(delays, delay)
+
+		switch fr.disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = saved
+		}
+	}
+	if len(frames) < 2 {
+		return nil, nil, nil
+	}
+	return frames, delays, nil
+}
+
+// gifFrameReader splits a GIF stream into single-frame GIFs, each the
+// stream's header followed by one frame, so the frames can be decoded one
+// at a time rather than all held at once.
+type gifFrameReader struct {
+	r             *bufio.Reader
+	header        []byte // signature, screen descriptor and global palette
+	width, height int
+}
+
+// gifFrame is one frame of a GIF as a standalone GIF file.
+type gifFrame struct {
+	data     []byte
+	bounds   image.Rectangle
+	delay    int // hundredths of a second
+	disposal byte
+}
+
+func newGIFFrameReader(r io.Reader) (*gifFrameReader, error) {
+	g := &gifFrameReader{r: bufio.NewReader(r), header: make([]byte, 13)}
+	if _, err := io.ReadFull(g.r, g.header); err != nil || !bytes.HasPrefix(g.header, []byte("GIF8")) {
+		return nil, errors.New("not a GIF")
+	}
+	g.width = int(binary.LittleEndian.Uint16(g.header[6:]))
+	g.height = int(binary.LittleEndian.Uint16(g.header[8:]))
+	if flags := g.header[10]; flags&0x80 != 0 {
+		palette := make([]byte, 3<<(flags&7+1))
+		if _, err := io.ReadFull(g.r, palette); err != nil {
+			return nil, err
+		}
+		g.header = append(g.header, palette...)
+	}
+	return g, nil
+}
+
+// next returns the following frame, or io.EOF after the last.
+func (g *gifFrameReader) next() (gifFrame, error) {
+	var fr gifFrame
+	var control []byte // the graphic control extension for this frame
+	for {
+		kind, err := g.r.ReadByte()
+		if err != nil {
+			return fr, err
+		}
+		switch kind {
+		case 0x3b: // trailer
+			return fr, io.EOF
+		case 0x21: // extension
+			label, err := g.r.ReadByte()
+			if err != nil {
+				return fr, err
+			}
+			body, err := g.subBlocks(1 << 20)
+			if err != nil {
+				return fr, err
+			}
+			if label == 0xf9 && len(body) >= 5 && body[0] == 4 {
+				control = append([]byte{0x21, 0xf9}, body...)
+				fr.disposal = body[1] >> 2 & 7
+				fr.delay = int(binary.LittleEndian.Uint16(body[2:]))
+			}
+		case 0x2c: // image descriptor
+			desc := make([]byte, 9)
+			if _, err := io.ReadFull(g.r, desc); err != nil {
+				return fr, err
+			}
+			x, y := int(binary.LittleEndian.Uint16(desc)), int(binary.LittleEndian.Uint16(desc[2:]))
+			w, h := int(binary.LittleEndian.Uint16(desc[4:])), int(binary.LittleEndian.Uint16(desc[6:]))
+			fr.bounds = image.Rect(x, y, x+w, y+h)
+			var palette []byte
+			if flags := desc[8]; flags&0x80 != 0 {
+				palette = make([]byte, 3<<(flags&7+1))
+				if _, err := io.ReadFull(g.r, palette); err != nil {
+					return fr, err
+				}
+			}
+			codeSize, err := g.r.ReadByte()
+			if err != nil {
+				return fr, err
+			}
+			// LZW codes are at most 12 bits, so valid data is well
+			// within two bytes a pixel.
+			pixels, err := g.subBlocks(2*w*h + 1<<10)
+			if err != nil {
+				return fr, err
+			}
+			fr.data = slices.Concat(g.header, control, []byte{0x2c}, desc, palette, []byte{codeSize}, pixels, []byte{0x3b})
+			return fr, nil
+		default:
+			return fr, fmt.Errorf("gif: unknown block 0x%02x", kind)
+		}
+	}
+}
+
+// subBlocks reads a chain of data sub-blocks, length bytes included, up to
+// its terminator, refusing one longer than limit.
+func (g *gifFrameReader) subBlocks(limit int) ([]byte, error) {
+	var out []byte
+	for {
+		n, err := g.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+		if n == 0 {
+			return out, nil
+		}
+		if len(out)+int(n) > limit {
+			return nil, errors.New("gif: block too long")
+		}
+		block := make([]byte, n)
+		if _, err := io.ReadFull(g.r, block); err != nil {
+			return nil, err
+		}
+		out = append(out, block...)
+	}
+}
+
+// ── video ─────────────────────────────────────────────────────────────────────
+
+var videoExts = map[string]bool{
+	".mp4": true, ".m4v": true, ".mkv": true, ".mov": true, ".webm": true, ".avi": true,
+}
+
+// probeStream is the part of an ffprobe stream entry the preview shows.
+type probeStream struct {
+	CodecType  string `json:"codec_type"`
+	CodecName  string `json:"codec_name"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	FrameRate  string `json:"avg_frame_rate"`
+	SampleRate string `json:"sample_rate"`
+	Channels   int    `json:"channels"`
+	Tags       struct {
+		Language string `json:"language"`
+	} `json:"tags"`
+}
+
+// probeResult is ffprobe's -show_format -show_streams output.
+type probeResult struct {
+	Streams []probeStream `json:"streams"`
+	Format  struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		BitRate    string `json:"bit_rate"`
+	} `json:"format"`
+}
+
+// probeMedia runs ffprobe on a file.
+func probeMedia(path string) (probeResult, error) {
+	var res probeResult
+	ctx, cancel := context.WithTimeout(context.Background(), previewerTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "ffprobe", "-v", "error", "-print_format", "json", "-show_format", "-show_streams", path).Output()
+	if err != nil {
+		return res, err
+	}
+	err = json.Unmarshal(out, &res)
+	return res, err
+}
+
+// mediaField writes a labelled line of media metadata.
+func mediaField(b *strings.Builder, name, value string) {
+	b.WriteString(lipgloss.NewStyle().Foreground(clrMuted).Render(fmt.Sprintf("%-10s", name)) + value + "\n")
+}
+
+// formatClock formats seconds as m:ss or h:mm:ss.
+func formatClock(seconds float64) string {
+	s := int(math.Round(seconds))
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+// renderVideoPreview shows a video's container, duration and streams from
+// ffprobe above a thumbnail of its middle frame from ffmpeg.
+func renderVideoPreview(path string, size int64, width, height int) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("video file: %s\nsize: %s\n", filepath.Base(path), humanSize(size)))
+	if !commandExists("ffprobe") {
+		b.WriteString("\nduration, streams and a thumbnail need ffmpeg (ffprobe)")
+		return b.String()
+	}
+	probe, err := probeMedia(path)
+	if err != nil {
+		b.WriteString(fmt.Sprintf("\nffprobe: %v", err))
+		return b.String()
+	}
+
+	duration, _ := strconv.ParseFloat(probe.Format.Duration, 64)
+	field := func(name, value string) { mediaField(&b, name, value) }
+	if duration > 0 {
+		field("duration", formatClock(duration))
+	}
+	if rate, err := strconv.ParseInt(probe.Format.BitRate, 10, 64); err == nil && rate > 0 {
+		field("bitrate", fmt.Sprintf("%d kb/s", rate/1000))
+	}
+	for _, s := range probe.Streams {
+		var parts []string
+		switch s.CodecType {
+		case "video":
+			parts = append(parts, s.CodecName, fmt.Sprintf("%d×%d", s.Width, s.Height))
+			if num, den, ok := strings.Cut(s.FrameRate, "/"); ok {
+				n, _ := strconv.ParseFloat(num, 64)
+				d, _ := strconv.ParseFloat(den, 64)
+				if n > 0 && d > 0 {
+					parts = append(parts, strconv.FormatFloat(math.Round(n/d*100)/100, 'f', -1, 64)+" fps")
+				}
+			}
+		case "audio":
+			parts = append(parts, s.CodecName)
+			if s.SampleRate != "" {
+				parts = append(parts, s.SampleRate+" Hz")
+			}
+			if s.Channels > 0 {
+				parts = append(parts, countNoun(s.Channels, "channel"))
+			}
+		case "subtitle":
+			parts = append(parts, s.CodecName)
+		default:
+			continue
+		}
+		if s.Tags.Language != "" && s.Tags.Language != "und" {
+			parts = append(parts, s.Tags.Language)
+		}
+		field(s.CodecType, strings.Join(parts, " · "))
+	}
+
+	// The thumbnail takes what's left of the pane.
+	used := strings.Count(b.String(), "\n") + 1
+	if !commandExists("ffmpeg") || height-used < 8 {
+		return strings.TrimRight(b.String(), "\n")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), previewerTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "ffmpeg", "-v", "error", "-ss", strconv.FormatFloat(duration/2, 'f', 2, 64),
+		"-i", path, "-frames:v", "1", "-f", "image2pipe", "-vcodec", "png", "-").Output()
+	if err != nil || len(out) == 0 {
+		return strings.TrimRight(b.String(), "\n")
+	}
+	if err := checkImageSize(bytes.NewReader(out)); err != nil {
+		return b.String() + "\n" + err.Error()
+	}
+	img, _, err := image.Decode(bytes.NewReader(out))
+	if err != nil {
+		return strings.TrimRight(b.String(), "\n")
+	}
+	b.WriteString("\n" + renderImageASCII(img, width, height-used))
+	return b.String()
+}
+
+// ── audio ─────────────────────────────────────────────────────────────────────
+
+var audioExts = map[string]bool{
+	".wav": true, ".flac": true, ".mp3": true, ".ogg": true, ".oga": true,
+	".opus": true, ".m4a": true, ".aac": true, ".aiff": true, ".aif": true, ".wma": true,
+}
+
+const (
+	// ffmpegWaveRate is the rate ffmpeg resamples to for the waveform;
+	// plenty for one column's peaks.
+	ffmpegWaveRate = 8000
+	maxWaveRows    = 12
+	// maxAudioDecodeBytes caps how much of a WAV or FLAC file is decoded
+	// natively; the waveform of a longer file covers its start.
+	maxAudioDecodeBytes = 64 << 20
+)
+
+// audioInfo describes a decoded audio stream.
+type audioInfo struct {
+	format     string
+	sampleRate int
+	channels   int
+	frames     int64
+}
+
+func (a audioInfo) duration() float64 {
+	if a.sampleRate == 0 {
+		return 0
+	}
+	return float64(a.frames) / float64(a.sampleRate)
+}
+
+// waveform accumulates per-column sample peaks over a stream whose length
+// in frames is known up front.
+type waveform struct {
+	lo, hi  []float64
+	clipped []bool
+	total   int64
+	n       int64
+	full    float64 // the level counted as clipping
+	peak    float64
+	clips   int64
+}
+
+func newWaveform(cols int, total int64, full float64) *waveform {
+	w := &waveform{lo: make([]float64, cols), hi: make([]float64, cols), clipped: make([]bool, cols), total: total, full: full}
+	for i := range w.lo {
+		w.lo[i], w.hi[i] = 1, -1
+	}
+	return w
+}
+
+// add records one frame of samples, each in [-1, 1].
+func (w *waveform) add(frame []float64) {
+	col := len(w.lo) - 1
+	if w.total > 0 {
+		col = int(w.n * int64(len(w.lo)) / w.total)
+	}
+	if col >= len(w.lo) {
+		col = len(w.lo) - 1
+	}
+	w.n++
+	for _, v := range frame {
+		w.lo[col] = math.Min(w.lo[col], v)
+		w.hi[col] = math.Max(w.hi[col], v)
+		w.peak = math.Max(w.peak, math.Abs(v))
+		if v >= w.full || v <= -1 {
+			w.clipped[col] = true
+			w.clips++
+		}
+	}
+}
+
+// renderAudioPreview shows an audio file's format and length above a
+// waveform. WAV and FLAC are decoded natively; anything else, or a file the
+// native decoders reject, goes through ffprobe and ffmpeg.
+func renderAudioPreview(path string, size int64, width, height int) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("audio file: %s\nsize: %s\n", filepath.Base(path), humanSize(size)))
+	cols := max(16, width-2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), previewerTimeout)
+	defer cancel()
+	var info audioInfo
+	var wave *waveform
+	err := errors.New("not decoded natively")
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".wav":
+		info, wave, err = decodeWAV(ctx, path, cols)
+	case ".flac":
+		info, wave, err = decodeFLAC(ctx, path, cols)
+	}
+	if err != nil {
+		if !commandExists("ffprobe") || !commandExists("ffmpeg") {
+			b.WriteString("\n" + err.Error() + "; other formats need ffmpeg")
+			return b.String()
+		}
+		if info, wave, err = decodeAudioFFmpeg(path, cols); err != nil {
+			b.WriteString("\n" + err.Error())
+			return b.String()
+		}
+	}
+
+	mediaField(&b, "format", info.format)
+	mediaField(&b, "rate", fmt.Sprintf("%d Hz · %s", info.sampleRate, countNoun(info.channels, "channel")))
+	mediaField(&b, "duration", formatClock(info.duration()))
+	if wave == nil {
+		return strings.TrimRight(b.String(), "\n")
+	}
+	if wave.peak > 0 {
+		mediaField(&b, "peak", fmt.Sprintf("%.1f dBFS", 20*math.Log10(wave.peak)))
+	} else {
+		mediaField(&b, "peak", "silent")
+	}
+	if wave.n < info.frames && wave.n > 0 {
+		mediaField(&b, "waveform", "first "+formatClock(float64(wave.n)/float64(info.sampleRate))+" decoded")
+	}
+	if wave.clips > 0 {
+		mediaField(&b, "clipping", lipgloss.NewStyle().Foreground(clrDanger).Render(fmt.Sprintf("%d samples at full scale", wave.clips)))
+	}
+
+	used := strings.Count(b.String(), "\n") + 2
+	rows := min(maxWaveRows, height-used-1)
+	if rows < 2 {
+		return strings.TrimRight(b.String(), "\n")
+	}
+	b.WriteString("\n" + renderWaveform(wave, rows))
+	axis := formatClock(0)
+	end := formatClock(info.duration())
+	b.WriteString("\n" + lipgloss.NewStyle().Foreground(clrDim).Render(axis+strings.Repeat(" ", max(1, cols-len(axis)-len(end)))+end))
+	return b.String()
+}
+
+// renderWaveform draws the column peaks with half blocks, two levels per row,
+// marking clipped columns.
+func renderWaveform(w *waveform, rows int) string {
+	levels := rows * 2
+	level := func(v float64) int {
+		return min(levels-1, max(0, int((1-v)/2*float64(levels))))
+	}
+	normal := lipgloss.NewStyle().Foreground(clrAccent)
+	clipped := lipgloss.NewStyle().Foreground(clrDanger)
+	lines := make([]strings.Builder, rows)
+	for c := range w.lo {
+		top, bottom := levels, -1
+		if w.lo[c] <= w.hi[c] {
+			top, bottom = level(w.hi[c]), level(w.lo[c])
+		}
+		style := normal
+		if w.clipped[c] {
+			style = clipped
+		}
+		for r := range lines {
+			upper := 2*r >= top && 2*r <= bottom
+			lower := 2*r+1 >= top && 2*r+1 <= bottom
+			switch {
+			case upper && lower:
+				lines[r].WriteString(style.Render("█"))
+			case upper:
+				lines[r].WriteString(style.Render("▀"))
+			case lower:
+				lines[r].WriteString(style.Render("▄"))
+			default:
+				lines[r].WriteByte(' ')
+			}
+		}
+	}
+	out := make([]string, rows)
+	for r := range lines {
+		out[r] = lines[r].String()
+	}
+	return strings.Join(out, "\n")
+}
+
+// decodeWAV reads a RIFF WAVE file of integer or float PCM, stopping after
+// maxAudioDecodeBytes of samples or when ctx is done.
+func decodeWAV(ctx context.Context, path string, cols int) (audioInfo, *waveform, error) {
+	var info audioInfo
+	f, err := os.Open(path)
+	if err != nil {
+		return info, nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReaderSize(f, 64<<10)
+
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil || string(header[:4]) != "RIFF" || string(header[8:]) != "WAVE" {
+		return info, nil, errors.New("not a RIFF WAVE file")
+	}
+	var format, depth, blockAlign int
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return info, nil, errors.New("WAVE file has no data chunk")
+		}
+		size := int64(binary.LittleEndian.Uint32(chunk[4:]))
+		switch string(chunk[:4]) {
+		case "fmt ":
+			if size < 16 {
+				return info, nil, errors.New("WAVE fmt chunk is too short")
+			}
+			if size > 1<<10 {
+				return info, nil, errors.New("WAVE fmt chunk is too long")
+			}
+			fmtChunk := make([]byte, size)
+			if _, err := io.ReadFull(r, fmtChunk); err != nil {
+				return info, nil, err
+			}
+			format = int(binary.LittleEndian.Uint16(fmtChunk))
+			info.channels = int(binary.LittleEndian.Uint16(fmtChunk[2:]))
+			info.sampleRate = int(binary.LittleEndian.Uint32(fmtChunk[4:]))
+			blockAlign = int(binary.LittleEndian.Uint16(fmtChunk[12:]))
+			depth = int(binary.LittleEndian.Uint16(fmtChunk[14:]))
+			if format == 0xfffe && size >= 26 {
+				// WAVE_FORMAT_EXTENSIBLE names the real format in its
+				// sub-format GUID.
+				format = int(binary.LittleEndian.Uint16(fmtChunk[24:]))
+			}
+		case "data":
+			if blockAlign == 0 || info.channels == 0 {
+				return info, nil, errors.New("WAVE data chunk before fmt")
+			}
+			if st, err := f.Stat(); err == nil && size > st.Size() {
+				size = st.Size() // streamed files leave the size unset
+			}
+			return readWAVData(ctx, r, info, format, depth, blockAlign, size, cols)
+		default:
+			if _, err := r.Discard(int(size + size%2)); err != nil {
+				return info, nil, errors.New("WAVE file has no data chunk")
+			}
+			continue
+		}
+		if size%2 == 1 {
+			r.Discard(1)
+		}
+	}
+}
+
+func readWAVData(ctx context.Context, r io.Reader, info audioInfo, format, depth, blockAlign int, size int64, cols int) (audioInfo, *waveform, error) {
+	width := depth / 8
+	switch {
+	case format == 1 && (depth == 8 || depth == 16 || depth == 24 || depth == 32):
+		info.format = fmt.Sprintf("WAV PCM %d-bit", depth)
+	case format == 3 && (depth == 32 || depth == 64):
+		info.format = fmt.Sprintf("WAV float %d-bit", depth)
+	default:
+		return info, nil, fmt.Errorf("unsupported WAVE encoding (format %d, %d-bit)", format, depth)
+	}
+	if width*info.channels > blockAlign {
+		return info, nil, errors.New("WAVE block alignment is too small")
+	}
+	info.frames = size / int64(blockAlign)
+	full := 1.0
+	if format == 1 {
+		full = 1 - 1/float64(int64(1)<<(depth-1))
+	}
+	wave := newWaveform(cols, info.frames, full)
+
+	block := make([]byte, blockAlign)
+	frame := make([]float64, info.channels)
+	limit := min64(info.frames, maxAudioDecodeBytes/int64(blockAlign))
+	for i := int64(0); i < limit; i++ {
+		if i%4096 == 0 && ctx.Err() != nil {
+			break
+		}
+		if _, err := io.ReadFull(r, block); err != nil {
+			break // a truncated file still shows what's there
+		}
+		for c := range frame {
+			s := block[c*width : (c+1)*width]
+			switch {
+			case format == 3 && depth == 32:
+				frame[c] = float64(math.Float32frombits(binary.LittleEndian.Uint32(s)))
+			case format == 3:
+				frame[c] = math.Float64frombits(binary.LittleEndian.Uint64(s))
+			case depth == 8:
+				frame[c] = (float64(s[0]) - 128) / 128
+			case depth == 16:
+				frame[c] = float64(int16(binary.LittleEndian.Uint16(s))) / (1 << 15)
+			case depth == 24:
+				frame[c] = float64(int32(uint32(s[0])<<8|uint32(s[1])<<16|uint32(s[2])<<24)>>8) / (1 << 23)
+			default:
+				frame[c] = float64(int32(binary.LittleEndian.Uint32(s))) / (1 << 31)
+			}
+		}
+		wave.add(frame)
+	}
+	return info, wave, nil
+}
+
+// decodeAudioFFmpeg probes the file and reads a mono, resampled stream from
+// ffmpeg for the waveform.
+func decodeAudioFFmpeg(path string, cols int) (audioInfo, *waveform, error) {
+	var info audioInfo
+	probe, err := probeMedia(path)
+	if err != nil {
+		return info, nil, fmt.Errorf("ffprobe: %v", err)
+	}
+	for _, s := range probe.Streams {
+		if s.CodecType == "audio" {
+			info.format = s.CodecName
+			info.sampleRate, _ = strconv.Atoi(s.SampleRate)
+			info.channels = s.Channels
+			break
+		}
+	}
+	if info.format == "" {
+		return info, nil, errors.New("no audio stream")
+	}
+	duration, _ := strconv.ParseFloat(probe.Format.Duration, 64)
+	info.frames = int64(duration * float64(info.sampleRate))
+	if duration <= 0 {
+		return info, nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), previewerTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-v", "error", "-i", path, "-ac", "1", "-ar", strconv.Itoa(ffmpegWaveRate), "-f", "s16le", "-")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return info, nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return info, nil, err
+	}
+	wave := newWaveform(cols, int64(math.Ceil(duration*ffmpegWaveRate)), 1-1.0/(1<<15))
+	r := bufio.NewReaderSize(out, 64<<10)
+	var sample [2]byte
+	frame := make([]float64, 1)
+	for {
+		if _, err := io.ReadFull(r, sample[:]); err != nil {
+			break
+		}
+		frame[0] = float64(int16(binary.LittleEndian.Uint16(sample[:]))) / (1 << 15)
+		wave.add(frame)
+	}
+	cmd.Wait()
+	return info, wave, nil
+}
+
+// flacBits reads a FLAC stream MSB first. Errors are sticky: once the data
+// runs out every read returns zero and err is set.
+type flacBits struct {
+	data []byte
+	pos  int
+	buf  uint64
+	n    uint
+	err  error
+}
+
+// read returns the next n (at most 56) bits.
+func (r *flacBits) read(n uint) uint64 {
+	for r.n < n {
+		if r.pos >= len(r.data) {
+			r.err = io.ErrUnexpectedEOF
+			return 0
+		}
+		r.buf = r.buf<<8 | uint64(r.data[r.pos])
+		r.pos++
+		r.n += 8
+	}
+	r.n -= n
+	return r.buf >> r.n & (1<<n - 1)
+}
+
+func (r *flacBits) signed(n uint) int64 {
+	v := r.read(n)
+	if n > 0 && v>>(n-1) == 1 {
+		return int64(v) - 1<<n
+	}
+	return int64(v)
+}
+
+// unary counts zero bits up to the next one bit.
+func (r *flacBits) unary() uint64 {
+	var q uint64
+	for r.err == nil {
+		if r.n == 0 {
+			if r.pos >= len(r.data) {
+				r.err = io.ErrUnexpectedEOF
+				break
+			}
+			r.buf, r.n = uint64(r.data[r.pos]), 8
+			r.pos++
+		}
+		if r.buf&(1<<r.n-1) == 0 {
+			q += uint64(r.n)
+			r.n = 0
+			continue
+		}
+		for r.buf>>(r.n-1)&1 == 0 {
+			q++
+			r.n--
+		}
+		r.n--
+		return q
+	}
+	return q
+}
+
+// align skips to the next byte boundary.
+func (r *flacBits) align() { r.n -= r.n % 8 }
+
+// decodeFLAC decodes a native FLAC stream from the first
+// maxAudioDecodeBytes of the file, stopping early when ctx is done.
+func decodeFLAC(ctx context.Context, path string, cols int) (audioInfo, *waveform, error) {
+	var info audioInfo
+	f, err := os.Open(path)
+	if err != nil {
+		return info, nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(f, maxAudioDecodeBytes))
+	f.Close()
+	if err != nil {
+		return info, nil, err
+	}
+	if len(data) < 4 || string(data[:4]) != "fLaC" {
+		return info, nil, errors.New("not a FLAC stream")
+	}
+	r := &flacBits{data: data, pos: 4}
+	bps := 0
+	for last := false; !last; {
+		last = r.read(1) == 1
+		kind := r.read(7)
+		length := int(r.read(24))
+		if r.err != nil || r.pos+length > len(data) {
+			return info, nil, errors.New("truncated FLAC metadata")
+		}
+		if kind == 0 && length >= 18 {
+			r.read(16 + 16) // block size bounds
+			r.read(24 + 24) // frame size bounds
+			info.sampleRate = int(r.read(20))
+			info.channels = int(r.read(3)) + 1
+			bps = int(r.read(5)) + 1
+			info.frames = int64(r.read(36))
+			r.pos += length - 18 // the MD5
+			continue
+		}
+		r.pos += length
+	}
+	if bps == 0 || info.sampleRate == 0 {
+		return info, nil, errors.New("FLAC stream has no STREAMINFO")
+	}
+	info.format = fmt.Sprintf("FLAC %d-bit", bps)
+	if info.frames == 0 {
+		return info, nil, errors.New("FLAC stream length unknown")
+	}
+
+	wave := newWaveform(cols, info.frames, 1-1/float64(int64(1)<<(bps-1)))
+	scale := float64(int64(1) << (bps - 1))
+	var channels [8][]int64
+	var frame []float64
+	for wave.n < info.frames && ctx.Err() == nil {
+		blockSize, samples, err := decodeFLACFrame(r, bps, info.sampleRate, &channels)
+		if err != nil {
+			break // show whatever decoded cleanly
+		}
+		if len(frame) != len(samples) {
+			frame = make([]float64, len(samples))
+		}
+		for i := 0; i < blockSize; i++ {
+			for c, ch := range samples {
+				frame[c] = float64(ch[i]) / scale
+			}
+			wave.add(frame)
+		}
+	}
+	return info, wave, nil
+}
+
+// decodeFLACFrame decodes one frame into per-channel buffers, reused across
+// frames, and returns its block size and channels.
+func decodeFLACFrame(r *flacBits, streamBPS, streamRate int, buffers *[8][]int64) (int, [][]int64, error) {
+	if r.read(14) != 0x3ffe {
+		return 0, nil, errors.New("lost FLAC frame sync")
+	}
+	r.read(2) // reserved, blocking strategy
+	sizeCode, rateCode := r.read(4), r.read(4)
+	assignment, bpsCode := r.read(4), r.read(3)
+	r.read(1)
+	// The frame or sample number, UTF-8 style.
+	first := r.read(8)
+	for extra := bits.LeadingZeros8(^uint8(first)); extra > 1; extra-- {
+		r.read(8)
+	}
+
+	var blockSize int
+	switch {
+	case sizeCode == 1:
+		blockSize = 192
+	case sizeCode >= 2 && sizeCode <= 5:
+		blockSize = 576 << (sizeCode - 2)
+	case sizeCode == 6:
+		blockSize = int(r.read(8)) + 1
+	case sizeCode == 7:
+		blockSize = int(r.read(16)) + 1
+	case sizeCode >= 8:
+		blockSize = 256 << (sizeCode - 8)
+	default:
+		return 0, nil, errors.New("reserved FLAC block size")
+	}
+	switch rateCode {
+	case 12:
+		r.read(8)
+	case 13, 14:
+		r.read(16)
+	}
+	bps := map[uint64]int{0: streamBPS, 1: 8, 2: 12, 4: 16, 5: 20, 6: 24, 7: 32}[bpsCode]
+	if bps == 0 {
+		return 0, nil, errors.New("reserved FLAC sample size")
+	}
+	r.read(8) // CRC-8
+
+	channels := int(assignment) + 1
+	if assignment >= 8 {
+		channels = 2
+		if assignment > 10 {
+			return 0, nil, errors.New("reserved FLAC channel assignment")
+		}
+	}
+	out := make([][]int64, channels)
+	for c := range out {
+		if cap(buffers[c]) < blockSize {
+			buffers[c] = make([]int64, blockSize)
+		}
+		out[c] = buffers[c][:blockSize]
+		subBPS := bps
+		// The side channel carries an extra bit.
+		if assignment == 8 && c == 1 || assignment == 9 && c == 0 || assignment == 10 && c == 1 {
+			subBPS++
+		}
+		if err := decodeFLACSubframe(r, out[c], subBPS); err != nil {
+			return 0, nil, err
+		}
+	}
+	r.align()
+	r.read(16) // CRC-16
+	if r.err != nil {
+		return 0, nil, r.err
+	}
+
+	left, right := out[0], out[len(out)-1]
+	for i := 0; i < blockSize && assignment >= 8; i++ {
+		switch assignment {
+		case 8: // left, side
+			right[i] = left[i] - right[i]
+		case 9: // side, right
+			left[i] += right[i]
+		case 10: // mid, side
+			mid := left[i]<<1 | right[i]&1
+			left[i], right[i] = (mid+right[i])>>1, (mid-right[i])>>1
+		}
+	}
+	return blockSize, out, nil
+}
+
+// flacFixedCoefficients are the fixed predictors, nearest sample first.
+var flacFixedCoefficients = [][]int64{{}, {1}, {2, -1}, {3, -3, 1}, {4, -6, 4, -1}}
+
+func decodeFLACSubframe(r *flacBits, out []int64, bps int) error {
+	r.read(1)
+	kind := r.read(6)
+	wasted := 0
+	if r.read(1) == 1 {
+		wasted = int(r.unary()) + 1
+		bps -= wasted
+	}
+	if bps < 1 {
+		return errors.New("bad FLAC wasted bits")
+	}
+
+	switch {
+	case kind == 0:
+		v := r.signed(uint(bps))
+		for i := range out {
+			out[i] = v
+		}
+	case kind == 1:
+		for i := range out {
+			out[i] = r.signed(uint(bps))
+		}
+	case kind >= 8 && kind <= 12:
+		order := int(kind - 8)
+		if order > len(out) {
+			return errors.New("bad FLAC predictor order")
+		}
+		for i := 0; i < order; i++ {
+			out[i] = r.signed(uint(bps))
+		}
+		if err := decodeFLACResidual(r, out, order); err != nil {
+			return err
+		}
+		predict(out, order, flacFixedCoefficients[order], 0)
+	case kind >= 32:
+		order := int(kind-32) + 1
+		if order > len(out) {
+			return errors.New("bad FLAC predictor order")
+		}
+		for i := 0; i < order; i++ {
+			out[i] = r.signed(uint(bps))
+		}
+		precision := uint(r.read(4)) + 1
+		if precision == 16 {
+			return errors.New("bad FLAC coefficient precision")
+		}
+		shift := r.signed(5)
+		if shift < 0 {
+			return errors.New("negative FLAC predictor shift")
+		}
+		coefs := make([]int64, order)
+		for i := range coefs {
+			coefs[i] = r.signed(precision)
+		}
+		if err := decodeFLACResidual(r, out, order); err != nil {
+			return err
+		}
+		predict(out, order, coefs, uint(shift))
+	default:
+		return errors.New("reserved FLAC subframe type")
+	}
+	if wasted > 0 {
+		for i := range out {
+			out[i] <<= wasted
+		}
+	}
+	return r.err
+}
+
+// predict adds the linear prediction from the preceding samples to the
+// residuals in out[order:].
+func predict(out []int64, order int, coefs []int64, shift uint) {
+	for i := order; i < len(out); i++ {
+		var sum int64
+		for j, c := range coefs {
+			sum += c * out[i-j-1]
+		}
+		out[i] += sum >> shift
+	}
+}
+
+// decodeFLACResidual reads Rice-coded residuals into out[order:].
+func decodeFLACResidual(r *flacBits, out []int64, order int) error {
+	paramBits, escape := uint(4), uint64(15)
+	switch r.read(2) {
+	case 0:
+	case 1:
+		paramBits, escape = 5, 31
+	default:
+		return errors.New("reserved FLAC residual coding")
+	}
+	partitionOrder := r.read(4)
+	partitions := 1 << partitionOrder
+	i := order
+	for p := 0; p < partitions; p++ {
+		n := len(out) >> partitionOrder
+		if p == 0 {
+			n -= order
+		}
+		if n < 0 || i+n > len(out) {
+			return errors.New("bad FLAC partition size")
+		}
+		k := r.read(paramBits)
+		if k == escape {
+			width := uint(r.read(5))
+			for end := i + n; i < end; i++ {
+				out[i] = r.signed(width)
+			}
+			continue
+		}
+		for end := i + n; i < end; i++ {
+			u := r.unary()<<k | r.read(uint(k))
+			out[i] = int64(u>>1) ^ -int64(u&1)
+		}
+		if r.err != nil {
+			return r.err
+		}
+	}
+	return r.err
+}
+
+// ── SVG ───────────────────────────────────────────────────────────────────────
+
+// svgPreview rasterises an SVG for the image renderer: with rsvg-convert or
+// ImageMagick when installed, otherwise with the built-in rasteriser, which
+// covers shapes, paths, transforms and flat fills and strokes but not text,
+// gradients or clipping.
+func svgPreview(path string, width, height int) (string, bool) {
+	// Match the canvas to the pane's aspect, two pixels per cell row, and
+	// supersample by two.
+	outW, outH := max(16, width-2), max(8, height-3)
+	canvasW, canvasH := outW*2, outH*4
+
+	img, err := rasterizeSVGCommand(path, canvasW, canvasH)
+	if err != nil {
+		data, readErr := os.ReadFile(path)
+		if readErr != nil {
+			return "", false
+		}
+		if img, err = rasterizeSVG(data, canvasW, canvasH); err != nil {
+			return "", false
+		}
+	}
+	rendered := renderImageASCII(img, width, height)
+	return rendered, rendered != ""
+}
+
+// rasterizeSVGCommand renders through an external tool, then letterboxes the
+// result onto a white canvas of the requested size.
+func rasterizeSVGCommand(path string, w, h int) (image.Image, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), previewerTimeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	switch {
+	case commandExists("rsvg-convert"):
+		cmd = exec.CommandContext(ctx, "rsvg-convert", "--keep-aspect-ratio", "-w", strconv.Itoa(w), "-h", strconv.Itoa(h), "-f", "png", path)
+	case commandExists("magick"):
+		cmd = exec.CommandContext(ctx, "magick", "-background", "none", path, "-resize", fmt.Sprintf("%dx%d", w, h), "png:-")
+	default:
+		return nil, errors.New("no SVG rasteriser installed")
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	src, _, err := image.Decode(bytes.NewReader(out))
+	if err != nil {
+		return nil, err
+	}
+	canvas := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(canvas, canvas.Bounds(), image.White, image.Point{}, draw.Src)
+	sb := src.Bounds()
+	at := image.Pt((w-sb.Dx())/2, (h-sb.Dy())/2)
+	draw.Draw(canvas, sb.Sub(sb.Min).Add(at), src, sb.Min, draw.Over)
+	return canvas, nil
+}
+
+func commandExists(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// svgMatrix is an affine transform [a b c d e f]: x' = ax + cy + e,
+// y' = bx + dy + f.
+type svgMatrix [6]float64
+
+var svgIdentity = svgMatrix{1, 0, 0, 1, 0, 0}
+
+func (m svgMatrix) mul(n svgMatrix) svgMatrix {
+	return svgMatrix{
+		m[0]*n[0] + m[2]*n[1], m[1]*n[0] + m[3]*n[1],
+		m[0]*n[2] + m[2]*n[3], m[1]*n[2] + m[3]*n[3],
+		m[0]*n[4] + m[2]*n[5] + m[4], m[1]*n[4] + m[3]*n[5] + m[5],
+	}
+}
+
+func (m svgMatrix) apply(x, y float64) (float64, float64) {
+	return m[0]*x + m[2]*y + m[4], m[1]*x + m[3]*y + m[5]
+}
+
+// scale is the transform's average linear scale, for stroke widths.
+func (m svgMatrix) scale() float64 {
+	return math.Sqrt(math.Abs(m[0]*m[3] - m[1]*m[2]))
+}
+
+// svgStyle is the inherited paint state of an element.
+type svgStyle struct {
+	fill, stroke  color.NRGBA
+	hasFill       bool
+	hasStroke     bool
+	strokeWidth   float64
+	opacity       float64
+	fillOpacity   float64
+	strokeOpacity float64
+	transform     svgMatrix
+}
+
+// svgSkipped elements hold no directly drawn shapes.
+var svgSkipped = map[string]bool{
+	"defs": true, "clipPath": true, "mask": true, "symbol": true, "linearGradient": true,
+	"radialGradient": true, "pattern": true, "title": true, "desc": true, "metadata": true,
+	"style": true, "text": true, "marker": true, "filter": true, "script": true,
+}
+
+// rasterizeSVG draws an SVG document onto a white w×h canvas, fitted and
+// centred as preserveAspectRatio's default would.
+func rasterizeSVG(data []byte, w, h int) (image.Image, error) {
+	canvas := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(canvas, canvas.Bounds(), image.White, image.Point{}, draw.Src)
+	raster := vector.NewRasterizer(w, h)
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	stack := []svgStyle{{
+		fill: color.NRGBA{A: 255}, hasFill: true, strokeWidth: 1,
+		opacity: 1, fillOpacity: 1, strokeOpacity: 1, transform: svgIdentity,
+	}}
+	root := true
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if svgSkipped[t.Name.Local] {
+				if err := dec.Skip(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			attrs := make(map[string]string, len(t.Attr))
+			for _, a := range t.Attr {
+				attrs[a.Name.Local] = a.Value
+			}
+			style := applySVGStyle(stack[len(stack)-1], attrs)
+			if root && t.Name.Local == "svg" {
+				style.transform = svgViewport(attrs, w, h).mul(style.transform)
+				root = false
+			}
+			stack = append(stack, style)
+			if subpaths := svgShape(t.Name.Local, attrs); len(subpaths) > 0 {
+				drawSVGShape(raster, canvas, subpaths, style)
+			}
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	if root {
+		return nil, errors.New("no svg element")
+	}
+	return canvas, nil
+}
+
+// svgViewport maps the root viewBox (or width × height) onto the canvas.
+func svgViewport(attrs map[string]string, w, h int) svgMatrix {
+	minX, minY := 0.0, 0.0
+	vw, vh := svgLength(attrs["width"]), svgLength(attrs["height"])
+	if vb := strings.FieldsFunc(attrs["viewBox"], func(r rune) bool { return r == ',' || unicode.IsSpace(r) }); len(vb) == 4 {
+		minX, minY = svgLength(vb[0]), svgLength(vb[1])
+		vw, vh = svgLength(vb[2]), svgLength(vb[3])
+	}
+	if vw <= 0 || vh <= 0 {
+		vw, vh = 300, 150 // the CSS default object size
+	}
+	s := math.Min(float64(w)/vw, float64(h)/vh)
+	offX := (float64(w) - vw*s) / 2
+	offY := (float64(h) - vh*s) / 2
+	return svgMatrix{s, 0, 0, s, offX - minX*s, offY - minY*s}
+}
+
+// applySVGStyle derives an element's style from its parent's and its
+// presentation attributes, with the style attribute taking precedence.
+func applySVGStyle(parent svgStyle, attrs map[string]string) svgStyle {
+	s := parent
+	props := make(map[string]string)
+	for _, k := range []string{"fill", "stroke", "stroke-width", "opacity", "fill-opacity", "stroke-opacity"} {
+		if v, ok := attrs[k]; ok {
+			props[k] = v
+		}
+	}
+	for _, decl := range strings.Split(attrs["style"], ";") {
+		if k, v, ok := strings.Cut(decl, ":"); ok {
+			props[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	for k, v := range props {
+		v = strings.TrimSpace(v)
+		switch k {
+		case "fill":
+			s.fill, s.hasFill = parseSVGColor(v)
+		case "stroke":
+			s.stroke, s.hasStroke = parseSVGColor(v)
+		case "stroke-width":
+			s.strokeWidth = svgLength(v)
+		case "opacity":
+			s.opacity *= svgLength(v)
+		case "fill-opacity":
+			s.fillOpacity = svgLength(v)
+		case "stroke-opacity":
+			s.strokeOpacity = svgLength(v)
+		}
+	}
+	if t, ok := attrs["transform"]; ok {
+		s.transform = parent.transform.mul(parseSVGTransform(t))
+	}
+	return s
+}
+
+// parseSVGColor reads hex, rgb() and named colours. none and unresolvable
+// paints such as gradients report false, except that url() paints fall back
+// to grey so gradient-filled shapes still show.
+func parseSVGColor(v string) (color.NRGBA, bool) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	switch {
+	case v == "" || v == "none" || v == "transparent":
+		return color.NRGBA{}, false
+	case v == "currentcolor":
+		return color.NRGBA{A: 255}, true
+	case strings.HasPrefix(v, "url("):
+		return color.NRGBA{R: 128, G: 128, B: 128, A: 255}, true
+	case strings.HasPrefix(v, "#"):
+		hex := v[1:]
+		if len(hex) == 3 {
+			hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+		}
+		n, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil || len(hex) != 6 {
+			return color.NRGBA{}, false
+		}
+		return color.NRGBA{R: uint8(n >> 16), G: uint8(n >> 8), B: uint8(n), A: 255}, true
+	case strings.HasPrefix(v, "rgb"):
+		open, end := strings.IndexByte(v, '('), strings.IndexByte(v, ')')
+		if open < 0 || end < open {
+			return color.NRGBA{}, false
+		}
+		parts := strings.FieldsFunc(v[open+1:end], func(r rune) bool { return r == ',' || r == '/' || unicode.IsSpace(r) })
+		if len(parts) < 3 {
+			return color.NRGBA{}, false
+		}
+		var c [4]uint8
+		c[3] = 255
+		for i, p := range parts[:min(len(parts), 4)] {
+			f := svgLength(p)
+			switch {
+			case strings.HasSuffix(p, "%"):
+				f = f / 100 * 255
+			case i == 3:
+				f *= 255
+			}
+			c[i] = uint8(math.Max(0, math.Min(255, f)))
+		}
+		return color.NRGBA{R: c[0], G: c[1], B: c[2], A: c[3]}, true
+	}
+	if c, ok := colornames.Map[v]; ok {
+		return color.NRGBA{R: c.R, G: c.G, B: c.B, A: 255}, true
+	}
+	return color.NRGBA{}, false
+}
+
+// svgLength parses a number, ignoring any unit.
+func svgLength(v string) float64 {
+	v = strings.TrimSpace(v)
+	end := 0
+	for end < len(v) && strings.IndexByte("+-.0123456789eE", v[end]) >= 0 {
+		end++
+	}
+	f, _ := strconv.ParseFloat(v[:end], 64)
+	return f
+}
+
+// parseSVGTransform composes a transform list such as
+// "translate(10 5) rotate(45) scale(2)".
+func parseSVGTransform(v string) svgMatrix {
+	m := svgIdentity
+	for {
+		open := strings.IndexByte(v, '(')
+		end := strings.IndexByte(v, ')')
+		if open < 0 || end < open {
+			return m
+		}
+		name := strings.TrimSpace(strings.Trim(v[:open], ", "))
+		var args []float64
+		for _, f := range strings.FieldsFunc(v[open+1:end], func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+			args = append(args, svgLength(f))
+		}
+		arg := func(i int, def float64) float64 {
+			if i < len(args) {
+				return args[i]
+			}
+			return def
+		}
+		var t svgMatrix
+		switch name {
+		case "matrix":
+			t = svgMatrix{arg(0, 1), arg(1, 0), arg(2, 0), arg(3, 1), arg(4, 0), arg(5, 0)}
+		case "translate":
+			t = svgMatrix{1, 0, 0, 1, arg(0, 0), arg(1, 0)}
+		case "scale":
+			sx := arg(0, 1)
+			t = svgMatrix{sx, 0, 0, arg(1, sx), 0, 0}
+		case "rotate":
+			a := arg(0, 0) * math.Pi / 180
+			cx, cy := arg(1, 0), arg(2, 0)
+			sin, cos := math.Sincos(a)
+			t = svgMatrix{1, 0, 0, 1, cx, cy}.mul(svgMatrix{cos, sin, -sin, cos, 0, 0}).mul(svgMatrix{1, 0, 0, 1, -cx, -cy})
+		case "skewX":
+			t = svgMatrix{1, 0, math.Tan(arg(0, 0) * math.Pi / 180), 1, 0, 0}
+		case "skewY":
+			t = svgMatrix{1, math.Tan(arg(0, 0) * math.Pi / 180), 0, 1, 0, 0}
+		default:
+			t = svgIdentity
+		}
+		m = m.mul(t)
+		v = v[end+1:]
+	}
+}
+
+// svgPoint is a point in user space.
+type svgPoint struct{ x, y float64 }
+
+// svgSubpath is a flattened polyline; closed ones also get a closing edge
+// when stroked.
+type svgSubpath struct {
+	points []svgPoint
+	closed bool
+}
+
+// svgShape flattens a basic shape or path into subpaths in user space.
+func svgShape(name string, attrs map[string]string) []svgSubpath {
+	num := func(k string) float64 { return svgLength(attrs[k]) }
+	ellipse := func(cx, cy, rx, ry float64) []svgSubpath {
+		if rx <= 0 || ry <= 0 {
+			return nil
+		}
+		const steps = 48
+		pts := make([]svgPoint, steps)
+		for i := range pts {
+			sin, cos := math.Sincos(2 * math.Pi * float64(i) / steps)
+			pts[i] = svgPoint{cx + rx*cos, cy + ry*sin}
+		}
+		return []svgSubpath{{points: pts, closed: true}}
+	}
+	switch name {
+	case "rect":
+		x, y, w, h := num("x"), num("y"), num("width"), num("height")
+		if w <= 0 || h <= 0 {
+			return nil
+		}
+		return []svgSubpath{{points: []svgPoint{{x, y}, {x + w, y}, {x + w, y + h}, {x, y + h}}, closed: true}}
+	case "circle":
+		return ellipse(num("cx"), num("cy"), num("r"), num("r"))
+	case "ellipse":
+		return ellipse(num("cx"), num("cy"), num("rx"), num("ry"))
+	case "line":
+		return []svgSubpath{{points: []svgPoint{{num("x1"), num("y1")}, {num("x2"), num("y2")}}}}
+	case "polyline", "polygon":
+		var pts []svgPoint
+		fields := strings.FieldsFunc(attrs["points"], func(r rune) bool { return r == ',' || unicode.IsSpace(r) })
+		for i := 0; i+1 < len(fields); i += 2 {
+			pts = append(pts, svgPoint{svgLength(fields[i]), svgLength(fields[i+1])})
+		}
+		return []svgSubpath{{points: pts, closed: name == "polygon"}}
+	case "path":
+		return parseSVGPath(attrs["d"])
+	}
+	return nil
+}
+
+// parseSVGPath flattens path data, converting curves and arcs to line
+// segments.
+func parseSVGPath(d string) []svgSubpath {
+	var paths []svgSubpath
+	var cur svgSubpath
+	var pos, start, ctrl svgPoint
+	var lastCmd byte
+	i := 0
+
+	skip := func() {
+		for i < len(d) && (d[i] == ',' || d[i] == ' ' || d[i] == '\t' || d[i] == '\n' || d[i] == '\r') {
+			i++
+		}
+	}
+	number := func() (float64, bool) {
+		skip()
+		j := i
+		if j < len(d) && (d[j] == '-' || d[j] == '+') {
+			j++
+		}
+		digits, dot := false, false
+		for j < len(d) {
+			c := d[j]
+			if c >= '0' && c <= '9' {
+				digits = true
+			} else if c == '.' && !dot {
+				dot = true
+			} else if (c == 'e' || c == 'E') && digits && j+1 < len(d) {
+				j++
+				if d[j] == '-' || d[j] == '+' {
+					j++
+				}
+				for j < len(d) && d[j] >= '0' && d[j] <= '9' {
+					j++
+				}
+				break
+			} else {
+				break
+			}
+			j++
+		}
+		if !digits {
+			return 0, false
+		}
+		f, err := strconv.ParseFloat(d[i:j], 64)
+		i = j
+		return f, err == nil
+	}
+	// flag reads an arc flag, which may be packed without separators.
+	flag := func() (float64, bool) {
+		skip()
+		if i < len(d) && (d[i] == '0' || d[i] == '1') {
+			i++
+			return float64(d[i-1] - '0'), true
+		}
+		return 0, false
+	}
+	numbers := func(n int) ([]float64, bool) {
+		out := make([]float64, n)
+		for k := range out {
+			v, ok := number()
+			if !ok {
+				return nil, false
+			}
+			out[k] = v
+		}
+		return out, true
+	}
+	lineTo := func(p svgPoint) {
+		if len(cur.points) == 0 {
+			cur.points = append(cur.points, pos)
+		}
+		cur.points = append(cur.points, p)
+		pos = p
+	}
+	cubic := func(c1, c2, end svgPoint) {
+		const steps = 16
+		p0 := pos
+		for s := 1; s <= steps; s++ {
+			t := float64(s) / steps
+			u := 1 - t
+			lineTo(svgPoint{
+				u*u*u*p0.x + 3*u*u*t*c1.x + 3*u*t*t*c2.x + t*t*t*end.x,
+				u*u*u*p0.y + 3*u*u*t*c1.y + 3*u*t*t*c2.y + t*t*t*end.y,
+			})
+		}
+	}
+	flush := func() {
+		if len(cur.points) > 1 {
+			paths = append(paths, cur)
+		}
+		cur = svgSubpath{}
+	}
+
+	for last := -1; ; {
+		skip()
+		if i >= len(d) || i == last {
+			// Stop at the end or at anything unparseable.
+			break
+		}
+		last = i
+		cmd := d[i]
+		if (cmd >= 'a' && cmd <= 'z' || cmd >= 'A' && cmd <= 'Z') && cmd != 'e' && cmd != 'E' {
+			i++
+		} else {
+			// Repeated coordinates reuse the last command; after a
+			// moveto they are linetos.
+			switch lastCmd {
+			case 0, 'z', 'Z':
+				return append(paths, cur)
+			case 'M':
+				cmd = 'L'
+			case 'm':
+				cmd = 'l'
+			default:
+				cmd = lastCmd
+			}
+		}
+		rel := cmd >= 'a' && cmd <= 'z'
+		abs := func(x, y float64) svgPoint {
+			if rel {
+				return svgPoint{pos.x + x, pos.y + y}
+			}
+			return svgPoint{x, y}
+		}
+		prevCmd := lastCmd
+		lastCmd = cmd
+		switch cmd {
+		case 'M', 'm':
+			v, ok := numbers(2)
+			if !ok {
+				flush()
+				return paths
+			}
+			flush()
+			pos = abs(v[0], v[1])
+			start = pos
+		case 'L', 'l':
+			v, ok := numbers(2)
+			if !ok {
+				break
+			}
+			lineTo(abs(v[0], v[1]))
+		case 'H', 'h':
+			v, ok := numbers(1)
+			if !ok {
+				break
+			}
+			x := v[0]
+			if rel {
+				x += pos.x
+			}
+			lineTo(svgPoint{x, pos.y})
+		case 'V', 'v':
+			v, ok := numbers(1)
+			if !ok {
+				break
+			}
+			y := v[0]
+			if rel {
+				y += pos.y
+			}
+			lineTo(svgPoint{pos.x, y})
+		case 'C', 'c':
+			v, ok := numbers(6)
+			if !ok {
+				break
+			}
+			c1, c2, end := abs(v[0], v[1]), abs(v[2], v[3]), abs(v[4], v[5])
+			cubic(c1, c2, end)
+			ctrl = c2
+		case 'S', 's':
+			v, ok := numbers(4)
+			if !ok {
+				break
+			}
+			c1 := pos
+			if strings.IndexByte("CcSs", prevCmd) >= 0 {
+				c1 = svgPoint{2*pos.x - ctrl.x, 2*pos.y - ctrl.y}
+			}
+			c2, end := abs(v[0], v[1]), abs(v[2], v[3])
+			cubic(c1, c2, end)
+			ctrl = c2
+		case 'Q', 'q', 'T', 't':
+			var q, end svgPoint
+			if cmd == 'Q' || cmd == 'q' {
+				v, ok := numbers(4)
+				if !ok {
+					break
+				}
+				q, end = abs(v[0], v[1]), abs(v[2], v[3])
+			} else {
+				v, ok := numbers(2)
+				if !ok {
+					break
+				}
+				q = pos
+				if strings.IndexByte("QqTt", prevCmd) >= 0 {
+					q = svgPoint{2*pos.x - ctrl.x, 2*pos.y - ctrl.y}
+				}
+				end = abs(v[0], v[1])
+			}
+			// Elevate the quadratic to a cubic.
+			p0 := pos
+			c1 := svgPoint{p0.x + 2.0/3*(q.x-p0.x), p0.y + 2.0/3*(q.y-p0.y)}
+			c2 := svgPoint{end.x + 2.0/3*(q.x-end.x), end.y + 2.0/3*(q.y-end.y)}
+			cubic(c1, c2, end)
+			ctrl = q
+		case 'A', 'a':
+			v, ok := numbers(3)
+			if !ok {
+				break
+			}
+			large, ok1 := flag()
+			sweep, ok2 := flag()
+			xy, ok3 := numbers(2)
+			if !ok1 || !ok2 || !ok3 {
+				break
+			}
+			end := abs(xy[0], xy[1])
+			for _, c := range svgArcToCubics(pos, end, v[0], v[1], v[2], large != 0, sweep != 0) {
+				cubic(c[0], c[1], c[2])
+			}
+		case 'Z', 'z':
+			cur.closed = true
+			pos = start
+			flush()
+		default:
+			return append(paths, cur)
+		}
+	}
+	flush()
+	return paths
+}
+
+// svgArcToCubics converts an SVG elliptical arc to cubic Bézier segments of
+// at most 90° each, following the SVG implementation notes (F.6.5).
+func svgArcToCubics(p0, p1 svgPoint, rx, ry, angle float64, large, sweep bool) [][3]svgPoint {
+	rx, ry = math.Abs(rx), math.Abs(ry)
+	if rx == 0 || ry == 0 || p0 == p1 {
+		return [][3]svgPoint{{p0, p1, p1}}
+	}
+	sinPhi, cosPhi := math.Sincos(angle * math.Pi / 180)
+	dx, dy := (p0.x-p1.x)/2, (p0.y-p1.y)/2
+	x1 := cosPhi*dx + sinPhi*dy
+	y1 := -sinPhi*dx + cosPhi*dy
+	if l := x1*x1/(rx*rx) + y1*y1/(ry*ry); l > 1 {
+		rx, ry = rx*math.Sqrt(l), ry*math.Sqrt(l)
+	}
+	num := rx*rx*ry*ry - rx*rx*y1*y1 - ry*ry*x1*x1
+	den := rx*rx*y1*y1 + ry*ry*x1*x1
+	coef := math.Sqrt(math.Max(0, num/den))
+	if large == sweep {
+		coef = -coef
+	}
+	cx1, cy1 := coef*rx*y1/ry, -coef*ry*x1/rx
+	cx := cosPhi*cx1 - sinPhi*cy1 + (p0.x+p1.x)/2
+	cy := sinPhi*cx1 + cosPhi*cy1 + (p0.y+p1.y)/2
+	if !svgFinite(rx, ry, cx, cy, x1, y1) {
+		// Radii so large the arithmetic overflows: draw a straight line.
+		return [][3]svgPoint{{p0, p1, p1}}
+	}
+
+	angleOf := func(ux, uy, vx, vy float64) float64 {
+		a := math.Atan2(ux*vy-uy*vx, ux*vx+uy*vy)
+		return a
+	}
+	theta := angleOf(1, 0, (x1-cx1)/rx, (y1-cy1)/ry)
+	delta := angleOf((x1-cx1)/rx, (y1-cy1)/ry, (-x1-cx1)/rx, (-y1-cy1)/ry)
+	if !sweep && delta > 0 {
+		delta -= 2 * math.Pi
+	} else if sweep && delta < 0 {
+		delta += 2 * math.Pi
+	}
+
+	segments := max(1, int(math.Ceil(math.Abs(delta)/(math.Pi/2))))
+	step := delta / float64(segments)
+	k := 4.0 / 3 * math.Tan(step/4)
+	point := func(t float64) (svgPoint, svgPoint) {
+		sin, cos := math.Sincos(t)
+		// The point on the ellipse and its derivative, rotated by phi.
+		px, py := rx*cos, ry*sin
+		tx, ty := -rx*sin, ry*cos
+		return svgPoint{cosPhi*px - sinPhi*py + cx, sinPhi*px + cosPhi*py + cy},
+			svgPoint{cosPhi*tx - sinPhi*ty, sinPhi*tx + cosPhi*ty}
+	}
+	var out [][3]svgPoint
+	t := theta
+	a, da := point(t)
+	for s := 0; s < segments; s++ {
+		b, db := point(t + step)
+		out = append(out, [3]svgPoint{
+			{a.x + k*da.x, a.y + k*da.y},
+			{b.x - k*db.x, b.y - k*db.y},
+			b,
+		})
+		a, da, t = b, db, t+step
+	}
+	out[len(out)-1][2] = p1
+	return out
+}
+
+// svgFinite reports whether every value is a usable number.
+func svgFinite(vs ...float64) bool {
+	for _, v := range vs {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// svgCoordLimit bounds the coordinates handed to the rasteriser, which
+// misbehaves on values near the float32 range. Shapes reaching that far off
+// the canvas are cut short without visibly changing what is on it.
+const svgCoordLimit = 1 << 20
+
+// drawSVGShape fills and then strokes subpaths onto the canvas. Shapes with
+// non-finite coordinates are skipped.
+func drawSVGShape(z *vector.Rasterizer, canvas *image.RGBA, subpaths []svgSubpath, s svgStyle) {
+	for _, sp := range subpaths {
+		for _, p := range sp.points {
+			if x, y := s.transform.apply(p.x, p.y); !svgFinite(x, y) {
+				return
+			}
+		}
+	}
+	size := canvas.Bounds().Size()
+	paint := func(c color.NRGBA, opacity float64) {
+		c.A = uint8(float64(c.A) * math.Max(0, math.Min(1, opacity)))
+		z.Draw(canvas, canvas.Bounds(), image.NewUniform(c), image.Point{})
+	}
+	f32 := func(v float64) float32 {
+		return float32(math.Max(-svgCoordLimit, math.Min(svgCoordLimit, v)))
+	}
+	moveTo := func(p svgPoint, first bool) {
+		x, y := s.transform.apply(p.x, p.y)
+		if first {
+			z.MoveTo(f32(x), f32(y))
+		} else {
+			z.LineTo(f32(x), f32(y))
+		}
+	}
+
+	if s.hasFill {
+		z.Reset(size.X, size.Y)
+		drawn := false
+		for _, sp := range subpaths {
+			if len(sp.points) < 3 {
+				continue
+			}
+			for k, p := range sp.points {
+				moveTo(p, k == 0)
+			}
+			z.ClosePath()
+			drawn = true
+		}
+		if drawn {
+			paint(s.fill, s.opacity*s.fillOpacity)
+		}
+	}
+
+	if s.hasStroke && s.strokeWidth > 0 {
+		// Outline every segment as a quad, with a disc at each vertex for
+		// round joins and caps, all wound the same way so overlaps merge.
+		half := math.Min(s.strokeWidth*s.transform.scale()/2, svgCoordLimit)
+		if !svgFinite(half) {
+			return
+		}
+		z.Reset(size.X, size.Y)
+		disc := func(x, y float64) {
+			const steps = 12
+			for k := 0; k < steps; k++ {
+				sin, cos := math.Sincos(2 * math.Pi * float64(k) / steps)
+				if k == 0 {
+					z.MoveTo(f32(x+half*cos), f32(y+half*sin))
+				} else {
+					z.LineTo(f32(x+half*cos), f32(y+half*sin))
+				}
+			}
+			z.ClosePath()
+		}
+		for _, sp := range subpaths {
+			pts := make([]svgPoint, 0, len(sp.points)+1)
+			for _, p := range sp.points {
+				x, y := s.transform.apply(p.x, p.y)
+				pts = append(pts, svgPoint{x, y})
+			}
+			if sp.closed && len(pts) > 0 {
+				pts = append(pts, pts[0])
+			}
+			for k := 0; k+1 < len(pts); k++ {
+				a, b := pts[k], pts[k+1]
+				length := math.Hypot(b.x-a.x, b.y-a.y)
+				if length == 0 {
+					continue
+				}
+				nx, ny := -(b.y-a.y)/length*half, (b.x-a.x)/length*half
+				z.MoveTo(f32(a.x-nx), f32(a.y-ny))
+				z.LineTo(f32(b.x-nx), f32(b.y-ny))
+				z.LineTo(f32(b.x+nx), f32(b.y+ny))
+				z.LineTo(f32(a.x+nx), f32(a.y+ny))
+				z.ClosePath()
+			}
+			for _, p := range pts {
+				disc(p.x, p.y)
+			}
+		}
+		paint(s.stroke, s.opacity*s.strokeOpacity)
+	}
+}
+
+// ── JSON renderer ─────────────────────────────────────────────────────────────
+
+// JSON color tokens, rebuilt from the active theme by applyTheme.
+var (
+	jsonKey     lipgloss.Style // keys
+	jsonStr     lipgloss.Style // string values
+	jsonNum     lipgloss.Style // numbers
+	jsonBool    lipgloss.Style // booleans
+	jsonNull    lipgloss.Style // null
+	jsonBracket lipgloss.Style // brackets
+	jsonMuted   lipgloss.Style // punctuation / ellipsis
+)
+
+func renderJSONPreview(text string, truncated bool) string {
+	// Parse into a generic value
+	var v interface{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(text)), &v); err != nil {
+		// Not valid JSON — show the error and fall back to raw text
+		errStyle := lipgloss.NewStyle().Foreground(clrDanger)
+		return errStyle.Render("  invalid JSON: "+err.Error()) + "\n\n" + text
+	}
+
+	var sb strings.Builder
+	writeJSON(&sb, v, 0)
+	out := sb.String()
+
+	if truncated {
+		out += "\n" + jsonMuted.Render("  … file truncated, showing partial parse")
+	}
+	return out
+}
+
+// writeJSON recursively pretty-prints a JSON value with colour.
+func writeJSON(sb *strings.Builder, v interface{}, depth int) {
+	indent := strings.Repeat("  ", depth)
+	childIndent := strings.Repeat("  ", depth+1)
+
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if len(val) == 0 {
+			sb.WriteString(jsonBracket.Render("{}"))
+			return
+		}
+		sb.WriteString(jsonBracket.Render("{") + "\n")
+		// Sort keys for deterministic output
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for i, k := range keys {
+			sb.WriteString(childIndent)
+			sb.WriteString(jsonKey.Render(`"` + k + `"`))
+			sb.WriteString(jsonMuted.Render(": "))
+			writeJSON(sb, val[k], depth+1)
+			if i < len(keys)-1 {
+				sb.WriteString(jsonMuted.Render(","))
+			}
+			sb.WriteString("\n")
+		}
+		sb.WriteString(indent + jsonBracket.Render("}"))
+
+	case []interface{}:
+		if len(val) == 0 {
+			sb.WriteString(jsonBracket.Render("[]"))
+			return
+		}
+		sb.WriteString(jsonBracket.Render("[") + "\n")
+		// Cap array preview at 100 items to avoid enormous output
+		limit := len(val)
+		capped := false
+		if limit > 100 {
+			limit = 100
+			capped = true
+		}
+		for i := 0; i < limit; i++ {
+			sb.WriteString(childIndent)
+			writeJSON(sb, val[i], depth+1)
+			if i < len(val)-1 {
+				sb.WriteString(jsonMuted.Render(","))
+			}
+			sb.WriteString("\n")
+		}
+		if capped {
+			sb.WriteString(childIndent + jsonMuted.Render(fmt.Sprintf("… %d more items", len(val)-limit)) + "\n")
+		}
+		sb.WriteString(indent + jsonBracket.Render("]"))
+
+	case string:
+		// Escape double quotes inside the string for display
+		escaped := strings.ReplaceAll(val, `"`, `\"`)
+		sb.WriteString(jsonStr.Render(`"` + escaped + `"`))
+
+	case float64:
+		// Render as integer when there's no fractional part
+		if val == float64(int64(val)) {
+			sb.WriteString(jsonNum.Render(fmt.Sprintf("%d", int64(val))))
+		} else {
+			sb.WriteString(jsonNum.Render(fmt.Sprintf("%g", val)))
+		}
+
+	case bool:
+		if val {
+			sb.WriteString(jsonBool.Render("true"))
+		} else {
+			sb.WriteString(jsonBool.Render("false"))
+		}
+
+	case nil:
+		sb.WriteString(jsonNull.Render("null"))
+
+	default:
+		sb.WriteString(fmt.Sprintf("%v", val))
+	}
+}
+
+func renderImageASCII(img image.Image, width, height int) string {
+	b := img.Bounds()
+	if b.Dx() <= 0 || b.Dy() <= 0 {
+		return ""
+	}
+
+	outW := max(16, width-2)
+	outH := max(8, height-3)
+
+	if supportsTrueColor() {
+		return renderImageTrueColor(img, outW, outH)
+	}
+	return renderImageGray(img, outW, outH)
+}
+
+func rgbValues(c color.Color) (int, int, int) {
+	r, g, b, _ := c.RGBA()
+	return int(r >> 8), int(g >> 8), int(b >> 8)
+}
+
+// imageBlockGlyphs maps a cell's foreground mask to a character for each
+// image_blocks mode, with the cell's pixel grid size. Mask bits run left to
+// right, top to bottom.
+var imageBlockGlyphs = map[string]struct {
+	w, h   int
+	glyphs func(mask int) rune
+}{
+	"half": {1, 2, func(mask int) rune { return []rune(" ▀▄█")[mask] }},
+	"quadrant": {2, 2, func(mask int) rune {
+		return []rune(" ▘▝▀▖▌▞▛▗▚▐▜▄▙▟█")[mask]
+	}},
+	"braille": {2, 4, func(mask int) rune {
+		// Braille numbers its dots down the left column, then the right,
+		// with the bottom row last.
+		dots := [8]int{0x01, 0x08, 0x02, 0x10, 0x04, 0x20, 0x40, 0x80}
+		r := 0
+		for i, d := range dots {
+			if mask&(1<<i) != 0 {
+				r |= d
+			}
+		}
+		if r == 0 {
+			return ' '
+		}
+		return rune(0x2800 + r)
+	}},
+}
+
+// renderImageTrueColor draws each cell in two colours: its pixels are split
+// at their mean luminance, and the glyph for the image_blocks mode shows
+// which of them are the brighter set.
+func renderImageTrueColor(img image.Image, outW, outH int) string {
+	mode, ok := imageBlockGlyphs[userConfig.imageBlocks]
+	if !ok {
+		mode = imageBlockGlyphs["half"]
+	}
+	gridW := outW * mode.w
+	pixels := downsampleImage(img, gridW, outH*mode.h)
+	cell := make([][3]int, mode.w*mode.h)
+
+	var sb strings.Builder
+	for row := 0; row < outH; row++ {
+		lastFgR, lastFgG, lastFgB := -1, -1, -1
+		lastBgR, lastBgG, lastBgB := -1, -1, -1
+
+		for x := 0; x < outW; x++ {
+			var mean float64
+			for i := range cell {
+				cell[i] = pixels[(row*mode.h+i/mode.w)*gridW+x*mode.w+i%mode.w]
+				mean += pixelLuminance(cell[i])
+			}
+			mean /= float64(len(cell))
+
+			mask := 0
+			var fg, bg [3]int
+			var nFg, nBg int
+			for i, p := range cell {
+				if pixelLuminance(p) > mean {
+					mask |= 1 << i
+					fg[0], fg[1], fg[2], nFg = fg[0]+p[0], fg[1]+p[1], fg[2]+p[2], nFg+1
+				} else {
+					bg[0], bg[1], bg[2], nBg = bg[0]+p[0], bg[1]+p[1], bg[2]+p[2], nBg+1
+				}
+			}
+			if nBg == 0 {
+				// A flat cell can round above its own mean.
+				mask, bg, nBg, nFg = 0, fg, nFg, 0
+			}
+			bgR, bgG, bgB := bg[0]/nBg, bg[1]/nBg, bg[2]/nBg
+			fgR, fgG, fgB := bgR, bgG, bgB
+			if nFg > 0 {
+				fgR, fgG, fgB = fg[0]/nFg, fg[1]/nFg, fg[2]/nFg
+			}
+
+			if fgR != lastFgR || fgG != lastFgG || fgB != lastFgB || bgR != lastBgR || bgG != lastBgG || bgB != lastBgB {
+				writeTrueColorANSI(&sb, fgR, fgG, fgB, bgR, bgG, bgB)
+				lastFgR, lastFgG, lastFgB = fgR, fgG, fgB
+				lastBgR, lastBgG, lastBgB = bgR, bgG, bgB
+			}
+			sb.WriteRune(mode.glyphs(mask))
+		}
+
+		sb.WriteString("\x1b[0m")
+		if row < outH-1 {
+			sb.WriteByte('\n')
+		}
+	}
+
+	return sb.String()
+}
+
+func renderImageGray(img image.Image, outW, outH int) string {
+	chars := []rune(" .:-=+*#%@")
+	pixels := downsampleImage(img, outW, outH)
+
+	var sb strings.Builder
+	for y := 0; y < outH; y++ {
+		for x := 0; x < outW; x++ {
+			lum := pixelLuminance(pixels[y*outW+x])
+			idx := int(lum * float64(len(chars)-1) / 255.0)
+			if idx < 0 {
+				idx = 0
+			}
+			if idx >= len(chars) {
+				idx = len(chars) - 1
+			}
+			sb.WriteRune(chars[idx])
+		}
+		if y < outH-1 {
+			sb.WriteByte('\n')
+		}
+	}
+
+	return sb.String()
+}
+
+// maxAreaSamples bounds how many source pixels are averaged per axis of an
+// output pixel, so huge images still render quickly.
+const maxAreaSamples = 8
+
+// downsampleImage scales img to w×h 8-bit RGB pixels, each the average of
+// the source area it covers rather than a single point sample.
+func downsampleImage(img image.Image, w, h int) [][3]int {
+	b := img.Bounds()
+	out := make([][3]int, w*h)
+	span := func(i, n, size, origin int) (int, int) {
+		lo := origin + i*size/n
+		hi := max(lo+1, origin+(i+1)*size/n)
+		return lo, hi
+	}
+	for y := 0; y < h; y++ {
+		y0, y1 := span(y, h, b.Dy(), b.Min.Y)
+		stepY := max(1, (y1-y0)/maxAreaSamples)
+		for x := 0; x < w; x++ {
+			x0, x1 := span(x, w, b.Dx(), b.Min.X)
+			stepX := max(1, (x1-x0)/maxAreaSamples)
+			var r, g, bl, n int
+			for sy := y0; sy < y1; sy += stepY {
+				for sx := x0; sx < x1; sx += stepX {
+					pr, pg, pb := rgbValues(img.At(sx, sy))
+					r, g, bl, n = r+pr, g+pg, bl+pb, n+1
+				}
+			}
+			out[y*w+x] = [3]int{r / n, g / n, bl / n}
+		}
+	}
+	return out
+}
+
+func pixelLuminance(p [3]int) float64 {
+	return float64(p[0])*0.299 + float64(p[1])*0.587 + float64(p[2])*0.114
+}
+
+func writeTrueColorANSI(sb *strings.Builder, fgR, fgG, fgB, bgR, bgG, bgB int) {
+	fmt.Fprintf(sb, "\x1b[38;2;%d;%d;%dm\x1b[48;2;%d;%d;%dm", fgR, fgG, fgB, bgR, bgG, bgB)
+}
+
+func supportsTrueColor() bool {
+	if _, noColor := os.LookupEnv("NO_COLOR"); noColor {
+		return false
+	}
+	colorTerm := strings.ToLower(os.Getenv("COLORTERM"))
+	if strings.Contains(colorTerm, "truecolor") || strings.Contains(colorTerm, "24bit") {
+		return true
+	}
+	term := strings.ToLower(os.Getenv("TERM"))
+	if strings.Contains(term, "kitty") || strings.Contains(term, "wezterm") {
+		return true
+	}
+	return false
+}
+
+func replaceMermaidFences(markdown string) string {
+	lines := strings.Split(markdown, "\n")
+	inMermaidFence := false
+	var block strings.Builder
+	transformed := make([]string, 0, len(lines))
+
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if !inMermaidFence {
+			if strings.HasPrefix(trimmed, "```") {
+				lang := strings.TrimSpace(strings.TrimPrefix(trimmed, "```"))
+				if strings.EqualFold(lang, "mermaid") {
+					inMermaidFence = true
+					block.Reset()
+					continue
+				}
+			}
+			transformed = append(transformed, line)
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "```") {
+			content := strings.TrimSpace(block.String())
+			if content != "" {
+				transformed = append(transformed, "")
+				transformed = append(transformed, renderMermaidMarkdownPreview(content))
+				transformed = append(transformed, "")
+			}
+			inMermaidFence = false
+			continue
+		}
+		block.WriteString(line)
+		block.WriteString("\n")
+	}
+
+	if inMermaidFence {
+		transformed = append(transformed, "```mermaid")
+		transformed = append(transformed, strings.TrimRight(block.String(), "\n"))
+	}
+
+	return strings.Join(transformed, "\n")
+}
+
+type mermaidNode struct {
+	id    string
+	label string
+}
+
+type mermaidEdge struct {
+	from      mermaidNode
+	to        mermaidNode
+	edgeLabel string
+}
+
+// mermaidGroup is a flowchart subgraph; parent is -1 at the top level.
+type mermaidGroup struct {
+	title  string
+	parent int
+}
+
+type mermaidGraph struct {
+	chartType string
+	direction string // TD, LR, RL or BT
+	nodeOrder []string
+	nodes     map[string]string
+	edges     []mermaidEdge
+	groups    []mermaidGroup
+	nodeGroup map[string]int // innermost subgraph of each grouped node
+}
+
+func renderMermaidNative(code string) string {
+	ct := mermaidChartType(code)
+	switch ct {
+	case "sequenceDiagram":
+		parts, msgs := parseSequenceDiagram(code)
+		if len(msgs) > 0 {
+			return asciiSequenceDiagram(parts, msgs, 0)
+		}
+	default:
+		g := parseMermaidGraph(code)
+		if len(g.nodeOrder) > 0 {
+			return asciiFlowchart(g, 0)
+		}
+	}
+	return code
+}
+
+func renderMermaidMarkdownPreview(code string) string {
+	ct := mermaidChartType(code)
+	var art string
+	switch ct {
+	case "sequenceDiagram":
+		parts, msgs := parseSequenceDiagram(code)
+		if len(msgs) > 0 {
+			art = asciiSequenceDiagram(parts, msgs, 80)
+		}
+	default:
+		g := parseMermaidGraph(code)
+		if len(g.nodeOrder) > 0 {
+			art = asciiFlowchart(g, 80)
+		}
+	}
+	if art == "" {
+		return "_Mermaid block: no diagram content parsed._"
+	}
+	return "```text\n" + art + "\n```\n"
+}
+
+func mermaidChartType(code string) string {
+	for _, line := range strings.Split(code, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "%%") {
+			continue
+		}
+		if parts := strings.Fields(trimmed); len(parts) > 0 {
+			return parts[0]
+		}
+	}
+	return "diagram"
+}
+
+// ── ASCII flowchart renderer ──────────────────────────────────────────────────
+
+// boxDrawMask maps box-drawing runes to a 4-bit NESW connectivity mask.
+// N=8 E=4 S=2 W=1 — combining masks via OR produces the correct merged character.
+var boxDrawMask = map[rune]int{
+	'│': 8 + 2, '─': 4 + 1,
+	'┌': 4 + 2, '┐': 1 + 2, '└': 8 + 4, '┘': 8 + 1,
+	'├': 8 + 4 + 2, '┤': 8 + 1 + 2, '┬': 4 + 1 + 2, '┴': 8 + 4 + 1, '┼': 15,
+	'╶': 4, '╴': 1, '╵': 8, '╷': 2,
+}
+
+// maskBoxDraw is the reverse of boxDrawMask.
+var maskBoxDraw = map[int]rune{
+	4 + 2: '┌', 1 + 2: '┐', 8 + 4: '└', 8 + 1: '┘',
+	4 + 1: '─', 8 + 2: '│',
+	8 + 4 + 2: '├', 8 + 1 + 2: '┤', 4 + 1 + 2: '┬', 8 + 4 + 1: '┴', 15: '┼',
+	4: '╶', 1: '╴', 8: '╵', 2: '╷',
+}
+
+// asciiFlowchart renders a mermaid flowchart as an ASCII box diagram. Levels
+// run along the graph's direction; each subgraph gets its own band across
+// them so its frame never encloses boxes that belong elsewhere.
+func asciiFlowchart(g mermaidGraph, maxW int) string {
+	if len(g.nodeOrder) == 0 {
+		return "(empty diagram)"
+	}
+
+	labelOf := func(id string) string {
+		if l := g.nodes[id]; l != "" {
+			return l
+		}
+		return id
+	}
+	nodeBoxW := func(id string) int { return len([]rune(labelOf(id))) + 4 }
+
+	vertical := g.direction != "LR" && g.direction != "RL"
+	reversed := g.direction == "BT" || g.direction == "RL"
+	// primary is a box's extent along the level axis, secondary across it.
+	primary := func(id string) int {
+		if vertical {
+			return 3
+		}
+		return nodeBoxW(id)
+	}
+	secondary := func(id string) int {
+		if vertical {
+			return nodeBoxW(id)
+		}
+		return 3
+	}
+
+	// Build adjacency and in-degree
+	succMap := make(map[string][]string)
+	tmpIn := make(map[string]int)
+	for id := range g.nodes {
+		tmpIn[id] = 0
+	}
+	for _, e := range g.edges {
+		if e.from.id == e.to.id {
+			continue
+		}
+		succMap[e.from.id] = append(succMap[e.from.id], e.to.id)
+		tmpIn[e.to.id]++
+	}
+
+	// Longest-path ranking via Kahn's algorithm
+	rank := make(map[string]int)
+	q := []string{}
+	for id := range g.nodes {
+		if tmpIn[id] == 0 {
+			q = append(q, id)
+		}
+	}
+	for len(q) > 0 {
+		cur := q[0]
+		q = q[1:]
+		for _, next := range succMap[cur] {
+			if rank[cur]+1 > rank[next] {
+				rank[next] = rank[cur] + 1
+			}
+			tmpIn[next]--
+			if tmpIn[next] == 0 {
+				q = append(q, next)
+			}
+		}
+	}
+
+	maxRank := 0
+	for _, r := range rank {
+		if r > maxRank {
+			maxRank = r
+		}
+	}
+
+	// Subgraph nesting. A node's cluster is its innermost subgraph (0 for
+	// none); frames sit one step further out per level of nesting.
+	depth := func(gi int) int {
+		d := 0
+		for p := g.groups[gi].parent; p >= 0; p = g.groups[p].parent {
+			d++
+		}
+		return d
+	}
+	clusterOf := func(id string) int {
+		if gi, ok := g.nodeGroup[id]; ok {
+			return gi + 1
+		}
+		return 0
+	}
+	used := make([]bool, len(g.groups))
+	for _, id := range g.nodeOrder {
+		if gi, ok := g.nodeGroup[id]; ok {
+			for ; gi >= 0; gi = g.groups[gi].parent {
+				used[gi] = true
+			}
+		}
+	}
+	maxDepth := -1
+	for gi := range g.groups {
+		if used[gi] {
+			maxDepth = max(maxDepth, depth(gi))
+		}
+	}
+	framed := maxDepth >= 0
+
+	// Group nodes by rank and cluster, preserving nodeOrder within each
+	levels := make([][][]string, maxRank+1)
+	for r := range levels {
+		levels[r] = make([][]string, len(g.groups)+1)
+	}
+	for _, id := range g.nodeOrder {
+		levels[rank[id]][clusterOf(id)] = append(levels[rank[id]][clusterOf(id)], id)
+	}
+
+	// Secondary positions: clusters side by side, each level centred
+	// within its cluster's band. Frames take two columns or one row.
+	sGap, step := 3, 2
+	if !vertical {
+		sGap, step = 1, 1
+	}
+	nodeSec := make(map[string]int)
+	secTotal := 0
+	for c := range len(g.groups) + 1 {
+		spans := make([]int, maxRank+1)
+		band := 0
+		for r := range levels {
+			for i, id := range levels[r][c] {
+				if i > 0 {
+					spans[r] += sGap
+				}
+				spans[r] += secondary(id)
+			}
+			band = max(band, spans[r])
+		}
+		if band == 0 {
+			continue
+		}
+		margin := 0
+		if c > 0 {
+			margin = step * (depth(c-1) + 1)
+			if vertical {
+				// Leave room for the title in the frame's top border.
+				band = max(band, len([]rune(g.groups[c-1].title))+2)
+			}
+		}
+		if secTotal > 0 {
+			secTotal += sGap
+		}
+		start := secTotal + margin
+		for r := range levels {
+			s := start + (band-spans[r])/2
+			for _, id := range levels[r][c] {
+				nodeSec[id] = s
+				s += secondary(id) + sGap
+			}
+		}
+		secTotal = start + band + margin
+	}
+
+	// Edge labels sit on the target side of the turning line; an edge is
+	// drawn only between adjacent levels, so each target has one slot for
+	// the labels of everything coming into it.
+	const maxEdgeLabel = 20
+	edgeLabels := make(map[string]string)
+	for _, e := range g.edges {
+		if e.edgeLabel == "" || e.from.id == e.to.id || rank[e.from.id]+1 != rank[e.to.id] {
+			continue
+		}
+		if prev := edgeLabels[e.to.id]; prev == "" {
+			edgeLabels[e.to.id] = e.edgeLabel
+		} else if !strings.Contains(", "+prev+", ", ", "+e.edgeLabel+", ") {
+			edgeLabels[e.to.id] = prev + ", " + e.edgeLabel
+		}
+	}
+	lab := 0 // extra room between the turning line and the targets
+	for _, l := range edgeLabels {
+		if vertical {
+			lab = 1
+		} else {
+			lab = max(lab, min(len([]rune(l)), maxEdgeLabel)+3)
+		}
+	}
+
+	// Primary positions. Edges turn on the row (or column) padP past the
+	// source level; frames are kept clear of it on both sides.
+	padP := 0
+	if !vertical {
+		padP = 1
+	}
+	if framed {
+		padP = maxDepth + 2
+		if !vertical {
+			padP = 2*maxDepth + 3
+		}
+	}
+	levelStart := make([]int, maxRank+1)
+	levelSize := make([]int, maxRank+1)
+	for r := range levels {
+		for _, ids := range levels[r] {
+			for _, id := range ids {
+				levelSize[r] = max(levelSize[r], primary(id))
+			}
+		}
+	}
+	p := 0
+	if framed {
+		p = padP
+	}
+	for i := range maxRank + 1 {
+		r := i
+		if reversed {
+			r = maxRank - i
+		}
+		levelStart[r] = p
+		p += levelSize[r]
+		if i < maxRank {
+			p += 2*padP + 2 + lab
+		}
+	}
+	if framed {
+		p += padP
+	}
+	nodePrim := make(map[string]int)
+	for _, id := range g.nodeOrder {
+		r := rank[id]
+		nodePrim[id] = levelStart[r] + (levelSize[r]-primary(id))/2
+	}
+
+	// at maps (primary, secondary) to grid (x, y).
+	at := func(prim, sec int) (int, int) {
+		if vertical {
+			return sec, prim
+		}
+		return prim, sec
+	}
+
+	totalW, totalH := at(p, secTotal)
+	totalW = max(totalW, 1)
+	if maxW > 0 && totalW > maxW {
+		totalW = maxW
+	}
+
+	// Grid
+	grid := make([][]rune, totalH)
+	for i := range grid {
+		grid[i] = make([]rune, totalW)
+		for j := range grid[i] {
+			grid[i][j] = ' '
+		}
+	}
+
+	setRaw := func(x, y int, r rune) {
+		if x >= 0 && x < totalW && y >= 0 && y < totalH {
+			grid[y][x] = r
+		}
+	}
+	// link merges NESW connections into a cell so crossing and branching
+	// lines combine cleanly.
+	link := func(x, y, m int) {
+		if x < 0 || x >= totalW || y < 0 || y >= totalH {
+			return
+		}
+		if em, ok := boxDrawMask[grid[y][x]]; ok {
+			m |= em
+		}
+		grid[y][x] = maskBoxDraw[m]
+	}
+	dirMask := func(dx, dy int) int {
+		switch {
+		case dy < 0:
+			return 8
+		case dx > 0:
+			return 4
+		case dy > 0:
+			return 2
+		case dx < 0:
+			return 1
+		}
+		return 0
+	}
+	sign := func(n int) int {
+		switch {
+		case n > 0:
+			return 1
+		case n < 0:
+			return -1
+		}
+		return 0
+	}
+	// path draws axis-aligned segments through pts.
+	path := func(pts ...[2]int) {
+		for i := 0; i+1 < len(pts); i++ {
+			a, b := pts[i], pts[i+1]
+			dx, dy := sign(b[0]-a[0]), sign(b[1]-a[1])
+			if dx == 0 && dy == 0 {
+				continue
+			}
+			for x, y := a[0], a[1]; ; x, y = x+dx, y+dy {
+				m := 0
+				if x != b[0] || y != b[1] {
+					m |= dirMask(dx, dy)
+				}
+				if x != a[0] || y != a[1] {
+					m |= dirMask(-dx, -dy)
+				}
+				link(x, y, m)
+				if x == b[0] && y == b[1] {
+					break
+				}
+			}
+		}
+	}
+	writeStr := func(x, y int, s string) {
+		for i, r := range []rune(s) {
+			setRaw(x+i, y, r)
+		}
+	}
+	nodeXY := func(id string) (x, y, w int) {
+		x, y = at(nodePrim[id], nodeSec[id])
+		return x, y, nodeBoxW(id)
+	}
+
+	// Draw subgraph frames around their members; titles go on last so
+	// edges crossing a frame's top border don't cut through them.
+	type frameTitle struct {
+		x, y  int
+		title string
+	}
+	var titles []frameTitle
+	for gi, grp := range g.groups {
+		if !used[gi] {
+			continue
+		}
+		x0, y0, x1, y1 := totalW, totalH, -1, -1
+		for _, id := range g.nodeOrder {
+			ng, ok := g.nodeGroup[id]
+			if !ok {
+				continue
+			}
+			k := 1
+			for ; ng >= 0 && ng != gi; ng = g.groups[ng].parent {
+				k++
+			}
+			if ng != gi {
+				continue
+			}
+			x, y, w := nodeXY(id)
+			ex, ey := 2*k, k
+			if vertical {
+				ey++
+			} else {
+				ex++
+			}
+			x0, y0 = min(x0, x-ex), min(y0, y-ey)
+			x1, y1 = max(x1, x+w-1+ex), max(y1, y+2+ey)
+		}
+		path([2]int{x0, y0}, [2]int{x1, y0}, [2]int{x1, y1}, [2]int{x0, y1}, [2]int{x0, y0})
+		if grp.title != "" && x1-x0 > 5 {
+			titles = append(titles, frameTitle{x0 + 2, y0, " " + trimVisual(grp.title, x1-x0-5) + " "})
+		}
+	}
+
+	// Draw boxes
+	for id := range g.nodes {
+		label := labelOf(id)
+		x, yy, w := nodeXY(id)
+		setRaw(x, yy, '┌')
+		for i := 1; i < w-1; i++ {
+			setRaw(x+i, yy, '─')
+		}
+		setRaw(x+w-1, yy, '┐')
+		setRaw(x, yy+1, '│')
+		writeStr(x+2, yy+1, label)
+		setRaw(x+w-1, yy+1, '│')
+		setRaw(x, yy+2, '└')
+		for i := 1; i < w-1; i++ {
+			setRaw(x+i, yy+2, '─')
+		}
+		setRaw(x+w-1, yy+2, '┘')
+	}
+
+	// Draw edges between adjacent-rank nodes: out of the source, along the
+	// turning line between levels, then into the target with an arrowhead.
+	arrow, back := '▼', 8
+	switch {
+	case vertical && reversed:
+		arrow, back = '▲', 2
+	case !vertical && !reversed:
+		arrow, back = '▶', 1
+	case !vertical && reversed:
+		arrow, back = '◀', 4
+	}
+	pt := func(prim, sec int) [2]int {
+		x, y := at(prim, sec)
+		return [2]int{x, y}
+	}
+	for _, e := range g.edges {
+		fid, tid := e.from.id, e.to.id
+		if fid == tid || rank[fid]+1 != rank[tid] {
+			continue
+		}
+		fs := nodeSec[fid] + secondary(fid)/2
+		ts := nodeSec[tid] + secondary(tid)/2
+		r := rank[fid]
+		exit := nodePrim[fid] + primary(fid)
+		turn := levelStart[r] + levelSize[r] + padP
+		entry := nodePrim[tid] - 1
+		if reversed {
+			exit = nodePrim[fid] - 1
+			turn = levelStart[r] - 1 - padP
+			entry = nodePrim[tid] + primary(tid)
+		}
+		start := pt(exit, fs)
+		link(start[0], start[1], back)
+		path(start, pt(turn, fs), pt(turn, ts), pt(entry, ts))
+		end := pt(entry, ts)
+		setRaw(end[0], end[1], arrow)
+	}
+	for tid, l := range edgeLabels {
+		r := rank[tid] - 1
+		turn := levelStart[r] + levelSize[r] + padP
+		if reversed {
+			turn = levelStart[r] - 1 - padP
+		}
+		if vertical {
+			l = trimVisual(l, nodeBoxW(tid))
+			row := turn + 1
+			if reversed {
+				row = turn - 1
 			}
-			sb.WriteRune(chars[idx])
+			x := max(nodeSec[tid]+(nodeBoxW(tid)-len([]rune(l)))/2, nodeSec[tid])
+			writeStr(x, row, l)
+			continue
 		}
-		if y < outH-1 {
-			sb.WriteByte('\n')
+		l = " " + trimVisual(l, lab-3) + " "
+		x := turn + 1
+		if reversed {
+			x = turn - len([]rune(l))
 		}
+		writeStr(x, nodeSec[tid]+1, l)
+	}
+	for _, t := range titles {
+		writeStr(t.x, t.y, t.title)
 	}
 
-	return sb.String()
+	var sb strings.Builder
+	for _, row := range grid {
+		sb.WriteString(strings.TrimRight(string(row), " "))
+		sb.WriteByte('\n')
+	}
+	return strings.Trim(sb.String(), "\n")
 }
 
-func writeTrueColorANSI(sb *strings.Builder, fgR, fgG, fgB, bgR, bgG, bgB int) {
-	fmt.Fprintf(sb, "\x1b[38;2;%d;%d;%dm\x1b[48;2;%d;%d;%dm", fgR, fgG, fgB, bgR, bgG, bgB)
-}
+// ── Graphviz DOT ──────────────────────────────────────────────────────────────
 
-func supportsTrueColor() bool {
-	if _, noColor := os.LookupEnv("NO_COLOR"); noColor {
-		return false
-	}
-	colorTerm := strings.ToLower(os.Getenv("COLORTERM"))
-	if strings.Contains(colorTerm, "truecolor") || strings.Contains(colorTerm, "24bit") {
-		return true
-	}
-	term := strings.ToLower(os.Getenv("TERM"))
-	if strings.Contains(term, "kitty") || strings.Contains(term, "wezterm") {
-		return true
+// renderDotPreview lays a Graphviz graph out with the flowchart renderer.
+// Only structure is read — nodes, edges, labels, rankdir and cluster
+// subgraphs; styling attributes are ignored.
+func renderDotPreview(text string) string {
+	g := parseDotGraph(text)
+	if len(g.nodeOrder) == 0 {
+		return text
 	}
-	return false
+	return asciiFlowchart(g, 0)
 }
 
-func luminance(c color.Color) float64 {
-	r, g, b, _ := c.RGBA()
-	rf := float64(r>>8) * 0.299
-	gf := float64(g>>8) * 0.587
-	bf := float64(b>>8) * 0.114
-	return rf + gf + bf
+// dotToken is an identifier, quoted string or HTML label (id set, quotes
+// and markup removed) or a piece of punctuation: { } [ ] ; , = : -> --.
+type dotToken struct {
+	text string
+	id   bool
 }
 
-func replaceMermaidFences(markdown string) string {
-	lines := strings.Split(markdown, "\n")
-	inMermaidFence := false
-	var block strings.Builder
-	transformed := make([]string, 0, len(lines))
-
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if !inMermaidFence {
-			if strings.HasPrefix(trimmed, "```") {
-				lang := strings.TrimSpace(strings.TrimPrefix(trimmed, "```"))
-				if strings.EqualFold(lang, "mermaid") {
-					inMermaidFence = true
-					block.Reset()
+func dotTokens(src string) []dotToken {
+	var toks []dotToken
+	rs := []rune(src)
+	atLineStart := true
+	for i := 0; i < len(rs); i++ {
+		c := rs[i]
+		switch {
+		case c == '\n':
+			atLineStart = true
+			continue
+		case unicode.IsSpace(c):
+			continue
+		case c == '#' && atLineStart, c == '/' && i+1 < len(rs) && rs[i+1] == '/':
+			for i < len(rs) && rs[i] != '\n' {
+				i++
+			}
+			i--
+			continue
+		case c == '/' && i+1 < len(rs) && rs[i+1] == '*':
+			i += 2
+			for i+1 < len(rs) && (rs[i] != '*' || rs[i+1] != '/') {
+				i++
+			}
+			i++
+		case c == '"':
+			var sb strings.Builder
+			for i++; i < len(rs) && rs[i] != '"'; i++ {
+				if rs[i] == '\\' && i+1 < len(rs) {
+					i++
+					switch rs[i] {
+					case 'n', 'l', 'r':
+						sb.WriteByte(' ')
+					case '\n':
+					default:
+						sb.WriteRune(rs[i])
+					}
 					continue
 				}
+				sb.WriteRune(rs[i])
 			}
-			transformed = append(transformed, line)
-			continue
-		}
-
-		if strings.HasPrefix(trimmed, "```") {
-			content := strings.TrimSpace(block.String())
-			if content != "" {
-				transformed = append(transformed, "")
-				transformed = append(transformed, renderMermaidMarkdownPreview(content))
-				transformed = append(transformed, "")
+			toks = append(toks, dotToken{text: sb.String(), id: true})
+		case c == '<':
+			// HTML label: keep the text between tags.
+			var sb strings.Builder
+			depth, inTag := 1, false
+			for i++; i < len(rs) && depth > 0; i++ {
+				switch rs[i] {
+				case '<':
+					depth++
+					inTag = true
+				case '>':
+					depth--
+					inTag = false
+					if depth > 0 {
+						sb.WriteByte(' ')
+					}
+				default:
+					if !inTag {
+						sb.WriteRune(rs[i])
+					}
+				}
 			}
-			inMermaidFence = false
-			continue
+			i--
+			toks = append(toks, dotToken{text: strings.Join(strings.Fields(sb.String()), " "), id: true})
+		case c == '-' && i+1 < len(rs) && (rs[i+1] == '>' || rs[i+1] == '-'):
+			toks = append(toks, dotToken{text: string(rs[i : i+2])})
+			i++
+		case strings.ContainsRune("{}[];,=:", c):
+			toks = append(toks, dotToken{text: string(c)})
+		default:
+			j := i
+			for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j]) || rs[j] == '_' || rs[j] == '.' ||
+				rs[j] == '-' && !(j+1 < len(rs) && (rs[j+1] == '>' || rs[j+1] == '-'))) {
+				j++
+			}
+			if j == i {
+				j++ // stray character
+			}
+			toks = append(toks, dotToken{text: string(rs[i:j]), id: true})
+			i = j - 1
 		}
-		block.WriteString(line)
-		block.WriteString("\n")
-	}
-
-	if inMermaidFence {
-		transformed = append(transformed, "```mermaid")
-		transformed = append(transformed, strings.TrimRight(block.String(), "\n"))
+		atLineStart = false
 	}
+	return toks
+}
 
-	return strings.Join(transformed, "\n")
+// dotParser builds a mermaidGraph from DOT tokens so the flowchart
+// renderer can draw it.
+type dotParser struct {
+	toks []dotToken
+	pos  int
+	g    mermaidGraph
+	open []int // enclosing cluster subgraphs, innermost last
 }
 
-type mermaidNode struct {
-	id    string
-	label string
+func parseDotGraph(src string) mermaidGraph {
+	p := &dotParser{
+		toks: dotTokens(src),
+		g: mermaidGraph{
+			chartType: "digraph",
+			direction: "TD",
+			nodes:     make(map[string]string),
+			nodeGroup: make(map[string]int),
+		},
+	}
+	for p.pos < len(p.toks) && !p.is("{") {
+		p.pos++ // strict, graph/digraph and the graph's name
+	}
+	if p.is("{") {
+		p.pos++
+		p.stmts()
+	}
+	return p.g
 }
 
-type mermaidEdge struct {
-	from      mermaidNode
-	to        mermaidNode
-	edgeLabel string
+func (p *dotParser) is(punct string) bool {
+	return p.pos < len(p.toks) && !p.toks[p.pos].id && p.toks[p.pos].text == punct
 }
 
-type mermaidGraph struct {
-	chartType string
-	nodeOrder []string
-	nodes     map[string]string
-	edges     []mermaidEdge
+func (p *dotParser) keyword(kw string) bool {
+	return p.pos < len(p.toks) && p.toks[p.pos].id && strings.EqualFold(p.toks[p.pos].text, kw)
 }
 
-func renderMermaidNative(code string) string {
-	ct := mermaidChartType(code)
-	switch ct {
-	case "sequenceDiagram":
-		parts, msgs := parseSequenceDiagram(code)
-		if len(msgs) > 0 {
-			return asciiSequenceDiagram(parts, msgs, 0)
+// stmts parses statements up to the closing brace and returns every node
+// mentioned, for edges whose endpoint is a subgraph.
+func (p *dotParser) stmts() []string {
+	var mentioned []string
+	for p.pos < len(p.toks) {
+		switch {
+		case p.is("}"):
+			p.pos++
+			return mentioned
+		case p.is(";"), p.is(","):
+			p.pos++
+			continue
+		case p.keyword("graph") || p.keyword("node") || p.keyword("edge"):
+			isGraph := p.keyword("graph")
+			p.pos++
+			attrs := p.attrs()
+			if isGraph {
+				p.graphAttrs(attrs)
+			}
+			continue
 		}
-	default:
-		g := parseMermaidGraph(code)
-		if len(g.nodeOrder) > 0 {
-			return asciiFlowchart(g, 0)
+		if p.pos+2 < len(p.toks) && p.toks[p.pos].id && p.toks[p.pos+1].text == "=" && !p.toks[p.pos+1].id {
+			p.graphAttrs(map[string]string{strings.ToLower(p.toks[p.pos].text): p.toks[p.pos+2].text})
+			p.pos += 3
+			continue
+		}
+		ids, isNode, ok := p.operand()
+		if !ok {
+			p.pos++
+			continue
+		}
+		mentioned = append(mentioned, ids...)
+		groups := [][]string{ids}
+		for p.is("->") || p.is("--") {
+			p.pos++
+			next, _, ok := p.operand()
+			if !ok {
+				break
+			}
+			mentioned = append(mentioned, next...)
+			groups = append(groups, next)
+		}
+		attrs := p.attrs()
+		if len(groups) == 1 {
+			if isNode && len(ids) == 1 {
+				if l, ok := attrs["label"]; ok && strings.TrimSpace(l) != "" && l != `\N` {
+					p.g.nodes[ids[0]] = cleanMermaidText(l)
+				}
+			}
+			continue
+		}
+		label := attrs["label"]
+		if label == "" {
+			label = attrs["xlabel"]
+		}
+		for i := 0; i+1 < len(groups); i++ {
+			for _, from := range groups[i] {
+				for _, to := range groups[i+1] {
+					p.g.edges = append(p.g.edges, mermaidEdge{
+						from:      mermaidNode{id: from, label: p.g.nodes[from]},
+						to:        mermaidNode{id: to, label: p.g.nodes[to]},
+						edgeLabel: cleanMermaidText(label),
+					})
+				}
+			}
 		}
 	}
-	return code
+	return mentioned
 }
 
-func renderMermaidMarkdownPreview(code string) string {
-	ct := mermaidChartType(code)
-	var art string
-	switch ct {
-	case "sequenceDiagram":
-		parts, msgs := parseSequenceDiagram(code)
-		if len(msgs) > 0 {
-			art = asciiSequenceDiagram(parts, msgs, 80)
+// operand parses a node id (ports dropped) or a subgraph, returning the
+// nodes it names and whether it was a single node.
+func (p *dotParser) operand() ([]string, bool, bool) {
+	if p.keyword("subgraph") || p.is("{") {
+		name := ""
+		if p.keyword("subgraph") {
+			p.pos++
+			if p.pos < len(p.toks) && p.toks[p.pos].id {
+				name = p.toks[p.pos].text
+				p.pos++
+			}
 		}
-	default:
-		g := parseMermaidGraph(code)
-		if len(g.nodeOrder) > 0 {
-			art = asciiFlowchart(g, 80)
+		if !p.is("{") {
+			return nil, false, false
+		}
+		p.pos++
+		cluster := strings.HasPrefix(strings.ToLower(name), "cluster")
+		if cluster {
+			parent := -1
+			if len(p.open) > 0 {
+				parent = p.open[len(p.open)-1]
+			}
+			p.g.groups = append(p.g.groups, mermaidGroup{title: strings.TrimPrefix(strings.TrimPrefix(name, "cluster_"), "cluster"), parent: parent})
+			p.open = append(p.open, len(p.g.groups)-1)
+		}
+		ids := p.stmts()
+		if cluster {
+			p.open = p.open[:len(p.open)-1]
 		}
+		return ids, false, true
 	}
-	if art == "" {
-		return "_Mermaid block: no diagram content parsed._"
+	if p.pos >= len(p.toks) || !p.toks[p.pos].id {
+		return nil, false, false
 	}
-	return "```text\n" + art + "\n```\n"
+	id := p.toks[p.pos].text
+	p.pos++
+	for p.is(":") && p.pos+1 < len(p.toks) {
+		p.pos += 2 // port and compass point
+	}
+	if _, seen := p.g.nodes[id]; !seen {
+		p.g.nodes[id] = cleanMermaidText(id)
+		p.g.nodeOrder = append(p.g.nodeOrder, id)
+	}
+	if _, grouped := p.g.nodeGroup[id]; !grouped && len(p.open) > 0 {
+		p.g.nodeGroup[id] = p.open[len(p.open)-1]
+	}
+	return []string{id}, true, true
 }
 
-func mermaidChartType(code string) string {
-	for _, line := range strings.Split(code, "\n") {
-		trimmed := strings.TrimSpace(line)
-		if trimmed == "" || strings.HasPrefix(trimmed, "%%") {
-			continue
-		}
-		if parts := strings.Fields(trimmed); len(parts) > 0 {
-			return parts[0]
+// attrs parses any bracketed attribute lists, keyed by lower-case name.
+func (p *dotParser) attrs() map[string]string {
+	attrs := make(map[string]string)
+	for p.is("[") {
+		p.pos++
+		for p.pos < len(p.toks) && !p.is("]") {
+			if p.pos+2 < len(p.toks) && p.toks[p.pos].id && p.toks[p.pos+1].text == "=" {
+				attrs[strings.ToLower(p.toks[p.pos].text)] = p.toks[p.pos+2].text
+				p.pos += 3
+				continue
+			}
+			p.pos++
 		}
+		p.pos++
 	}
-	return "diagram"
+	return attrs
 }
 
-// ── ASCII flowchart renderer ──────────────────────────────────────────────────
-
-// boxDrawMask maps box-drawing runes to a 4-bit NESW connectivity mask.
-// N=8 E=4 S=2 W=1 — combining masks via OR produces the correct merged character.
-var boxDrawMask = map[rune]int{
-	'│': 8 + 2, '─': 4 + 1,
-	'┌': 4 + 2, '┐': 1 + 2, '└': 8 + 4, '┘': 8 + 1,
-	'├': 8 + 4 + 2, '┤': 8 + 1 + 2, '┬': 4 + 1 + 2, '┴': 8 + 4 + 1, '┼': 15,
+// graphAttrs applies rankdir, and a cluster's label as its frame title.
+func (p *dotParser) graphAttrs(attrs map[string]string) {
+	if d, ok := attrs["rankdir"]; ok {
+		switch d = strings.ToUpper(d); d {
+		case "LR", "RL", "BT":
+			p.g.direction = d
+		case "TB":
+			p.g.direction = "TD"
+		}
+	}
+	if l, ok := attrs["label"]; ok && len(p.open) > 0 {
+		p.g.groups[p.open[len(p.open)-1]].title = cleanMermaidText(l)
+	}
 }
 
-// maskBoxDraw is the reverse of boxDrawMask.
-var maskBoxDraw = map[int]rune{
-	4 + 2: '┌', 1 + 2: '┐', 8 + 4: '└', 8 + 1: '┘',
-	4 + 1: '─', 8 + 2: '│',
-	8 + 4 + 2: '├', 8 + 1 + 2: '┤', 4 + 1 + 2: '┬', 8 + 4 + 1: '┴', 15: '┼',
-	4: '╶', 1: '╴', 8: '╵', 2: '╷',
+// ── PlantUML and D2 ───────────────────────────────────────────────────────────
+
+// renderPlantUMLPreview draws a PlantUML diagram as text, with plantuml's own
+// text output when it's installed and can produce one (sequence diagrams),
+// otherwise natively for sequence and activity diagrams.
+func renderPlantUMLPreview(text string) string {
+	if commandExists("plantuml") {
+		ctx, cancel := context.WithTimeout(context.Background(), previewerTimeout)
+		cmd := exec.CommandContext(ctx, "plantuml", "-tutxt", "-pipe")
+		cmd.Stdin = strings.NewReader(text)
+		out, err := cmd.Output()
+		cancel()
+		if err == nil && len(bytes.TrimSpace(out)) > 0 {
+			return strings.TrimRight(strings.ToValidUTF8(string(out), ""), "\n")
+		}
+	}
+	if g := parsePlantUMLActivity(text); len(g.nodeOrder) > 0 {
+		return asciiFlowchart(g, 0)
+	}
+	if parts, msgs := parsePlantUMLSequence(text); len(msgs) > 0 {
+		return asciiSequenceDiagram(parts, msgs, 0)
+	}
+	return text
 }
 
-// asciiFlowchart renders a mermaid flowchart as an ASCII box diagram.
-func asciiFlowchart(g mermaidGraph, maxW int) string {
-	if len(g.nodeOrder) == 0 {
-		return "(empty diagram)"
+// plantUMLLines yields the diagram's statements: @start/@end markers,
+// comments, styling and notes are dropped.
+func plantUMLLines(text string) []string {
+	var lines []string
+	inNote, inComment := false, false
+	for _, line := range strings.Split(text, "\n") {
+		t := strings.TrimSpace(line)
+		lower := strings.ToLower(t)
+		switch {
+		case inComment:
+			inComment = !strings.Contains(t, "'/")
+			continue
+		case strings.HasPrefix(t, "/'"):
+			inComment = !strings.Contains(t[2:], "'/")
+			continue
+		case inNote:
+			inNote = !strings.HasPrefix(lower, "end note") && !strings.HasPrefix(lower, "endnote")
+			continue
+		case strings.HasPrefix(lower, "note ") || strings.HasPrefix(lower, "rnote ") || strings.HasPrefix(lower, "hnote "):
+			inNote = !strings.Contains(t, ":")
+			continue
+		case t == "", strings.HasPrefix(t, "'"), strings.HasPrefix(t, "@"), strings.HasPrefix(t, "!"),
+			strings.HasPrefix(lower, "skinparam"), strings.HasPrefix(lower, "title "), strings.HasPrefix(lower, "hide "),
+			strings.HasPrefix(lower, "autonumber"), strings.HasPrefix(t, "|"):
+			continue
+		}
+		lines = append(lines, t)
 	}
+	return lines
+}
 
-	labelOf := func(id string) string {
-		if l := g.nodes[id]; l != "" {
-			return l
+// parsePlantUMLSequence maps PlantUML's sequence syntax onto the mermaid
+// sequence parser: its participant kinds and reversed arrows are rewritten.
+func parsePlantUMLSequence(text string) ([]string, []seqMsg) {
+	var sb strings.Builder
+	for _, t := range plantUMLLines(text) {
+		if f := strings.Fields(t); len(f) > 1 {
+			switch strings.ToLower(f[0]) {
+			case "boundary", "control", "entity", "database", "collections", "queue":
+				t = "participant " + strings.Join(f[1:], " ")
+			}
 		}
-		return id
+		head, label, _ := strings.Cut(t, ":")
+		for _, op := range []string{"<--", "<-"} {
+			if from, to, ok := strings.Cut(head, op); ok {
+				t = strings.TrimSpace(to) + " " + strings.TrimPrefix(op, "<") + "> " + strings.TrimSpace(from)
+				if label != "" {
+					t += " : " + label
+				}
+				break
+			}
+		}
+		sb.WriteString(strings.ReplaceAll(t, `"`, ""))
+		sb.WriteByte('\n')
 	}
-	nodeBoxW := func(id string) int { return len([]rune(labelOf(id))) + 4 }
+	return parseSequenceDiagram(sb.String())
+}
 
-	// Build adjacency and in-degree
-	succMap := make(map[string][]string)
-	tmpIn := make(map[string]int)
-	for id := range g.nodes {
-		tmpIn[id] = 0
+// parsePlantUMLActivity reads the (new) activity syntax — start/stop,
+// :actions;, if/else/endif, while, fork and arrow labels — into a graph.
+// Loops are drawn without their back edge.
+func parsePlantUMLActivity(text string) mermaidGraph {
+	g := mermaidGraph{chartType: "activity", direction: "TD", nodes: make(map[string]string)}
+	type branch struct {
+		from    []string // where each branch starts
+		ends    []string // where finished branches left off
+		hasElse bool
 	}
-	for _, e := range g.edges {
-		if e.from.id == e.to.id {
-			continue
+	var (
+		prev    []string // nodes the next step continues from
+		label   string   // label for the next edge
+		stack   []*branch
+		action  strings.Builder
+		inBlock bool
+		isFlow  bool
+	)
+	add := func(text string) string {
+		id := fmt.Sprintf("n%d", len(g.nodeOrder))
+		g.nodes[id] = fitMermaidLabel(text)
+		g.nodeOrder = append(g.nodeOrder, id)
+		for _, p := range prev {
+			g.edges = append(g.edges, mermaidEdge{from: mermaidNode{id: p}, to: mermaidNode{id: id}, edgeLabel: label})
 		}
-		succMap[e.from.id] = append(succMap[e.from.id], e.to.id)
-		tmpIn[e.to.id]++
+		prev, label = []string{id}, ""
+		return id
 	}
-
-	// Longest-path ranking via Kahn's algorithm
-	rank := make(map[string]int)
-	q := []string{}
-	for id := range g.nodes {
-		if tmpIn[id] == 0 {
-			q = append(q, id)
+	// paren returns the text inside the first (...) after the keyword.
+	paren := func(s string) string {
+		if i := strings.IndexByte(s, '('); i >= 0 {
+			if j := strings.IndexByte(s[i:], ')'); j > 0 {
+				return cleanMermaidText(s[i+1 : i+j])
+			}
 		}
+		return ""
 	}
-	for len(q) > 0 {
-		cur := q[0]
-		q = q[1:]
-		for _, next := range succMap[cur] {
-			if rank[cur]+1 > rank[next] {
-				rank[next] = rank[cur] + 1
-			}
-			tmpIn[next]--
-			if tmpIn[next] == 0 {
-				q = append(q, next)
+	// thenLabel returns the label in "then (...)" or "is (...)".
+	thenLabel := func(s string) string {
+		for _, kw := range []string{" then ", " is "} {
+			if i := strings.Index(strings.ToLower(s), kw); i >= 0 {
+				return paren(s[i:])
 			}
 		}
+		return ""
 	}
 
-	maxRank := 0
-	for _, r := range rank {
-		if r > maxRank {
-			maxRank = r
+	for _, t := range plantUMLLines(text) {
+		lower := strings.ToLower(t)
+		if inBlock || strings.HasPrefix(t, ":") {
+			if !inBlock {
+				t = t[1:]
+			}
+			end := strings.LastIndexAny(t, ";|<>]}/")
+			if end >= 0 && end == len(t)-1 {
+				action.WriteString(t[:end])
+				add(action.String())
+				action.Reset()
+				inBlock = false
+			} else {
+				action.WriteString(t + " ")
+				inBlock = true
+			}
+			isFlow = true
+			continue
+		}
+		switch {
+		case lower == "start":
+			add("start")
+			isFlow = true
+		case lower == "stop" || lower == "end" || lower == "kill" || lower == "detach":
+			if lower != "detach" {
+				add(lower)
+			}
+			prev = nil
+		case strings.HasPrefix(lower, "->"):
+			label = cleanMermaidText(strings.TrimSuffix(strings.TrimSpace(t[2:]), ";"))
+		case strings.HasPrefix(lower, "if ") || strings.HasPrefix(lower, "if(") ||
+			strings.HasPrefix(lower, "while ") || strings.HasPrefix(lower, "while("):
+			cond := paren(t)
+			if !strings.HasSuffix(cond, "?") {
+				cond += "?"
+			}
+			id := add(cond)
+			stack = append(stack, &branch{from: []string{id}})
+			label = thenLabel(t)
+			isFlow = true
+		case strings.HasPrefix(lower, "elseif") || strings.HasPrefix(lower, "else if"):
+			if len(stack) > 0 {
+				b := stack[len(stack)-1]
+				b.ends = append(b.ends, prev...)
+				prev, label = b.from, paren(t)
+				if l := thenLabel(t); l != "" {
+					label += " " + l
+				}
+			}
+		case strings.HasPrefix(lower, "else"), lower == "fork again", lower == "split again":
+			if len(stack) > 0 {
+				b := stack[len(stack)-1]
+				b.ends = append(b.ends, prev...)
+				prev, label, b.hasElse = b.from, paren(t), true
+			}
+		case strings.HasPrefix(lower, "endif"), strings.HasPrefix(lower, "endwhile"), lower == "end fork",
+			lower == "end merge", lower == "end split", strings.HasPrefix(lower, "endfork"):
+			if len(stack) > 0 {
+				b := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				if strings.HasPrefix(lower, "endwhile") {
+					// Leave the loop from its condition.
+					prev, label = b.from, paren(t)
+					continue
+				}
+				prev = append(b.ends, prev...)
+				if !b.hasElse {
+					prev = append(prev, b.from...)
+				}
+			}
+		case lower == "fork", lower == "split":
+			stack = append(stack, &branch{from: prev, hasElse: true})
+			isFlow = true
 		}
 	}
-
-	// Group nodes by rank, preserving nodeOrder within each level
-	levels := make([][]string, maxRank+1)
-	for _, id := range g.nodeOrder {
-		r := rank[id]
-		levels[r] = append(levels[r], id)
+	if !isFlow {
+		return mermaidGraph{}
 	}
+	return g
+}
 
-	// Compute x positions within each level
-	const hGap = 3
-	nodeX := make(map[string]int)
-	levelW := make([]int, maxRank+1)
-	for r, nodes := range levels {
-		x := 0
-		for i, id := range nodes {
-			nodeX[id] = x
-			x += nodeBoxW(id)
-			if i < len(nodes)-1 {
-				x += hGap
+// renderD2Preview draws a D2 diagram as text, with d2's own ASCII renderer
+// when it's installed, otherwise natively: connections and containers as a
+// flowchart, or a sequence diagram for shape: sequence_diagram.
+func renderD2Preview(path, text string) string {
+	if commandExists("d2") {
+		if dir, err := os.MkdirTemp("", "seer-d2-"); err == nil {
+			out := filepath.Join(dir, "preview.txt")
+			ctx, cancel := context.WithTimeout(context.Background(), previewerTimeout)
+			err = exec.CommandContext(ctx, "d2", path, out).Run()
+			cancel()
+			art, readErr := os.ReadFile(out)
+			os.RemoveAll(dir)
+			if err == nil && readErr == nil && len(bytes.TrimSpace(art)) > 0 {
+				return strings.TrimRight(strings.ToValidUTF8(string(art), ""), "\n")
 			}
 		}
-		levelW[r] = x
 	}
-
-	totalW := 1
-	for _, lw := range levelW {
-		if lw > totalW {
-			totalW = lw
+	g, sequence := parseD2Graph(text)
+	if sequence && len(g.edges) > 0 {
+		var parts []string
+		var msgs []seqMsg
+		for _, e := range g.edges {
+			for _, id := range []string{e.from.id, e.to.id} {
+				if !slices.Contains(parts, g.nodes[id]) {
+					parts = append(parts, g.nodes[id])
+				}
+			}
+			msgs = append(msgs, seqMsg{from: g.nodes[e.from.id], to: g.nodes[e.to.id], label: e.edgeLabel})
 		}
+		return asciiSequenceDiagram(parts, msgs, 0)
 	}
-	if maxW > 0 && totalW > maxW {
-		totalW = maxW
+	if len(g.nodeOrder) == 0 {
+		return text
 	}
+	return asciiFlowchart(g, 0)
+}
 
-	// Center each level within totalW
-	for r, lw := range levelW {
-		off := (totalW - lw) / 2
-		if off < 0 {
-			off = 0
+// d2Reserved are D2 keywords that set properties rather than name shapes.
+var d2Reserved = map[string]bool{
+	"label": true, "shape": true, "style": true, "icon": true, "near": true,
+	"width": true, "height": true, "tooltip": true, "link": true, "class": true,
+	"classes": true, "vars": true, "direction": true, "constraint": true,
+	"source-arrowhead": true, "target-arrowhead": true, "grid-rows": true,
+	"grid-columns": true, "grid-gap": true, "top": true, "left": true, "layers": true,
+	"scenarios": true, "steps": true, "title": true,
+}
+
+// parseD2Graph reads D2 shapes, connections and containers into a graph;
+// containers become subgraphs. It reports whether any shape is a sequence
+// diagram.
+func parseD2Graph(text string) (mermaidGraph, bool) {
+	g := mermaidGraph{chartType: "d2", direction: "TD", nodes: make(map[string]string), nodeGroup: make(map[string]int)}
+	groupOf := make(map[string]int) // container path → group
+	labels := make(map[string]string)
+	var scope []string // enclosing container keys
+	var skip []bool    // whether each open block is a property map rather than a container
+	sequence := false
+	inBlockString := false
+
+	qualify := func(key string) string {
+		key = strings.Trim(strings.TrimSpace(key), `"'`)
+		return strings.Join(append(slices.Clone(scope), key), ".")
+	}
+	var container func(path string) int
+	container = func(path string) int {
+		if gi, ok := groupOf[path]; ok {
+			return gi
 		}
-		for _, id := range levels[r] {
-			nodeX[id] += off
+		parent := -1
+		if i := strings.LastIndexByte(path, '.'); i >= 0 {
+			parent = container(path[:i])
 		}
+		g.groups = append(g.groups, mermaidGroup{title: path[strings.LastIndexByte(path, '.')+1:], parent: parent})
+		groupOf[path] = len(g.groups) - 1
+		return len(g.groups) - 1
 	}
-
-	// Y positions: 3 rows per box + 2 connector rows between levels
-	nodeY := make(map[string]int)
-	y := 0
-	for r, nodes := range levels {
-		for _, id := range nodes {
-			nodeY[id] = y
-		}
-		y += 3
-		if r < maxRank {
-			y += 2
+	node := func(path string) {
+		if _, seen := g.nodes[path]; seen {
+			return
 		}
+		g.nodes[path] = path[strings.LastIndexByte(path, '.')+1:]
+		g.nodeOrder = append(g.nodeOrder, path)
 	}
-	totalH := y
-
-	// Grid
-	grid := make([][]rune, totalH)
-	for i := range grid {
-		grid[i] = make([]rune, totalW)
-		for j := range grid[i] {
-			grid[i][j] = ' '
+	// property handles "key: value" where key's last part is a keyword.
+	property := func(owner, prop, value string) {
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		switch prop {
+		case "direction":
+			if owner == "" {
+				switch value {
+				case "right":
+					g.direction = "LR"
+				case "left":
+					g.direction = "RL"
+				case "up":
+					g.direction = "BT"
+				}
+			}
+		case "shape":
+			sequence = sequence || value == "sequence_diagram"
+		case "label":
+			if owner != "" {
+				labels[owner] = value
+			}
 		}
 	}
 
-	setRaw := func(x, y int, r rune) {
-		if x >= 0 && x < totalW && y >= 0 && y < totalH {
-			grid[y][x] = r
+	for _, line := range strings.Split(text, "\n") {
+		t := strings.TrimSpace(line)
+		if inBlockString {
+			inBlockString = !strings.HasSuffix(t, "|") && !strings.HasSuffix(t, "|`")
+			continue
 		}
-	}
-	// setBox merges box-drawing characters so branching connectors combine cleanly.
-	setBox := func(x, y int, r rune) {
-		if x < 0 || x >= totalW || y < 0 || y >= totalH {
-			return
+		if i := strings.Index(t, "#"); i >= 0 && !strings.Contains(t[:i], `"`) {
+			t = strings.TrimSpace(t[:i])
 		}
-		existing := grid[y][x]
-		if existing == ' ' {
-			grid[y][x] = r
-			return
+		if t == "" {
+			continue
 		}
-		em, ok1 := boxDrawMask[existing]
-		nm, ok2 := boxDrawMask[r]
-		if ok1 && ok2 {
-			if merged, ok3 := maskBoxDraw[em|nm]; ok3 {
-				grid[y][x] = merged
-				return
+		if t == "}" {
+			if n := len(skip); n > 0 {
+				if !skip[n-1] {
+					scope = scope[:len(scope)-1]
+				}
+				skip = skip[:n-1]
 			}
+			continue
 		}
-		grid[y][x] = r
-	}
-	writeStr := func(x, y int, s string) {
-		for i, r := range []rune(s) {
-			setRaw(x+i, y, r)
+		opens := strings.HasSuffix(t, "{")
+		t = strings.TrimSpace(strings.TrimSuffix(t, "{"))
+
+		// Split off the value or connection label after the first top-level colon.
+		head, value, hasValue := strings.Cut(t, ":")
+		value = strings.TrimSpace(value)
+		var inline []string // properties of a one-line {k: v; ...} map
+		switch {
+		case strings.HasPrefix(value, "|"):
+			inBlockString = !strings.HasSuffix(value[1:], "|")
+			value = ""
+		case strings.HasSuffix(value, "}") && strings.Contains(value, "{"):
+			i := strings.IndexByte(value, '{')
+			inline = strings.Split(value[i+1:len(value)-1], ";")
+			value = strings.TrimSpace(value[:i])
 		}
-	}
 
-	// Draw boxes
-	for id := range g.nodes {
-		label := labelOf(id)
-		x, yy, w := nodeX[id], nodeY[id], nodeBoxW(id)
-		setRaw(x, yy, '┌')
-		for i := 1; i < w-1; i++ {
-			setRaw(x+i, yy, '─')
+		var ends []string
+		var arrows []string
+		rest := head
+		for {
+			i, op := -1, ""
+			for _, candidate := range []string{"<->", "->", "<-", "--"} {
+				if j := strings.Index(rest, candidate); j >= 0 && (i < 0 || j < i) {
+					i, op = j, candidate
+				}
+			}
+			if i < 0 {
+				break
+			}
+			ends = append(ends, rest[:i])
+			arrows = append(arrows, op)
+			rest = rest[i+len(op):]
 		}
-		setRaw(x+w-1, yy, '┐')
-		setRaw(x, yy+1, '│')
-		writeStr(x+2, yy+1, label)
-		setRaw(x+w-1, yy+1, '│')
-		setRaw(x, yy+2, '└')
-		for i := 1; i < w-1; i++ {
-			setRaw(x+i, yy+2, '─')
+		if len(arrows) > 0 {
+			ends = append(ends, rest)
+			for i, op := range arrows {
+				from, to := qualify(ends[i]), qualify(ends[i+1])
+				if op == "<-" {
+					from, to = to, from
+				}
+				node(from)
+				node(to)
+				g.edges = append(g.edges, mermaidEdge{from: mermaidNode{id: from}, to: mermaidNode{id: to}, edgeLabel: cleanMermaidText(value)})
+			}
+			if opens {
+				skip = append(skip, true)
+			}
+			continue
 		}
-		setRaw(x+w-1, yy+2, '┘')
-	}
 
-	// Draw edges between adjacent-rank nodes
-	for _, e := range g.edges {
-		fid, tid := e.from.id, e.to.id
-		if fid == tid || rank[fid]+1 != rank[tid] {
+		key := strings.Trim(strings.TrimSpace(head), `"'`)
+		parts := strings.Split(key, ".")
+		last := parts[len(parts)-1]
+		if d2Reserved[last] || strings.HasPrefix(last, "style") {
+			owner := ""
+			if len(parts) > 1 {
+				owner = qualify(strings.Join(parts[:len(parts)-1], "."))
+			} else if len(scope) > 0 {
+				owner = strings.Join(scope, ".")
+			}
+			if hasValue {
+				property(owner, last, value)
+			}
+			if opens {
+				skip = append(skip, true)
+			}
 			continue
 		}
-		fw := nodeBoxW(fid)
-		fcx := nodeX[fid] + fw/2
-		row1 := nodeY[fid] + 3 // first connector row
-
-		tw := nodeBoxW(tid)
-		tcx := nodeX[tid] + tw/2
-
-		switch {
-		case fcx == tcx:
-			// Straight down: │ then ▼
-			setBox(fcx, row1, '│')
-			setRaw(tcx, row1+1, '▼')
-		case fcx < tcx:
-			// Go right: └────┐ then ▼
-			setBox(fcx, row1, '└')
-			for x := fcx + 1; x < tcx; x++ {
-				setBox(x, row1, '─')
-			}
-			setBox(tcx, row1, '┐')
-			setRaw(tcx, row1+1, '▼')
-		default:
-			// Go left: ┌────┘ then ▼
-			setBox(tcx, row1, '┌')
-			for x := tcx + 1; x < fcx; x++ {
-				setBox(x, row1, '─')
+		path := qualify(key)
+		if hasValue && value != "" {
+			labels[path] = value
+		}
+		for _, prop := range inline {
+			if k, v, ok := strings.Cut(prop, ":"); ok {
+				property(path, strings.TrimSpace(k), v)
 			}
-			setBox(fcx, row1, '┘')
-			setRaw(tcx, row1+1, '▼')
+		}
+		node(path)
+		if opens {
+			container(path)
+			scope = append(scope, key)
+			skip = append(skip, false)
 		}
 	}
 
-	var sb strings.Builder
-	for _, row := range grid {
-		sb.WriteString(strings.TrimRight(string(row), " "))
-		sb.WriteByte('\n')
+	// Containers with shapes inside aren't boxes unless something connects
+	// to them directly.
+	connected := make(map[string]bool)
+	for _, e := range g.edges {
+		connected[e.from.id], connected[e.to.id] = true, true
 	}
-	return strings.TrimRight(sb.String(), "\n")
+	order := g.nodeOrder[:0]
+	for _, id := range g.nodeOrder {
+		isContainer := false
+		for _, other := range g.nodeOrder {
+			if strings.HasPrefix(other, id+".") {
+				isContainer = true
+				break
+			}
+		}
+		if isContainer && !connected[id] {
+			delete(g.nodes, id)
+			continue
+		}
+		order = append(order, id)
+	}
+	g.nodeOrder = order
+	for _, id := range g.nodeOrder {
+		if i := strings.LastIndexByte(id, '.'); i >= 0 {
+			g.nodeGroup[id] = container(id[:i])
+		}
+		if l := labels[id]; l != "" {
+			g.nodes[id] = cleanMermaidText(l)
+		}
+	}
+	for path, gi := range groupOf {
+		if l := labels[path]; l != "" {
+			g.groups[gi].title = cleanMermaidText(l)
+		}
+	}
+	return g, sequence
 }
 
 // ── ASCII sequence diagram renderer ──────────────────────────────────────────
@@ -2411,6 +19746,19 @@ func parseMermaidGraph(code string) mermaidGraph {
 
 	nodeOrder := make([]string, 0)
 	nodes := make(map[string]string)
+	direction := "TD"
+	var groups []mermaidGroup
+	nodeGroup := make(map[string]int)
+	var open []int // subgraphs enclosing the current line, innermost last
+
+	// place records a node in the innermost open subgraph the first time
+	// it's mentioned inside one.
+	place := func(n mermaidNode) {
+		registerMermaidNode(nodes, &nodeOrder, n)
+		if _, seen := nodeGroup[n.id]; n.id != "" && !seen && len(open) > 0 {
+			nodeGroup[n.id] = open[len(open)-1]
+		}
+	}
 
 	for _, line := range lines {
 		trimmed := strings.TrimSpace(line)
@@ -2422,22 +19770,59 @@ func parseMermaidGraph(code string) mermaidGraph {
 			if len(parts) > 0 {
 				chartType = parts[0]
 			}
+			if len(parts) > 1 && (parts[0] == "graph" || parts[0] == "flowchart") {
+				switch d := strings.ToUpper(strings.TrimSuffix(parts[1], ";")); d {
+				case "LR", "RL", "BT":
+					direction = d
+				}
+			}
+		}
+
+		keyword := strings.ToLower(strings.Fields(trimmed)[0])
+		switch keyword {
+		case "subgraph":
+			rest := strings.TrimSpace(trimmed[len(keyword):])
+			title := cleanMermaidText(rest)
+			if strings.ContainsAny(rest, "[(") {
+				title = parseMermaidNode(rest).label
+			}
+			parent := -1
+			if len(open) > 0 {
+				parent = open[len(open)-1]
+			}
+			groups = append(groups, mermaidGroup{title: title, parent: parent})
+			open = append(open, len(groups)-1)
+			continue
+		case "end", "end;":
+			if len(open) > 0 {
+				open = open[:len(open)-1]
+			}
+			continue
+		case "direction", "style", "classdef", "class", "click", "linkstyle":
+			continue
 		}
 
 		edge, ok := parseMermaidEdge(trimmed)
 		if !ok {
+			// Subgraphs usually declare their members on lines of their own.
+			if len(open) > 0 {
+				place(parseMermaidNode(trimmed))
+			}
 			continue
 		}
 		edges = append(edges, edge)
-		registerMermaidNode(nodes, &nodeOrder, edge.from)
-		registerMermaidNode(nodes, &nodeOrder, edge.to)
+		place(edge.from)
+		place(edge.to)
 	}
 
 	return mermaidGraph{
 		chartType: chartType,
+		direction: direction,
 		nodeOrder: nodeOrder,
 		nodes:     nodes,
 		edges:     edges,
+		groups:    groups,
+		nodeGroup: nodeGroup,
 	}
 }
 
@@ -2563,9 +19948,10 @@ func listDir(path string, showHidden bool) ([]entry, error) {
 	}
 
 	entries := make([]entry, 0, len(items))
+	sniffs := 0
 	for _, item := range items {
 		name := item.Name()
-		if !showHidden && strings.HasPrefix(name, ".") {
+		if !showHidden && isHiddenDirEntry(item) {
 			continue
 		}
 		full := filepath.Join(path, name)
@@ -2573,26 +19959,75 @@ func listDir(path string, showHidden bool) ([]entry, error) {
 		if err != nil {
 			continue
 		}
+		owner, group := fileOwner(info)
 		entries = append(entries, entry{
 			name:    name,
 			path:    full,
 			isDir:   item.IsDir(),
 			size:    info.Size(),
 			modTime: info.ModTime(),
+			mode:    info.Mode(),
+			owner:   owner,
+			group:   group,
+			ignored: isIgnoredName(name),
 		})
+		if item.IsDir() {
+			entries[len(entries)-1].repo = repoKind(full)
+		}
+		// Only regular files are read: opening a FIFO would block.
+		if e := &entries[len(entries)-1]; info.Mode().IsRegular() && categorise(*e) == catOther && sniffs < maxSniffedEntries {
+			e.sniffed = sniffFile(full)
+			sniffs++
+		}
 	}
 
+	sortEntries(entries, userConfig.dirs)
+	return entries, nil
+}
+
+// sortEntries orders entries by name, grouping directories before or after
+// files per the dirs setting ("first", "last" or "mixed").
+func sortEntries(entries []entry, dirs string) {
 	sort.Slice(entries, func(i, j int) bool {
-		if entries[i].isDir != entries[j].isDir {
-			return entries[i].isDir
+		if dirs != "mixed" && entries[i].isDir != entries[j].isDir {
+			return entries[i].isDir != (dirs == "last")
 		}
 		return strings.ToLower(entries[i].name) < strings.ToLower(entries[j].name)
 	})
+}
 
-	return entries, nil
+// ownerNames caches uid/gid → name lookups, which read the user database.
+var ownerNames sync.Map
+
+func lookupID(kind string, id uint64) string {
+	key := kind + strconv.FormatUint(id, 10)
+	if name, ok := ownerNames.Load(key); ok {
+		return name.(string)
+	}
+	name := strconv.FormatUint(id, 10)
+	if kind == "u" {
+		if u, err := user.LookupId(name); err == nil {
+			name = u.Username
+		}
+	} else if g, err := user.LookupGroupId(name); err == nil {
+		name = g.Name
+	}
+	ownerNames.Store(key, name)
+	return name
 }
 
+// ── trash ─────────────────────────────────────────────────────────────────────
+
+// moveToTrash moves path into the platform trash: ~/.Trash on macOS and the
+// FreeDesktop.org trash (with .trashinfo records) elsewhere.
 func moveToTrash(path string) error {
+	if runtime.GOOS == "darwin" {
+		return moveToMacTrash(path)
+	}
+	return moveToXDGTrash(path)
+}
+
+func moveToMacTrash(path string) error {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return err
@@ -2627,20 +20062,245 @@ func moveToTrash(path string) error {
 	return os.Rename(path, destPath)
 }
 
-func previewKey(path string, modTime time.Time, size int64, width, height int) string {
-	return fmt.Sprintf("%s|%d|%d|%d|%d", path, modTime.UnixNano(), size, width, height)
+// moveToXDGTrash implements the FreeDesktop.org trash specification. Files on
+// the home filesystem go to $XDG_DATA_HOME/Trash; files on other mounts go to
+// $topdir/.Trash/$uid (when an admin-created, sticky .Trash exists) or
+// $topdir/.Trash-$uid, so the move stays a cheap rename on the same device.
+func moveToXDGTrash(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(abs); err != nil {
+		return err
+	}
+	// Resolve the parent so symlinked directories map to their real mount;
+	// a symlink being trashed is moved itself, not its target.
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(abs)); err == nil {
+		abs = filepath.Join(dir, filepath.Base(abs))
+	}
+
+	homeTrash := filepath.Join(xdgDataHome(), "Trash")
+	mounts := readMountPoints()
+	top := mountPointOf(abs, mounts)
+	homeTop := mountPointOf(existingAncestor(homeTrash), mounts)
+	if top == "" || top == homeTop {
+		return trashInto(homeTrash, abs, abs)
+	}
+
+	rel, err := filepath.Rel(top, abs)
+	if err != nil {
+		return err
+	}
+	uid := strconv.Itoa(os.Getuid())
+	if dir, ok := adminTrashDir(top); ok {
+		if err := trashInto(filepath.Join(dir, uid), abs, rel); err == nil {
+			return nil
+		}
+	}
+	if err := trashInto(filepath.Join(top, ".Trash-"+uid), abs, rel); err == nil {
+		return nil
+	}
+	// No usable trash on that mount; the home trash only works if the
+	// rename happens to succeed (e.g. bind mounts of the same device).
+	return trashInto(homeTrash, abs, abs)
+}
+
+// trashInto moves path into trashDir/files and records it in
+// trashDir/info/<name>.trashinfo. infoPath is the Path= value: absolute for
+// the home trash, relative to the mount point for per-mount trashes.
+func trashInto(trashDir, path, infoPath string) error {
+	filesDir := filepath.Join(trashDir, "files")
+	infoDir := filepath.Join(trashDir, "info")
+	if err := os.MkdirAll(filesDir, 0o700); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(infoDir, 0o700); err != nil {
+		return err
+	}
+
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	if stem == "" {
+		stem, ext = base, ""
+	}
+	record := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: filepath.ToSlash(infoPath)}).EscapedPath(),
+		time.Now().Format("2006-01-02T15:04:05"))
+
+	for i := 1; ; i++ {
+		name := base
+		if i > 1 {
+			name = fmt.Sprintf("%s.%d%s", stem, i, ext)
+		}
+		// Creating the info file exclusively reserves the name atomically.
+		infoFile := filepath.Join(infoDir, name+".trashinfo")
+		f, err := os.OpenFile(infoFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		_, writeErr := f.WriteString(record)
+		closeErr := f.Close()
+		if writeErr == nil {
+			writeErr = closeErr
+		}
+		if writeErr != nil {
+			os.Remove(infoFile)
+			return writeErr
+		}
+		if _, err := os.Lstat(filepath.Join(filesDir, name)); err == nil {
+			// Orphaned payload without an info record; keep it and try the next name.
+			os.Remove(infoFile)
+			continue
+		}
+		if err := os.Rename(path, filepath.Join(filesDir, name)); err != nil {
+			os.Remove(infoFile)
+			return err
+		}
+		return nil
+	}
+}
+
+// adminTrashDir returns $topdir/.Trash when it satisfies the spec: a real
+// directory (not a symlink) with the sticky bit set.
+func adminTrashDir(top string) (string, bool) {
+	dir := filepath.Join(top, ".Trash")
+	info, err := os.Lstat(dir)
+	if err != nil || !info.IsDir() || info.Mode()&os.ModeSticky == 0 {
+		return "", false
+	}
+	return dir, true
+}
+
+func xdgDataHome() string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".local/share"
+	}
+	return filepath.Join(home, ".local", "share")
+}
+
+// readMountPoints lists mount points from /proc/self/mountinfo. It returns
+// nil where that file does not exist, which makes every path share the home
+// trash.
+func readMountPoints() []string {
+	data, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return nil
+	}
+	var mounts []string
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			continue
+		}
+		mounts = append(mounts, unescapeMountPath(fields[4]))
+	}
+	return mounts
+}
+
+// unescapeMountPath decodes the octal escapes (\040 for space, …) used in
+// mountinfo paths.
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				sb.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// mountPointOf returns the longest mount point containing path.
+func mountPointOf(path string, mounts []string) string {
+	best := ""
+	for _, mp := range mounts {
+		if path != mp && !strings.HasPrefix(path, strings.TrimSuffix(mp, "/")+"/") {
+			continue
+		}
+		if len(mp) > len(best) {
+			best = mp
+		}
+	}
+	return best
+}
+
+// existingAncestor walks up from path to the nearest directory that exists.
+func existingAncestor(path string) string {
+	for {
+		if _, err := os.Stat(path); err == nil {
+			if resolved, err := filepath.EvalSymlinks(path); err == nil {
+				return resolved
+			}
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
+
+func previewKey(path string, modTime time.Time, size int64, width, height int, opts previewOptions) string {
+	return fmt.Sprintf("%s|%d|%d|%d|%d|%+v", path, modTime.UnixNano(), size, width, height, opts)
+}
+
+// builtPreviewKey is the cache key for e's preview built at width x height.
+// Previews that don't depend on the pane size are keyed with a zero size, so
+// they survive resizes and layout changes.
+func builtPreviewKey(e entry, width, height int, opts previewOptions, sized bool) string {
+	if !sized {
+		width, height = 0, 0
+	}
+	return previewKey(e.path, e.modTime, e.size, width, height, opts)
+}
+
+// cachedPreview looks e's preview up in the cache, first as built for any
+// pane size and then as built for width x height.
+func (m model) cachedPreview(e entry, width, height int, opts previewOptions) (string, bool) {
+	if val, ok := m.cache[builtPreviewKey(e, width, height, opts, false)]; ok {
+		return val, true
+	}
+	val, ok := m.cache[builtPreviewKey(e, width, height, opts, true)]
+	return val, ok
 }
 
 func highlight(path, text string) string {
 	lexer := lexers.Match(path)
+	if lexer == nil {
+		if ext := sniffExt(filepath.Base(path), text); ext != "" {
+			lexer = lexers.Match("file" + ext)
+		}
+	}
 	if lexer == nil {
 		lexer = lexers.Analyse(text)
 	}
 	if lexer == nil {
 		lexer = lexers.Fallback
 	}
+	return highlightWith(lexer, text)
+}
 
-	style := styles.Get("nord")
+// highlightWith colours text with a specific lexer, for code whose language
+// is named rather than implied by a file name.
+func highlightWith(lexer chroma.Lexer, text string) string {
+	style := styles.Get(chromaStyleName)
 	if style == nil {
 		style = styles.Fallback
 	}
@@ -2730,9 +20390,91 @@ func max(a, b int) int {
 	return b
 }
 
+// ── ls subcommand ─────────────────────────────────────────────────────────────
+
+// lsEntry is the JSON shape emitted by `seer ls --json`.
+type lsEntry struct {
+	Name     string    `json:"name"`
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mtime"`
+	Category string    `json:"category"`
+	IsDir    bool      `json:"isDir"`
+}
+
+// runLs prints a directory listing using the same listDir/categorise logic as
+// the TUI, either as aligned text or as a JSON array.
+func runLs(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("ls", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "emit the listing as a JSON array")
+	showHidden := fs.Bool("a", false, "include hidden entries")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: seer ls [--json] [-a] [directory]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	dir := "."
+	if fs.NArg() > 0 {
+		dir = fs.Arg(0)
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	// Honour the configured directory grouping; a broken config is reported
+	// by the TUI, not here.
+	if cfg, err := loadConfig(); err == nil {
+		userConfig = cfg
+	}
+	entries, err := listDir(dir, *showHidden)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		items := make([]lsEntry, 0, len(entries))
+		for _, e := range entries {
+			items = append(items, lsEntry{
+				Name:     e.name,
+				Path:     e.path,
+				Size:     e.size,
+				ModTime:  e.modTime,
+				Category: categorise(e).String(),
+				IsDir:    e.isDir,
+			})
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(items)
+	}
+
+	for _, e := range entries {
+		name := e.name
+		size := humanSize(e.size)
+		if e.isDir {
+			name += "/"
+			size = "-"
+		}
+		fmt.Fprintf(out, "%-7s %9s  %s  %s\n", categorise(e), size, e.modTime.Format("Jan 02 15:04"), name)
+	}
+	return nil
+}
+
 func main() {
 	if len(os.Args) > 1 {
 		switch os.Args[1] {
+		case "ls":
+			if err := runLs(os.Args[2:], os.Stdout); err != nil {
+				if errors.Is(err, flag.ErrHelp) {
+					return
+				}
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			return
 		case "--version", "-v":
 			fmt.Println("seer " + version)
 			return
@@ -2742,6 +20484,10 @@ func main() {
 			fmt.Println("A dead-simple TUI for browsing directories and previewing files.")
 			fmt.Println()
 			fmt.Println("Usage: seer [directory]")
+			fmt.Println("       seer ls [--json] [-a] [directory]")
+			fmt.Println()
+			fmt.Println("Commands:")
+			fmt.Println("  ls              Print the directory listing (--json for machine-readable output)")
 			fmt.Println()
 			fmt.Println("Options:")
 			fmt.Println("  -h, --help      Show this help message")
@@ -2751,8 +20497,15 @@ func main() {
 	}
 
 	p := tea.NewProgram(initialModel(), tea.WithAltScreen(), tea.WithMouseCellMotion())
-	if _, err := p.Run(); err != nil {
+	final, err := p.Run()
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
+	// Visits since the last background save.
+	if m, ok := final.(model); ok && m.frecencyDirty {
+		if err := saveFrecency(m.frecency); err != nil {
+			fmt.Fprintf(os.Stderr, "frecency: %v\n", err)
+		}
+	}
 }
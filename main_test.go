@@ -0,0 +1,479 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// bplist builds a bplist00 file holding the single object obj, with one-byte
+// offsets and references.
+func bplist(obj []byte) []byte {
+	data := append([]byte("bplist00"), obj...)
+	tableOffset := len(data)
+	data = append(data, 8) // the object's offset
+	trailer := make([]byte, 32)
+	trailer[6], trailer[7] = 1, 1
+	binary.BigEndian.PutUint64(trailer[8:16], 1)
+	binary.BigEndian.PutUint64(trailer[24:32], uint64(tableOffset))
+	return append(data, trailer...)
+}
+
+func TestDecodeBinaryPlistMalformed(t *testing.T) {
+	huge := []byte{0x13, 0x80, 0, 0, 0, 0, 0, 0, 0} // int 1<<63 as a length
+	tests := map[string][]byte{
+		"dict count overflows":  bplist(append([]byte{0xdf}, huge...)),
+		"utf16 count overflows": bplist(append([]byte{0x6f}, huge...)),
+		"array count overflows": bplist(append([]byte{0xaf}, huge...)),
+		"dict refs truncated":   bplist([]byte{0xd3, 0}),
+		"string truncated":      bplist([]byte{0x5f, 0x10, 0x40, 'a'}),
+		"trailer only":          append([]byte("bplist00"), make([]byte, 32)...),
+		"shorter than trailer":  []byte("bplist00\x00\x01"),
+	}
+	for name, data := range tests {
+		if _, err := decodeBinaryPlist(data); err == nil {
+			t.Errorf("%s: decoded without error", name)
+		}
+	}
+}
+
+func TestDecodeCBORIndefiniteStrings(t *testing.T) {
+	tests := map[string]struct {
+		data []byte
+		want interface{}
+	}{
+		"bytes": {[]byte{0x5f, 0x42, 0x01, 0x02, 0x41, 0x03, 0xff}, "<3 bytes: 010203>"},
+		"text":  {[]byte{0x7f, 0x62, 'h', 'i', 0x61, '!', 0xff}, "hi!"},
+	}
+	for name, tt := range tests {
+		d := &binDecoder{data: tt.data}
+		if got, err := d.cbor(0); err != nil || got != tt.want {
+			t.Errorf("%s: got %v, %v; want %v", name, got, err, tt.want)
+		}
+	}
+	d := &binDecoder{data: []byte{0x5f, 0x61, 'x', 0xff}}
+	if _, err := d.cbor(0); err == nil {
+		t.Error("text chunk in a byte string: decoded without error")
+	}
+}
+
+func TestParseProtoOutlineIncompleteRPC(t *testing.T) {
+	for _, src := range []string{
+		"service S {\n  rpc",
+		"service S { rpc ; }",
+		"service S { rpc Get",
+		"service S { rpc }",
+	} {
+		parseProtoOutline(src) // must not panic
+	}
+	_, _, items := parseProtoOutline("service S { rpc Get (Req) returns (Resp); }")
+	if len(items) != 2 || items[1].name != "Get" || items[1].detail != "(Req) returns (Resp)" {
+		t.Errorf("complete rpc: got %+v", items)
+	}
+}
+
+func TestRasterizeSVGHugeValues(t *testing.T) {
+	for _, src := range []string{
+		`<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><path d="M0 0 A1e200 1e200 0 1 1 5 5" stroke="black"/></svg>`,
+		`<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><rect width="1e308" height="1e308" stroke="black" stroke-width="1e308"/></svg>`,
+		`<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><circle r="1e308" fill="red"/></svg>`,
+		`<svg xmlns="http://www.w3.org/2000/svg" width="10" height="10"><path d="M0 0 L1e39 1e39 L-1e39 5z" fill="red"/></svg>`,
+	} {
+		if _, err := rasterizeSVG([]byte(src), 32, 32); err != nil {
+			t.Errorf("%s: %v", src, err)
+		}
+	}
+}
+
+func TestMaskSecrets(t *testing.T) {
+	tests := map[string]struct {
+		text, want string
+		count      int
+	}{
+		"env": {
+			"export API_KEY=abc123\nNAME=seer\nDB_PASSWORD=\"pw\"",
+			"export API_KEY=" + secretMask + "\nNAME=seer\nDB_PASSWORD=\"" + secretMask + "\"", 2,
+		},
+		"ini": {
+			"[db]\npassword = hunter2\n; token = old\nhost = localhost",
+			"[db]\npassword = " + secretMask + "\n; token = old\nhost = localhost", 1,
+		},
+		"yaml block": {
+			"password: |\n    hunter2\n\n    more\napi_key: >-\n  abcdef123\nname: seer",
+			"password: |\n    " + secretMask + "\n\n    " + secretMask + "\napi_key: >-\n  " + secretMask + "\nname: seer", 2,
+		},
+		"nested yaml block": {
+			"tls:\n  private_key: |\n    -----BEGIN KEY-----\n    MIIE\n  cert: c.pem",
+			"tls:\n  private_key: |\n    " + secretMask + "\n    " + secretMask + "\n  cert: c.pem", 1,
+		},
+		"json": {
+			"{\n  \"token\": \"abc\",\n  \"port\": 80,\n  \"auth\": {\n    \"key\": 42\n  }\n}",
+			"{\n  \"token\": \"" + secretMask + "\",\n  \"port\": 80,\n  \"auth\": {\n    \"key\": " + secretMask + "\n  }\n}", 2,
+		},
+	}
+	for name, tt := range tests {
+		if got, count := maskSecrets(tt.text); got != tt.want || count != tt.count {
+			t.Errorf("%s: got %d masked:\n%s\nwant %d:\n%s", name, count, got, tt.count, tt.want)
+		}
+	}
+}
+
+func TestMaskJSONSecrets(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/config.json"
+	doc := `{"apiKey": "abc", "name": "seer", "db": {"password": "pw", "port": 5432}, "tokens": [{"token": 7}]}`
+	if err := os.WriteFile(path, []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	v, masked, err := readJSONDocument(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := v.(map[string]interface{})
+	if masked != 3 || root["apiKey"] != secretMask || root["name"] != "seer" ||
+		root["db"].(map[string]interface{})["password"] != secretMask {
+		t.Errorf("masked %d: %v", masked, root)
+	}
+	if v, masked, _ = readJSONDocument(path, true); masked != 0 || v.(map[string]interface{})["apiKey"] != "abc" {
+		t.Errorf("revealed: masked %d: %v", masked, v)
+	}
+}
+
+// wav builds a RIFF WAVE file from its chunks.
+func wav(chunks ...[]byte) []byte {
+	data := []byte("RIFF\x00\x00\x00\x00WAVE")
+	for _, c := range chunks {
+		data = append(data, c...)
+	}
+	return data
+}
+
+func TestDecodeWAVLimits(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.wav")
+	// A fmt chunk claiming 4 GiB must not be allocated.
+	if err := os.WriteFile(path, wav([]byte("fmt \xff\xff\xff\xff\x01\x00")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := decodeWAV(context.Background(), path, 16); err == nil {
+		t.Error("huge fmt chunk: decoded without error")
+	}
+
+	format := []byte("fmt \x10\x00\x00\x00\x01\x00\x01\x00\x44\xac\x00\x00\x88\x58\x01\x00\x02\x00\x10\x00")
+	samples := make([]byte, 2*10000)
+	data := append([]byte("data\x20\x4e\x00\x00"), samples...)
+	if err := os.WriteFile(path, wav(format, data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, wave, err := decodeWAV(context.Background(), path, 16)
+	if err != nil || info.frames != 10000 || wave.n != 10000 {
+		t.Fatalf("decoded %d of %d frames: %v", wave.n, info.frames, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, wave, _ := decodeWAV(ctx, path, 16); wave.n != 0 {
+		t.Errorf("cancelled: decoded %d frames", wave.n)
+	}
+}
+
+// tarOf builds a tar archive; a header with Linkname set is a symlink.
+func tarOf(t *testing.T, hdrs ...tar.Header) *bytes.Buffer {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, h := range hdrs {
+		switch {
+		case h.Linkname != "":
+			h.Typeflag = tar.TypeSymlink
+		case h.Typeflag == 0:
+			h.Typeflag = tar.TypeReg
+		}
+		if err := tw.WriteHeader(&h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestUntarSymlinkEscapes(t *testing.T) {
+	tests := map[string][]tar.Header{
+		"through a link to the parent": {
+			{Name: "b/", Typeflag: tar.TypeDir, Mode: 0o755},
+			{Name: "b/up", Linkname: ".."},
+			{Name: "b/up/esc", Linkname: ".."},
+		},
+		"onto an extracted link": {
+			{Name: "b/", Typeflag: tar.TypeDir, Mode: 0o755},
+			{Name: "s", Linkname: "b"},
+			{Name: "s", Mode: 0o644},
+		},
+		"absolute link":     {{Name: "a", Linkname: "/"}},
+		"link above dest":   {{Name: "a", Linkname: "../.."}},
+		"dot-dot file name": {{Name: "../x", Mode: 0o644}},
+	}
+	for name, hdrs := range tests {
+		root := t.TempDir()
+		dest := filepath.Join(root, "dest")
+		if err := os.Mkdir(dest, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := untar(context.Background(), tarOf(t, hdrs...), dest); err == nil {
+			t.Errorf("%s: extracted without error", name)
+		}
+	}
+}
+
+func TestUntarDefaultMode(t *testing.T) {
+	dest := t.TempDir()
+	if err := untar(context.Background(), tarOf(t, tar.Header{Name: "f"}), dest); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(dest, "f"))
+	if err != nil || info.Mode().Perm() != 0o644 {
+		t.Errorf("mode-0 entry: %v, %v", info.Mode(), err)
+	}
+}
+
+func TestRepoKindGitFile(t *testing.T) {
+	tests := map[string]string{
+		"gitdir: ../.git/modules/lib\n":             "submodule",
+		"gitdir: /src/app/.git/worktrees/feature\n": "worktree",
+		"not a gitdir line\n":                       "",
+	}
+	for content, want := range tests {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, ".git"), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if got := repoKind(dir); got != want {
+			t.Errorf("%q: got %q, want %q", content, got, want)
+		}
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]int64{
+		"512":   512,
+		"10k":   10 << 10,
+		"10KB":  10 << 10,
+		"1.5mb": 3 << 19,
+		"2G":    2 << 30,
+		"1t":    1 << 40,
+	}
+	for s, want := range tests {
+		if got, ok := parseByteSize(s); !ok || got != want {
+			t.Errorf("%s: got %d, %v; want %d", s, got, ok, want)
+		}
+	}
+	for _, s := range []string{"", "k", "-1", "ten", "1x"} {
+		if got, ok := parseByteSize(s); ok {
+			t.Errorf("%s: got %d, want no size", s, got)
+		}
+	}
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+		return d
+	}
+	entries := []entry{
+		{name: "main.go", size: 1 << 10, modTime: day("2024-03-10 12:00")},
+		{name: "README.md", size: 12 << 10, modTime: day("2024-06-01 09:00")},
+		{name: "big.iso", size: 2 << 30, modTime: day("2023-05-01 00:00")},
+		{name: "docs", isDir: true, size: 4096, modTime: day("2025-01-01 00:00")},
+	}
+	tests := []struct {
+		query, text string
+		want        []string
+	}{
+		{"ext:go", "", []string{"main.go"}},
+		{"ext:.MD,go", "", []string{"main.go", "README.md"}},
+		{"size>10k", "", []string{"README.md", "big.iso"}},
+		{"size>=1k", "", []string{"main.go", "README.md", "big.iso"}},
+		{"size<1k", "", nil},
+		{"size<=1kb", "", []string{"main.go"}},
+		{"after:2024-03-09", "", []string{"main.go", "README.md", "docs"}},
+		{"after:2024-03-10", "", []string{"README.md", "docs"}},
+		{"before:2024-03-10", "", []string{"big.iso"}},
+		{"type:dir", "", []string{"docs"}},
+		{"type:f size<1g", "", []string{"main.go", "README.md"}},
+		{"read ext:md me", "read me", []string{"README.md"}},
+		{"after:2024-13-01", "after:2024-13-01", []string{"main.go", "README.md", "big.iso", "docs"}},
+		{"size=5 size>x ext: before:soon", "size=5 size>x ext: before:soon", []string{"main.go", "README.md", "big.iso", "docs"}},
+	}
+	for _, tt := range tests {
+		text, preds := parseSearchQuery(tt.query)
+		var got []string
+		for _, e := range entries {
+			if matchesAll(preds, e) {
+				got = append(got, e.name)
+			}
+		}
+		if text != tt.text || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got text %q matching %v; want %q matching %v", tt.query, text, got, tt.text, tt.want)
+		}
+	}
+}
+
+func TestFuzzyScoreOrder(t *testing.T) {
+	tests := []struct{ query, better, worse string }{
+		{"mg", "main.go", "image.go"},                  // word boundaries
+		{"fb", "fooBar.go", "fabric.go"},               // camelCase hump
+		{"abc", "xabcx", "xaxbxcx"},                    // consecutive run
+		{"log", "catalog.txt", "l_o_g"},                // substring over scattered
+		{"read", "README.md", "rebuild_and_deploy.sh"}, // prefix substring
+		{"z", "zeta", "pizza"},                         // earlier first match
+	}
+	for _, tt := range tests {
+		better, ok1 := fuzzyScore(tt.query, tt.better, false)
+		worse, ok2 := fuzzyScore(tt.query, tt.worse, false)
+		if !ok1 || !ok2 || better <= worse {
+			t.Errorf("%q: %s scored %d (%v), %s scored %d (%v)", tt.query, tt.better, better, ok1, tt.worse, worse, ok2)
+		}
+	}
+
+	rejected := []struct {
+		query, s      string
+		caseSensitive bool
+	}{
+		{"gm", "main.go", false},
+		{"mgx", "main.go", false},
+		{"M", "main.go", true},
+	}
+	for _, tt := range rejected {
+		if score, ok := fuzzyScore(tt.query, tt.s, tt.caseSensitive); ok {
+			t.Errorf("%q in %s: matched with score %d", tt.query, tt.s, score)
+		}
+	}
+	if score, ok := fuzzyScore("", "main.go", false); !ok || score != 0 {
+		t.Errorf("empty query: got %d, %v", score, ok)
+	}
+}
+
+func TestEvalJSONQuery(t *testing.T) {
+	doc := map[string]interface{}{
+		"name": "seer",
+		"items": []interface{}{
+			map[string]interface{}{"name": "a", "n": 1.0},
+			map[string]interface{}{"name": "b", "n": 2.0},
+			map[string]interface{}{"name": "c", "n": 3.0},
+		},
+		"odd key": map[string]interface{}{"x": true},
+	}
+	type list = []interface{}
+	tests := map[string]list{
+		".":                   {doc},
+		".name":               {"seer"},
+		".missing":            {nil},
+		".missing.deeper":     {nil},
+		`."odd key".x`:        {true},
+		`.["odd key"]["x"]`:   {true},
+		".items[0].name":      {"a"},
+		".items[-1].n":        {3.0},
+		".items[9]":           {nil},
+		".items[1:].[0].n":    {2.0},
+		".items[:2] | length": {2.0},
+		".items[-2:][].name":  {"b", "c"},
+		".items[2:1]":         {list{}},
+		".name[1:3]":          {"ee"},
+		".items[].name":       {"a", "b", "c"},
+		".[] | type":          {"array", "string", "object"},
+		".items | keys":       {list{0.0, 1.0, 2.0}},
+		".name | length":      {4.0},
+	}
+	for expr, want := range tests {
+		got, err := evalJSONQuery(doc, expr)
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, %v; want %v", expr, got, err, want)
+		}
+	}
+
+	for _, expr := range []string{
+		"name",
+		".items[",
+		".items[x]",
+		".items[1:x]",
+		`.["unterminated]`,
+		".name.x",
+		".name[0]",
+		".[] | keys",
+		".items..name",
+		".items[] | .name |",
+	} {
+		if got, err := evalJSONQuery(doc, expr); err == nil {
+			t.Errorf("%s: got %v, want an error", expr, got)
+		}
+	}
+}
+
+func TestEvalJSONQueryUnicodeKey(t *testing.T) {
+	v := map[string]interface{}{"größe": map[string]interface{}{"名前": "x"}}
+	got, err := evalJSONQuery(v, ".größe.名前")
+	if err != nil || len(got) != 1 || got[0] != "x" {
+		t.Errorf("got %v, %v", got, err)
+	}
+	if _, err := evalJSONQuery(v, ".→"); err == nil {
+		t.Error("bad identifier: no error")
+	}
+}
+
+func TestRenderGIFFrames(t *testing.T) {
+	palette := color.Palette{color.Black, color.White, color.RGBA{255, 0, 0, 255}}
+	g := &gif.GIF{}
+	for i := range 3 {
+		frame := image.NewPaletted(image.Rect(0, 0, 8, 8), palette)
+		for p := range frame.Pix {
+			frame.Pix[p] = uint8(i)
+		}
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, 5*(i+1))
+		g.Disposal = append(g.Disposal, gif.DisposalNone)
+	}
+	path := filepath.Join(t.TempDir(), "a.gif")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gif.EncodeAll(f, g); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	frames, delays, err := renderGIFFrames(path, 40, 10)
+	if err != nil || len(frames) != 3 {
+		t.Fatalf("got %d frames: %v", len(frames), err)
+	}
+	if frames[0] == frames[1] || frames[1] == frames[2] {
+		t.Error("frames render the same")
+	}
+	want := []time.Duration{50 * time.Millisecond, 100 * time.Millisecond, 150 * time.Millisecond}
+	for i, d := range delays {
+		if d != want[i] {
+			t.Errorf("delay %d: got %v, want %v", i, d, want[i])
+		}
+	}
+}
+
+func TestVisibleEntriesAfterShrink(t *testing.T) {
+	m := model{entries: make([]entry, 3), listScrolled: true, listTop: 40}
+	start, end, _, _ := m.visibleEntries(10)
+	if start > end || end > len(m.entries) {
+		t.Errorf("window [%d, %d) of %d entries", start, end, len(m.entries))
+	}
+	m.entries = nil
+	if start, end, _, _ := m.visibleEntries(10); start != 0 || end != 0 {
+		t.Errorf("empty list: window [%d, %d)", start, end)
+	}
+}
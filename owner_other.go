@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// fileOwner returns empty names where files have no Unix owner.
+func fileOwner(info os.FileInfo) (string, string) {
+	return "", ""
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner returns the owner and group names recorded in info, falling back
+// to the numeric ids.
+func fileOwner(info os.FileInfo) (string, string) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", ""
+	}
+	return lookupID("u", uint64(st.Uid)), lookupID("g", uint64(st.Gid))
+}